@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sso/internal/config"
+	"sso/internal/lib/hasher"
+	"sso/internal/lib/keyring"
+	"sso/internal/lib/notify"
+	"sso/internal/services/admin"
+	"sso/internal/services/auth"
+	"sso/internal/storage/postgresql"
+)
+
+// bootstrap makes the first admin, it refuses to run when an admin already
+// exists: go run cmd/bootstrap/main.go --config=./config/local.yaml --email=admin@example.com --password=...
+func main() {
+	var email, password string
+	flag.StringVar(&email, "email", "", "email of the first admin")
+	flag.StringVar(&password, "password", "", "password, used only if the user doesn't exist")
+
+	cfg := config.MustLoad()
+
+	if email == "" {
+		email = cfg.Bootstrap.AdminEmail
+	}
+	if password == "" {
+		password = cfg.Bootstrap.AdminPassword
+	}
+	if email == "" {
+		fmt.Fprintln(os.Stderr, "email is required")
+		os.Exit(2)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	storage, err := postgresql.NewDB(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	var opts auth.Options
+	keys, err := keyring.Open(cfg.Keyring.Path, cfg.Keyring.Keys)
+	if err != nil {
+		panic(err)
+	}
+	if keys != nil {
+		opts.Hasher = hasher.Peppered{Hasher: hasher.Bcrypt{}, Pepper: keys}
+		opts.Secrets = keys
+	}
+
+	authService := auth.NewAuth(log, storage, storage, storage, storage, storage, storage, storage, storage,
+		storage, storage, storage, storage, storage, notify.NewLogNotifier(log), storage, cfg.GRPC.Timeout, opts)
+	adminService := admin.NewAdmin(log, storage, storage, authService)
+
+	userID, err := adminService.Bootstrap(context.Background(), email, password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("user %d is admin now\n", userID)
+}
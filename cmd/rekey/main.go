@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sso/internal/config"
+	"sso/internal/lib/keyring"
+	"sso/internal/services/rekey"
+	"sso/internal/storage/postgresql"
+)
+
+// rekey moves the encrypted app secrets to the current master key, run it
+// after putting a new key first in the keyring and keep the old key until it
+// is done: go run cmd/rekey/main.go --config=./config/local.yaml
+func main() {
+	cfg := config.MustLoad()
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	keys, err := keyring.Open(cfg.Keyring.Path, cfg.Keyring.Keys)
+	if err != nil {
+		panic(err)
+	}
+	if keys == nil {
+		fmt.Fprintln(os.Stderr, "keyring is not configured")
+		os.Exit(2)
+	}
+
+	storage, err := postgresql.NewDB(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	updated, err := rekey.NewRekey(log, storage, storage, keys).Run(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d apps rekeyed to %q\n", updated, keys.Current())
+}
@@ -0,0 +1,325 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.27.3
+// source: sso/relations.proto
+
+package ssov1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Relations_WriteNamespace_FullMethodName = "/auth.Relations/WriteNamespace"
+	Relations_WriteTuples_FullMethodName    = "/auth.Relations/WriteTuples"
+	Relations_DeleteTuples_FullMethodName   = "/auth.Relations/DeleteTuples"
+	Relations_Check_FullMethodName          = "/auth.Relations/Check"
+	Relations_Expand_FullMethodName         = "/auth.Relations/Expand"
+	Relations_ListObjects_FullMethodName    = "/auth.Relations/ListObjects"
+)
+
+// RelationsClient is the client API for Relations service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Relations stores relation tuples written as object#relation@subject,
+// e.g. doc:readme#viewer@group:eng#member.
+type RelationsClient interface {
+	// WriteNamespace creates or replaces the relations of an object type.
+	WriteNamespace(ctx context.Context, in *WriteNamespaceRequest, opts ...grpc.CallOption) (*WriteNamespaceResponse, error)
+	WriteTuples(ctx context.Context, in *WriteTuplesRequest, opts ...grpc.CallOption) (*WriteTuplesResponse, error)
+	DeleteTuples(ctx context.Context, in *DeleteTuplesRequest, opts ...grpc.CallOption) (*DeleteTuplesResponse, error)
+	// Check checks whether the subject has the relation on the object.
+	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	// Expand returns the subjects that have the relation on the object.
+	Expand(ctx context.Context, in *ExpandRequest, opts ...grpc.CallOption) (*ExpandResponse, error)
+	// ListObjects returns the objects on which the subject has the relation.
+	ListObjects(ctx context.Context, in *ListObjectsRequest, opts ...grpc.CallOption) (*ListObjectsResponse, error)
+}
+
+type relationsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRelationsClient(cc grpc.ClientConnInterface) RelationsClient {
+	return &relationsClient{cc}
+}
+
+func (c *relationsClient) WriteNamespace(ctx context.Context, in *WriteNamespaceRequest, opts ...grpc.CallOption) (*WriteNamespaceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteNamespaceResponse)
+	err := c.cc.Invoke(ctx, Relations_WriteNamespace_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *relationsClient) WriteTuples(ctx context.Context, in *WriteTuplesRequest, opts ...grpc.CallOption) (*WriteTuplesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteTuplesResponse)
+	err := c.cc.Invoke(ctx, Relations_WriteTuples_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *relationsClient) DeleteTuples(ctx context.Context, in *DeleteTuplesRequest, opts ...grpc.CallOption) (*DeleteTuplesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteTuplesResponse)
+	err := c.cc.Invoke(ctx, Relations_DeleteTuples_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *relationsClient) Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckResponse)
+	err := c.cc.Invoke(ctx, Relations_Check_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *relationsClient) Expand(ctx context.Context, in *ExpandRequest, opts ...grpc.CallOption) (*ExpandResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExpandResponse)
+	err := c.cc.Invoke(ctx, Relations_Expand_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *relationsClient) ListObjects(ctx context.Context, in *ListObjectsRequest, opts ...grpc.CallOption) (*ListObjectsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListObjectsResponse)
+	err := c.cc.Invoke(ctx, Relations_ListObjects_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RelationsServer is the server API for Relations service.
+// All implementations must embed UnimplementedRelationsServer
+// for forward compatibility.
+//
+// Relations stores relation tuples written as object#relation@subject,
+// e.g. doc:readme#viewer@group:eng#member.
+type RelationsServer interface {
+	// WriteNamespace creates or replaces the relations of an object type.
+	WriteNamespace(context.Context, *WriteNamespaceRequest) (*WriteNamespaceResponse, error)
+	WriteTuples(context.Context, *WriteTuplesRequest) (*WriteTuplesResponse, error)
+	DeleteTuples(context.Context, *DeleteTuplesRequest) (*DeleteTuplesResponse, error)
+	// Check checks whether the subject has the relation on the object.
+	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+	// Expand returns the subjects that have the relation on the object.
+	Expand(context.Context, *ExpandRequest) (*ExpandResponse, error)
+	// ListObjects returns the objects on which the subject has the relation.
+	ListObjects(context.Context, *ListObjectsRequest) (*ListObjectsResponse, error)
+	mustEmbedUnimplementedRelationsServer()
+}
+
+// UnimplementedRelationsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRelationsServer struct{}
+
+func (UnimplementedRelationsServer) WriteNamespace(context.Context, *WriteNamespaceRequest) (*WriteNamespaceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteNamespace not implemented")
+}
+func (UnimplementedRelationsServer) WriteTuples(context.Context, *WriteTuplesRequest) (*WriteTuplesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteTuples not implemented")
+}
+func (UnimplementedRelationsServer) DeleteTuples(context.Context, *DeleteTuplesRequest) (*DeleteTuplesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTuples not implemented")
+}
+func (UnimplementedRelationsServer) Check(context.Context, *CheckRequest) (*CheckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Check not implemented")
+}
+func (UnimplementedRelationsServer) Expand(context.Context, *ExpandRequest) (*ExpandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Expand not implemented")
+}
+func (UnimplementedRelationsServer) ListObjects(context.Context, *ListObjectsRequest) (*ListObjectsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListObjects not implemented")
+}
+func (UnimplementedRelationsServer) mustEmbedUnimplementedRelationsServer() {}
+func (UnimplementedRelationsServer) testEmbeddedByValue()                   {}
+
+// UnsafeRelationsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RelationsServer will
+// result in compilation errors.
+type UnsafeRelationsServer interface {
+	mustEmbedUnimplementedRelationsServer()
+}
+
+func RegisterRelationsServer(s grpc.ServiceRegistrar, srv RelationsServer) {
+	// If the following call pancis, it indicates UnimplementedRelationsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Relations_ServiceDesc, srv)
+}
+
+func _Relations_WriteNamespace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteNamespaceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationsServer).WriteNamespace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relations_WriteNamespace_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationsServer).WriteNamespace(ctx, req.(*WriteNamespaceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Relations_WriteTuples_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteTuplesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationsServer).WriteTuples(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relations_WriteTuples_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationsServer).WriteTuples(ctx, req.(*WriteTuplesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Relations_DeleteTuples_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTuplesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationsServer).DeleteTuples(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relations_DeleteTuples_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationsServer).DeleteTuples(ctx, req.(*DeleteTuplesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Relations_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationsServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relations_Check_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationsServer).Check(ctx, req.(*CheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Relations_Expand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationsServer).Expand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relations_Expand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationsServer).Expand(ctx, req.(*ExpandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Relations_ListObjects_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListObjectsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RelationsServer).ListObjects(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Relations_ListObjects_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RelationsServer).ListObjects(ctx, req.(*ListObjectsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Relations_ServiceDesc is the grpc.ServiceDesc for Relations service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Relations_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "auth.Relations",
+	HandlerType: (*RelationsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "WriteNamespace",
+			Handler:    _Relations_WriteNamespace_Handler,
+		},
+		{
+			MethodName: "WriteTuples",
+			Handler:    _Relations_WriteTuples_Handler,
+		},
+		{
+			MethodName: "DeleteTuples",
+			Handler:    _Relations_DeleteTuples_Handler,
+		},
+		{
+			MethodName: "Check",
+			Handler:    _Relations_Check_Handler,
+		},
+		{
+			MethodName: "Expand",
+			Handler:    _Relations_Expand_Handler,
+		},
+		{
+			MethodName: "ListObjects",
+			Handler:    _Relations_ListObjects_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "sso/relations.proto",
+}
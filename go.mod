@@ -9,10 +9,7 @@ require (
 	google.golang.org/grpc v1.67.1
 )
 
-require (
-	github.com/lib/pq v1.10.9
-	github.com/maximka200/buffpr v0.0.0-20241014095157-968fcdca94e7
-)
+require github.com/lib/pq v1.10.9
 
 require (
 	github.com/brianvoe/gofakeit v3.18.0+incompatible
@@ -21,17 +18,23 @@ require (
 	github.com/stretchr/testify v1.9.0
 )
 
-require github.com/mattn/go-sqlite3 v1.14.24
+require (
+	github.com/go-asn1-ber/asn1-ber v1.5.5
+	github.com/go-ldap/ldap/v3 v3.4.8
+	github.com/mattn/go-sqlite3 v1.14.24
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241007155032-5fefd90f89a9
+	google.golang.org/protobuf v1.35.1
+)
 
 require (
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
 	github.com/BurntSushi/toml v1.4.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
 	golang.org/x/text v0.19.0 // indirect
-	google.golang.org/genproto/googleapis/rpc v0.0.0-20241007155032-5fefd90f89a9 // indirect
-	google.golang.org/protobuf v1.35.1 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	olympos.io/encoding/edn v0.0.0-20201019073823-d3554ca0b0a3 // indirect
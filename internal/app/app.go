@@ -1,16 +1,41 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	grpcapp "sso/internal/app/grpc"
 	"sso/internal/config"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/lib/breach"
+	"sso/internal/lib/hasher"
+	"sso/internal/lib/keyring"
+	"sso/internal/lib/ldap"
+	"sso/internal/lib/notify"
+	"sso/internal/lib/oidc"
+	"sso/internal/lib/password"
+	"sso/internal/lib/policy"
+	"sso/internal/lib/risk"
+	"sso/internal/services/admin"
+	"sso/internal/services/audit"
 	"sso/internal/services/auth"
+	"sso/internal/services/authz"
+	"sso/internal/services/relations"
+	"sso/internal/services/throttle"
+	"sso/internal/storage/memory"
 	"sso/internal/storage/postgresql"
 	// sqlite "sso/internal/storage/sqllite"
-	//"time"
+	"time"
+
+	"google.golang.org/grpc"
 )
 
+// minTokenKeyLen is the shortest auth.token_key, as long as an HS256 key.
+const minTokenKeyLen = 32
+
 type App struct {
 	GRPCSrv *grpcapp.App
 }
@@ -22,15 +47,301 @@ func New(log *slog.Logger, cfg *config.Config) *App { // TTL - time to live
 		panic(err)
 	}
 
-	auth := auth.NewAuth(log, storage, storage, storage, storage, cfg.GRPC.Timeout)
+	if len(cfg.Auth.TokenKey) < minTokenKeyLen {
+		panic(fmt.Sprintf("auth.token_key must be at least %d bytes", minTokenKeyLen))
+	}
+	authOpts := auth.Options{
+		TokenKey:                    []byte(cfg.Auth.TokenKey),
+		EnumerationSafeRegistration: cfg.Auth.EnumerationSafeRegistration,
+		Hasher:                      newHasher(cfg.Auth.PasswordHash),
+		PasswordPolicy:              passwordPolicy(cfg.Auth.PasswordPolicy),
+		OrgPasswordPolicies:         orgPasswordPolicies(cfg.Auth.OrgPasswordPolicies),
+		EnforceBreachedAtLogin:      cfg.Auth.BreachedPasswords.EnforceAtLogin,
+		PasswordResetTTL:            cfg.Auth.PasswordResetTTL,
+		PasswordHistory:             cfg.Auth.PasswordHistory,
+		MaxPasswordAge:              cfg.Auth.MaxPasswordAge,
+		PasswordChangeTokenTTL:      cfg.Auth.PasswordChangeTokenTTL,
+		AppSecretGrace:              cfg.Auth.AppSecretGrace,
+		NotifyNewDevice:             cfg.Auth.NotifyNewDevice,
+		StepUpTokenTTL:              cfg.Auth.StepUpTokenTTL,
+		ImpersonationTTL:            cfg.Auth.ImpersonationTTL,
+		ExchangeRules:               exchangeRules(cfg.Auth.TokenExchange),
+		ExchangeTokenTTL:            cfg.Auth.TokenExchange.TTL,
+		PATMaxTTL:                   cfg.Auth.PATMaxTTL,
+		ServiceAccountTokenTTL:      cfg.Auth.ServiceAccounts.TokenTTL,
+		AssertionAudience:           cfg.Auth.ServiceAccounts.AssertionAudience,
+		FederatedProviders:          federatedProviders(cfg.Auth.Federation, cfg.GRPC.Timeout),
+		FederationStateTTL:          cfg.Auth.Federation.StateTTL,
+		AuthBackends:                cfg.Auth.Backends,
+	}
+	if slices.Contains(cfg.Auth.Backends, auth.BackendLDAP) {
+		authOpts.LDAP = mustLDAP(cfg.Auth.LDAP)
+	}
+	if cfg.Auth.Risk.Enabled {
+		authOpts.Risk = mustRiskEngine(cfg.Auth.Risk, storage)
+	}
+	if keys := mustKeyring(cfg.Keyring); keys != nil {
+		authOpts.Hasher = hasher.Peppered{Hasher: authOpts.Hasher, Pepper: keys}
+		authOpts.Secrets = keys
+	}
+	if cfg.Auth.BreachedPasswords.Path != "" {
+		corpus, err := breach.Open(cfg.Auth.BreachedPasswords.Path)
+		if err != nil {
+			panic(err)
+		}
+		authOpts.BreachedPasswords = corpus
+	}
+
+	auditService := audit.NewAudit(log, storage, storage, storage, storage, cfg.Audit.Retention)
+	go auditService.RunRetention(context.Background(), cfg.Audit.PurgeInterval)
+
+	authz := authz.NewAuthz(log, storage, storage, storage, policy.NewEngine())
+	authOpts.Policies = authz
+
+	auth := auth.NewAuth(log, storage, storage, storage, storage, storage, storage, storage, storage,
+		storage, storage, storage, storage, storage, newNotifier(log, cfg.Notify), auditService, cfg.GRPC.Timeout, authOpts)
+
+	relations := relations.NewRelations(log, storage, storage, storage, storage, cfg.Relations.MaxDepth)
+
+	adminService := admin.NewAdmin(log, storage, storage, auth)
+
+	if cfg.Bootstrap.AdminEmail != "" {
+		bootstrapAdmin(log, adminService, cfg.Bootstrap)
+	}
+
+	before := []grpc.UnaryServerInterceptor{interceptors.ClientInfo(cfg.Throttle.TrustProxy)}
+
+	var after []grpc.UnaryServerInterceptor
+	if cfg.Throttle.Enabled {
+		var store throttle.Store = memory.NewThrottleStore()
+		if cfg.Throttle.Store == "db" {
+			store = storage
+		}
 
-	grpcApp := grpcapp.New(log, cfg.GRPC.Port, auth)
+		limiter := throttle.NewThrottle(log, store, throttleRules(cfg.Throttle))
+		after = append(after, interceptors.Throttle(limiter, cfg.Throttle.TrustProxy))
+	}
+
+	grpcApp := grpcapp.New(log, cfg.GRPC.Port, auth, authz, relations, adminService, auditService, before, after...)
 
 	return &App{
 		GRPCSrv: grpcApp,
 	}
 }
 
+func newHasher(cfg config.PasswordHashConfig) hasher.PasswordHasher {
+	switch cfg.Algorithm {
+	case "argon2id":
+		return hasher.Argon2id{Time: cfg.Argon2Time, Memory: cfg.Argon2Memory, Threads: cfg.Argon2Threads}
+	case "scrypt":
+		return hasher.Scrypt{LogN: cfg.ScryptLogN, R: cfg.ScryptR, P: cfg.ScryptP}
+	case "bcrypt", "":
+		return hasher.Bcrypt{Cost: cfg.BcryptCost}
+	}
+
+	panic("unknown password hash algorithm: " + cfg.Algorithm)
+}
+
+// mustKeyring loads the master keys, it returns nil when none are configured.
+func mustKeyring(cfg config.KeyringConfig) *keyring.Keyring {
+	keys, err := keyring.Open(cfg.Path, cfg.Keys)
+	if err != nil {
+		panic("failed to load keyring: " + err.Error())
+	}
+
+	return keys
+}
+
+func passwordPolicy(cfg config.PasswordPolicyConfig) password.Policy {
+	return password.Policy{
+		MinLength:     cfg.MinLength,
+		MaxLength:     cfg.MaxLength,
+		RequireLower:  cfg.RequireLower,
+		RequireUpper:  cfg.RequireUpper,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+		Denylist:      cfg.Denylist,
+		ForbidEmail:   cfg.ForbidEmail,
+		MinScore:      cfg.MinScore,
+	}
+}
+
+func orgPasswordPolicies(cfg map[int64]config.PasswordPolicyConfig) map[int64]password.Policy {
+	policies := make(map[int64]password.Policy, len(cfg))
+	for orgID, c := range cfg {
+		policies[orgID] = passwordPolicy(c)
+	}
+
+	return policies
+}
+
+func exchangeRules(cfg config.TokenExchangeConfig) []auth.ExchangeRule {
+	rules := make([]auth.ExchangeRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		rules = append(rules, auth.ExchangeRule{
+			SourceAppID:  rule.From,
+			TargetAppID:  rule.To,
+			Scopes:       rule.Scopes,
+			RequireActor: rule.RequireActor,
+		})
+	}
+
+	return rules
+}
+
+func federatedProviders(cfg config.FederationConfig, timeout time.Duration) []auth.FederatedProvider {
+	providers := make([]auth.FederatedProvider, 0, len(cfg.Providers))
+	for _, provider := range cfg.Providers {
+		providers = append(providers, auth.FederatedProvider{
+			ID:    provider.ID,
+			Name:  provider.Name,
+			OrgID: provider.OrgID,
+			Client: oidc.New(oidc.Config{
+				Issuer:       provider.Issuer,
+				ClientID:     provider.ClientID,
+				ClientSecret: provider.ClientSecret,
+				RedirectURL:  provider.RedirectURL,
+				Scopes:       provider.Scopes,
+				Timeout:      timeout,
+			}),
+			Claims: auth.ClaimMapping{
+				Subject:       provider.Claims.Subject,
+				Email:         provider.Claims.Email,
+				EmailVerified: provider.Claims.EmailVerified,
+			},
+			AutoProvision:  provider.AutoProvision,
+			LinkByEmail:    provider.LinkByEmail,
+			TrustEmail:     provider.TrustEmail,
+			AllowedDomains: provider.AllowedDomains,
+		})
+	}
+
+	return providers
+}
+
+func mustLDAP(cfg config.LDAPConfig) *auth.LDAPOptions {
+	directory, err := ldap.New(ldap.Config{
+		URL:                cfg.URL,
+		StartTLS:           cfg.StartTLS,
+		CAFile:             cfg.CAFile,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		BindDN:             cfg.BindDN,
+		BindPassword:       cfg.BindPassword,
+		BaseDN:             cfg.BaseDN,
+		UserFilter:         cfg.UserFilter,
+		UIDAttribute:       cfg.UIDAttribute,
+		EmailAttribute:     cfg.EmailAttribute,
+		GroupAttribute:     cfg.GroupAttribute,
+		Timeout:            cfg.Timeout,
+	})
+	if err != nil {
+		panic("failed to configure ldap: " + err.Error())
+	}
+
+	return &auth.LDAPOptions{
+		Directory:      directory,
+		GroupRoles:     cfg.GroupRoles,
+		LinkByEmail:    cfg.LinkByEmail,
+		AllowedDomains: cfg.AllowedDomains,
+	}
+}
+
+// riskStore gives the risk signals the devices and the login history.
+type riskStore interface {
+	risk.DeviceProvider
+	risk.LoginHistory
+}
+
+func mustRiskEngine(cfg config.RiskConfig, store riskStore) *risk.Engine {
+	var signals []risk.Signal
+
+	if cfg.NewDevice > 0 {
+		signals = append(signals, risk.NewDevice{Devices: store, Weight: cfg.NewDevice})
+	}
+	if cfg.ImpossibleTravel > 0 && cfg.GeoIPPath != "" {
+		geoIP, err := risk.LoadGeoIP(cfg.GeoIPPath)
+		if err != nil {
+			panic(err)
+		}
+		signals = append(signals, risk.ImpossibleTravel{
+			GeoIP:    geoIP,
+			History:  store,
+			MaxSpeed: cfg.MaxTravelSpeed,
+			Weight:   cfg.ImpossibleTravel,
+		})
+	}
+	if cfg.Velocity > 0 {
+		signals = append(signals, risk.Velocity{
+			History:  store,
+			Window:   cfg.VelocityWindow,
+			Failures: cfg.VelocityFailures,
+			Weight:   cfg.Velocity,
+		})
+	}
+	if cfg.UnusualHour > 0 {
+		signals = append(signals, risk.UnusualHour{
+			History:   store,
+			MinLogins: cfg.UnusualHourMinLogins,
+			Weight:    cfg.UnusualHour,
+		})
+	}
+	if cfg.IPReputation > 0 && cfg.IPReputationPath != "" {
+		list, err := risk.LoadIPList(cfg.IPReputationPath)
+		if err != nil {
+			panic(err)
+		}
+		signals = append(signals, risk.IPReputation{List: list, Weight: cfg.IPReputation})
+	}
+
+	apps := make(map[int64]risk.Thresholds, len(cfg.Apps))
+	for appID, c := range cfg.Apps {
+		apps[appID] = risk.Thresholds{StepUp: c.StepUpScore, Deny: c.DenyScore}
+	}
+
+	return risk.NewEngine(risk.Thresholds{StepUp: cfg.StepUpScore, Deny: cfg.DenyScore}, apps, signals...)
+}
+
+func newNotifier(log *slog.Logger, cfg config.NotifyConfig) auth.Notifier {
+	if cfg.Driver == "smtp" {
+		return notify.NewSMTPNotifier(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From)
+	}
+
+	return notify.NewLogNotifier(log)
+}
+
+func throttleRules(cfg config.ThrottleConfig) throttle.Rules {
+	rules := throttle.Rules{
+		Window:    cfg.Window,
+		BaseDelay: cfg.BaseDelay,
+		MaxDelay:  cfg.MaxDelay,
+		Lockout:   cfg.Lockout,
+		Limits:    make(map[string]throttle.Limit),
+	}
+
+	for kind, limit := range map[string]config.ThrottleLimitConfig{
+		models.ThrottleByEmail: cfg.Email,
+		models.ThrottleByIP:    cfg.IP,
+		models.ThrottleByApp:   cfg.App,
+	} {
+		if limit.DelayAfter > 0 || limit.LockoutAfter > 0 {
+			rules.Limits[kind] = throttle.Limit{DelayAfter: limit.DelayAfter, LockoutAfter: limit.LockoutAfter}
+		}
+	}
+
+	return rules
+}
+
+func bootstrapAdmin(log *slog.Logger, adminService *admin.Admin, cfg config.BootstrapConfig) {
+	_, err := adminService.Bootstrap(context.Background(), cfg.AdminEmail, cfg.AdminPassword)
+	if errors.Is(err, admin.ErrAlreadyBootstrapped) {
+		log.Info("admin bootstrap skipped, admin already exist")
+		return
+	}
+	if err != nil {
+		panic(fmt.Errorf("error bootstrap admin: %w", err))
+	}
+}
+
 func (app *App) MustRun() {
 	if err := app.GRPCSrv.Run(); err != nil {
 		err = fmt.Errorf("error run server: %w", err)
@@ -4,7 +4,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	admingrpc "sso/internal/grps/admin"
+	auditgrpc "sso/internal/grps/audit"
 	authgrpc "sso/internal/grps/auth"
+	authzgrpc "sso/internal/grps/authz"
+	"sso/internal/grps/interceptors"
+	relationsgrpc "sso/internal/grps/relations"
 
 	"google.golang.org/grpc"
 )
@@ -15,9 +20,19 @@ type App struct {
 	port       int
 }
 
-func New(log *slog.Logger, port int, authService authgrpc.Auth) *App {
-	gRPCServer := grpc.NewServer()
+func New(log *slog.Logger, port int, authService authgrpc.Auth,
+	authzService authzgrpc.Authz, relationsService relationsgrpc.Relations,
+	adminService admingrpc.Admin, auditService auditgrpc.Audit,
+	before []grpc.UnaryServerInterceptor, after ...grpc.UnaryServerInterceptor) *App {
+	// the before interceptors run ahead of the token validation, so it sees
+	// the client info, the after ones see the caller
+	chain := append(before, interceptors.Auth(authService))
+	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(append(chain, after...)...))
 	authgrpc.RegisterServ(gRPCServer, authService)
+	authzgrpc.RegisterServ(gRPCServer, authzService)
+	relationsgrpc.RegisterServ(gRPCServer, relationsService)
+	admingrpc.RegisterServ(gRPCServer, adminService)
+	auditgrpc.RegisterServ(gRPCServer, auditService)
 	return &App{
 		log:        log,
 		gRPCServer: gRPCServer,
@@ -2,18 +2,43 @@ package config
 
 import (
 	"flag"
+	"log/slog"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path"`
-	TokenTTL    time.Duration `yaml:"token_ttl" env-required:"true"`
-	GRPC        GRPCConfig    `yaml:"grpc"`
-	DB          DBConfig      `yaml:"db"`
+	Env         string          `yaml:"env" env-default:"local"`
+	StoragePath string          `yaml:"storage_path"`
+	TokenTTL    time.Duration   `yaml:"token_ttl" env-required:"true"`
+	GRPC        GRPCConfig      `yaml:"grpc"`
+	DB          DBConfig        `yaml:"db"`
+	Relations   RelationsConfig `yaml:"relations"`
+	Bootstrap   BootstrapConfig `yaml:"bootstrap"`
+	Throttle    ThrottleConfig  `yaml:"throttle"`
+	Auth        AuthConfig      `yaml:"auth"`
+	Notify      NotifyConfig    `yaml:"notify"`
+	Keyring     KeyringConfig   `yaml:"keyring"`
+	Audit       AuditConfig     `yaml:"audit"`
+}
+
+// AuditConfig sets how long the audit events are kept, a zero Retention
+// keeps them forever so it has no default.
+type AuditConfig struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// KeyringConfig holds the master keys as "<id>:<base64 32 bytes>" entries,
+// the first one is current. Path points to a file with one entry per line,
+// Keys is a comma separated list, better given in the environment. Without
+// keys passwords aren't peppered and app secrets are stored as is.
+type KeyringConfig struct {
+	Path string `yaml:"path" env:"SSO_KEYRING_FILE"`
+	Keys string `yaml:"keys" env:"SSO_KEYRING"`
 }
 
 type DBConfig struct {
@@ -31,6 +56,256 @@ type GRPCConfig struct {
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+type RelationsConfig struct {
+	MaxDepth int `yaml:"max_depth" env-default:"10"`
+}
+
+// BootstrapConfig names the first admin, it is applied on start only while
+// there are no admins.
+type BootstrapConfig struct {
+	AdminEmail    string `yaml:"admin_email" env:"SSO_BOOTSTRAP_ADMIN_EMAIL"`
+	AdminPassword string `yaml:"admin_password" env:"SSO_BOOTSTRAP_ADMIN_PASSWORD"`
+}
+
+// ThrottleConfig limits the failed logins in a sliding window, see
+// throttle.Rules. Enabled has no default, a default of true would replace
+// an explicit false.
+type ThrottleConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Store is "memory" or "db", the memory store works for one instance only.
+	Store      string              `yaml:"store" env-default:"memory"`
+	TrustProxy bool                `yaml:"trust_proxy"`
+	Window     time.Duration       `yaml:"window" env-default:"15m"`
+	BaseDelay  time.Duration       `yaml:"base_delay" env-default:"250ms"`
+	MaxDelay   time.Duration       `yaml:"max_delay" env-default:"5s"`
+	Lockout    time.Duration       `yaml:"lockout" env-default:"15m"`
+	Email      ThrottleLimitConfig `yaml:"email"`
+	IP         ThrottleLimitConfig `yaml:"ip"`
+	App        ThrottleLimitConfig `yaml:"app"`
+}
+
+type ThrottleLimitConfig struct {
+	DelayAfter   int `yaml:"delay_after"`
+	LockoutAfter int `yaml:"lockout_after"`
+}
+
+// AuthConfig sets how users authenticate. TokenKey signs the tokens of the
+// SSO itself, at least 32 bytes, better given in the environment.
+type AuthConfig struct {
+	TokenKey                    string                         `yaml:"token_key" env:"SSO_TOKEN_KEY" env-required:"true"`
+	EnumerationSafeRegistration bool                           `yaml:"enumeration_safe_registration"`
+	PasswordHash                PasswordHashConfig             `yaml:"password_hash"`
+	PasswordPolicy              PasswordPolicyConfig           `yaml:"password_policy"`
+	OrgPasswordPolicies         map[int64]PasswordPolicyConfig `yaml:"org_password_policies"`
+	BreachedPasswords           BreachedPasswordsConfig        `yaml:"breached_passwords"`
+	PasswordResetTTL            time.Duration                  `yaml:"password_reset_ttl" env-default:"1h"`
+	PasswordHistory             int                            `yaml:"password_history"`
+	MaxPasswordAge              time.Duration                  `yaml:"max_password_age"`
+	PasswordChangeTokenTTL      time.Duration                  `yaml:"password_change_token_ttl" env-default:"10m"`
+	AppSecretGrace              time.Duration                  `yaml:"app_secret_grace" env-default:"24h"`
+	NotifyNewDevice             bool                           `yaml:"notify_new_device"`
+	StepUpTokenTTL              time.Duration                  `yaml:"step_up_token_ttl" env-default:"5m"`
+	ImpersonationTTL            time.Duration                  `yaml:"impersonation_ttl" env-default:"15m"`
+	PATMaxTTL                   time.Duration                  `yaml:"pat_max_ttl" env-default:"8760h"`
+	Risk                        RiskConfig                     `yaml:"risk"`
+	TokenExchange               TokenExchangeConfig            `yaml:"token_exchange"`
+	ServiceAccounts             ServiceAccountsConfig          `yaml:"service_accounts"`
+	Federation                  FederationConfig               `yaml:"federation"`
+	Backends                    []string                       `yaml:"backends" env-default:"local"`
+	LDAP                        LDAPConfig                     `yaml:"ldap"`
+}
+
+// LDAPConfig sets the directory of the "ldap" backend. The user entry is
+// searched with the bind account by UserFilter, %s is the login, and the
+// password is checked by binding as the entry. UIDAttribute is the stable id
+// of the entry the local shadow user is linked by. GroupRoles maps group DNs
+// to the roles put into the tokens of their members.
+type LDAPConfig struct {
+	URL                string              `yaml:"url"`
+	StartTLS           bool                `yaml:"start_tls"`
+	CAFile             string              `yaml:"ca_file"`
+	InsecureSkipVerify bool                `yaml:"insecure_skip_verify"`
+	BindDN             string              `yaml:"bind_dn"`
+	BindPassword       string              `yaml:"bind_password" env:"SSO_LDAP_BIND_PASSWORD"`
+	BaseDN             string              `yaml:"base_dn"`
+	UserFilter         string              `yaml:"user_filter" env-default:"(&(objectClass=person)(mail=%s))"`
+	UIDAttribute       string              `yaml:"uid_attribute" env-default:"entryUUID"`
+	EmailAttribute     string              `yaml:"email_attribute" env-default:"mail"`
+	GroupAttribute     string              `yaml:"group_attribute" env-default:"memberOf"`
+	GroupRoles         map[string][]string `yaml:"group_roles"`
+	LinkByEmail        bool                `yaml:"link_by_email"`
+	AllowedDomains     []string            `yaml:"allowed_domains"`
+	Timeout            time.Duration       `yaml:"timeout" env-default:"5s"`
+}
+
+// FederationConfig sets the upstream OIDC providers the orgs log in with.
+// StateTTL is how long a login may take at the provider.
+type FederationConfig struct {
+	StateTTL  time.Duration             `yaml:"state_ttl" env-default:"10m"`
+	Providers []FederatedProviderConfig `yaml:"providers"`
+}
+
+// FederatedProviderConfig is an OIDC provider of an org. Claims names the
+// claims of the user attributes, new identities get a user when
+// AutoProvision is set or are linked to the user with their email when
+// LinkByEmail is set. TrustEmail treats emails as verified when the provider
+// doesn't say, AllowedDomains limits the emails of new identities.
+type FederatedProviderConfig struct {
+	ID             string                `yaml:"id"`
+	Name           string                `yaml:"name"`
+	OrgID          int64                 `yaml:"org_id"`
+	Issuer         string                `yaml:"issuer"`
+	ClientID       string                `yaml:"client_id"`
+	ClientSecret   string                `yaml:"client_secret"`
+	RedirectURL    string                `yaml:"redirect_url"`
+	Scopes         []string              `yaml:"scopes"`
+	Claims         FederatedClaimsConfig `yaml:"claims"`
+	AutoProvision  bool                  `yaml:"auto_provision"`
+	LinkByEmail    bool                  `yaml:"link_by_email"`
+	TrustEmail     bool                  `yaml:"trust_email"`
+	AllowedDomains []string              `yaml:"allowed_domains"`
+}
+
+type FederatedClaimsConfig struct {
+	Subject       string `yaml:"subject" env-default:"sub"`
+	Email         string `yaml:"email" env-default:"email"`
+	EmailVerified string `yaml:"email_verified" env-default:"email_verified"`
+}
+
+// ServiceAccountsConfig sets the tokens of the service accounts and the
+// audience their private_key_jwt assertions must name.
+type ServiceAccountsConfig struct {
+	TokenTTL          time.Duration `yaml:"token_ttl" env-default:"1h"`
+	AssertionAudience string        `yaml:"assertion_audience" env-default:"sso"`
+}
+
+// TokenExchangeConfig sets which apps trust each other in the token
+// exchange, an app may exchange its tokens only for the targets of its
+// rules.
+type TokenExchangeConfig struct {
+	TTL   time.Duration             `yaml:"ttl" env-default:"5m"`
+	Rules []TokenExchangeRuleConfig `yaml:"rules"`
+}
+
+// TokenExchangeRuleConfig lets From exchange its tokens for tokens of To.
+// Scopes caps the scopes of the new tokens, empty keeps the subject token's.
+type TokenExchangeRuleConfig struct {
+	From         int64    `yaml:"from"`
+	To           int64    `yaml:"to"`
+	Scopes       []string `yaml:"scopes"`
+	RequireActor bool     `yaml:"require_actor"`
+}
+
+// RiskConfig scores the logins, every signal adds its weight to the score
+// and a zero weight turns it off. A login needs a step-up from
+// StepUpScore and is denied from DenyScore, Apps overrides both per app id
+// and zero turns them off too. The weights and scores have no defaults, so
+// an explicit zero isn't replaced.
+type RiskConfig struct {
+	Enabled              bool                           `yaml:"enabled"`
+	StepUpScore          int                            `yaml:"step_up_score"`
+	DenyScore            int                            `yaml:"deny_score"`
+	Apps                 map[int64]RiskThresholdsConfig `yaml:"apps"`
+	NewDevice            int                            `yaml:"new_device"`
+	ImpossibleTravel     int                            `yaml:"impossible_travel"`
+	GeoIPPath            string                         `yaml:"geoip_path"`
+	MaxTravelSpeed       float64                        `yaml:"max_travel_speed" env-default:"900"`
+	Velocity             int                            `yaml:"velocity"`
+	VelocityWindow       time.Duration                  `yaml:"velocity_window" env-default:"15m"`
+	VelocityFailures     int                            `yaml:"velocity_failures" env-default:"5"`
+	UnusualHour          int                            `yaml:"unusual_hour"`
+	UnusualHourMinLogins int                            `yaml:"unusual_hour_min_logins" env-default:"10"`
+	IPReputation         int                            `yaml:"ip_reputation"`
+	IPReputationPath     string                         `yaml:"ip_reputation_path"`
+}
+
+type RiskThresholdsConfig struct {
+	StepUpScore int `yaml:"step_up_score"`
+	DenyScore   int `yaml:"deny_score"`
+}
+
+// BreachedPasswordsConfig points to a local breached passwords corpus in the
+// Pwned Passwords "ordered by hash" SHA-1 format, an empty Path disables the
+// check.
+type BreachedPasswordsConfig struct {
+	Path           string `yaml:"path"`
+	EnforceAtLogin bool   `yaml:"enforce_at_login"`
+}
+
+// PasswordPolicyConfig is the password policy of all users. The checks a
+// zero value turns off have no defaults, a default would replace it. An org
+// policy of AuthConfig.OrgPasswordPolicies replaces it for the users of the
+// org as a whole and gets no defaults at all.
+type PasswordPolicyConfig struct {
+	MinLength     int  `yaml:"min_length" env-default:"8"`
+	MaxLength     int  `yaml:"max_length" env-default:"128"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	Denylist      bool `yaml:"denylist"`
+	ForbidEmail   bool `yaml:"forbid_email"`
+	// MinScore is the minimal strength from 0 to 4
+	MinScore int `yaml:"min_score"`
+}
+
+// PasswordHashConfig selects the hasher of new passwords, Algorithm is
+// "bcrypt", "argon2id" or "scrypt".
+type PasswordHashConfig struct {
+	Algorithm  string `yaml:"algorithm" env-default:"bcrypt"`
+	BcryptCost int    `yaml:"bcrypt_cost" env-default:"10"`
+	// Argon2Memory is in KiB
+	Argon2Time    uint32 `yaml:"argon2_time" env-default:"3"`
+	Argon2Memory  uint32 `yaml:"argon2_memory" env-default:"65536"`
+	Argon2Threads uint8  `yaml:"argon2_threads" env-default:"2"`
+	ScryptLogN    uint8  `yaml:"scrypt_log_n" env-default:"15"`
+	ScryptR       int    `yaml:"scrypt_r" env-default:"8"`
+	ScryptP       int    `yaml:"scrypt_p" env-default:"1"`
+}
+
+// NotifyConfig selects how users are notified, Driver is "log" or "smtp".
+type NotifyConfig struct {
+	Driver string     `yaml:"driver" env-default:"log"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SSO_SMTP_PASSWORD"`
+	From     string `yaml:"from"`
+}
+
+// redacted replaces the secrets in the logged config.
+const redacted = "REDACTED"
+
+// plainConfig is Config without LogValue, so it is logged field by field.
+type plainConfig Config
+
+// LogValue logs the config with its secrets redacted.
+func (c Config) LogValue() slog.Value {
+	redact(&c.DB.Password)
+	redact(&c.Bootstrap.AdminPassword)
+	redact(&c.Auth.TokenKey)
+	redact(&c.Auth.LDAP.BindPassword)
+	redact(&c.Keyring.Keys)
+	redact(&c.Notify.SMTP.Password)
+
+	c.Auth.Federation.Providers = slices.Clone(c.Auth.Federation.Providers)
+	for i := range c.Auth.Federation.Providers {
+		redact(&c.Auth.Federation.Providers[i].ClientSecret)
+	}
+
+	return slog.AnyValue(plainConfig(c))
+}
+
+func redact(secret *string) {
+	if *secret != "" {
+		*secret = redacted
+	}
+}
+
 func MustLoad() *Config {
 	path := fetchConfig()
 	if path == "" {
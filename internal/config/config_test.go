@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_LogValue(t *testing.T) {
+	cfg := &Config{
+		DB:        DBConfig{Username: "sso", Password: "db-password"},
+		Bootstrap: BootstrapConfig{AdminEmail: "admin@example.com", AdminPassword: "admin-password"},
+		Auth: AuthConfig{
+			TokenKey: "token-key",
+			LDAP:     LDAPConfig{BindDN: "cn=sso", BindPassword: "bind-password"},
+			Federation: FederationConfig{Providers: []FederatedProviderConfig{
+				{ID: "corp", ClientID: "client", ClientSecret: "client-secret"},
+			}},
+		},
+		Keyring: KeyringConfig{Keys: "k1:a2V5"},
+		Notify:  NotifyConfig{SMTP: SMTPConfig{Username: "mailer", Password: "smtp-password"}},
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("starting application", slog.Any("config", cfg))
+
+	for _, secret := range []string{"db-password", "admin-password", "token-key", "bind-password", "client-secret",
+		"k1:a2V5", "smtp-password"} {
+		assert.NotContains(t, buf.String(), secret)
+	}
+	assert.Contains(t, buf.String(), "admin@example.com")
+	assert.Contains(t, buf.String(), "cn=sso")
+	assert.Contains(t, buf.String(), redacted)
+
+	// the loaded config keeps its secrets
+	assert.Equal(t, "client-secret", cfg.Auth.Federation.Providers[0].ClientSecret)
+	assert.Equal(t, "token-key", cfg.Auth.TokenKey)
+}
+
+// TestMustByLoad_ZeroValues loads the settings where zero turns a feature
+// off, the zeros must not be replaced by defaults.
+func TestMustByLoad_ZeroValues(t *testing.T) {
+	cfg := loadConfig(t, `
+token_ttl: 1h
+throttle:
+  enabled: false
+auth:
+  token_key: "0123456789abcdef0123456789abcdef"
+  notify_new_device: false
+  password_history: 0
+  password_policy:
+    denylist: false
+    forbid_email: false
+    min_score: 0
+  risk:
+    enabled: true
+    step_up_score: 0
+    deny_score: 0
+    new_device: 0
+    impossible_travel: 0
+    velocity: 0
+    unusual_hour: 0
+    ip_reputation: 0
+audit:
+  retention: 0s
+`)
+
+	assert.Equal(t, RiskConfig{
+		Enabled:              true,
+		MaxTravelSpeed:       900,
+		VelocityWindow:       15 * time.Minute,
+		VelocityFailures:     5,
+		UnusualHourMinLogins: 10,
+	}, cfg.Auth.Risk)
+	assert.Zero(t, cfg.Audit.Retention)
+	assert.False(t, cfg.Throttle.Enabled)
+	assert.False(t, cfg.Auth.NotifyNewDevice)
+	assert.False(t, cfg.Auth.PasswordPolicy.Denylist)
+	assert.False(t, cfg.Auth.PasswordPolicy.ForbidEmail)
+	assert.Zero(t, cfg.Auth.PasswordPolicy.MinScore)
+	assert.Zero(t, cfg.Auth.PasswordHistory)
+}
+
+func TestMustByLoad_OrgPasswordPolicies(t *testing.T) {
+	cfg := loadConfig(t, `
+token_ttl: 1h
+auth:
+  token_key: "0123456789abcdef0123456789abcdef"
+  org_password_policies:
+    5:
+      max_length: 64
+      require_digit: true
+`)
+
+	assert.Equal(t, 8, cfg.Auth.PasswordPolicy.MinLength)
+	assert.Equal(t, map[int64]PasswordPolicyConfig{5: {MaxLength: 64, RequireDigit: true}}, cfg.Auth.OrgPasswordPolicies)
+}
+
+func loadConfig(t *testing.T, yaml string) *Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o600))
+
+	return MustByLoad(path)
+}
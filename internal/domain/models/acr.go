@@ -0,0 +1,34 @@
+package models
+
+import "strconv"
+
+// Authentication context classes, the "acr" claim. A higher level means a
+// stronger or more recent authentication.
+const (
+	// ACRPassword is a login with a password.
+	ACRPassword = "1"
+	// ACRStepUp is a recent re-authentication within a session with the
+	// password and a second factor.
+	ACRStepUp = "2"
+)
+
+// Authentication methods, the "amr" claim (RFC 8176).
+const (
+	AMRPassword = "pwd"
+	// AMROTP is a one-time password of an authenticator app.
+	AMROTP = "otp"
+	// AMRFederated is a login at an upstream identity provider, not in
+	// RFC 8176 but common among providers.
+	AMRFederated = "fed"
+)
+
+// ACRLevel returns the level of the acr, 0 for an unknown or empty one.
+func ACRLevel(acr string) int {
+	switch acr {
+	case ACRPassword, ACRStepUp:
+		level, _ := strconv.Atoi(acr)
+		return level
+	}
+
+	return 0
+}
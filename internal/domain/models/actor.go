@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Admin permissions, granted on top of the admin rights for sensitive
+// actions.
+const (
+	PermissionImpersonate = "impersonate"
+)
+
+// Permissions lists the known admin permissions.
+var Permissions = []string{PermissionImpersonate}
+
+// Actor is who acts on behalf of the subject of a token, the "act" claim
+// (RFC 8693). Actor is set when the actor itself acts for someone else.
+// ServiceAccountID is set instead of UserID when a service account acts.
+type Actor struct {
+	UserID           int64
+	Email            string
+	ServiceAccountID int64
+	Actor            *Actor
+}
+
+// Impersonation is a token issued to an admin for another user.
+type Impersonation struct {
+	Token     string
+	SessionID string
+	ExpiresAt time.Time
+}
+
+// ExchangedToken is a token issued by a token exchange.
+type ExchangedToken struct {
+	Token     string
+	TokenType string
+	ExpiresAt time.Time
+	Scopes    []string
+}
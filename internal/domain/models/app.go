@@ -1,7 +1,33 @@
 package models
 
+import "time"
+
 type App struct {
-	Id int
-	Name string
+	Id     int
+	Name   string
 	Secret []byte
-}
\ No newline at end of file
+	Scopes []string
+	// PreviousSecret still verifies the tokens signed before the last
+	// rotation, until PreviousSecretExpiresAt.
+	PreviousSecret          []byte
+	PreviousSecretExpiresAt time.Time
+	SecretRotatedAt         time.Time
+	CreatedAt               time.Time
+	// MinACR is the lowest acr the app accepts at login, see ACRLevel.
+	MinACR string
+}
+
+// VerificationSecrets returns the secrets that verify the app tokens at t.
+func (a App) VerificationSecrets(t time.Time) [][]byte {
+	secrets := [][]byte{a.Secret}
+	if len(a.PreviousSecret) > 0 && t.Before(a.PreviousSecretExpiresAt) {
+		secrets = append(secrets, a.PreviousSecret)
+	}
+
+	return secrets
+}
+
+// SSOAppID is the app id of the tokens of the SSO itself, the only ones its
+// own RPCs accept. They are signed with the server token key instead of an
+// app secret, so no app can issue them.
+const SSOAppID = 0
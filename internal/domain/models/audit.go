@@ -0,0 +1,133 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditAdminGranted      = "admin.granted"
+	AuditAdminRevoked      = "admin.revoked"
+	AuditAdminBootstrap    = "admin.bootstrap"
+	AuditPermissionGranted = "admin.permission_granted"
+	AuditPermissionRevoked = "admin.permission_revoked"
+	AuditUserStatus        = "user.status_changed"
+	AuditUserOrg           = "user.org_changed"
+
+	AuditLogin                  = "auth.login"
+	AuditLoginRisk              = "auth.login_risk"
+	AuditStepUp                 = "auth.step_up"
+	AuditTOTPEnrolled           = "auth.totp_enrolled"
+	AuditRegister               = "auth.register"
+	AuditPasswordChanged        = "auth.password_changed"
+	AuditPasswordResetRequested = "auth.password_reset_requested"
+	AuditPasswordReset          = "auth.password_reset"
+	AuditConsentGranted         = "consent.granted"
+	AuditConsentRevoked         = "consent.revoked"
+	AuditAppCreated             = "app.created"
+	AuditAppUpdated             = "app.updated"
+	AuditAppDeleted             = "app.deleted"
+	AuditAppSecretRotated       = "app.secret_rotated"
+	AuditSessionRevoked         = "session.revoked"
+	AuditSessionsRevoked        = "session.revoked_all"
+	AuditImpersonationStarted   = "impersonation.started"
+	AuditImpersonationEnded     = "impersonation.ended"
+	AuditTokenExchanged         = "auth.token_exchanged"
+	AuditPATCreated             = "pat.created"
+	AuditPATRevoked             = "pat.revoked"
+
+	AuditServiceAccountCreated       = "service_account.created"
+	AuditServiceAccountUpdated       = "service_account.updated"
+	AuditServiceAccountDeleted       = "service_account.deleted"
+	AuditServiceAccountSecretRotated = "service_account.secret_rotated"
+	AuditServiceAccountKeyAdded      = "service_account.key_added"
+	AuditServiceAccountKeyDeleted    = "service_account.key_deleted"
+	AuditServiceAccountToken         = "service_account.token_issued"
+
+	AuditFederatedLogin = "auth.federated_login"
+	AuditIdentityLinked = "identity.linked"
+	AuditRetention      = "audit.purged"
+)
+
+// AuditActorServiceAccount marks events whose actor is a service account,
+// the actor of other events is a user.
+const AuditActorServiceAccount = "service_account"
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// AuditEvent is a security relevant action, ActorID is zero for actions
+// made by the system itself or by an unknown caller. Every event carries the
+// hash of the one before it, so a changed or removed event breaks the chain.
+type AuditEvent struct {
+	ID        int64
+	Type      string
+	ActorID   int64
+	ActorType string
+	SubjectID int64
+	AppID     int64
+	IP        string
+	UserAgent string
+	Outcome   string
+	Metadata  map[string]string
+	CreatedAt time.Time
+	PrevHash  string
+	Hash      string
+}
+
+// ChainHash returns the hash of the event linked to the previous one. The
+// time is hashed with microseconds in UTC, as the database keeps it.
+func (e AuditEvent) ChainHash(prev string) string {
+	metadata := e.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	// json.Marshal sorts the map keys, so the encoding is stable
+	data, _ := json.Marshal(struct {
+		Prev      string            `json:"prev"`
+		Type      string            `json:"type"`
+		ActorID   int64             `json:"actor"`
+		ActorType string            `json:"actor_type,omitempty"`
+		SubjectID int64             `json:"subject"`
+		AppID     int64             `json:"app"`
+		IP        string            `json:"ip"`
+		UserAgent string            `json:"ua"`
+		Outcome   string            `json:"outcome"`
+		Metadata  map[string]string `json:"metadata"`
+		CreatedAt string            `json:"created_at"`
+	}{
+		Prev:      prev,
+		Type:      e.Type,
+		ActorID:   e.ActorID,
+		ActorType: e.ActorType,
+		SubjectID: e.SubjectID,
+		AppID:     e.AppID,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Outcome:   e.Outcome,
+		Metadata:  metadata,
+		CreatedAt: e.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter selects audit events, zero fields match any event.
+type AuditFilter struct {
+	Types     []string
+	ActorID   int64
+	ActorType string
+	SubjectID int64
+	AppID     int64
+	Outcome   string
+	Since     time.Time
+	Until     time.Time
+}
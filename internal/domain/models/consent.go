@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Consent is the set of scopes a user granted to an app.
+type Consent struct {
+	UserID    int64
+	AppID     int64
+	Scopes    []string
+	GrantedAt time.Time
+}
+
+// Covers reports whether every scope is in the consent.
+func (c Consent) Covers(scopes []string) bool {
+	granted := make(map[string]bool, len(c.Scopes))
+	for _, s := range c.Scopes {
+		granted[s] = true
+	}
+
+	for _, s := range scopes {
+		if !granted[s] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Identity links an account of an upstream identity provider, the subject,
+// to a user. Email is the last email the provider sent.
+type Identity struct {
+	ID          int64
+	Provider    string
+	Subject     string
+	UserID      int64
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+// FederationState is a federated login waiting for the code of the
+// provider. The nonce is checked in the ID token, the code verifier proves
+// the code was requested by us (PKCE).
+type FederationState struct {
+	StateHash    string
+	Provider     string
+	AppID        int64
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// IdentityProvider is an upstream identity provider an org logs in with.
+type IdentityProvider struct {
+	ID    string
+	Name  string
+	OrgID int64
+}
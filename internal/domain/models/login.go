@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// LoginResult is the outcome of a successful password check. With
+// PasswordChangeRequired the token only permits changing the password, with
+// StepUpRequired it only permits a step-up.
+type LoginResult struct {
+	Token                  string
+	PasswordChangeRequired bool
+	StepUpRequired         bool
+}
+
+// LoginAttempt is a recorded login, successful or not. UserID is 0 when the
+// email is unknown, Reason says why the login failed.
+type LoginAttempt struct {
+	ID        int64
+	UserID    int64
+	AppID     int64
+	Email     string
+	DeviceID  string
+	IP        string
+	UserAgent string
+	Success   bool
+	Reason    string
+	CreatedAt time.Time
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// PAT is a personal access token, a long-lived token a user creates for
+// scripts and CI jobs instead of logging in with the password. Only the hash
+// of the token is stored.
+type PAT struct {
+	ID        int64
+	UserID    int64
+	AppID     int64
+	Name      string
+	TokenHash string
+	// Hint is the end of the token, so the user can tell the tokens apart.
+	Hint       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	LastUsedIP string
+	RevokedAt  time.Time
+}
+
+// ActiveAt reports whether the token is neither revoked nor expired at t.
+func (p PAT) ActiveAt(t time.Time) bool {
+	return p.RevokedAt.IsZero() && t.Before(p.ExpiresAt)
+}
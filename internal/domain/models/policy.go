@@ -0,0 +1,23 @@
+package models
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+type Policy struct {
+	ID         int64
+	AppID      int64
+	Name       string
+	Effect     string
+	Actions    []string
+	Expression string
+	Priority   int32
+}
+
+// Decision is the result of a policy evaluation, Policy is empty when no
+// policy matched the request.
+type Decision struct {
+	Allowed bool
+	Policy  Policy
+}
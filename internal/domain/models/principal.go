@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Principal is the caller identified by a bearer token.
+type Principal struct {
+	UserID    int64
+	Email     string
+	AppID     int64
+	Scopes    []string
+	ExpiresAt time.Time
+	// SessionID is the login session of the token, empty for tokens that
+	// aren't tied to one.
+	SessionID string
+	// AuthTime is when the user last authenticated, ACR and AMR say how.
+	AuthTime time.Time
+	ACR      string
+	AMR      []string
+	// PasswordChangeOnly tokens are issued when the password must be changed
+	// and permit nothing else.
+	PasswordChangeOnly bool
+	// StepUpOnly tokens are issued when the app needs a stronger
+	// authentication than the login and only permit a step-up.
+	StepUpOnly bool
+	// Actor is the admin or service acting on behalf of the user, nil when
+	// the user acts for themselves.
+	Actor *Actor
+	// PATID is the personal access token the caller authenticated with,
+	// zero for the tokens issued at login.
+	PATID int64
+	// ServiceAccountID is set instead of UserID when the caller is a
+	// service account.
+	ServiceAccountID int64
+	// Roles are the roles of the service account, or of the directory
+	// groups of a user who logged in with LDAP.
+	Roles []string
+}
+
+// SSO reports whether the caller holds a token of the SSO itself, see
+// SSOAppID, rather than a token of an app.
+func (p Principal) SSO() bool {
+	return p.AppID == SSOAppID && p.PATID == 0 && p.ServiceAccountID == 0
+}
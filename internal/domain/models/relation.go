@@ -0,0 +1,80 @@
+package models
+
+import "fmt"
+
+// Object is a resource addressed as "type:id".
+type Object struct {
+	Type string
+	ID   string
+}
+
+func (o Object) String() string {
+	return fmt.Sprintf("%s:%s", o.Type, o.ID)
+}
+
+// Subject is either a concrete object ("user:42") or a userset, the members
+// of a relation on another object ("group:eng#member").
+type Subject struct {
+	Type     string
+	ID       string
+	Relation string
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return fmt.Sprintf("%s:%s", s.Type, s.ID)
+	}
+
+	return fmt.Sprintf("%s:%s#%s", s.Type, s.ID, s.Relation)
+}
+
+// RelationTuple reads as "object#relation@subject".
+type RelationTuple struct {
+	Object   Object
+	Relation string
+	Subject  Subject
+}
+
+func (t RelationTuple) String() string {
+	return fmt.Sprintf("%s#%s@%s", t.Object, t.Relation, t.Subject)
+}
+
+// Namespace describes the relations of one object type within an app.
+type Namespace struct {
+	AppID     int64
+	Name      string
+	Relations []RelationConfig
+}
+
+// RelationConfig lists the rewrite rules of a relation, direct tuples are
+// always included. Union holds relations on the same object whose members
+// are members of this relation too, TupleToUserset follows tuples to other
+// objects, e.g. the viewers of a folder are viewers of its documents.
+type RelationConfig struct {
+	Name           string           `json:"name"`
+	Union          []string         `json:"union,omitempty"`
+	TupleToUserset []TupleToUserset `json:"tuple_to_userset,omitempty"`
+}
+
+type TupleToUserset struct {
+	Tupleset         string `json:"tupleset"`
+	ComputedRelation string `json:"computed_relation"`
+}
+
+func (n Namespace) Relation(name string) (RelationConfig, bool) {
+	for _, rel := range n.Relations {
+		if rel.Name == name {
+			return rel, true
+		}
+	}
+
+	return RelationConfig{}, false
+}
+
+// UsersetTree is the expanded membership of object#relation.
+type UsersetTree struct {
+	Object   Object
+	Relation string
+	Subjects []Subject
+	Children []UsersetTree
+}
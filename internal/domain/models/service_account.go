@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// ServiceAccount is an automation identity without a password, owned by an
+// app or by an org. It authenticates with its client secret or with an
+// assertion signed by one of its keys.
+type ServiceAccount struct {
+	ID   int64
+	Name string
+	// AppID or OrgID owns the account, exactly one of them is set. An app's
+	// account gets tokens only for the app.
+	AppID int64
+	OrgID int64
+	Roles []string
+	// SecretHash is the hash of the client secret, empty when the account
+	// only has keys.
+	SecretHash string
+	Disabled   bool
+	CreatedAt  time.Time
+}
+
+// ServiceAccountKey is a public key verifying the assertions of a service
+// account, ID is the "kid" header of the assertions.
+type ServiceAccountKey struct {
+	ID               string
+	ServiceAccountID int64
+	// PublicKey is PEM encoded, RSA or ECDSA.
+	PublicKey string
+	CreatedAt time.Time
+}
+
+// ServiceAccountToken is a token issued to a service account.
+type ServiceAccountToken struct {
+	Token     string
+	ExpiresAt time.Time
+	Scopes    []string
+}
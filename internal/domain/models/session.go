@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Session is a login of a user to an app, the tokens issued by the login
+// carry its id and stop validating once it is revoked.
+type Session struct {
+	ID         string
+	UserID     int64
+	AppID      int64
+	DeviceID   string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  time.Time
+	// ActorID is the admin impersonating the user in the session, zero for
+	// the user's own logins.
+	ActorID int64
+}
+
+// ActiveAt reports whether the session is neither revoked nor expired at t.
+func (s Session) ActiveAt(t time.Time) bool {
+	return s.RevokedAt.IsZero() && t.Before(s.ExpiresAt)
+}
@@ -0,0 +1,18 @@
+package models
+
+const (
+	ThrottleByEmail = "email"
+	ThrottleByIP    = "ip"
+	ThrottleByApp   = "app"
+)
+
+// ThrottleKey identifies a login attempt counter, e.g. the attempts for one
+// email or from one IP.
+type ThrottleKey struct {
+	Kind  string
+	Value string
+}
+
+func (k ThrottleKey) String() string {
+	return k.Kind + ":" + k.Value
+}
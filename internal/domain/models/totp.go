@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// TOTP is the authenticator app of a user, the second factor of the step-up.
+// The enrollment is pending until a first code confirms it. LastStep is the
+// time step of the last accepted code, so a code is accepted only once.
+type TOTP struct {
+	UserID int64
+	// Secret is encrypted when a keyring is set.
+	Secret    []byte
+	Confirmed bool
+	LastStep  int64
+	CreatedAt time.Time
+}
+
+// TOTPEnrollment is shown once to add the secret to an authenticator app,
+// URL is the otpauth:// URL to put into a QR code.
+type TOTPEnrollment struct {
+	Secret string
+	URL    string
+}
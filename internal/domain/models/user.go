@@ -1,7 +1,88 @@
 package models
 
+import "time"
+
 type User struct {
-	ID int64
-	Email string
-	PassHash []byte
-}
\ No newline at end of file
+	ID        int64
+	Email     string
+	PassHash  []byte
+	IsAdmin   bool
+	CreatedAt time.Time
+	// Status is one of UserStatus*, StatusUntil ends a non-active status,
+	// the zero value means it doesn't expire.
+	Status       string
+	StatusReason string
+	StatusUntil  time.Time
+	// PasswordChangeRequired is set when the password must be changed
+	// before the next login, e.g. it was found in a breach.
+	PasswordChangeRequired bool
+	PasswordChangedAt      time.Time
+	// OrgID is the org the user belongs to, 0 is no org.
+	OrgID int64
+}
+
+// NoPasswordHash is the password hash of users without a local password,
+// e.g. provisioned by an identity provider. No password matches it.
+const NoPasswordHash = "!"
+
+// HasPassword reports whether the user can log in with a password.
+func (u User) HasPassword() bool {
+	return len(u.PassHash) > 0 && string(u.PassHash) != NoPasswordHash
+}
+
+const (
+	UserStatusActive              = "active"
+	UserStatusDisabled            = "disabled"
+	UserStatusLocked              = "locked"
+	UserStatusPendingVerification = "pending_verification"
+)
+
+// ValidUserStatus reports whether status is one of UserStatus*.
+func ValidUserStatus(status string) bool {
+	switch status {
+	case UserStatusActive, UserStatusDisabled, UserStatusLocked, UserStatusPendingVerification:
+		return true
+	}
+
+	return false
+}
+
+// StatusAt returns the status of the user at t, taking StatusUntil into
+// account.
+func (u User) StatusAt(t time.Time) string {
+	if u.Status == "" {
+		return UserStatusActive
+	}
+	if u.Status != UserStatusActive && !u.StatusUntil.IsZero() && !t.Before(u.StatusUntil) {
+		return UserStatusActive
+	}
+
+	return u.Status
+}
+
+const (
+	SortUsersByID        = "id"
+	SortUsersByEmail     = "email"
+	SortUsersByCreatedAt = "created_at"
+)
+
+// UserFilter narrows ListUsers, zero fields are not applied. Status matches
+// the status at the time of the query, see StatusAt.
+type UserFilter struct {
+	EmailPrefix   string
+	IsAdmin       *bool
+	Status        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	OrgID         int64
+}
+
+// UserPage describes one page of ListUsers. After is the last user of the
+// previous page, the next page starts right after it in the sort order.
+type UserPage struct {
+	Filter UserFilter
+	SortBy string
+	Desc   bool
+	After  *User
+	Limit  int
+}
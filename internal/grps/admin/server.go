@@ -0,0 +1,284 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/admin"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const emptyValue = 0
+
+type Admin interface {
+	ListUsers(ctx context.Context, actorID int64, page models.UserPage, cursor string) (users []models.User, next string, err error)
+	GetUser(ctx context.Context, actorID int64, userID int64) (user models.User, err error)
+	SetAdmin(ctx context.Context, actorID int64, userID int64, isAdmin bool, reason string) error
+	ListAdmins(ctx context.Context, actorID int64) (admins []models.User, err error)
+	SetUserStatus(ctx context.Context, actorID int64, userID int64,
+		status string, reason string, until time.Time) error
+	SetPermission(ctx context.Context, actorID int64, userID int64, permission string, granted bool, reason string) error
+	SetUserOrg(ctx context.Context, actorID int64, userID int64, orgID int64, reason string) error
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAdminServer
+	admin Admin
+}
+
+func RegisterServ(gRPC *grpc.Server, admin Admin) {
+	ssov1.RegisterAdminServer(gRPC, &serverAPI{admin: admin})
+}
+
+func (s *serverAPI) ListUsers(ctx context.Context, req *ssov1.ListUsersRequest) (*ssov1.ListUsersResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	page := models.UserPage{
+		Filter: models.UserFilter{EmailPrefix: req.GetEmailPrefix()},
+		Desc:   req.GetDesc(),
+		Limit:  int(req.GetPageSize()),
+	}
+	if req.GetIsAdmin() != nil {
+		isAdmin := req.GetIsAdmin().GetValue()
+		page.Filter.IsAdmin = &isAdmin
+	}
+	if req.GetStatus() != ssov1.UserStatus_USER_STATUS_UNSPECIFIED {
+		page.Filter.Status = statusFromProto(req.GetStatus())
+	}
+	if req.GetCreatedAfter() != nil {
+		page.Filter.CreatedAfter = req.GetCreatedAfter().AsTime()
+	}
+	if req.GetCreatedBefore() != nil {
+		page.Filter.CreatedBefore = req.GetCreatedBefore().AsTime()
+	}
+	if req.GetOrgId() != emptyValue {
+		page.Filter.OrgID = req.GetOrgId()
+	}
+
+	switch req.GetSortBy() {
+	case ssov1.UserSort_USER_SORT_EMAIL:
+		page.SortBy = models.SortUsersByEmail
+	case ssov1.UserSort_USER_SORT_CREATED_AT:
+		page.SortBy = models.SortUsersByCreatedAt
+	default:
+		page.SortBy = models.SortUsersByID
+	}
+
+	users, next, err := s.admin.ListUsers(ctx, actor.UserID, page, req.GetCursor())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListUsersResponse{Users: make([]*ssov1.User, 0, len(users)), NextCursor: next}
+	for _, u := range users {
+		resp.Users = append(resp.Users, userToProto(u))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) GetUser(ctx context.Context, req *ssov1.GetUserRequest) (*ssov1.GetUserResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "User id is empty")
+	}
+
+	user, err := s.admin.GetUser(ctx, actor.UserID, req.GetUserId())
+	if err != nil {
+		if errors.Is(err, admin.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("User not found with id: %d", req.GetUserId()))
+		}
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.GetUserResponse{User: userToProto(user)}, nil
+}
+
+func (s *serverAPI) SetAdmin(ctx context.Context, req *ssov1.SetAdminRequest) (*ssov1.SetAdminResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "User id is empty")
+	}
+	if req.GetReason() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Reason is empty")
+	}
+
+	err := s.admin.SetAdmin(ctx, actor.UserID, req.GetUserId(), req.GetIsAdmin(), req.GetReason())
+	if err != nil {
+		if errors.Is(err, admin.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("User not found with id: %d", req.GetUserId()))
+		}
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.SetAdminResponse{Success: true}, nil
+}
+
+func (s *serverAPI) ListAdmins(ctx context.Context, req *ssov1.ListAdminsRequest) (*ssov1.ListAdminsResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	admins, err := s.admin.ListAdmins(ctx, actor.UserID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListAdminsResponse{Admins: make([]*ssov1.User, 0, len(admins))}
+	for _, u := range admins {
+		resp.Admins = append(resp.Admins, userToProto(u))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) SetUserStatus(ctx context.Context, req *ssov1.SetUserStatusRequest) (*ssov1.SetUserStatusResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "User id is empty")
+	}
+	if req.GetStatus() == ssov1.UserStatus_USER_STATUS_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "Status is empty")
+	}
+
+	var until time.Time
+	if req.GetUntil() != nil {
+		until = req.GetUntil().AsTime()
+	}
+
+	err := s.admin.SetUserStatus(ctx, actor.UserID, req.GetUserId(), statusFromProto(req.GetStatus()), req.GetReason(), until)
+	if err != nil {
+		if errors.Is(err, admin.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("User not found with id: %d", req.GetUserId()))
+		}
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.SetUserStatusResponse{Success: true}, nil
+}
+
+func userToProto(u models.User) *ssov1.User {
+	user := &ssov1.User{
+		Id:           u.ID,
+		Email:        u.Email,
+		IsAdmin:      u.IsAdmin,
+		CreatedAt:    timestamppb.New(u.CreatedAt),
+		Status:       statusToProto(u.StatusAt(time.Now())),
+		StatusReason: u.StatusReason,
+		OrgId:        u.OrgID,
+	}
+	if !u.StatusUntil.IsZero() {
+		user.StatusUntil = timestamppb.New(u.StatusUntil)
+	}
+
+	return user
+}
+
+func statusFromProto(s ssov1.UserStatus) string {
+	switch s {
+	case ssov1.UserStatus_USER_STATUS_DISABLED:
+		return models.UserStatusDisabled
+	case ssov1.UserStatus_USER_STATUS_LOCKED:
+		return models.UserStatusLocked
+	case ssov1.UserStatus_USER_STATUS_PENDING_VERIFICATION:
+		return models.UserStatusPendingVerification
+	default:
+		return models.UserStatusActive
+	}
+}
+
+func statusToProto(s string) ssov1.UserStatus {
+	switch s {
+	case models.UserStatusDisabled:
+		return ssov1.UserStatus_USER_STATUS_DISABLED
+	case models.UserStatusLocked:
+		return ssov1.UserStatus_USER_STATUS_LOCKED
+	case models.UserStatusPendingVerification:
+		return ssov1.UserStatus_USER_STATUS_PENDING_VERIFICATION
+	default:
+		return ssov1.UserStatus_USER_STATUS_ACTIVE
+	}
+}
+
+func (s *serverAPI) SetPermission(ctx context.Context, req *ssov1.SetPermissionRequest) (*ssov1.SetPermissionResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "User id is empty")
+	}
+	if req.GetReason() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Reason is empty")
+	}
+
+	err := s.admin.SetPermission(ctx, actor.UserID, req.GetUserId(), req.GetPermission(), req.GetGranted(), req.GetReason())
+	if err != nil {
+		if errors.Is(err, admin.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("User not found with id: %d", req.GetUserId()))
+		}
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.SetPermissionResponse{Success: true}, nil
+}
+
+func (s *serverAPI) SetUserOrg(ctx context.Context, req *ssov1.SetUserOrgRequest) (*ssov1.SetUserOrgResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "User id is empty")
+	}
+	if req.GetReason() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Reason is empty")
+	}
+
+	err := s.admin.SetUserOrg(ctx, actor.UserID, req.GetUserId(), req.GetOrgId(), req.GetReason())
+	if err != nil {
+		if errors.Is(err, admin.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("User not found with id: %d", req.GetUserId()))
+		}
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.SetUserOrgResponse{Success: true}, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, admin.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	case errors.Is(err, admin.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, "Invalid cursor")
+	case errors.Is(err, admin.ErrInvalidStatus), errors.Is(err, admin.ErrReasonRequired),
+		errors.Is(err, admin.ErrInvalidPermission), errors.Is(err, admin.ErrInvalidOrg):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, admin.ErrLastAdmin):
+		return status.Error(codes.FailedPrecondition, "Cannot demote the last admin")
+	}
+
+	return status.Error(codes.Internal, "Iternal error: "+err.Error())
+}
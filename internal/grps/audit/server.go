@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/audit"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Audit interface {
+	Query(ctx context.Context, actorID int64, filter models.AuditFilter,
+		limit int, cursor string) (events []models.AuditEvent, next string, err error)
+	Verify(ctx context.Context, actorID int64) (checked int64, brokenID int64, err error)
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAuditServer
+	audit Audit
+}
+
+func RegisterServ(gRPC *grpc.Server, audit Audit) {
+	ssov1.RegisterAuditServer(gRPC, &serverAPI{audit: audit})
+}
+
+func (s *serverAPI) QueryAuditLog(ctx context.Context, req *ssov1.QueryAuditLogRequest) (*ssov1.QueryAuditLogResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	filter := models.AuditFilter{
+		Types:     req.GetTypes(),
+		ActorID:   req.GetActorId(),
+		ActorType: req.GetActorType(),
+		SubjectID: req.GetSubjectId(),
+		AppID:     req.GetAppId(),
+		Outcome:   req.GetOutcome(),
+	}
+	if req.GetSince() != nil {
+		filter.Since = req.GetSince().AsTime()
+	}
+	if req.GetUntil() != nil {
+		filter.Until = req.GetUntil().AsTime()
+	}
+
+	events, next, err := s.audit.Query(ctx, actor.UserID, filter, int(req.GetPageSize()), req.GetCursor())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.QueryAuditLogResponse{Events: make([]*ssov1.AuditEvent, 0, len(events)), NextCursor: next}
+	for _, e := range events {
+		resp.Events = append(resp.Events, &ssov1.AuditEvent{
+			Id:        e.ID,
+			Type:      e.Type,
+			ActorId:   e.ActorID,
+			ActorType: e.ActorType,
+			SubjectId: e.SubjectID,
+			AppId:     e.AppID,
+			Ip:        e.IP,
+			UserAgent: e.UserAgent,
+			Outcome:   e.Outcome,
+			Metadata:  e.Metadata,
+			CreatedAt: timestamppb.New(e.CreatedAt),
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) VerifyAuditLog(ctx context.Context, req *ssov1.VerifyAuditLogRequest) (*ssov1.VerifyAuditLogResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	checked, brokenID, err := s.audit.Verify(ctx, actor.UserID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.VerifyAuditLogResponse{Valid: brokenID == 0, Checked: checked, BrokenEventId: brokenID}, nil
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, audit.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	case errors.Is(err, audit.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, "Invalid cursor")
+	}
+
+	return status.Error(codes.Internal, "Iternal error: "+err.Error())
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) GetApp(ctx context.Context, req *ssov1.GetAppRequest) (*ssov1.GetAppResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	app, err := s.auth.GetApp(ctx, actor.UserID, req.GetAppId())
+	if err != nil {
+		return nil, appStatus(err, req.GetAppId())
+	}
+
+	return &ssov1.GetAppResponse{App: appToProto(app)}, nil
+}
+
+func (s *serverAPI) ListApps(ctx context.Context, req *ssov1.ListAppsRequest) (*ssov1.ListAppsResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	apps, next, err := s.auth.ListApps(ctx, actor.UserID, int(req.GetPageSize()), req.GetCursor())
+	if err != nil {
+		return nil, appStatus(err, 0)
+	}
+
+	resp := &ssov1.ListAppsResponse{Apps: make([]*ssov1.App, 0, len(apps)), NextCursor: next}
+	for _, app := range apps {
+		resp.Apps = append(resp.Apps, appToProto(app))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) UpdateApp(ctx context.Context, req *ssov1.UpdateAppRequest) (*ssov1.UpdateAppResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	var upd auth.AppUpdate
+	if req.GetName() != nil {
+		name := req.GetName().GetValue()
+		if name == "" {
+			return nil, status.Error(codes.InvalidArgument, "Name is empty")
+		}
+		upd.Name = &name
+	}
+	if req.GetScopes() != nil {
+		scopes := req.GetScopes().GetScopes()
+		upd.Scopes = &scopes
+	}
+	if req.GetMinAcr() != nil {
+		minACR := req.GetMinAcr().GetValue()
+		upd.MinACR = &minACR
+	}
+
+	app, err := s.auth.UpdateApp(ctx, actor.UserID, req.GetAppId(), upd)
+	if err != nil {
+		return nil, appStatus(err, req.GetAppId())
+	}
+
+	return &ssov1.UpdateAppResponse{App: appToProto(app)}, nil
+}
+
+func (s *serverAPI) DeleteApp(ctx context.Context, req *ssov1.DeleteAppRequest) (*ssov1.DeleteAppResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	if err := s.auth.DeleteApp(ctx, actor.UserID, req.GetAppId()); err != nil {
+		return nil, appStatus(err, req.GetAppId())
+	}
+
+	return &ssov1.DeleteAppResponse{Success: true}, nil
+}
+
+func (s *serverAPI) RotateAppSecret(ctx context.Context, req *ssov1.RotateAppSecretRequest) (*ssov1.RotateAppSecretResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	secret, previousExpiresAt, err := s.auth.RotateAppSecret(ctx, actor.UserID, req.GetAppId())
+	if err != nil {
+		return nil, appStatus(err, req.GetAppId())
+	}
+
+	return &ssov1.RotateAppSecretResponse{
+		Secret:                  secret,
+		PreviousSecretExpiresAt: timestamppb.New(previousExpiresAt),
+	}, nil
+}
+
+func appToProto(app models.App) *ssov1.App {
+	res := &ssov1.App{
+		Id:        int64(app.Id),
+		Name:      app.Name,
+		Scopes:    app.Scopes,
+		CreatedAt: timestamppb.New(app.CreatedAt),
+		MinAcr:    app.MinACR,
+	}
+	if !app.SecretRotatedAt.IsZero() {
+		res.SecretRotatedAt = timestamppb.New(app.SecretRotatedAt)
+	}
+	if !app.PreviousSecretExpiresAt.IsZero() {
+		res.PreviousSecretExpiresAt = timestamppb.New(app.PreviousSecretExpiresAt)
+	}
+
+	return res
+}
+
+func appStatus(err error, appID int64) error {
+	switch {
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	case errors.Is(err, auth.ErrAppNotFound):
+		return status.Error(codes.NotFound, fmt.Sprintf("App not found with id: %d", appID))
+	case errors.Is(err, auth.ErrAppExist):
+		return status.Error(codes.AlreadyExists, "App already exist")
+	case errors.Is(err, auth.ErrInvalidScope), errors.Is(err, auth.ErrInvalidCursor), errors.Is(err, auth.ErrInvalidACR):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return status.Error(codes.Internal, "Iternal error: "+err.Error())
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) TokenExchange(ctx context.Context, req *ssov1.TokenExchangeRequest) (*ssov1.TokenExchangeResponse, error) {
+	caller, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetSubjectToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Subject token is empty")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if len(req.GetScopes()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Scopes is empty")
+	}
+
+	exchanged, err := s.auth.TokenExchange(ctx, auth.TokenExchangeRequest{
+		Caller:             caller,
+		SubjectToken:       req.GetSubjectToken(),
+		SubjectTokenType:   req.GetSubjectTokenType(),
+		ActorToken:         req.GetActorToken(),
+		ActorTokenType:     req.GetActorTokenType(),
+		AppID:              req.GetAppId(),
+		Scopes:             req.GetScopes(),
+		RequestedTokenType: req.GetRequestedTokenType(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUnsupportedTokenType):
+			return nil, status.Error(codes.InvalidArgument, "Unsupported token type")
+		case errors.Is(err, auth.ErrInvalidSubjectToken):
+			return nil, status.Error(codes.InvalidArgument, "Invalid subject token")
+		case errors.Is(err, auth.ErrInvalidActorToken):
+			return nil, status.Error(codes.InvalidArgument, "Invalid actor token")
+		case errors.Is(err, auth.ErrActorTokenRequired):
+			return nil, status.Error(codes.InvalidArgument, "Actor token is required")
+		case errors.Is(err, auth.ErrInvalidScope):
+			return nil, status.Error(codes.InvalidArgument, "Invalid scope")
+		case errors.Is(err, auth.ErrExchangeCaller):
+			return nil, status.Error(codes.PermissionDenied, "Caller is not a client of the source app")
+		case errors.Is(err, auth.ErrExchangeNotAllowed):
+			return nil, status.Error(codes.PermissionDenied, "Token exchange is not allowed")
+		case errors.Is(err, auth.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("App not found with id: %d", req.GetAppId()))
+		case errors.Is(err, auth.ErrStepUpRequired):
+			return nil, stepUpStatus()
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.TokenExchangeResponse{
+		AccessToken:     exchanged.Token,
+		IssuedTokenType: exchanged.TokenType,
+		TokenType:       "Bearer",
+		ExpiresAt:       timestamppb.New(exchanged.ExpiresAt),
+		Scopes:          exchanged.Scopes,
+	}, nil
+}
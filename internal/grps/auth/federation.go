@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) ListIdentityProviders(ctx context.Context,
+	req *ssov1.ListIdentityProvidersRequest) (*ssov1.ListIdentityProvidersResponse, error) {
+	if req.GetOrgId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Org_id is empty")
+	}
+
+	providers := s.auth.ListIdentityProviders(req.GetOrgId())
+
+	resp := &ssov1.ListIdentityProvidersResponse{Providers: make([]*ssov1.IdentityProvider, 0, len(providers))}
+	for _, provider := range providers {
+		resp.Providers = append(resp.Providers, &ssov1.IdentityProvider{
+			Id:    provider.ID,
+			Name:  provider.Name,
+			OrgId: provider.OrgID,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) StartFederatedLogin(ctx context.Context,
+	req *ssov1.StartFederatedLoginRequest) (*ssov1.StartFederatedLoginResponse, error) {
+	if req.GetProviderId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Provider_id is empty")
+	}
+
+	authURL, err := s.auth.StartFederatedLogin(ctx, req.GetProviderId(), req.GetAppId())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrProviderNotFound):
+			return nil, status.Error(codes.NotFound, "Identity provider not found")
+		case errors.Is(err, auth.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("App not found with id: %d", req.GetAppId()))
+		case errors.Is(err, auth.ErrFederationFailed):
+			return nil, status.Error(codes.Unavailable, "Identity provider is unavailable")
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.StartFederatedLoginResponse{AuthorizationUrl: authURL}, nil
+}
+
+func (s *serverAPI) CompleteFederatedLogin(ctx context.Context,
+	req *ssov1.CompleteFederatedLoginRequest) (*ssov1.CompleteFederatedLoginResponse, error) {
+	if req.GetState() == "" {
+		return nil, status.Error(codes.InvalidArgument, "State is empty")
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Code is empty")
+	}
+	ctx, deviceID := withDevice(ctx)
+
+	result, err := s.auth.CompleteFederatedLogin(ctx, req.GetState(), req.GetCode())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidFederationState):
+			return nil, status.Error(codes.InvalidArgument, "Invalid or expired state")
+		case errors.Is(err, auth.ErrProviderNotFound):
+			return nil, status.Error(codes.NotFound, "Identity provider not found")
+		case errors.Is(err, auth.ErrFederationFailed):
+			return nil, status.Error(codes.Unauthenticated, "Federated login failed")
+		case errors.Is(err, auth.ErrIdentityNotLinked):
+			return nil, status.Error(codes.PermissionDenied, "Identity is not linked to a user")
+		case errors.Is(err, auth.ErrEmailNotAllowed):
+			return nil, status.Error(codes.PermissionDenied, "Email domain is not allowed")
+		case errors.Is(err, auth.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, "App not found")
+		case errors.Is(err, auth.ErrUserDisabled):
+			return nil, status.Error(codes.PermissionDenied, "Account is disabled")
+		case errors.Is(err, auth.ErrUserLocked):
+			return nil, status.Error(codes.FailedPrecondition, "Account is locked")
+		case errors.Is(err, auth.ErrUserNotVerified):
+			return nil, status.Error(codes.Unauthenticated, "Account is pending verification")
+		case errors.Is(err, auth.ErrStepUpRequired):
+			return nil, stepUpStatus()
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.CompleteFederatedLoginResponse{
+		Token:          result.Token,
+		DeviceId:       deviceID,
+		StepUpRequired: result.StepUpRequired,
+	}, nil
+}
+
+func (s *serverAPI) ListIdentities(ctx context.Context, req *ssov1.ListIdentitiesRequest) (*ssov1.ListIdentitiesResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	identities, err := s.auth.ListIdentities(ctx, actor.UserID, sessionUser(actor, req.GetUserId()))
+	if err != nil {
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	resp := &ssov1.ListIdentitiesResponse{Identities: make([]*ssov1.Identity, 0, len(identities))}
+	for _, identity := range identities {
+		resp.Identities = append(resp.Identities, identityToProto(identity))
+	}
+
+	return resp, nil
+}
+
+func identityToProto(identity models.Identity) *ssov1.Identity {
+	res := &ssov1.Identity{
+		Id:        identity.ID,
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		UserId:    identity.UserID,
+		Email:     identity.Email,
+		CreatedAt: timestamppb.New(identity.CreatedAt),
+	}
+	if !identity.LastLoginAt.IsZero() {
+		res.LastLoginAt = timestamppb.New(identity.LastLoginAt)
+	}
+
+	return res
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) Impersonate(ctx context.Context, req *ssov1.ImpersonateRequest) (*ssov1.ImpersonateResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "User id is empty")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if req.GetReason() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Reason is empty")
+	}
+
+	impersonation, err := s.auth.Impersonate(ctx, actor, req.GetUserId(), req.GetAppId(), req.GetReason())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		case errors.Is(err, auth.ErrImpersonationDisabled):
+			return nil, status.Error(codes.PermissionDenied, "Impersonation is disabled for the app")
+		case errors.Is(err, auth.ErrUserNotFound):
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("User not found with id: %d", req.GetUserId()))
+		case errors.Is(err, auth.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("App not found with id: %d", req.GetAppId()))
+		case errors.Is(err, auth.ErrReasonRequired):
+			return nil, status.Error(codes.InvalidArgument, "Reason is empty")
+		case errors.Is(err, auth.ErrUserDisabled), errors.Is(err, auth.ErrUserLocked),
+			errors.Is(err, auth.ErrUserNotVerified):
+			return nil, status.Error(codes.FailedPrecondition, "User is not active")
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.ImpersonateResponse{
+		Token:     impersonation.Token,
+		SessionId: impersonation.SessionID,
+		ExpiresAt: timestamppb.New(impersonation.ExpiresAt),
+	}, nil
+}
+
+func (s *serverAPI) EndImpersonation(ctx context.Context, req *ssov1.EndImpersonationRequest) (*ssov1.EndImpersonationResponse, error) {
+	principal, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetReason() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Reason is empty")
+	}
+
+	if err := s.auth.EndImpersonation(ctx, principal, req.GetReason()); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrNotImpersonating):
+			return nil, status.Error(codes.FailedPrecondition, "Token is not an impersonation")
+		case errors.Is(err, auth.ErrReasonRequired):
+			return nil, status.Error(codes.InvalidArgument, "Reason is empty")
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.EndImpersonationResponse{Success: true}, nil
+}
+
+func actorToProto(actor *models.Actor) *ssov1.Actor {
+	res := &ssov1.Actor{UserId: actor.UserID, Email: actor.Email, ServiceAccountId: actor.ServiceAccountID}
+	if actor.Actor != nil {
+		res.Act = actorToProto(actor.Actor)
+	}
+
+	return res
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/lib/clientinfo"
+	"sso/internal/services/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	deviceIDLen    = 16
+	maxDeviceIDLen = 128
+)
+
+func (s *serverAPI) GetLoginHistory(ctx context.Context, req *ssov1.GetLoginHistoryRequest) (*ssov1.GetLoginHistoryResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	attempts, next, err := s.auth.GetLoginHistory(ctx, actor.UserID, sessionUser(actor, req.GetUserId()),
+		int(req.GetPageSize()), req.GetCursor())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		case errors.Is(err, auth.ErrInvalidCursor):
+			return nil, status.Error(codes.InvalidArgument, "Invalid cursor")
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	resp := &ssov1.GetLoginHistoryResponse{Attempts: make([]*ssov1.LoginAttempt, 0, len(attempts)), NextCursor: next}
+	for _, attempt := range attempts {
+		resp.Attempts = append(resp.Attempts, loginAttemptToProto(attempt))
+	}
+
+	return resp, nil
+}
+
+// withDevice makes sure the caller has a device id and returns it. A missing
+// or malformed id is replaced with a new one, which is then returned to the
+// client to keep.
+func withDevice(ctx context.Context) (context.Context, string) {
+	client := clientinfo.From(ctx)
+	if client.DeviceID != "" && len(client.DeviceID) <= maxDeviceIDLen {
+		return ctx, client.DeviceID
+	}
+
+	raw := make([]byte, deviceIDLen)
+	if _, err := rand.Read(raw); err != nil {
+		client.DeviceID = ""
+		return clientinfo.With(ctx, client), ""
+	}
+	client.DeviceID = base64.RawURLEncoding.EncodeToString(raw)
+
+	return clientinfo.With(ctx, client), client.DeviceID
+}
+
+func loginAttemptToProto(attempt models.LoginAttempt) *ssov1.LoginAttempt {
+	return &ssov1.LoginAttempt{
+		Id:        attempt.ID,
+		UserId:    attempt.UserID,
+		AppId:     attempt.AppID,
+		DeviceId:  attempt.DeviceID,
+		Ip:        attempt.IP,
+		UserAgent: attempt.UserAgent,
+		Success:   attempt.Success,
+		Reason:    attempt.Reason,
+		CreatedAt: timestamppb.New(attempt.CreatedAt),
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/auth"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) CreatePAT(ctx context.Context, req *ssov1.CreatePATRequest) (*ssov1.CreatePATResponse, error) {
+	principal, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Name is empty")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	var expiresAt time.Time
+	if req.GetExpiresAt() != nil {
+		expiresAt = req.GetExpiresAt().AsTime()
+	}
+
+	pat, token, err := s.auth.CreatePAT(ctx, principal, req.GetAppId(), req.GetName(), req.GetScopes(), expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidPATName):
+			return nil, status.Error(codes.InvalidArgument, "Invalid name")
+		case errors.Is(err, auth.ErrInvalidExpiry):
+			return nil, status.Error(codes.InvalidArgument, "Invalid expires_at")
+		case errors.Is(err, auth.ErrInvalidScope):
+			return nil, status.Error(codes.InvalidArgument, "Invalid scope")
+		case errors.Is(err, auth.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("App not found with id: %d", req.GetAppId()))
+		case errors.Is(err, auth.ErrStepUpRequired):
+			return nil, stepUpStatus()
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.CreatePATResponse{Token: token, Pat: patToProto(pat)}, nil
+}
+
+func (s *serverAPI) ListPATs(ctx context.Context, req *ssov1.ListPATsRequest) (*ssov1.ListPATsResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	pats, err := s.auth.ListPATs(ctx, actor.UserID, sessionUser(actor, req.GetUserId()))
+	if err != nil {
+		return nil, patStatus(err)
+	}
+
+	resp := &ssov1.ListPATsResponse{Pats: make([]*ssov1.PAT, 0, len(pats))}
+	for _, pat := range pats {
+		resp.Pats = append(resp.Pats, patToProto(pat))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokePAT(ctx context.Context, req *ssov1.RevokePATRequest) (*ssov1.RevokePATResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetPatId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Pat_id is empty")
+	}
+
+	if err := s.auth.RevokePAT(ctx, actor.UserID, sessionUser(actor, req.GetUserId()), req.GetPatId()); err != nil {
+		return nil, patStatus(err)
+	}
+
+	return &ssov1.RevokePATResponse{Success: true}, nil
+}
+
+func patToProto(pat models.PAT) *ssov1.PAT {
+	res := &ssov1.PAT{
+		Id:         pat.ID,
+		UserId:     pat.UserID,
+		AppId:      pat.AppID,
+		Name:       pat.Name,
+		Hint:       pat.Hint,
+		Scopes:     pat.Scopes,
+		CreatedAt:  timestamppb.New(pat.CreatedAt),
+		ExpiresAt:  timestamppb.New(pat.ExpiresAt),
+		LastUsedIp: pat.LastUsedIP,
+	}
+	if !pat.LastUsedAt.IsZero() {
+		res.LastUsedAt = timestamppb.New(pat.LastUsedAt)
+	}
+
+	return res
+}
+
+func patStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	case errors.Is(err, auth.ErrPATNotFound):
+		return status.Error(codes.NotFound, "Personal access token not found")
+	}
+
+	return status.Error(codes.Internal, "Iternal error: "+err.Error())
+}
@@ -4,21 +4,75 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/lib/password"
 	"sso/internal/services/auth"
+	"time"
 
-	ssov1 "github.com/maximka200/buffpr/gen/go/sso"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const emptyValue = 0
 
 type Auth interface {
-	Login(ctx context.Context, email string, password string, appId int64) (token string, err error)
+	Login(ctx context.Context, email string, password string, appId int64,
+		scopes []string, consent bool) (result models.LoginResult, err error)
 	RegisterNewUser(ctx context.Context, email string, password string) (userID int64, err error)
 	IsAdmin(ctx context.Context, userID int64) (flag bool, err error)
-	CreateApp(ctx context.Context, name string, secret string) (appId int64, err error)
+	CreateApp(ctx context.Context, actorID int64, name string, scopes []string) (appId int64, secret string, err error)
+	ListConsents(ctx context.Context, actorID int64, userID int64) (consents []models.Consent, err error)
+	RevokeConsent(ctx context.Context, actorID int64, userID int64, appID int64) error
+	ValidateToken(ctx context.Context, token string) (principal models.Principal, err error)
+	IntrospectToken(ctx context.Context, token string) (principal models.Principal, active bool, err error)
+	ChangePassword(ctx context.Context, userID int64, sessionID string, oldPass string, newPass string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, newPass string) error
+	GetApp(ctx context.Context, actorID int64, appID int64) (app models.App, err error)
+	ListApps(ctx context.Context, actorID int64, limit int, cursor string) (apps []models.App, next string, err error)
+	UpdateApp(ctx context.Context, actorID int64, appID int64, upd auth.AppUpdate) (app models.App, err error)
+	DeleteApp(ctx context.Context, actorID int64, appID int64) error
+	RotateAppSecret(ctx context.Context, actorID int64, appID int64) (secret string, previousExpiresAt time.Time, err error)
+	ListSessions(ctx context.Context, actorID int64, userID int64) (sessions []models.Session, err error)
+	RevokeSession(ctx context.Context, actorID int64, userID int64, sessionID string) error
+	RevokeAllSessions(ctx context.Context, actorID int64, userID int64, exceptID string) (revoked int64, err error)
+	StepUp(ctx context.Context, principal models.Principal, password string,
+		code string) (token string, expiresAt time.Time, err error)
+	EnrollTOTP(ctx context.Context, userID int64) (enrollment models.TOTPEnrollment, err error)
+	ConfirmTOTP(ctx context.Context, userID int64, code string) error
+	Impersonate(ctx context.Context, actor models.Principal, userID int64, appID int64,
+		reason string) (impersonation models.Impersonation, err error)
+	EndImpersonation(ctx context.Context, principal models.Principal, reason string) error
+	TokenExchange(ctx context.Context, req auth.TokenExchangeRequest) (token models.ExchangedToken, err error)
+	CreatePAT(ctx context.Context, principal models.Principal, appID int64, name string,
+		scopes []string, expiresAt time.Time) (pat models.PAT, token string, err error)
+	ListPATs(ctx context.Context, actorID int64, userID int64) (pats []models.PAT, err error)
+	RevokePAT(ctx context.Context, actorID int64, userID int64, patID int64) error
+	GetLoginHistory(ctx context.Context, actorID int64, userID int64,
+		limit int, cursor string) (attempts []models.LoginAttempt, next string, err error)
+	CreateServiceAccount(ctx context.Context, actorID int64,
+		account models.ServiceAccount) (created models.ServiceAccount, secret string, err error)
+	GetServiceAccount(ctx context.Context, actorID int64, accountID int64) (account models.ServiceAccount, err error)
+	ListServiceAccounts(ctx context.Context, actorID int64, limit int,
+		cursor string) (accounts []models.ServiceAccount, next string, err error)
+	UpdateServiceAccount(ctx context.Context, actorID int64, accountID int64,
+		upd auth.ServiceAccountUpdate) (account models.ServiceAccount, err error)
+	DeleteServiceAccount(ctx context.Context, actorID int64, accountID int64) error
+	RotateServiceAccountSecret(ctx context.Context, actorID int64, accountID int64) (secret string, err error)
+	AddServiceAccountKey(ctx context.Context, actorID int64, accountID int64,
+		publicKey string) (key models.ServiceAccountKey, err error)
+	ListServiceAccountKeys(ctx context.Context, actorID int64, accountID int64) (keys []models.ServiceAccountKey, err error)
+	DeleteServiceAccountKey(ctx context.Context, actorID int64, accountID int64, keyID string) error
+	ServiceAccountToken(ctx context.Context, req auth.ServiceAccountTokenRequest) (token models.ServiceAccountToken, err error)
+	ListIdentityProviders(orgID int64) (providers []models.IdentityProvider)
+	StartFederatedLogin(ctx context.Context, providerID string, appID int64) (authorizationURL string, err error)
+	CompleteFederatedLogin(ctx context.Context, state string, code string) (result models.LoginResult, err error)
+	ListIdentities(ctx context.Context, actorID int64, userID int64) (identities []models.Identity, err error)
 }
 
 type serverAPI struct {
@@ -37,18 +91,43 @@ func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.
 	if req.GetPassword() == "" {
 		return nil, status.Error(codes.InvalidArgument, "Password is empty")
 	}
-	if req.GetAppId() == emptyValue {
-		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
-	}
-	token, err := s.auth.Login(ctx, req.Email, req.Password, int64(req.AppId))
+	ctx, deviceID := withDevice(ctx)
+
+	result, err := s.auth.Login(ctx, req.Email, req.Password, int64(req.AppId), req.GetScopes(), req.GetConsent())
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.NotFound, "Invalid credentials")
 		}
+		if errors.Is(err, auth.ErrInvalidScope) {
+			return nil, status.Error(codes.InvalidArgument, "Invalid scope")
+		}
+		if errors.Is(err, auth.ErrConsentRequired) {
+			return nil, status.Error(codes.FailedPrecondition, "Consent required")
+		}
+		if errors.Is(err, auth.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "Account is disabled")
+		}
+		if errors.Is(err, auth.ErrUserLocked) {
+			return nil, status.Error(codes.FailedPrecondition, "Account is locked")
+		}
+		if errors.Is(err, auth.ErrUserNotVerified) {
+			return nil, status.Error(codes.Unauthenticated, "Account is pending verification")
+		}
+		if errors.Is(err, auth.ErrLoginDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Login denied")
+		}
+		if errors.Is(err, auth.ErrStepUpRequired) {
+			return nil, stepUpStatus()
+		}
 		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
 	}
 
-	return &ssov1.LoginResponse{Token: token}, nil
+	return &ssov1.LoginResponse{
+		Token:                  result.Token,
+		PasswordChangeRequired: result.PasswordChangeRequired,
+		DeviceId:               deviceID,
+		StepUpRequired:         result.StepUpRequired,
+	}, nil
 }
 
 /* func (s *serverAPI) Logout(ctx context.Context, req *ssov1.LogoutRequest) (*ssov1.LogoutResponse, error) {
@@ -83,26 +162,222 @@ func (s *serverAPI) Register(ctx context.Context, req *ssov1.RegisterRequest) (*
 		if errors.Is(err, auth.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("User already exist with email: %s", req.GetEmail()))
 		}
+		if errors.Is(err, auth.ErrWeakPassword) {
+			return nil, weakPasswordStatus(err)
+		}
 		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
 	}
 	return &ssov1.RegisterResponse{UserId: userId}, nil
 }
 
 func (s *serverAPI) CreateApp(ctx context.Context, req *ssov1.CreateAppRequest) (*ssov1.CreateAppResponse, error) {
+	principal, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
 	if req.GetName() == "" {
 		return nil, status.Error(codes.InvalidArgument, "Name is empty")
 	}
-	if req.GetSecret() == "" {
-		return nil, status.Error(codes.InvalidArgument, "Secret is empty")
-	}
-	appId, err := s.auth.CreateApp(ctx, req.Name, req.Secret)
+	appId, secret, err := s.auth.CreateApp(ctx, principal.UserID, req.Name, req.GetScopes())
 	if err != nil {
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+		if errors.Is(err, auth.ErrInvalidScope) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		if errors.Is(err, auth.ErrAppExist) {
 			return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("App already exist with email: %s", req.GetName()))
 		}
 		return nil, status.Errorf(codes.Internal, "Iternal error: "+err.Error())
 	}
-	return &ssov1.CreateAppResponse{AppId: appId}, nil
+	return &ssov1.CreateAppResponse{AppId: appId, Secret: secret}, nil
+}
+
+func (s *serverAPI) ListConsents(ctx context.Context, req *ssov1.ListConsentsRequest) (*ssov1.ListConsentsResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	consents, err := s.auth.ListConsents(ctx, actor.UserID, sessionUser(actor, req.GetUserId()))
+	if err != nil {
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	resp := &ssov1.ListConsentsResponse{Consents: make([]*ssov1.Consent, 0, len(consents))}
+	for _, c := range consents {
+		resp.Consents = append(resp.Consents, &ssov1.Consent{
+			AppId:     c.AppID,
+			Scopes:    c.Scopes,
+			GrantedAt: timestamppb.New(c.GrantedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeConsent(ctx context.Context, req *ssov1.RevokeConsentRequest) (*ssov1.RevokeConsentResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	if err := s.auth.RevokeConsent(ctx, actor.UserID, sessionUser(actor, req.GetUserId()), req.GetAppId()); err != nil {
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+		if errors.Is(err, auth.ErrConsentNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("Consent not found for app: %d", req.GetAppId()))
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.RevokeConsentResponse{Success: true}, nil
+}
+
+func (s *serverAPI) IntrospectToken(ctx context.Context, req *ssov1.IntrospectTokenRequest) (*ssov1.IntrospectTokenResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Token is empty")
+	}
+
+	principal, active, err := s.auth.IntrospectToken(ctx, req.GetToken())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+	if !active {
+		return &ssov1.IntrospectTokenResponse{Active: false}, nil
+	}
+
+	resp := &ssov1.IntrospectTokenResponse{
+		Active:    true,
+		UserId:    principal.UserID,
+		Email:     principal.Email,
+		AppId:     principal.AppID,
+		Scopes:    principal.Scopes,
+		ExpiresAt: timestamppb.New(principal.ExpiresAt),
+		Acr:       principal.ACR,
+		Amr:       principal.AMR,
+		PatId:     principal.PATID,
+
+		ServiceAccountId: principal.ServiceAccountID,
+		Roles:            principal.Roles,
+	}
+	if !principal.AuthTime.IsZero() {
+		resp.AuthTime = timestamppb.New(principal.AuthTime)
+	}
+	if principal.Actor != nil {
+		resp.Act = actorToProto(principal.Actor)
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ChangePassword(ctx context.Context, req *ssov1.ChangePasswordRequest) (*ssov1.ChangePasswordResponse, error) {
+	principal, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetOldPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Old password is empty")
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "New password is empty")
+	}
+
+	if err := s.auth.ChangePassword(ctx, principal.UserID, principal.SessionID, req.GetOldPassword(),
+		req.GetNewPassword()); err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.PermissionDenied, "Invalid credentials")
+		}
+		if errors.Is(err, auth.ErrWeakPassword) {
+			return nil, weakPasswordStatus(err)
+		}
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("User not found with id: %d", principal.UserID))
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.ChangePasswordResponse{Success: true}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(ctx context.Context, req *ssov1.RequestPasswordResetRequest) (*ssov1.RequestPasswordResetResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Email is empty")
+	}
+
+	if err := s.auth.RequestPasswordReset(ctx, req.GetEmail()); err != nil {
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.RequestPasswordResetResponse{Success: true}, nil
+}
+
+func (s *serverAPI) ResetPassword(ctx context.Context, req *ssov1.ResetPasswordRequest) (*ssov1.ResetPasswordResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Token is empty")
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "New password is empty")
+	}
+
+	if err := s.auth.ResetPassword(ctx, req.GetToken(), req.GetNewPassword()); err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return nil, status.Error(codes.InvalidArgument, "Invalid or expired reset token")
+		}
+		if errors.Is(err, auth.ErrWeakPassword) {
+			return nil, weakPasswordStatus(err)
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.ResetPasswordResponse{Success: true}, nil
+}
+
+// weakPasswordStatus returns InvalidArgument with a field violation of the
+// password per broken rule.
+func weakPasswordStatus(err error) error {
+	st := status.New(codes.InvalidArgument, "Password doesn't meet the policy")
+
+	var policyErr *password.PolicyError
+	if !errors.As(err, &policyErr) {
+		return st.Err()
+	}
+
+	details := &errdetails.BadRequest{}
+	for _, v := range policyErr.Violations {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "password",
+			Description: v.Rule + ": " + v.Description,
+		})
+	}
+
+	withDetails, detailsErr := st.WithDetails(details)
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
 }
 
 // implement delete user from db
+
+// stepUpStatus tells the client the login needs a second factor, the
+// ErrorInfo reason tells it apart from other failed preconditions.
+func stepUpStatus() error {
+	st := status.New(codes.FailedPrecondition, "Step-up authentication required")
+
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{Reason: "STEP_UP_REQUIRED", Domain: "sso"})
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
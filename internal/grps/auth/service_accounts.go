@@ -0,0 +1,302 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) CreateServiceAccount(ctx context.Context,
+	req *ssov1.CreateServiceAccountRequest) (*ssov1.CreateServiceAccountResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Name is empty")
+	}
+
+	account, secret, err := s.auth.CreateServiceAccount(ctx, actor.UserID, models.ServiceAccount{
+		Name:  req.GetName(),
+		AppID: req.GetAppId(),
+		OrgID: req.GetOrgId(),
+		Roles: req.GetRoles(),
+	})
+	if err != nil {
+		if errors.Is(err, auth.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("App not found with id: %d", req.GetAppId()))
+		}
+		return nil, serviceAccountStatus(err)
+	}
+
+	return &ssov1.CreateServiceAccountResponse{
+		ServiceAccount: serviceAccountToProto(account),
+		ClientSecret:   secret,
+	}, nil
+}
+
+func (s *serverAPI) GetServiceAccount(ctx context.Context,
+	req *ssov1.GetServiceAccountRequest) (*ssov1.GetServiceAccountResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetServiceAccountId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Service_account_id is empty")
+	}
+
+	account, err := s.auth.GetServiceAccount(ctx, actor.UserID, req.GetServiceAccountId())
+	if err != nil {
+		return nil, serviceAccountStatus(err)
+	}
+
+	return &ssov1.GetServiceAccountResponse{ServiceAccount: serviceAccountToProto(account)}, nil
+}
+
+func (s *serverAPI) ListServiceAccounts(ctx context.Context,
+	req *ssov1.ListServiceAccountsRequest) (*ssov1.ListServiceAccountsResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	accounts, next, err := s.auth.ListServiceAccounts(ctx, actor.UserID, int(req.GetPageSize()), req.GetCursor())
+	if err != nil {
+		return nil, serviceAccountStatus(err)
+	}
+
+	resp := &ssov1.ListServiceAccountsResponse{
+		ServiceAccounts: make([]*ssov1.ServiceAccount, 0, len(accounts)),
+		NextCursor:      next,
+	}
+	for _, account := range accounts {
+		resp.ServiceAccounts = append(resp.ServiceAccounts, serviceAccountToProto(account))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) UpdateServiceAccount(ctx context.Context,
+	req *ssov1.UpdateServiceAccountRequest) (*ssov1.UpdateServiceAccountResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetServiceAccountId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Service_account_id is empty")
+	}
+
+	var upd auth.ServiceAccountUpdate
+	if req.GetName() != nil {
+		name := req.GetName().GetValue()
+		if name == "" {
+			return nil, status.Error(codes.InvalidArgument, "Name is empty")
+		}
+		upd.Name = &name
+	}
+	if req.GetRoles() != nil {
+		roles := req.GetRoles().GetRoles()
+		upd.Roles = &roles
+	}
+	if req.GetDisabled() != nil {
+		disabled := req.GetDisabled().GetValue()
+		upd.Disabled = &disabled
+	}
+
+	account, err := s.auth.UpdateServiceAccount(ctx, actor.UserID, req.GetServiceAccountId(), upd)
+	if err != nil {
+		return nil, serviceAccountStatus(err)
+	}
+
+	return &ssov1.UpdateServiceAccountResponse{ServiceAccount: serviceAccountToProto(account)}, nil
+}
+
+func (s *serverAPI) DeleteServiceAccount(ctx context.Context,
+	req *ssov1.DeleteServiceAccountRequest) (*ssov1.DeleteServiceAccountResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetServiceAccountId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Service_account_id is empty")
+	}
+
+	if err := s.auth.DeleteServiceAccount(ctx, actor.UserID, req.GetServiceAccountId()); err != nil {
+		return nil, serviceAccountStatus(err)
+	}
+
+	return &ssov1.DeleteServiceAccountResponse{Success: true}, nil
+}
+
+func (s *serverAPI) RotateServiceAccountSecret(ctx context.Context,
+	req *ssov1.RotateServiceAccountSecretRequest) (*ssov1.RotateServiceAccountSecretResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetServiceAccountId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Service_account_id is empty")
+	}
+
+	secret, err := s.auth.RotateServiceAccountSecret(ctx, actor.UserID, req.GetServiceAccountId())
+	if err != nil {
+		return nil, serviceAccountStatus(err)
+	}
+
+	return &ssov1.RotateServiceAccountSecretResponse{ClientSecret: secret}, nil
+}
+
+func (s *serverAPI) AddServiceAccountKey(ctx context.Context,
+	req *ssov1.AddServiceAccountKeyRequest) (*ssov1.AddServiceAccountKeyResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetServiceAccountId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Service_account_id is empty")
+	}
+	if req.GetPublicKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Public_key is empty")
+	}
+
+	key, err := s.auth.AddServiceAccountKey(ctx, actor.UserID, req.GetServiceAccountId(), req.GetPublicKey())
+	if err != nil {
+		return nil, serviceAccountStatus(err)
+	}
+
+	return &ssov1.AddServiceAccountKeyResponse{Key: serviceAccountKeyToProto(key)}, nil
+}
+
+func (s *serverAPI) ListServiceAccountKeys(ctx context.Context,
+	req *ssov1.ListServiceAccountKeysRequest) (*ssov1.ListServiceAccountKeysResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetServiceAccountId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Service_account_id is empty")
+	}
+
+	keys, err := s.auth.ListServiceAccountKeys(ctx, actor.UserID, req.GetServiceAccountId())
+	if err != nil {
+		return nil, serviceAccountStatus(err)
+	}
+
+	resp := &ssov1.ListServiceAccountKeysResponse{Keys: make([]*ssov1.ServiceAccountKey, 0, len(keys))}
+	for _, key := range keys {
+		resp.Keys = append(resp.Keys, serviceAccountKeyToProto(key))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) DeleteServiceAccountKey(ctx context.Context,
+	req *ssov1.DeleteServiceAccountKeyRequest) (*ssov1.DeleteServiceAccountKeyResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetServiceAccountId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Service_account_id is empty")
+	}
+	if req.GetKeyId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Key_id is empty")
+	}
+
+	if err := s.auth.DeleteServiceAccountKey(ctx, actor.UserID, req.GetServiceAccountId(), req.GetKeyId()); err != nil {
+		return nil, serviceAccountStatus(err)
+	}
+
+	return &ssov1.DeleteServiceAccountKeyResponse{Success: true}, nil
+}
+
+func (s *serverAPI) ServiceAccountToken(ctx context.Context,
+	req *ssov1.ServiceAccountTokenRequest) (*ssov1.ServiceAccountTokenResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if req.GetClientAssertion() == "" {
+		if req.GetServiceAccountId() == emptyValue {
+			return nil, status.Error(codes.InvalidArgument, "Service_account_id is empty")
+		}
+		if req.GetClientSecret() == "" {
+			return nil, status.Error(codes.InvalidArgument, "Client_secret is empty")
+		}
+	}
+
+	issued, err := s.auth.ServiceAccountToken(ctx, auth.ServiceAccountTokenRequest{
+		ServiceAccountID:    req.GetServiceAccountId(),
+		ClientSecret:        req.GetClientSecret(),
+		ClientAssertion:     req.GetClientAssertion(),
+		ClientAssertionType: req.GetClientAssertionType(),
+		AppID:               req.GetAppId(),
+		Scopes:              req.GetScopes(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidClientCredentials):
+			return nil, status.Error(codes.Unauthenticated, "Invalid client credentials")
+		case errors.Is(err, auth.ErrUnsupportedAssertionType):
+			return nil, status.Error(codes.InvalidArgument, "Unsupported client assertion type")
+		case errors.Is(err, auth.ErrInvalidScope):
+			return nil, status.Error(codes.InvalidArgument, "Invalid scope")
+		case errors.Is(err, auth.ErrPermissionDenied):
+			return nil, status.Error(codes.PermissionDenied, "Service account is owned by another app")
+		case errors.Is(err, auth.ErrAppNotFound):
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("App not found with id: %d", req.GetAppId()))
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.ServiceAccountTokenResponse{
+		AccessToken: issued.Token,
+		TokenType:   "Bearer",
+		ExpiresAt:   timestamppb.New(issued.ExpiresAt),
+		Scopes:      issued.Scopes,
+	}, nil
+}
+
+func serviceAccountToProto(account models.ServiceAccount) *ssov1.ServiceAccount {
+	return &ssov1.ServiceAccount{
+		Id:        account.ID,
+		Name:      account.Name,
+		AppId:     account.AppID,
+		OrgId:     account.OrgID,
+		Roles:     account.Roles,
+		Disabled:  account.Disabled,
+		CreatedAt: timestamppb.New(account.CreatedAt),
+	}
+}
+
+func serviceAccountKeyToProto(key models.ServiceAccountKey) *ssov1.ServiceAccountKey {
+	return &ssov1.ServiceAccountKey{
+		Id:               key.ID,
+		ServiceAccountId: key.ServiceAccountID,
+		PublicKey:        key.PublicKey,
+		CreatedAt:        timestamppb.New(key.CreatedAt),
+	}
+}
+
+func serviceAccountStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	case errors.Is(err, auth.ErrServiceAccountNotFound):
+		return status.Error(codes.NotFound, "Service account not found")
+	case errors.Is(err, auth.ErrServiceAccountKeyNotFound):
+		return status.Error(codes.NotFound, "Service account key not found")
+	case errors.Is(err, auth.ErrInvalidServiceAccount), errors.Is(err, auth.ErrInvalidRole),
+		errors.Is(err, auth.ErrInvalidPublicKey), errors.Is(err, auth.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return status.Error(codes.Internal, "Iternal error: "+err.Error())
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) ListSessions(ctx context.Context, req *ssov1.ListSessionsRequest) (*ssov1.ListSessionsResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	sessions, err := s.auth.ListSessions(ctx, actor.UserID, sessionUser(actor, req.GetUserId()))
+	if err != nil {
+		return nil, sessionStatus(err)
+	}
+
+	resp := &ssov1.ListSessionsResponse{Sessions: make([]*ssov1.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, sessionToProto(session))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) RevokeSession(ctx context.Context, req *ssov1.RevokeSessionRequest) (*ssov1.RevokeSessionResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Session_id is empty")
+	}
+
+	if err := s.auth.RevokeSession(ctx, actor.UserID, sessionUser(actor, req.GetUserId()), req.GetSessionId()); err != nil {
+		return nil, sessionStatus(err)
+	}
+
+	return &ssov1.RevokeSessionResponse{Success: true}, nil
+}
+
+func (s *serverAPI) RevokeAllSessions(ctx context.Context, req *ssov1.RevokeAllSessionsRequest) (*ssov1.RevokeAllSessionsResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	userID := sessionUser(actor, req.GetUserId())
+
+	var exceptID string
+	if req.GetKeepCurrent() && userID == actor.UserID {
+		exceptID = actor.SessionID
+	}
+
+	revoked, err := s.auth.RevokeAllSessions(ctx, actor.UserID, userID, exceptID)
+	if err != nil {
+		return nil, sessionStatus(err)
+	}
+
+	return &ssov1.RevokeAllSessionsResponse{Revoked: revoked}, nil
+}
+
+// sessionUser returns the user whose sessions are managed, 0 is the caller.
+func sessionUser(actor models.Principal, userID int64) int64 {
+	if userID == emptyValue {
+		return actor.UserID
+	}
+
+	return userID
+}
+
+func sessionToProto(session models.Session) *ssov1.Session {
+	return &ssov1.Session{
+		Id:         session.ID,
+		UserId:     session.UserID,
+		AppId:      session.AppID,
+		DeviceId:   session.DeviceID,
+		Ip:         session.IP,
+		UserAgent:  session.UserAgent,
+		CreatedAt:  timestamppb.New(session.CreatedAt),
+		LastSeenAt: timestamppb.New(session.LastSeenAt),
+		ExpiresAt:  timestamppb.New(session.ExpiresAt),
+		ActorId:    session.ActorID,
+	}
+}
+
+func sessionStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	case errors.Is(err, auth.ErrSessionNotFound):
+		return status.Error(codes.NotFound, "Session not found")
+	}
+
+	return status.Error(codes.Internal, "Iternal error: "+err.Error())
+}
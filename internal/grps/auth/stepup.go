@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/auth"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *serverAPI) StepUp(ctx context.Context, req *ssov1.StepUpRequest) (*ssov1.StepUpResponse, error) {
+	principal, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Password is empty")
+	}
+	if req.GetTotpCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Totp_code is empty")
+	}
+
+	token, expiresAt, err := s.auth.StepUp(ctx, principal, req.GetPassword(), req.GetTotpCode())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrInvalidTOTPCode):
+			return nil, status.Error(codes.NotFound, "Invalid credentials")
+		case errors.Is(err, auth.ErrTOTPNotEnrolled):
+			return nil, status.Error(codes.FailedPrecondition, "Authenticator not enrolled")
+		case errors.Is(err, auth.ErrSessionRequired):
+			return nil, status.Error(codes.FailedPrecondition, "Token has no session")
+		case errors.Is(err, auth.ErrInvalidToken):
+			return nil, status.Error(codes.Unauthenticated, "Invalid token")
+		case errors.Is(err, auth.ErrUserDisabled):
+			return nil, status.Error(codes.PermissionDenied, "Account is disabled")
+		case errors.Is(err, auth.ErrUserLocked):
+			return nil, status.Error(codes.FailedPrecondition, "Account is locked")
+		case errors.Is(err, auth.ErrUserNotVerified):
+			return nil, status.Error(codes.Unauthenticated, "Account is pending verification")
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.StepUpResponse{Token: token, ExpiresAt: timestamppb.New(expiresAt)}, nil
+}
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *ssov1.EnrollTOTPRequest) (*ssov1.EnrollTOTPResponse, error) {
+	principal, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+
+	enrollment, err := s.auth.EnrollTOTP(ctx, principal.UserID)
+	if err != nil {
+		return nil, totpStatus(err)
+	}
+
+	return &ssov1.EnrollTOTPResponse{Secret: enrollment.Secret, Url: enrollment.URL}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *ssov1.ConfirmTOTPRequest) (*ssov1.ConfirmTOTPResponse, error) {
+	principal, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Code is empty")
+	}
+
+	if err := s.auth.ConfirmTOTP(ctx, principal.UserID, req.GetCode()); err != nil {
+		return nil, totpStatus(err)
+	}
+
+	return &ssov1.ConfirmTOTPResponse{}, nil
+}
+
+func totpStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrTOTPExist):
+		return status.Error(codes.AlreadyExists, "Authenticator already enrolled")
+	case errors.Is(err, auth.ErrTOTPNotEnrolled):
+		return status.Error(codes.FailedPrecondition, "Authenticator not enrolled")
+	case errors.Is(err, auth.ErrInvalidTOTPCode):
+		return status.Error(codes.InvalidArgument, "Invalid code")
+	case errors.Is(err, auth.ErrInvalidToken):
+		return status.Error(codes.Unauthenticated, "Invalid token")
+	}
+	return status.Error(codes.Internal, "Iternal error: "+err.Error())
+}
@@ -0,0 +1,187 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/grps/interceptors"
+	"sso/internal/services/authz"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const emptyValue = 0
+
+type Authz interface {
+	AuthorizeCaller(ctx context.Context, caller models.Principal, appID int64, userID int64, action string,
+		user map[string]any, resource map[string]any, reqCtx map[string]any) (decision models.Decision, err error)
+	CreatePolicy(ctx context.Context, actorID int64, policy models.Policy) (policyID int64, err error)
+	Policies(ctx context.Context, actorID int64, appID int64) (policies []models.Policy, err error)
+	DeletePolicy(ctx context.Context, actorID int64, appID int64, policyID int64) error
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAuthzServer
+	authz Authz
+}
+
+func RegisterServ(gRPC *grpc.Server, authz Authz) {
+	ssov1.RegisterAuthzServer(gRPC, &serverAPI{authz: authz})
+}
+
+func (s *serverAPI) Authorize(ctx context.Context, req *ssov1.AuthorizeRequest) (*ssov1.AuthorizeResponse, error) {
+	caller, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if req.GetAction() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Action is empty")
+	}
+
+	decision, err := s.authz.AuthorizeCaller(ctx, caller, req.GetAppId(), req.GetUserId(), req.GetAction(),
+		req.GetUser().AsMap(), req.GetResource().AsMap(), req.GetContext().AsMap())
+	if err != nil {
+		if errors.Is(err, authz.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+		if errors.Is(err, authz.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("User not found with id: %d", req.GetUserId()))
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.AuthorizeResponse{
+		Allowed:    decision.Allowed,
+		PolicyId:   decision.Policy.ID,
+		PolicyName: decision.Policy.Name,
+	}, nil
+}
+
+func (s *serverAPI) CreatePolicy(ctx context.Context, req *ssov1.CreatePolicyRequest) (*ssov1.CreatePolicyResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	policy := req.GetPolicy()
+	if policy.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if policy.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Name is empty")
+	}
+	if policy.GetEffect() == ssov1.Effect_EFFECT_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "Effect is empty")
+	}
+	if policy.GetExpression() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Expression is empty")
+	}
+
+	policyId, err := s.authz.CreatePolicy(ctx, actor.UserID, policyFromProto(policy))
+	if err != nil {
+		if errors.Is(err, authz.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+		if errors.Is(err, authz.ErrInvalidPolicy) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, authz.ErrPolicyExist) {
+			return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("Policy already exist with name: %s", policy.GetName()))
+		}
+		if errors.Is(err, authz.ErrInvalidAppID) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("App not found with id: %d", policy.GetAppId()))
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.CreatePolicyResponse{PolicyId: policyId}, nil
+}
+
+func (s *serverAPI) ListPolicies(ctx context.Context, req *ssov1.ListPoliciesRequest) (*ssov1.ListPoliciesResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	policies, err := s.authz.Policies(ctx, actor.UserID, req.GetAppId())
+	if err != nil {
+		if errors.Is(err, authz.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	resp := &ssov1.ListPoliciesResponse{Policies: make([]*ssov1.Policy, 0, len(policies))}
+	for _, p := range policies {
+		resp.Policies = append(resp.Policies, policyToProto(p))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) DeletePolicy(ctx context.Context, req *ssov1.DeletePolicyRequest) (*ssov1.DeletePolicyResponse, error) {
+	actor, ok := interceptors.Principal(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Token is required")
+	}
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if req.GetPolicyId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "Policy_id is empty")
+	}
+
+	if err := s.authz.DeletePolicy(ctx, actor.UserID, req.GetAppId(), req.GetPolicyId()); err != nil {
+		if errors.Is(err, authz.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+		if errors.Is(err, authz.ErrPolicyNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("Policy not found with id: %d", req.GetPolicyId()))
+		}
+		return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+	}
+
+	return &ssov1.DeletePolicyResponse{Success: true}, nil
+}
+
+func policyFromProto(p *ssov1.Policy) models.Policy {
+	effect := models.EffectAllow
+	if p.GetEffect() == ssov1.Effect_EFFECT_DENY {
+		effect = models.EffectDeny
+	}
+
+	return models.Policy{
+		AppID:      p.GetAppId(),
+		Name:       p.GetName(),
+		Effect:     effect,
+		Actions:    p.GetActions(),
+		Expression: p.GetExpression(),
+		Priority:   p.GetPriority(),
+	}
+}
+
+func policyToProto(p models.Policy) *ssov1.Policy {
+	effect := ssov1.Effect_EFFECT_ALLOW
+	if p.Effect == models.EffectDeny {
+		effect = ssov1.Effect_EFFECT_DENY
+	}
+
+	return &ssov1.Policy{
+		Id:         p.ID,
+		AppId:      p.AppID,
+		Name:       p.Name,
+		Effect:     effect,
+		Actions:    p.Actions,
+		Expression: p.Expression,
+		Priority:   p.Priority,
+	}
+}
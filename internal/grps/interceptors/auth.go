@@ -0,0 +1,138 @@
+package interceptors
+
+import (
+	"context"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type Authenticator interface {
+	ValidateToken(ctx context.Context, token string) (principal models.Principal, err error)
+}
+
+type principalKey struct{}
+
+// appTokenMethods are the methods that accept a token of an app rather than
+// of the SSO itself. Any app holding its secret can sign its own tokens, so
+// the other methods only trust tokens of the SSO, see models.SSOAppID. A
+// personal access token is a token of its app too, a leaked one can't reach
+// the account or admin methods.
+var appTokenMethods = map[string]bool{
+	ssov1.Auth_ChangePassword_FullMethodName:   true,
+	ssov1.Auth_StepUp_FullMethodName:           true,
+	ssov1.Auth_EndImpersonation_FullMethodName: true,
+	ssov1.Auth_TokenExchange_FullMethodName:    true,
+	ssov1.Authz_Authorize_FullMethodName:       true,
+	ssov1.Relations_Check_FullMethodName:       true,
+	ssov1.Relations_Expand_FullMethodName:      true,
+	ssov1.Relations_ListObjects_FullMethodName: true,
+}
+
+// actorForbidden are the methods a token with an actor, e.g. of an
+// impersonating admin, can't call on behalf of the user.
+var actorForbidden = map[string]bool{
+	ssov1.Auth_ChangePassword_FullMethodName:    true,
+	ssov1.Auth_StepUp_FullMethodName:            true,
+	ssov1.Auth_RevokeAllSessions_FullMethodName: true,
+	ssov1.Auth_CreatePAT_FullMethodName:         true,
+	ssov1.Auth_EnrollTOTP_FullMethodName:        true,
+	ssov1.Auth_ConfirmTOTP_FullMethodName:       true,
+}
+
+// patForbidden are the app methods a personal access token can't call, a
+// leaked token must not take over the account.
+var patForbidden = map[string]bool{
+	ssov1.Auth_ChangePassword_FullMethodName:   true,
+	ssov1.Auth_StepUp_FullMethodName:           true,
+	ssov1.Auth_EndImpersonation_FullMethodName: true,
+}
+
+// serviceAccountForbidden are the methods of users a service account can't
+// call, it has no password, sessions or personal access tokens.
+var serviceAccountForbidden = map[string]bool{
+	ssov1.Auth_ChangePassword_FullMethodName:    true,
+	ssov1.Auth_StepUp_FullMethodName:            true,
+	ssov1.Auth_ListSessions_FullMethodName:      true,
+	ssov1.Auth_RevokeSession_FullMethodName:     true,
+	ssov1.Auth_RevokeAllSessions_FullMethodName: true,
+	ssov1.Auth_GetLoginHistory_FullMethodName:   true,
+	ssov1.Auth_Impersonate_FullMethodName:       true,
+	ssov1.Auth_EndImpersonation_FullMethodName:  true,
+	ssov1.Auth_CreatePAT_FullMethodName:         true,
+	ssov1.Auth_ListPATs_FullMethodName:          true,
+	ssov1.Auth_RevokePAT_FullMethodName:         true,
+	ssov1.Auth_ListIdentities_FullMethodName:    true,
+	ssov1.Auth_EnrollTOTP_FullMethodName:        true,
+	ssov1.Auth_ConfirmTOTP_FullMethodName:       true,
+}
+
+// Auth validates the bearer token from the "authorization" metadata and puts
+// its owner into the context. Requests without a token pass through, the
+// handlers that need a caller check for it with Principal. Tokens of apps are
+// only accepted by appTokenMethods. A token issued for
+// a required password change only lets the caller change the password, one
+// issued for a required step-up only lets the caller step up.
+func Auth(authenticator Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		token := BearerToken(ctx)
+		if token == "" {
+			return handler(ctx, req)
+		}
+
+		principal, err := authenticator.ValidateToken(ctx, token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "Invalid token")
+		}
+
+		if !principal.SSO() && !appTokenMethods[info.FullMethod] {
+			return nil, status.Error(codes.Unauthenticated, "Token is not for the SSO")
+		}
+		if principal.PasswordChangeOnly && info.FullMethod != ssov1.Auth_ChangePassword_FullMethodName {
+			return nil, status.Error(codes.PermissionDenied, "Password change required")
+		}
+		if principal.StepUpOnly && info.FullMethod != ssov1.Auth_StepUp_FullMethodName {
+			return nil, status.Error(codes.PermissionDenied, "Step-up required")
+		}
+		if principal.Actor != nil && actorForbidden[info.FullMethod] {
+			return nil, status.Error(codes.PermissionDenied, "Not allowed on behalf of the user")
+		}
+		if principal.PATID != 0 && patForbidden[info.FullMethod] {
+			return nil, status.Error(codes.PermissionDenied, "Not allowed with a personal access token")
+		}
+		if principal.ServiceAccountID != 0 && serviceAccountForbidden[info.FullMethod] {
+			return nil, status.Error(codes.PermissionDenied, "Not allowed for a service account")
+		}
+
+		return handler(context.WithValue(ctx, principalKey{}, principal), req)
+	}
+}
+
+// Principal returns the caller authenticated by the Auth interceptor.
+func Principal(ctx context.Context) (models.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(models.Principal)
+
+	return principal, ok
+}
+
+// BearerToken returns the token of the "authorization: Bearer <token>"
+// metadata, or an empty string.
+func BearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	for _, v := range md.Get("authorization") {
+		if token, found := strings.CutPrefix(v, "Bearer "); found {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,148 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeAuthenticator struct {
+	principal models.Principal
+	err       error
+}
+
+func (a fakeAuthenticator) ValidateToken(context.Context, string) (models.Principal, error) {
+	return a.principal, a.err
+}
+
+func TestAuth(t *testing.T) {
+	sso := models.Principal{UserID: 7, AppID: models.SSOAppID, SessionID: "s1"}
+	app := models.Principal{UserID: 7, AppID: 2, SessionID: "s1"}
+
+	tests := []struct {
+		name          string
+		token         string
+		authenticator fakeAuthenticator
+		method        string
+		wantCode      codes.Code
+		wantPrincipal bool
+	}{
+		{
+			name:     "no token",
+			method:   ssov1.Auth_ListSessions_FullMethodName,
+			wantCode: codes.OK,
+		},
+		{
+			name:          "invalid token",
+			token:         "t",
+			authenticator: fakeAuthenticator{err: errors.New("invalid token")},
+			method:        ssov1.Auth_ListSessions_FullMethodName,
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:          "sso token",
+			token:         "t",
+			authenticator: fakeAuthenticator{principal: sso},
+			method:        ssov1.Auth_ListSessions_FullMethodName,
+			wantCode:      codes.OK,
+			wantPrincipal: true,
+		},
+		{
+			name:          "app token on an sso method",
+			token:         "t",
+			authenticator: fakeAuthenticator{principal: app},
+			method:        ssov1.Admin_SetAdmin_FullMethodName,
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:          "app token on an app method",
+			token:         "t",
+			authenticator: fakeAuthenticator{principal: app},
+			method:        ssov1.Auth_StepUp_FullMethodName,
+			wantCode:      codes.OK,
+			wantPrincipal: true,
+		},
+		{
+			name:          "service account token on an sso method",
+			token:         "t",
+			authenticator: fakeAuthenticator{principal: models.Principal{AppID: 2, ServiceAccountID: 3}},
+			method:        ssov1.Auth_CreateApp_FullMethodName,
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:          "personal access token on an admin method",
+			token:         "t",
+			authenticator: fakeAuthenticator{principal: models.Principal{UserID: 7, AppID: 2, PATID: 4}},
+			method:        ssov1.Admin_SetUserStatus_FullMethodName,
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:          "personal access token on an app method",
+			token:         "t",
+			authenticator: fakeAuthenticator{principal: models.Principal{UserID: 7, AppID: 2, PATID: 4}},
+			method:        ssov1.Authz_Authorize_FullMethodName,
+			wantCode:      codes.OK,
+			wantPrincipal: true,
+		},
+		{
+			name:          "personal access token changing the password",
+			token:         "t",
+			authenticator: fakeAuthenticator{principal: models.Principal{UserID: 7, AppID: 2, PATID: 4}},
+			method:        ssov1.Auth_ChangePassword_FullMethodName,
+			wantCode:      codes.PermissionDenied,
+		},
+		{
+			name:          "step-up only token",
+			token:         "t",
+			authenticator: fakeAuthenticator{principal: models.Principal{UserID: 7, AppID: 2, StepUpOnly: true}},
+			method:        ssov1.Auth_ChangePassword_FullMethodName,
+			wantCode:      codes.PermissionDenied,
+		},
+		{
+			name:  "impersonating admin",
+			token: "t",
+			authenticator: fakeAuthenticator{principal: models.Principal{
+				UserID: 7, AppID: models.SSOAppID, Actor: &models.Actor{UserID: 1},
+			}},
+			method:   ssov1.Auth_RevokeAllSessions_FullMethodName,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:  "impersonating admin enrolling an authenticator",
+			token: "t",
+			authenticator: fakeAuthenticator{principal: models.Principal{
+				UserID: 7, AppID: models.SSOAppID, Actor: &models.Actor{UserID: 1},
+			}},
+			method:   ssov1.Auth_EnrollTOTP_FullMethodName,
+			wantCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tt.token))
+			}
+
+			var gotPrincipal bool
+			handler := func(ctx context.Context, req any) (any, error) {
+				_, gotPrincipal = Principal(ctx)
+				return nil, nil
+			}
+
+			_, err := Auth(tt.authenticator)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			require.Equal(t, tt.wantCode, status.Code(err), err)
+			assert.Equal(t, tt.wantPrincipal, gotPrincipal)
+		})
+	}
+}
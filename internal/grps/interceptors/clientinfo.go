@@ -0,0 +1,27 @@
+package interceptors
+
+import (
+	"context"
+	"sso/internal/lib/clientinfo"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ClientInfo puts the caller IP, user agent and the "x-device-id" metadata
+// into the context, see ClientIP for trustProxy.
+func ClientInfo(trustProxy bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		client := clientinfo.Info{IP: ClientIP(ctx, trustProxy)}
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ua := md.Get("user-agent"); len(ua) > 0 {
+				client.UserAgent = ua[0]
+			}
+			if device := md.Get("x-device-id"); len(device) > 0 {
+				client.DeviceID = device[0]
+			}
+		}
+
+		return handler(clientinfo.With(ctx, client), req)
+	}
+}
@@ -0,0 +1,139 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/services/throttle"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type Limiter interface {
+	Check(ctx context.Context, keys []models.ThrottleKey) (delay time.Duration, retryAfter time.Duration, err error)
+	Fail(ctx context.Context, keys []models.ThrottleKey) error
+	Succeed(ctx context.Context, keys []models.ThrottleKey) error
+}
+
+// loginRequest is implemented by the requests that check a password.
+type loginRequest interface {
+	GetEmail() string
+	GetAppId() int64
+}
+
+// Throttle limits the login attempts per email, client IP and app. Locked
+// attempts fail with ResourceExhausted and a "retry-after" header in seconds,
+// the others may be delayed. Invalid credentials, which the Login and StepUp
+// handlers report as NotFound, count as failures. StepUp is throttled by the
+// email and app of the caller, so Throttle goes after Auth. With trustProxy
+// the client IP is taken from the "x-forwarded-for" metadata.
+func Throttle(limiter Limiter, trustProxy bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		keys, ok := throttleKeys(ctx, req, info.FullMethod)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		if ip := ClientIP(ctx, trustProxy); ip != "" {
+			keys = append(keys, models.ThrottleKey{Kind: models.ThrottleByIP, Value: ip})
+		}
+
+		delay, retryAfter, err := limiter.Check(ctx, keys)
+		if err != nil {
+			if errors.Is(err, throttle.ErrLocked) {
+				seconds := int64(math.Ceil(retryAfter.Seconds()))
+				_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(seconds, 10)))
+				return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("Too many login attempts, retry after %ds", seconds))
+			}
+			return nil, status.Error(codes.Internal, "Iternal error: "+err.Error())
+		}
+
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, status.FromContextError(ctx.Err()).Err()
+			case <-timer.C:
+			}
+		}
+
+		resp, err := handler(ctx, req)
+
+		// the attempt already has its answer, counting errors must not change it
+		switch {
+		case err == nil:
+			_ = limiter.Succeed(ctx, keys)
+		case status.Code(err) == codes.NotFound:
+			_ = limiter.Fail(ctx, keys)
+		}
+
+		return resp, err
+	}
+}
+
+// throttleKeys returns the keys of a request that checks a password, false
+// for the other requests.
+func throttleKeys(ctx context.Context, req any, method string) ([]models.ThrottleKey, bool) {
+	var (
+		email string
+		appID int64
+	)
+
+	switch login, ok := req.(loginRequest); {
+	case ok:
+		email, appID = login.GetEmail(), login.GetAppId()
+	case method == ssov1.Auth_StepUp_FullMethodName:
+		principal, ok := Principal(ctx)
+		if !ok {
+			// the handler asks for a token
+			return nil, false
+		}
+		email, appID = principal.Email, principal.AppID
+	default:
+		return nil, false
+	}
+
+	return []models.ThrottleKey{
+		{Kind: models.ThrottleByEmail, Value: strings.ToLower(email)},
+		{Kind: models.ThrottleByApp, Value: strconv.FormatInt(appID, 10)},
+	}, true
+}
+
+// ClientIP returns the IP of the caller, from the first "x-forwarded-for"
+// entry when trustProxy is set, otherwise from the connection.
+func ClientIP(ctx context.Context, trustProxy bool) string {
+	if trustProxy {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			for _, v := range md.Get("x-forwarded-for") {
+				first, _, _ := strings.Cut(v, ",")
+				if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+					return ip.String()
+				}
+			}
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
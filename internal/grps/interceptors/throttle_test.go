@@ -0,0 +1,180 @@
+package interceptors
+
+import (
+	"context"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/services/throttle"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeLimiter struct {
+	delay      time.Duration
+	retryAfter time.Duration
+	err        error
+
+	checked   []models.ThrottleKey
+	failed    int
+	succeeded int
+}
+
+func (l *fakeLimiter) Check(_ context.Context, keys []models.ThrottleKey) (time.Duration, time.Duration, error) {
+	l.checked = keys
+	return l.delay, l.retryAfter, l.err
+}
+
+func (l *fakeLimiter) Fail(context.Context, []models.ThrottleKey) error {
+	l.failed++
+	return nil
+}
+
+func (l *fakeLimiter) Succeed(context.Context, []models.ThrottleKey) error {
+	l.succeeded++
+	return nil
+}
+
+// headerStream records the headers the interceptor sets.
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestThrottle(t *testing.T) {
+	login := &ssov1.LoginRequest{Email: "User@Example.com", Password: "secret", AppId: 1}
+	stepUp := &ssov1.StepUpRequest{Password: "secret"}
+	caller := models.Principal{UserID: 7, Email: "caller@example.com", AppID: 2}
+
+	tests := []struct {
+		name      string
+		req       any
+		method    string
+		principal *models.Principal
+		limiter   fakeLimiter
+		handler   error
+
+		wantCode       codes.Code
+		wantKeys       []models.ThrottleKey
+		wantRetryAfter string
+		wantMinTime    time.Duration
+		wantFailed     int
+		wantSucceeded  int
+	}{
+		{
+			name:          "login succeeds",
+			req:           login,
+			method:        ssov1.Auth_Login_FullMethodName,
+			wantCode:      codes.OK,
+			wantKeys:      []models.ThrottleKey{{Kind: models.ThrottleByEmail, Value: "user@example.com"}, {Kind: models.ThrottleByApp, Value: "1"}},
+			wantSucceeded: 1,
+		},
+		{
+			name:       "invalid credentials count as a failure",
+			req:        login,
+			method:     ssov1.Auth_Login_FullMethodName,
+			handler:    status.Error(codes.NotFound, "Invalid credentials"),
+			wantCode:   codes.NotFound,
+			wantKeys:   []models.ThrottleKey{{Kind: models.ThrottleByEmail, Value: "user@example.com"}, {Kind: models.ThrottleByApp, Value: "1"}},
+			wantFailed: 1,
+		},
+		{
+			name:          "delayed",
+			req:           login,
+			method:        ssov1.Auth_Login_FullMethodName,
+			limiter:       fakeLimiter{delay: 50 * time.Millisecond},
+			wantCode:      codes.OK,
+			wantKeys:      []models.ThrottleKey{{Kind: models.ThrottleByEmail, Value: "user@example.com"}, {Kind: models.ThrottleByApp, Value: "1"}},
+			wantMinTime:   50 * time.Millisecond,
+			wantSucceeded: 1,
+		},
+		{
+			name:           "locked",
+			req:            login,
+			method:         ssov1.Auth_Login_FullMethodName,
+			limiter:        fakeLimiter{retryAfter: 1200 * time.Millisecond, err: throttle.ErrLocked},
+			wantCode:       codes.ResourceExhausted,
+			wantKeys:       []models.ThrottleKey{{Kind: models.ThrottleByEmail, Value: "user@example.com"}, {Kind: models.ThrottleByApp, Value: "1"}},
+			wantRetryAfter: "2",
+		},
+		{
+			name:       "step-up is throttled by the caller",
+			req:        stepUp,
+			method:     ssov1.Auth_StepUp_FullMethodName,
+			principal:  &caller,
+			handler:    status.Error(codes.NotFound, "Invalid credentials"),
+			wantCode:   codes.NotFound,
+			wantKeys:   []models.ThrottleKey{{Kind: models.ThrottleByEmail, Value: "caller@example.com"}, {Kind: models.ThrottleByApp, Value: "2"}},
+			wantFailed: 1,
+		},
+		{
+			name:           "locked step-up",
+			req:            stepUp,
+			method:         ssov1.Auth_StepUp_FullMethodName,
+			principal:      &caller,
+			limiter:        fakeLimiter{retryAfter: 30 * time.Second, err: throttle.ErrLocked},
+			wantCode:       codes.ResourceExhausted,
+			wantKeys:       []models.ThrottleKey{{Kind: models.ThrottleByEmail, Value: "caller@example.com"}, {Kind: models.ThrottleByApp, Value: "2"}},
+			wantRetryAfter: "30",
+		},
+		{
+			name:     "step-up without a token is left to the handler",
+			req:      stepUp,
+			method:   ssov1.Auth_StepUp_FullMethodName,
+			handler:  status.Error(codes.Unauthenticated, "Token is required"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "other requests pass",
+			req:      &ssov1.RegisterRequest{Email: "user@example.com", Password: "secret"},
+			method:   ssov1.Auth_Register_FullMethodName,
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := tt.limiter
+			stream := &headerStream{}
+
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+			if tt.principal != nil {
+				ctx = context.WithValue(ctx, principalKey{}, *tt.principal)
+			}
+
+			var called bool
+			handler := func(context.Context, any) (any, error) {
+				called = true
+				return nil, tt.handler
+			}
+
+			start := time.Now()
+			_, err := Throttle(&limiter, false)(ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+
+			require.Equal(t, tt.wantCode, status.Code(err))
+			assert.GreaterOrEqual(t, time.Since(start), tt.wantMinTime)
+			assert.Equal(t, tt.wantKeys, limiter.checked)
+			assert.Equal(t, tt.wantFailed, limiter.failed)
+			assert.Equal(t, tt.wantSucceeded, limiter.succeeded)
+
+			if tt.wantRetryAfter != "" {
+				assert.False(t, called)
+				assert.Equal(t, []string{tt.wantRetryAfter}, stream.header.Get("retry-after"))
+			} else {
+				assert.True(t, called)
+				assert.Empty(t, stream.header.Get("retry-after"))
+			}
+		})
+	}
+}
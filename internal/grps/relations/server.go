@@ -0,0 +1,224 @@
+package relations
+
+import (
+	"context"
+	"errors"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/domain/models"
+	"sso/internal/services/relations"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const emptyValue = 0
+
+type Relations interface {
+	WriteNamespace(ctx context.Context, ns models.Namespace) error
+	WriteTuples(ctx context.Context, appID int64, tuples []models.RelationTuple) (token string, err error)
+	DeleteTuples(ctx context.Context, appID int64, tuples []models.RelationTuple) (token string, err error)
+	Check(ctx context.Context, appID int64, object models.Object, relation string,
+		subject models.Subject, token string) (allowed bool, revToken string, err error)
+	Expand(ctx context.Context, appID int64, object models.Object, relation string,
+		token string) (tree models.UsersetTree, revToken string, err error)
+	ListObjects(ctx context.Context, appID int64, objectType string, relation string,
+		subject models.Subject, token string) (ids []string, revToken string, err error)
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedRelationsServer
+	relations Relations
+}
+
+func RegisterServ(gRPC *grpc.Server, relations Relations) {
+	ssov1.RegisterRelationsServer(gRPC, &serverAPI{relations: relations})
+}
+
+func (s *serverAPI) WriteNamespace(ctx context.Context, req *ssov1.WriteNamespaceRequest) (*ssov1.WriteNamespaceResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if req.GetNamespace().GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Namespace name is empty")
+	}
+
+	ns := models.Namespace{AppID: req.GetAppId(), Name: req.GetNamespace().GetName()}
+	for _, rel := range req.GetNamespace().GetRelations() {
+		cfg := models.RelationConfig{Name: rel.GetName(), Union: rel.GetUnion()}
+		for _, ttu := range rel.GetTupleToUserset() {
+			cfg.TupleToUserset = append(cfg.TupleToUserset, models.TupleToUserset{
+				Tupleset:         ttu.GetTupleset(),
+				ComputedRelation: ttu.GetComputedRelation(),
+			})
+		}
+		ns.Relations = append(ns.Relations, cfg)
+	}
+
+	if err := s.relations.WriteNamespace(ctx, ns); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.WriteNamespaceResponse{Success: true}, nil
+}
+
+func (s *serverAPI) WriteTuples(ctx context.Context, req *ssov1.WriteTuplesRequest) (*ssov1.WriteTuplesResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	tuples, err := parseTuples(req.GetTuples())
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.relations.WriteTuples(ctx, req.GetAppId(), tuples)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.WriteTuplesResponse{ConsistencyToken: token}, nil
+}
+
+func (s *serverAPI) DeleteTuples(ctx context.Context, req *ssov1.DeleteTuplesRequest) (*ssov1.DeleteTuplesResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+
+	tuples, err := parseTuples(req.GetTuples())
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.relations.DeleteTuples(ctx, req.GetAppId(), tuples)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.DeleteTuplesResponse{ConsistencyToken: token}, nil
+}
+
+func (s *serverAPI) Check(ctx context.Context, req *ssov1.CheckRequest) (*ssov1.CheckResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if req.GetRelation() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Relation is empty")
+	}
+
+	object, err := relations.ParseObject(req.GetObject())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	subject, err := relations.ParseSubject(req.GetSubject())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	allowed, token, err := s.relations.Check(ctx, req.GetAppId(), object, req.GetRelation(), subject, req.GetConsistencyToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.CheckResponse{Allowed: allowed, ConsistencyToken: token}, nil
+}
+
+func (s *serverAPI) Expand(ctx context.Context, req *ssov1.ExpandRequest) (*ssov1.ExpandResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if req.GetRelation() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Relation is empty")
+	}
+
+	object, err := relations.ParseObject(req.GetObject())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	tree, token, err := s.relations.Expand(ctx, req.GetAppId(), object, req.GetRelation(), req.GetConsistencyToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &ssov1.ExpandResponse{Tree: treeToProto(tree), ConsistencyToken: token}, nil
+}
+
+func (s *serverAPI) ListObjects(ctx context.Context, req *ssov1.ListObjectsRequest) (*ssov1.ListObjectsResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "App_id is empty")
+	}
+	if req.GetObjectType() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Object_type is empty")
+	}
+	if req.GetRelation() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Relation is empty")
+	}
+
+	subject, err := relations.ParseSubject(req.GetSubject())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ids, token, err := s.relations.ListObjects(ctx, req.GetAppId(), req.GetObjectType(), req.GetRelation(),
+		subject, req.GetConsistencyToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &ssov1.ListObjectsResponse{ConsistencyToken: token}
+	for _, id := range ids {
+		resp.Objects = append(resp.Objects, models.Object{Type: req.GetObjectType(), ID: id}.String())
+	}
+
+	return resp, nil
+}
+
+func parseTuples(raw []string) ([]models.RelationTuple, error) {
+	if len(raw) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Tuples are empty")
+	}
+
+	tuples := make([]models.RelationTuple, 0, len(raw))
+	for _, r := range raw {
+		t, err := relations.ParseTuple(r)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		tuples = append(tuples, t)
+	}
+
+	return tuples, nil
+}
+
+func treeToProto(tree models.UsersetTree) *ssov1.UsersetTree {
+	res := &ssov1.UsersetTree{Object: tree.Object.String(), Relation: tree.Relation}
+
+	for _, subject := range tree.Subjects {
+		res.Subjects = append(res.Subjects, subject.String())
+	}
+	for _, child := range tree.Children {
+		res.Children = append(res.Children, treeToProto(child))
+	}
+
+	return res
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, relations.ErrInvalidTuple),
+		errors.Is(err, relations.ErrInvalidNamespace),
+		errors.Is(err, relations.ErrUnknownRelation),
+		errors.Is(err, relations.ErrInvalidToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, relations.ErrNamespaceNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, relations.ErrInvalidAppID):
+		return status.Error(codes.NotFound, "App not found")
+	case errors.Is(err, relations.ErrDepthExceeded):
+		return status.Error(codes.FailedPrecondition, "Max check depth exceeded")
+	}
+
+	return status.Error(codes.Internal, "Iternal error: "+err.Error())
+}
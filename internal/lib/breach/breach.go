@@ -0,0 +1,153 @@
+// Package breach looks passwords up in a local copy of a breached password
+// corpus in the Pwned Passwords "ordered by hash" format: one
+// "<SHA-1 hex>:<count>" line per password, sorted by the hash.
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const (
+	hashLen = sha1.Size * 2
+	// maxLineLen is longer than any "<hash>:<count>\r\n" line
+	maxLineLen = 128
+)
+
+// Corpus is an opened corpus file, lookups binary search the file without
+// loading it into memory.
+type Corpus struct {
+	f    *os.File
+	size int64
+}
+
+func Open(path string) (*Corpus, error) {
+	const op = "breach.Open"
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Corpus{f: f, size: info.Size()}, nil
+}
+
+func (c *Corpus) Close() error {
+	return c.f.Close()
+}
+
+// Contains reports whether the password is in the corpus.
+func (c *Corpus) Contains(password string) (bool, error) {
+	count, err := c.Count(password)
+
+	return count > 0, err
+}
+
+// Count returns how many times the password was seen in breaches, zero if
+// it is not in the corpus.
+func (c *Corpus) Count(password string) (int64, error) {
+	const op = "breach.Corpus.Count"
+
+	sum := sha1.Sum([]byte(password))
+	target := bytes.ToUpper([]byte(hex.EncodeToString(sum[:])))
+
+	// the line of the target, if any, starts in [lo, hi)
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, err := c.lineStart(mid)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		line, err := c.line(start)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		switch cmp := bytes.Compare(hashOf(line), target); {
+		case cmp == 0:
+			return countOf(line), nil
+		case cmp < 0:
+			lo = start + int64(len(line))
+		default:
+			// no line starts in [mid, start)
+			hi = mid
+		}
+	}
+
+	return 0, nil
+}
+
+// lineStart returns the offset of the first line starting at or after
+// offset, the file size if there is none.
+func (c *Corpus) lineStart(offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, maxLineLen)
+
+	n, err := c.f.ReadAt(buf, offset-1)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	nl := bytes.IndexByte(buf[:n], '\n')
+	if nl < 0 {
+		return c.size, nil
+	}
+
+	return offset + int64(nl), nil
+}
+
+// line returns the line starting at offset with its newline.
+func (c *Corpus) line(offset int64) ([]byte, error) {
+	r := bufio.NewReaderSize(io.NewSectionReader(c.f, offset, c.size-offset), maxLineLen)
+
+	line, err := r.ReadSlice('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return append([]byte(nil), line...), nil
+}
+
+func hashOf(line []byte) []byte {
+	if len(line) < hashLen {
+		return bytes.ToUpper(bytes.TrimSpace(line))
+	}
+
+	return bytes.ToUpper(line[:hashLen])
+}
+
+func countOf(line []byte) int64 {
+	_, count, found := bytes.Cut(bytes.TrimSpace(line), []byte(":"))
+	if !found {
+		return 1
+	}
+
+	n, err := strconv.ParseInt(string(count), 10, 64)
+	if err != nil || n < 1 {
+		return 1
+	}
+
+	return n
+}
@@ -0,0 +1,130 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// openCorpus writes the lines sorted by the hash, each ending with newline,
+// and opens them.
+func openCorpus(t *testing.T, lines []string, newline string) *Corpus {
+	t.Helper()
+
+	sort.Slice(lines, func(i, j int) bool {
+		return strings.ToUpper(lines[i][:hashLen]) < strings.ToUpper(lines[j][:hashLen])
+	})
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	var data strings.Builder
+	for _, line := range lines {
+		data.WriteString(line + newline)
+	}
+	require.NoError(t, os.WriteFile(path, []byte(data.String()), 0o600))
+
+	c, err := Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestCount(t *testing.T) {
+	c := openCorpus(t, []string{
+		sha1Hex("password") + ":9545824",
+		sha1Hex("123456") + ":37359195",
+		strings.ToLower(sha1Hex("qwerty")) + ":3946737",
+		// a plain list of hashes counts every one once
+		sha1Hex("letmein"),
+		sha1Hex("dragon") + ":not a number",
+	}, "\n")
+
+	count, err := c.Count("password")
+	require.NoError(t, err)
+	assert.Equal(t, int64(9545824), count)
+
+	count, err = c.Count("123456")
+	require.NoError(t, err)
+	assert.Equal(t, int64(37359195), count)
+
+	count, err = c.Count("qwerty")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3946737), count)
+
+	count, err = c.Count("letmein")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = c.Count("dragon")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = c.Count("correct horse battery staple")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestContains(t *testing.T) {
+	// the downloaded corpus has windows line endings
+	c := openCorpus(t, []string{sha1Hex("password") + ":3", sha1Hex("123456") + ":7"}, "\r\n")
+
+	found, err := c.Contains("password")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = c.Contains("Password")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	count, err := c.Count("123456")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), count)
+}
+
+func TestContains_LargeCorpus(t *testing.T) {
+	lines := make([]string, 0, 5000)
+	for i := 0; i < cap(lines); i++ {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(fmt.Sprintf("password%d", i)), i+1))
+	}
+	c := openCorpus(t, lines, "\n")
+
+	// the first and last lines are the edges of the search
+	for i := 0; i < cap(lines); i++ {
+		count, err := c.Count(fmt.Sprintf("password%d", i))
+		require.NoError(t, err)
+		require.Equal(t, int64(i+1), count, i)
+	}
+
+	for i := cap(lines); i < cap(lines)+100; i++ {
+		found, err := c.Contains(fmt.Sprintf("password%d", i))
+		require.NoError(t, err)
+		require.False(t, found, i)
+	}
+}
+
+func TestContains_EmptyCorpus(t *testing.T) {
+	c := openCorpus(t, nil, "\n")
+
+	found, err := c.Contains("password")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestOpen(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,27 @@
+// Package clientinfo carries what is known about the caller of a request,
+// the transport puts it into the context and the services read it.
+package clientinfo
+
+import "context"
+
+// Info describes the caller, empty fields are unknown.
+type Info struct {
+	IP        string
+	UserAgent string
+	// DeviceID is a long-lived id the client keeps per device.
+	DeviceID string
+}
+
+type infoKey struct{}
+
+// With returns a copy of ctx carrying info.
+func With(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// From returns the caller info of ctx, zero if there is none.
+func From(ctx context.Context) Info {
+	info, _ := ctx.Value(infoKey{}).(Info)
+
+	return info
+}
@@ -0,0 +1,246 @@
+// Package hasher hashes passwords into PHC-style strings, e.g.
+// "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>". Bcrypt keeps its own
+// "$2a$<cost>$..." format, so hashes stored before stay valid.
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrMismatch          = errors.New("password mismatch")
+	ErrUnknownAlgorithm  = errors.New("unknown hash algorithm")
+	ErrMalformedHash     = errors.New("malformed hash")
+	ErrUnsupportedParams = errors.New("unsupported hash parameters")
+)
+
+const (
+	saltLen = 16
+	keyLen  = 32
+)
+
+var b64 = base64.RawStdEncoding
+
+// PasswordHasher hashes passwords with one algorithm and set of parameters.
+type PasswordHasher interface {
+	Hash(password []byte) ([]byte, error)
+	// Verify checks the password against a hash made by any hasher, it
+	// returns ErrMismatch for a wrong password.
+	Verify(hash []byte, password []byte) error
+	// Current reports whether the hash was made by this hasher with the same
+	// parameters, otherwise it should be replaced by a new one.
+	Current(hash []byte) bool
+}
+
+// Verify checks the password against a hash of any supported format, it
+// returns ErrMismatch for a wrong password.
+func Verify(hash []byte, password []byte) error {
+	s := string(hash)
+
+	switch {
+	case strings.HasPrefix(s, "$2a$"), strings.HasPrefix(s, "$2b$"), strings.HasPrefix(s, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword(hash, password); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return ErrMismatch
+			}
+			return err
+		}
+		return nil
+	case strings.HasPrefix(s, "$argon2id$"):
+		params, salt, key, err := parseArgon2id(s)
+		if err != nil {
+			return err
+		}
+		return compare(key, argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, uint32(len(key))))
+	case strings.HasPrefix(s, "$scrypt$"):
+		params, salt, key, err := parseScrypt(s)
+		if err != nil {
+			return err
+		}
+		derived, err := scrypt.Key(password, salt, 1<<params.LogN, params.R, params.P, len(key))
+		if err != nil {
+			return err
+		}
+		return compare(key, derived)
+	}
+
+	return ErrUnknownAlgorithm
+}
+
+func compare(expected, actual []byte) error {
+	if subtle.ConstantTimeCompare(expected, actual) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+func salt() ([]byte, error) {
+	s := make([]byte, saltLen)
+	if _, err := rand.Read(s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Bcrypt hashes with bcrypt, a zero Cost means bcrypt.DefaultCost.
+type Bcrypt struct {
+	Cost int
+}
+
+func (h Bcrypt) cost() int {
+	if h.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+
+	return h.Cost
+}
+
+func (h Bcrypt) Hash(password []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, h.cost())
+}
+
+func (h Bcrypt) Verify(hash []byte, password []byte) error {
+	return Verify(hash, password)
+}
+
+func (h Bcrypt) Current(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+
+	return err == nil && cost == h.cost()
+}
+
+// Argon2id hashes with argon2id, Memory is in KiB.
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+func (h Argon2id) Hash(password []byte) ([]byte, error) {
+	s, err := salt()
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey(password, s, h.Time, h.Memory, h.Threads, keyLen)
+
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads, b64.EncodeToString(s), b64.EncodeToString(key))), nil
+}
+
+func (h Argon2id) Verify(hash []byte, password []byte) error {
+	return Verify(hash, password)
+}
+
+func (h Argon2id) Current(hash []byte) bool {
+	params, _, _, err := parseArgon2id(string(hash))
+
+	return err == nil && params == h
+}
+
+func parseArgon2id(s string) (Argon2id, []byte, []byte, error) {
+	var params Argon2id
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(s, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: argon2 version %d", ErrUnsupportedParams, version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, fmt.Errorf("%w: argon2 t=%d p=%d", ErrUnsupportedParams, params.Time, params.Threads)
+	}
+
+	salt, key, err := decodeSaltKey(parts[4], parts[5])
+
+	return params, salt, key, err
+}
+
+// Scrypt hashes with scrypt, the cost is N = 2^LogN.
+type Scrypt struct {
+	LogN uint8
+	R    int
+	P    int
+}
+
+func (h Scrypt) Hash(password []byte) ([]byte, error) {
+	s, err := salt()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(password, s, 1<<h.LogN, h.R, h.P, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		h.LogN, h.R, h.P, b64.EncodeToString(s), b64.EncodeToString(key))), nil
+}
+
+func (h Scrypt) Verify(hash []byte, password []byte) error {
+	return Verify(hash, password)
+}
+
+func (h Scrypt) Current(hash []byte) bool {
+	params, _, _, err := parseScrypt(string(hash))
+
+	return err == nil && params == h
+}
+
+func parseScrypt(s string) (Scrypt, []byte, []byte, error) {
+	var params Scrypt
+
+	// "", "scrypt", "ln=...,r=...,p=...", salt, key
+	parts := strings.Split(s, "$")
+	if len(parts) != 5 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.LogN, &params.R, &params.P); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if params.LogN == 0 || params.LogN > 30 {
+		return params, nil, nil, fmt.Errorf("%w: scrypt ln=%d", ErrUnsupportedParams, params.LogN)
+	}
+
+	salt, key, err := decodeSaltKey(parts[3], parts[4])
+
+	return params, salt, key, err
+}
+
+func decodeSaltKey(rawSalt, rawKey string) ([]byte, []byte, error) {
+	salt, err := b64.DecodeString(rawSalt)
+	if err != nil {
+		return nil, nil, ErrMalformedHash
+	}
+
+	key, err := b64.DecodeString(rawKey)
+	if err != nil || len(key) == 0 {
+		return nil, nil, ErrMalformedHash
+	}
+
+	return salt, key, nil
+}
@@ -0,0 +1,147 @@
+package hasher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters, the tests check the formats rather than the cost
+var (
+	testBcrypt   = Bcrypt{Cost: bcrypt.MinCost}
+	testArgon2id = Argon2id{Time: 1, Memory: 64, Threads: 1}
+	testScrypt   = Scrypt{LogN: 4, R: 8, P: 1}
+)
+
+// hashAndVerify hashes "secret" with h and checks the hash against the
+// right and a wrong password.
+func hashAndVerify(t *testing.T, h PasswordHasher, prefix string) []byte {
+	t.Helper()
+
+	hash, err := h.Hash([]byte("secret"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), prefix), string(hash))
+
+	assert.NoError(t, h.Verify(hash, []byte("secret")))
+	assert.ErrorIs(t, h.Verify(hash, []byte("wrong")), ErrMismatch)
+	assert.True(t, h.Current(hash))
+
+	again, err := h.Hash([]byte("secret"))
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again, "the salt must differ")
+
+	return hash
+}
+
+func TestBcrypt(t *testing.T) {
+	hash := hashAndVerify(t, testBcrypt, "$2a$04$")
+
+	assert.False(t, Bcrypt{Cost: bcrypt.MinCost + 1}.Current(hash))
+	// a zero cost is the default one
+	assert.Equal(t, bcrypt.DefaultCost, Bcrypt{}.cost())
+}
+
+func TestArgon2id(t *testing.T) {
+	hash := hashAndVerify(t, testArgon2id, "$argon2id$v=19$m=64,t=1,p=1$")
+
+	assert.False(t, Argon2id{Time: 1, Memory: 128, Threads: 1}.Current(hash))
+	assert.False(t, testScrypt.Current(hash))
+	// the other hashers verify it too, so the algorithm can be switched
+	assert.NoError(t, testBcrypt.Verify(hash, []byte("secret")))
+}
+
+func TestScrypt(t *testing.T) {
+	hash := hashAndVerify(t, testScrypt, "$scrypt$ln=4,r=8,p=1$")
+
+	assert.False(t, Scrypt{LogN: 5, R: 8, P: 1}.Current(hash))
+	assert.False(t, testBcrypt.Current(hash))
+	assert.NoError(t, testArgon2id.Verify(hash, []byte("secret")))
+}
+
+func TestVerify_Malformed(t *testing.T) {
+	assert.ErrorIs(t, Verify([]byte("$md5$abc"), []byte("secret")), ErrUnknownAlgorithm)
+	// hashes stored before the hashers existed were never plaintext
+	assert.ErrorIs(t, Verify([]byte("secret"), []byte("secret")), ErrUnknownAlgorithm)
+
+	assert.ErrorIs(t, Verify([]byte("$argon2id$v=19$m=64,t=1,p=1$c2FsdA"), []byte("secret")), ErrMalformedHash)
+	assert.ErrorIs(t, Verify([]byte("$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5"), []byte("secret")), ErrUnsupportedParams)
+	assert.ErrorIs(t, Verify([]byte("$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5"), []byte("secret")), ErrUnsupportedParams)
+
+	assert.ErrorIs(t, Verify([]byte("$scrypt$ln=4,r=8,p=1$!!$a2V5"), []byte("secret")), ErrMalformedHash)
+	// a cost this high would keep the server busy for ages
+	assert.ErrorIs(t, Verify([]byte("$scrypt$ln=40,r=8,p=1$c2FsdA$a2V5"), []byte("secret")), ErrUnsupportedParams)
+}
+
+// fakePepper is an HMAC-SHA256 pepper with keys by id.
+type fakePepper struct {
+	current string
+	keys    map[string][]byte
+}
+
+var errUnknownPepper = errors.New("unknown pepper key")
+
+func (p fakePepper) Current() string {
+	return p.current
+}
+
+func (p fakePepper) Pepper(data []byte) (string, []byte) {
+	mac, _ := p.PepperWith(p.current, data)
+	return p.current, mac
+}
+
+func (p fakePepper) PepperWith(keyID string, data []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, errUnknownPepper
+	}
+
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+
+	return m.Sum(nil), nil
+}
+
+func TestPeppered(t *testing.T) {
+	keys := map[string][]byte{"k1": []byte("first key"), "k2": []byte("second key")}
+	k1 := Peppered{Hasher: testArgon2id, Pepper: fakePepper{current: "k1", keys: keys}}
+	k2 := Peppered{Hasher: testArgon2id, Pepper: fakePepper{current: "k2", keys: keys}}
+
+	hash, err := k1.Hash([]byte("secret"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), "$pepper$k1$argon2id$"), string(hash))
+
+	assert.NoError(t, k1.Verify(hash, []byte("secret")))
+	assert.ErrorIs(t, k1.Verify(hash, []byte("wrong")), ErrMismatch)
+	// the hash alone can't be checked without the pepper
+	assert.ErrorIs(t, Verify(hash, []byte("secret")), ErrUnknownAlgorithm)
+
+	t.Run("rotated key", func(t *testing.T) {
+		assert.NoError(t, k2.Verify(hash, []byte("secret")))
+		assert.True(t, k1.Current(hash))
+		assert.False(t, k2.Current(hash))
+	})
+
+	t.Run("removed key", func(t *testing.T) {
+		only2 := Peppered{Hasher: testArgon2id, Pepper: fakePepper{current: "k2", keys: map[string][]byte{"k2": keys["k2"]}}}
+		assert.ErrorIs(t, only2.Verify(hash, []byte("secret")), errUnknownPepper)
+	})
+
+	t.Run("unpeppered hash", func(t *testing.T) {
+		plain, err := testArgon2id.Hash([]byte("secret"))
+		require.NoError(t, err)
+
+		assert.NoError(t, k1.Verify(plain, []byte("secret")))
+		assert.False(t, k1.Current(plain))
+	})
+
+	t.Run("other hasher", func(t *testing.T) {
+		scrypt := Peppered{Hasher: testScrypt, Pepper: fakePepper{current: "k1", keys: keys}}
+		assert.False(t, scrypt.Current(hash))
+	})
+}
@@ -0,0 +1,78 @@
+package hasher
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+)
+
+// pepperPrefix starts peppered hashes: "$pepper$<key id>" followed by the
+// hash of the peppered password, e.g. "$pepper$k1$argon2id$...".
+const pepperPrefix = "$pepper$"
+
+// Pepper computes a keyed MAC of the password, the keys are kept out of the
+// database, so stolen hashes can't be cracked without them.
+type Pepper interface {
+	Current() string
+	Pepper(data []byte) (keyID string, mac []byte)
+	PepperWith(keyID string, data []byte) (mac []byte, err error)
+}
+
+// Peppered peppers passwords before hashing them with Hasher. Hashes made
+// without a pepper are still verified, they aren't Current and get peppered
+// on the next login.
+type Peppered struct {
+	Hasher PasswordHasher
+	Pepper Pepper
+}
+
+func (h Peppered) Hash(password []byte) ([]byte, error) {
+	keyID, mac := h.Pepper.Pepper(password)
+
+	hash, err := h.Hasher.Hash(encodeMAC(mac))
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(pepperPrefix+keyID), hash...), nil
+}
+
+func (h Peppered) Verify(hash []byte, password []byte) error {
+	keyID, inner, ok := splitPeppered(hash)
+	if !ok {
+		return Verify(hash, password)
+	}
+
+	mac, err := h.Pepper.PepperWith(keyID, password)
+	if err != nil {
+		return err
+	}
+
+	return Verify(inner, encodeMAC(mac))
+}
+
+func (h Peppered) Current(hash []byte) bool {
+	keyID, inner, ok := splitPeppered(hash)
+
+	return ok && keyID == h.Pepper.Current() && h.Hasher.Current(inner)
+}
+
+func splitPeppered(hash []byte) (string, []byte, bool) {
+	rest, ok := bytes.CutPrefix(hash, []byte(pepperPrefix))
+	if !ok {
+		return "", nil, false
+	}
+
+	i := bytes.IndexByte(rest, '$')
+	if i <= 0 {
+		return "", nil, false
+	}
+
+	return string(rest[:i]), rest[i:], true
+}
+
+// encodeMAC keeps the peppered password printable and under the 72 bytes
+// bcrypt looks at.
+func encodeMAC(mac []byte) []byte {
+	return []byte(strings.TrimRight(base64.StdEncoding.EncodeToString(mac), "="))
+}
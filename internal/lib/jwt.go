@@ -1,13 +1,46 @@
 package jwtlocal
 
 import (
+	"errors"
+	"slices"
 	"sso/internal/domain/models"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
+// SSOAudience is the "aud" claim of the tokens of the SSO itself, see
+// models.SSOAppID.
+const SSOAudience = "sso"
+
+// TokenOptions holds the optional claims of a token.
+type TokenOptions struct {
+	Scopes []string
+	// SessionID ties the token to a login session, "sid" claim.
+	SessionID string
+	// AuthTime, ACR and AMR say when and how the user authenticated,
+	// "auth_time", "acr" and "amr" claims.
+	AuthTime time.Time
+	ACR      string
+	AMR      []string
+	// PasswordChangeOnly marks a token that only permits changing the
+	// password.
+	PasswordChangeOnly bool
+	// StepUpOnly marks a token that only permits a step-up.
+	StepUpOnly bool
+	// Actor acts on behalf of the user, "act" claim.
+	Actor *models.Actor
+	// ServiceAccountID marks a token of a service account instead of a
+	// user, "sa_id" claim.
+	ServiceAccountID int64
+	// Roles are the roles of the service account or those granted by the
+	// backend of the user, "roles" claim.
+	Roles []string
+}
+
+func NewToken(user models.User, app models.App, duration time.Duration, opts TokenOptions) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	claims := token.Claims.(jwt.MapClaims)
@@ -15,6 +48,39 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 	claims["email"] = user.Email
 	claims["exp"] = time.Now().Add(duration).Unix()
 	claims["app_id"] = app.Id
+	if app.Id == models.SSOAppID {
+		claims["aud"] = SSOAudience
+	}
+	if len(opts.Scopes) > 0 {
+		claims["scope"] = strings.Join(opts.Scopes, " ")
+	}
+	if opts.SessionID != "" {
+		claims["sid"] = opts.SessionID
+	}
+	if !opts.AuthTime.IsZero() {
+		claims["auth_time"] = opts.AuthTime.Unix()
+	}
+	if opts.ACR != "" {
+		claims["acr"] = opts.ACR
+	}
+	if len(opts.AMR) > 0 {
+		claims["amr"] = opts.AMR
+	}
+	if opts.PasswordChangeOnly {
+		claims["pwd_change_only"] = true
+	}
+	if opts.StepUpOnly {
+		claims["step_up_only"] = true
+	}
+	if opts.Actor != nil {
+		claims["act"] = actorClaim(opts.Actor)
+	}
+	if opts.ServiceAccountID != 0 {
+		claims["sa_id"] = opts.ServiceAccountID
+	}
+	if len(opts.Roles) > 0 {
+		claims["roles"] = opts.Roles
+	}
 
 	tokenString, err := token.SignedString([]byte(app.Secret))
 	if err != nil {
@@ -23,3 +89,154 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 
 	return tokenString, nil
 }
+
+// Claims are the claims of a token issued by NewToken.
+type Claims struct {
+	UserID    int64
+	Email     string
+	AppID     int64
+	Scopes    []string
+	ExpiresAt time.Time
+	SessionID string
+	AuthTime  time.Time
+	ACR       string
+	AMR       []string
+
+	PasswordChangeOnly bool
+	StepUpOnly         bool
+	Actor              *models.Actor
+	ServiceAccountID   int64
+	Roles              []string
+}
+
+// ParseToken verifies the token signature with the secrets of the app the
+// token was issued for and returns its claims. Any of the secrets may match,
+// so tokens signed before a secret rotation stay valid for a while. Only the
+// tokens of models.SSOAppID may have the SSOAudience, and they must.
+func ParseToken(tokenString string, appSecrets func(appID int64) ([][]byte, error)) (Claims, error) {
+	var claims Claims
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		mapClaims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, errors.New("unexpected claims")
+		}
+
+		appID, ok := mapClaims["app_id"].(float64)
+		if !ok {
+			return nil, errors.New("app_id claim is missing")
+		}
+
+		aud, err := mapClaims.GetAudience()
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(aud, SSOAudience) != (int64(appID) == models.SSOAppID) {
+			return nil, errors.New("aud claim doesn't match app_id")
+		}
+
+		secrets, err := appSecrets(int64(appID))
+		if err != nil {
+			return nil, err
+		}
+
+		keys := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, 0, len(secrets))}
+		for _, secret := range secrets {
+			keys.Keys = append(keys.Keys, secret)
+		}
+
+		return keys, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return claims, err
+	}
+
+	mapClaims := token.Claims.(jwt.MapClaims)
+
+	uid, _ := mapClaims["uid"].(float64)
+	appID, _ := mapClaims["app_id"].(float64)
+	claims.UserID = int64(uid)
+	claims.AppID = int64(appID)
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.SessionID, _ = mapClaims["sid"].(string)
+	claims.ACR, _ = mapClaims["acr"].(string)
+	claims.PasswordChangeOnly, _ = mapClaims["pwd_change_only"].(bool)
+	claims.StepUpOnly, _ = mapClaims["step_up_only"].(bool)
+	if act, ok := mapClaims["act"].(map[string]any); ok {
+		claims.Actor = parseActor(act)
+	}
+	if saID, ok := mapClaims["sa_id"].(float64); ok {
+		claims.ServiceAccountID = int64(saID)
+	}
+	if roles, ok := mapClaims["roles"].([]any); ok {
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				claims.Roles = append(claims.Roles, s)
+			}
+		}
+	}
+	if authTime, ok := mapClaims["auth_time"].(float64); ok {
+		claims.AuthTime = time.Unix(int64(authTime), 0)
+	}
+	if amr, ok := mapClaims["amr"].([]any); ok {
+		for _, method := range amr {
+			if s, ok := method.(string); ok {
+				claims.AMR = append(claims.AMR, s)
+			}
+		}
+	}
+	if exp, err := mapClaims.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	if scope, _ := mapClaims["scope"].(string); scope != "" {
+		claims.Scopes = strings.Fields(scope)
+	}
+
+	return claims, nil
+}
+
+// serviceAccountSubPrefix starts the "sub" of an actor that is a service
+// account, so it can't be taken for a user id.
+const serviceAccountSubPrefix = "sa:"
+
+// actorClaim returns the "act" claim of the actor, the actor's own actor is
+// nested in it (RFC 8693, section 4.1).
+func actorClaim(actor *models.Actor) map[string]any {
+	claim := map[string]any{
+		"sub":   strconv.FormatInt(actor.UserID, 10),
+		"email": actor.Email,
+	}
+	if actor.ServiceAccountID != 0 {
+		claim = map[string]any{"sub": serviceAccountSubPrefix + strconv.FormatInt(actor.ServiceAccountID, 10)}
+	}
+	if actor.Actor != nil {
+		claim["act"] = actorClaim(actor.Actor)
+	}
+
+	return claim
+}
+
+func parseActor(claim map[string]any) *models.Actor {
+	sub, _ := claim["sub"].(string)
+
+	actor := &models.Actor{}
+	if accountID, ok := strings.CutPrefix(sub, serviceAccountSubPrefix); ok {
+		id, err := strconv.ParseInt(accountID, 10, 64)
+		if err != nil {
+			return nil
+		}
+		actor.ServiceAccountID = id
+	} else {
+		userID, err := strconv.ParseInt(sub, 10, 64)
+		if err != nil {
+			return nil
+		}
+		actor.UserID = userID
+		actor.Email, _ = claim["email"].(string)
+	}
+	if act, ok := claim["act"].(map[string]any); ok {
+		actor.Actor = parseActor(act)
+	}
+
+	return actor
+}
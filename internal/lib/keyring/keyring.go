@@ -0,0 +1,303 @@
+// Package keyring holds the server master keys. Every key has an id, the
+// values produced with a key carry its id as a prefix, so old values stay
+// readable after a new key becomes current.
+//
+// The keys are used to pepper passwords with HMAC-SHA256 and to encrypt
+// sensitive columns with AES-GCM envelopes: the value is sealed with a random
+// data key, and the data key is sealed with the master key, so rotating the
+// master key only rewraps the data keys.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrNoKeys        = errors.New("keyring has no keys")
+	ErrInvalidKey    = errors.New("invalid key")
+	ErrUnknownKey    = errors.New("unknown key id")
+	ErrNotEncrypted  = errors.New("value is not encrypted")
+	ErrMalformed     = errors.New("malformed encrypted value")
+	ErrDecryptFailed = errors.New("decryption failed")
+)
+
+const (
+	// encPrefix starts encrypted values: "enc:v1:<key id>:<data key>:<data>".
+	encPrefix = "enc:v1:"
+	keyLen    = 32
+)
+
+var b64 = base64.RawStdEncoding
+
+// Keyring is a set of master keys, one of them is current and used for new
+// values.
+type Keyring struct {
+	current string
+	// kek and pepper are derived from the master keys, so a key is never
+	// used for two purposes.
+	kek    map[string][]byte
+	pepper map[string][]byte
+}
+
+// New returns a keyring of 32 byte keys by id, current is the id of the key
+// for new values.
+func New(current string, keys map[string][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current %q", ErrUnknownKey, current)
+	}
+
+	kr := &Keyring{
+		current: current,
+		kek:     make(map[string][]byte, len(keys)),
+		pepper:  make(map[string][]byte, len(keys)),
+	}
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ":$, \t\n") {
+			return nil, fmt.Errorf("%w: id %q", ErrInvalidKey, id)
+		}
+		if len(key) != keyLen {
+			return nil, fmt.Errorf("%w: key %q must be %d bytes", ErrInvalidKey, id, keyLen)
+		}
+
+		kr.kek[id] = derive(key, "kek")
+		kr.pepper[id] = derive(key, "pepper")
+	}
+
+	return kr, nil
+}
+
+// Parse reads keys written as "<id>:<base64 key>", separated by commas or new
+// lines. The first key is current, empty lines and "#" comments are skipped.
+func Parse(spec string) (*Keyring, error) {
+	var current string
+	keys := make(map[string][]byte)
+
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, raw, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("%w: %q has no key id", ErrInvalidKey, line)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q is not base64", ErrInvalidKey, id)
+		}
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("%w: duplicate id %q", ErrInvalidKey, id)
+		}
+
+		if current == "" {
+			current = id
+		}
+		keys[id] = key
+	}
+
+	return New(current, keys)
+}
+
+// Load reads the keys from a file in the Parse format.
+func Load(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(string(data))
+}
+
+// Open loads the keyring from the file at path or, if path is empty, parses
+// spec. It returns nil when both are empty.
+func Open(path string, spec string) (*Keyring, error) {
+	switch {
+	case path != "":
+		return Load(path)
+	case spec != "":
+		return Parse(spec)
+	}
+
+	return nil, nil
+}
+
+// Current returns the id of the key used for new values.
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Pepper returns the HMAC of data under the current key and the key id.
+func (k *Keyring) Pepper(data []byte) (string, []byte) {
+	return k.current, mac(k.pepper[k.current], data)
+}
+
+// PepperWith returns the HMAC of data under the key with the id.
+func (k *Keyring) PepperWith(keyID string, data []byte) ([]byte, error) {
+	key, ok := k.pepper[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+
+	return mac(key, data), nil
+}
+
+// Encrypt seals plaintext under the current key. The aad binds the value to
+// its place, e.g. the column name, and must be the same on Decrypt.
+func (k *Keyring) Encrypt(plaintext, aad []byte) (string, error) {
+	dataKey := make([]byte, keyLen)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	data, err := seal(dataKey, plaintext, aad)
+	if err != nil {
+		return "", err
+	}
+
+	return k.wrap(k.current, dataKey, data)
+}
+
+// Decrypt opens a value made by Encrypt.
+func (k *Keyring) Decrypt(value string, aad []byte) ([]byte, error) {
+	_, dataKey, data, err := k.unwrap(value)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := open(dataKey, data, aad)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+
+	return plaintext, nil
+}
+
+// Rewrap seals the data key of the value under the current key, the data
+// itself is left as is. It reports false when the value already uses the
+// current key.
+func (k *Keyring) Rewrap(value string) (string, bool, error) {
+	keyID, dataKey, data, err := k.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == k.current {
+		return value, false, nil
+	}
+
+	rewrapped, err := k.wrap(k.current, dataKey, data)
+	if err != nil {
+		return "", false, err
+	}
+
+	return rewrapped, true, nil
+}
+
+// IsEncrypted reports whether the value was made by Encrypt, values stored
+// before the encryption was turned on are plaintext.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encPrefix)
+}
+
+func (k *Keyring) wrap(keyID string, dataKey, data []byte) (string, error) {
+	wrapped, err := seal(k.kek[keyID], dataKey, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+
+	return encPrefix + keyID + ":" + b64.EncodeToString(wrapped) + ":" + b64.EncodeToString(data), nil
+}
+
+func (k *Keyring) unwrap(value string) (string, []byte, []byte, error) {
+	rest, ok := strings.CutPrefix(value, encPrefix)
+	if !ok {
+		return "", nil, nil, ErrNotEncrypted
+	}
+
+	// key id, data key, data
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+
+	kek, ok := k.kek[parts[0]]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("%w: %q", ErrUnknownKey, parts[0])
+	}
+
+	wrapped, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	data, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+
+	dataKey, err := open(kek, wrapped, []byte(parts[0]))
+	if err != nil {
+		return "", nil, nil, ErrDecryptFailed
+	}
+
+	return parts[0], dataKey, data, nil
+}
+
+// seal encrypts with AES-256-GCM, the random nonce goes first.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func derive(key []byte, purpose string) []byte {
+	return mac(key, []byte("sso keyring "+purpose))
+}
+
+func mac(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,133 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, keyLen)
+	key2 = bytes.Repeat([]byte{2}, keyLen)
+)
+
+func TestNew(t *testing.T) {
+	kr, err := New("k1", map[string][]byte{"k1": key1, "k2": key2})
+	require.NoError(t, err)
+	assert.Equal(t, "k1", kr.Current())
+
+	_, err = New("k1", nil)
+	assert.ErrorIs(t, err, ErrNoKeys)
+	_, err = New("k3", map[string][]byte{"k1": key1})
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = New("k1", map[string][]byte{"k1": key1[:16]})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	// the id ends up in "enc:v1:<id>:..."
+	_, err = New("k:1", map[string][]byte{"k:1": key1})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestParse(t *testing.T) {
+	spec := "# rotated in march\nk2:" + base64.StdEncoding.EncodeToString(key2) +
+		"\n\nk1:" + base64.StdEncoding.EncodeToString(key1)
+
+	kr, err := Parse(spec)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", kr.Current())
+
+	_, err = Parse("k1:" + base64.StdEncoding.EncodeToString(key1) + ",k1:" + base64.StdEncoding.EncodeToString(key2))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = Parse("k1:not base64!")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = Parse("# nothing\n")
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	kr, err := New("k1", map[string][]byte{"k1": key1})
+	require.NoError(t, err)
+
+	value, err := kr.Encrypt([]byte("totp seed"), []byte("users.totp_secret"))
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(value))
+	assert.True(t, strings.HasPrefix(value, "enc:v1:k1:"), value)
+
+	again, err := kr.Encrypt([]byte("totp seed"), []byte("users.totp_secret"))
+	require.NoError(t, err)
+	assert.NotEqual(t, value, again, "the data key and nonce must differ")
+
+	plaintext, err := kr.Decrypt(value, []byte("users.totp_secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "totp seed", string(plaintext))
+
+	// a value copied to another column doesn't decrypt there
+	_, err = kr.Decrypt(value, []byte("apps.secret"))
+	assert.ErrorIs(t, err, ErrDecryptFailed)
+
+	_, err = kr.Decrypt("totp seed", []byte("users.totp_secret"))
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+	_, err = kr.Decrypt("enc:v1:k1:abc", []byte("users.totp_secret"))
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = kr.Decrypt("enc:v1:k1:!!:abc", []byte("users.totp_secret"))
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = kr.Decrypt(strings.Replace(value, ":k1:", ":k9:", 1), []byte("users.totp_secret"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestRewrap(t *testing.T) {
+	before, err := New("k1", map[string][]byte{"k1": key1})
+	require.NoError(t, err)
+	after, err := New("k2", map[string][]byte{"k1": key1, "k2": key2})
+	require.NoError(t, err)
+	rotated, err := New("k2", map[string][]byte{"k2": key2})
+	require.NoError(t, err)
+
+	value, err := before.Encrypt([]byte("client secret"), []byte("apps.secret"))
+	require.NoError(t, err)
+
+	_, _, err = rotated.Rewrap(value)
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	rewrapped, changed, err := after.Rewrap(value)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, strings.HasPrefix(rewrapped, "enc:v1:k2:"), rewrapped)
+	// only the data key is sealed again
+	assert.Equal(t, value[strings.LastIndex(value, ":"):], rewrapped[strings.LastIndex(rewrapped, ":"):])
+
+	same, changed, err := after.Rewrap(rewrapped)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, rewrapped, same)
+
+	// the old key can go now
+	plaintext, err := rotated.Decrypt(rewrapped, []byte("apps.secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "client secret", string(plaintext))
+
+	_, _, err = after.Rewrap("client secret")
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+}
+
+func TestPepper(t *testing.T) {
+	kr, err := New("k2", map[string][]byte{"k1": key1, "k2": key2})
+	require.NoError(t, err)
+
+	id, mac := kr.Pepper([]byte("secret"))
+	assert.Equal(t, "k2", id)
+
+	with, err := kr.PepperWith("k2", []byte("secret"))
+	require.NoError(t, err)
+	assert.Equal(t, mac, with)
+
+	other, err := kr.PepperWith("k1", []byte("secret"))
+	require.NoError(t, err)
+	assert.NotEqual(t, mac, other)
+
+	_, err = kr.PepperWith("k9", []byte("secret"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
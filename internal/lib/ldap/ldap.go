@@ -0,0 +1,239 @@
+// Package ldap checks passwords against an LDAP directory, e.g. Active
+// Directory. The user entry is searched with a service account and the
+// password is checked by binding as the entry.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrUserNotFound       = errors.New("ldap user not found")
+	ErrInvalidCredentials = errors.New("ldap invalid credentials")
+)
+
+// Config is the directory and how its users are found.
+type Config struct {
+	// URL is ldap://host:389 or ldaps://host:636.
+	URL string
+	// StartTLS upgrades an ldap:// connection to TLS before binding.
+	StartTLS bool
+	// CAFile is a PEM file of the CAs of the server certificate, the system
+	// pool if empty.
+	CAFile             string
+	InsecureSkipVerify bool
+	// BindDN and BindPassword are the service account searching for the
+	// users.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the entry of a user, %s is the escaped username,
+	// e.g. "(&(objectClass=person)(mail=%s))".
+	UserFilter string
+	// UIDAttribute is a stable id of the entry that survives renames,
+	// e.g. "entryUUID" or "objectGUID" in Active Directory.
+	UIDAttribute   string
+	EmailAttribute string
+	// GroupAttribute lists the DNs of the groups of the entry, e.g.
+	// "memberOf".
+	GroupAttribute string
+	// Timeout bounds the connection and every request, 10 seconds if zero.
+	Timeout time.Duration
+}
+
+// Entry is the user entry of the directory.
+type Entry struct {
+	DN     string
+	UID    string
+	Email  string
+	Groups []string
+}
+
+type Client struct {
+	cfg Config
+	tls *tls.Config
+}
+
+func New(cfg Config) (*Client, error) {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.UserFilter == "" || !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, fmt.Errorf("user filter %q has no %%s", cfg.UserFilter)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.CAFile)
+		}
+	}
+
+	return &Client{cfg: cfg, tls: tlsConfig}, nil
+}
+
+// Authenticate finds the entry of the username and checks the password by
+// binding as it. It returns ErrUserNotFound when no single entry matches and
+// ErrInvalidCredentials when the bind fails, other errors mean the directory
+// couldn't answer.
+func (c *Client) Authenticate(ctx context.Context, username string, password string) (Entry, error) {
+	// an empty password is an unauthenticated bind, which servers accept
+	if username == "" || password == "" {
+		return Entry{}, ErrInvalidCredentials
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer conn.Close()
+
+	found, err := c.find(conn, username)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return Entry{}, ErrInvalidCredentials
+		}
+		return Entry{}, fmt.Errorf("user bind: %w", err)
+	}
+
+	entry := Entry{
+		DN:    found.DN,
+		UID:   attributeString(found, c.cfg.UIDAttribute),
+		Email: strings.TrimSpace(found.GetAttributeValue(c.cfg.EmailAttribute)),
+	}
+	if c.cfg.GroupAttribute != "" {
+		entry.Groups = found.GetAttributeValues(c.cfg.GroupAttribute)
+	}
+	if entry.UID == "" {
+		return Entry{}, fmt.Errorf("entry %s has no %s", found.DN, c.cfg.UIDAttribute)
+	}
+
+	return entry, nil
+}
+
+// Probe takes as long as Authenticate without checking a password: it
+// searches the username and binds as no one. A failed login of another
+// backend calls it, so that it can't be told from an unknown username.
+func (c *Client) Probe(ctx context.Context, username string) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = c.find(conn, username)
+	switch {
+	case err == nil:
+		// in place of the bind as the entry
+		c.dummyBind(conn)
+	case !errors.Is(err, ErrUserNotFound):
+		return err
+	}
+
+	return nil
+}
+
+// find binds as the service account and searches the entry of the
+// username. A miss binds as no one, so that it takes as long as the bind of
+// a found entry.
+func (c *Client) find(conn *goldap.Conn, username string) (*goldap.Entry, error) {
+	if err := conn.Bind(c.cfg.BindDN, c.cfg.BindPassword); err != nil {
+		return nil, fmt.Errorf("service bind: %w", err)
+	}
+
+	attributes := []string{c.cfg.UIDAttribute, c.cfg.EmailAttribute}
+	if c.cfg.GroupAttribute != "" {
+		attributes = append(attributes, c.cfg.GroupAttribute)
+	}
+
+	res, err := conn.Search(goldap.NewSearchRequest(
+		c.cfg.BaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		2, int(c.cfg.Timeout/time.Second), false,
+		fmt.Sprintf(c.cfg.UserFilter, goldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	// an ambiguous filter mustn't let one user log in as another
+	if res == nil || len(res.Entries) != 1 {
+		c.dummyBind(conn)
+		return nil, ErrUserNotFound
+	}
+
+	return res.Entries[0], nil
+}
+
+// dummyBind binds as an entry that doesn't exist, it fails like the bind of
+// a wrong password without counting against any account.
+func (c *Client) dummyBind(conn *goldap.Conn) {
+	_ = conn.Bind("cn=sso-dummy-bind,"+c.cfg.BaseDN, "dummy password")
+}
+
+func (c *Client) dial(ctx context.Context) (*goldap.Conn, error) {
+	timeout := c.cfg.Timeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	conn, err := goldap.DialURL(c.cfg.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		goldap.DialWithTLSConfig(c.tls),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	conn.SetTimeout(timeout)
+
+	if c.cfg.StartTLS {
+		if err := conn.StartTLS(c.tlsFor(c.cfg.URL)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// tlsFor sets the server name StartTLS verifies the certificate against.
+func (c *Client) tlsFor(rawURL string) *tls.Config {
+	cfg := c.tls.Clone()
+	if u, err := url.Parse(rawURL); err == nil && cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+
+	return cfg
+}
+
+// attributeString returns the value of the attribute, a binary value such
+// as the objectGUID of Active Directory is hex encoded.
+func attributeString(entry *goldap.Entry, attribute string) string {
+	raw := entry.GetRawAttributeValue(attribute)
+	if !utf8.Valid(raw) {
+		return hex.EncodeToString(raw)
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,323 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBaseDN   = "dc=example,dc=com"
+	testBindDN   = "cn=sso,dc=example,dc=com"
+	testBindPass = "service password"
+)
+
+type stubEntry struct {
+	password   string
+	attributes map[string][]string
+}
+
+// stubDirectory is an LDAP server on a local listener. It answers simple
+// binds and equality searches of one attribute, "*" matches any value.
+type stubDirectory struct {
+	addr    string
+	entries map[string]stubEntry
+
+	mu       sync.Mutex
+	binds    []string
+	searches []string
+}
+
+func newStubDirectory(t *testing.T, entries map[string]stubEntry) *stubDirectory {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	d := &stubDirectory{addr: ln.Addr().String(), entries: entries}
+	entries[testBindDN] = stubEntry{password: testBindPass}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+
+	return d
+}
+
+func (d *stubDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Value.(string), op.Children[2].Data.String()
+			d.mu.Lock()
+			d.binds = append(d.binds, dn)
+			d.mu.Unlock()
+
+			code := uint16(goldap.LDAPResultSuccess)
+			if entry, ok := d.entries[dn]; !ok || entry.password != password {
+				code = goldap.LDAPResultInvalidCredentials
+			}
+			d.write(conn, id, result(goldap.ApplicationBindResponse, code))
+		case goldap.ApplicationSearchRequest:
+			filter, err := goldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				return
+			}
+			sizeLimit := int(op.Children[3].Value.(int64))
+			d.mu.Lock()
+			d.searches = append(d.searches, filter)
+			d.mu.Unlock()
+
+			code, sent := uint16(goldap.LDAPResultSuccess), 0
+			for dn, entry := range d.entries {
+				if !entry.matches(filter) {
+					continue
+				}
+				if sent == sizeLimit {
+					code = goldap.LDAPResultSizeLimitExceeded
+					break
+				}
+				d.write(conn, id, entry.packet(dn))
+				sent++
+			}
+			d.write(conn, id, result(goldap.ApplicationSearchResultDone, code))
+		default:
+			return
+		}
+	}
+}
+
+func (d *stubDirectory) write(conn net.Conn, id int64, op *ber.Packet) {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "message")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "id"))
+	msg.AppendChild(op)
+
+	_, _ = conn.Write(msg.Bytes())
+}
+
+func (d *stubDirectory) bound() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.binds...)
+}
+
+func result(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matched dn"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "message"))
+
+	return op
+}
+
+// matches checks a filter like "(mail=user@example.com)".
+func (e stubEntry) matches(filter string) bool {
+	attribute, value, ok := strings.Cut(strings.Trim(filter, "()"), "=")
+	if !ok {
+		return false
+	}
+
+	for _, v := range e.attributes[attribute] {
+		if value == "*" || v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e stubEntry) packet(dn string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "dn"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range e.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+
+	return op
+}
+
+func testDirectory(t *testing.T) (*stubDirectory, *Client) {
+	t.Helper()
+
+	d := newStubDirectory(t, map[string]stubEntry{
+		"uid=alice,dc=example,dc=com": {password: "alice password", attributes: map[string][]string{
+			"mail":       {"alice@example.com"},
+			"entryUUID":  {"alice-uuid"},
+			"memberOf":   {"cn=admins,dc=example,dc=com", "cn=staff,dc=example,dc=com"},
+			"department": {"sales"},
+		}},
+		"uid=bob,dc=example,dc=com": {password: "bob password", attributes: map[string][]string{
+			"mail":       {"bob@example.com"},
+			"entryUUID":  {"bob-uuid"},
+			"department": {"sales"},
+		}},
+		"uid=guid,dc=example,dc=com": {password: "guid password", attributes: map[string][]string{
+			"mail":      {"guid@example.com"},
+			"entryUUID": {"\xff\x00\x10"},
+		}},
+	})
+
+	client, err := New(Config{
+		URL:            "ldap://" + d.addr,
+		BindDN:         testBindDN,
+		BindPassword:   testBindPass,
+		BaseDN:         testBaseDN,
+		UserFilter:     "(mail=%s)",
+		UIDAttribute:   "entryUUID",
+		EmailAttribute: "mail",
+		GroupAttribute: "memberOf",
+		Timeout:        5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	return d, client
+}
+
+func TestAuthenticate(t *testing.T) {
+	_, client := testDirectory(t)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     Entry
+		wantErr  error
+	}{
+		{
+			name:     "valid",
+			username: "alice@example.com",
+			password: "alice password",
+			want: Entry{
+				DN:     "uid=alice,dc=example,dc=com",
+				UID:    "alice-uuid",
+				Email:  "alice@example.com",
+				Groups: []string{"cn=admins,dc=example,dc=com", "cn=staff,dc=example,dc=com"},
+			},
+		},
+		{
+			name:     "binary uid",
+			username: "guid@example.com",
+			password: "guid password",
+			want:     Entry{DN: "uid=guid,dc=example,dc=com", UID: "ff0010", Email: "guid@example.com", Groups: []string{}},
+		},
+		{name: "wrong password", username: "alice@example.com", password: "bob password", wantErr: ErrInvalidCredentials},
+		{name: "empty password", username: "alice@example.com", wantErr: ErrInvalidCredentials},
+		{name: "unknown user", username: "carol@example.com", password: "alice password", wantErr: ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := client.Authenticate(context.Background(), tt.username, tt.password)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, entry)
+		})
+	}
+}
+
+func TestAuthenticate_EscapesUsername(t *testing.T) {
+	d, client := testDirectory(t)
+
+	_, err := client.Authenticate(context.Background(), "*)(uid=*", "alice password")
+	require.ErrorIs(t, err, ErrUserNotFound)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	assert.Equal(t, []string{`(mail=\2a\29\28uid=\2a)`}, d.searches)
+}
+
+func TestAuthenticate_AmbiguousFilter(t *testing.T) {
+	d, _ := testDirectory(t)
+
+	client, err := New(Config{
+		URL:            "ldap://" + d.addr,
+		BindDN:         testBindDN,
+		BindPassword:   testBindPass,
+		BaseDN:         testBaseDN,
+		UserFilter:     "(department=%s)",
+		UIDAttribute:   "entryUUID",
+		EmailAttribute: "mail",
+	})
+	require.NoError(t, err)
+
+	// alice and bob both match, neither may log in
+	_, err = client.Authenticate(context.Background(), "sales", "alice password")
+	require.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestAuthenticate_ServiceBindFails(t *testing.T) {
+	d, _ := testDirectory(t)
+
+	client, err := New(Config{
+		URL:          "ldap://" + d.addr,
+		BindDN:       testBindDN,
+		BindPassword: "wrong",
+		BaseDN:       testBaseDN,
+		UserFilter:   "(mail=%s)",
+	})
+	require.NoError(t, err)
+
+	// a broken service account is an outage, not a wrong password
+	_, err = client.Authenticate(context.Background(), "alice@example.com", "alice password")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrInvalidCredentials))
+	assert.False(t, errors.Is(err, ErrUserNotFound))
+}
+
+func TestProbe(t *testing.T) {
+	d, client := testDirectory(t)
+
+	require.NoError(t, client.Probe(context.Background(), "alice@example.com"))
+	require.NoError(t, client.Probe(context.Background(), "carol@example.com"))
+
+	// both bind as the service account and then as no one
+	dummy := "cn=sso-dummy-bind," + testBaseDN
+	assert.Equal(t, []string{testBindDN, dummy, testBindDN, dummy}, d.bound())
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{UserFilter: "(mail=alice@example.com)"})
+	assert.Error(t, err)
+
+	_, err = New(Config{UserFilter: "(mail=%s)", CAFile: "/nonexistent/ca.pem"})
+	assert.Error(t, err)
+}
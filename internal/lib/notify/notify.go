@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// Message is a notification for a user, To is the email address.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// LogNotifier writes the messages to the log instead of sending them, it is
+// meant for local runs.
+type LogNotifier struct {
+	log *slog.Logger
+}
+
+func NewLogNotifier(log *slog.Logger) *LogNotifier {
+	return &LogNotifier{log: log}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	n.log.Info("notification", slog.String("to", msg.To), slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body))
+
+	return nil
+}
+
+// SMTPNotifier sends the messages by mail.
+type SMTPNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPNotifier returns a notifier sending from the from address through
+// the server at host:port, it authenticates only when username is set.
+func NewSMTPNotifier(host string, port int, username string, password string, from string) *SMTPNotifier {
+	n := &SMTPNotifier{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+	}
+	if username != "" {
+		n.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return n
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	const op = "notify.SMTPNotifier.Notify"
+
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("%s: header contains a line break", op)
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		n.from, msg.To, msg.Subject, msg.Body)
+
+	if err := smtp.SendMail(n.addr, n.auth, n.from, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
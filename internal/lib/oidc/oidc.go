@@ -0,0 +1,315 @@
+// Package oidc is a relying party of an upstream OpenID Connect provider. It
+// discovers the provider, builds the authorization URL of the code flow with
+// PKCE and redeems the code for a verified ID token.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDiscovery     = errors.New("oidc discovery failed")
+	ErrTokenExchange = errors.New("oidc code exchange failed")
+	ErrInvalidToken  = errors.New("invalid id token")
+)
+
+const (
+	// keysRefreshInterval limits how often the keys are fetched for an
+	// unknown key id, so forged tokens can't make us hammer the provider.
+	keysRefreshInterval = time.Minute
+	maxResponseSize     = 1 << 20
+)
+
+// Config is a client registered at the provider.
+type Config struct {
+	// Issuer is the issuer URL, the discovery document is at
+	// <Issuer>/.well-known/openid-configuration.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are requested on top of "openid".
+	Scopes []string
+	// Timeout bounds every request to the provider, 10 seconds if zero.
+	Timeout time.Duration
+}
+
+// Metadata is the part of the discovery document the client uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an upstream provider. It is discovered on first use, so an
+// unreachable provider doesn't keep the service from starting.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *Metadata
+	keys        map[string]any
+	keysFetched time.Time
+}
+
+func New(cfg Config) *Provider {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// AuthCodeURL returns the URL the user is sent to. The state comes back with
+// the code, the nonce comes back in the ID token and the challenge is the
+// S256 challenge of the code verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems the code at the token endpoint and returns the claims of
+// the ID token, verified against the keys of the provider. The token must
+// be issued by the provider for the client and carry the nonce.
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (map[string]any, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var resp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenExchange, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d: %s %s", ErrTokenExchange, status, resp.Error, resp.ErrorDescription)
+	}
+	if resp.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in the response", ErrTokenExchange)
+	}
+
+	return p.verify(ctx, meta, resp.IDToken, nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, meta *Metadata, idToken string, nonce string) (map[string]any, error) {
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		return p.key(ctx, meta, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("%w: sub claim is missing", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// key returns the key of the id, the keys are fetched again when the
+// provider rotated them.
+func (p *Provider) key(ctx context.Context, meta *Metadata, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysFetched) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, meta.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// lookup finds the key of the id, a token without a key id matches the only
+// key of the provider.
+func (p *Provider) lookup(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+
+	return key, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("fetch keys: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("fetch keys: status %d", status)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// keys of other types don't verify our tokens
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (p *Provider) metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+
+	var meta Metadata
+	status, err := p.do(req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrDiscovery, status)
+	}
+	// the document must be the issuer's own (OpenID Connect Discovery 1.0,
+	// section 4.3)
+	if strings.TrimSuffix(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q doesn't match %q", ErrDiscovery, meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: endpoints are missing", ErrDiscovery)
+	}
+
+	p.meta = &meta
+
+	return p.meta, nil
+}
+
+// do sends the request and decodes the JSON answer into v, whatever the
+// status.
+func (p *Provider) do(req *http.Request, v any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, err
+	}
+
+	return resp.StatusCode, nil
+}
+
+// CodeChallenge returns the S256 challenge of the code verifier (RFC 7636,
+// section 4.2).
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
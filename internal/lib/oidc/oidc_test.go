@@ -0,0 +1,314 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientID = "client"
+	testNonce    = "nonce"
+)
+
+// stubProvider is an OpenID provider on an httptest server. The token
+// endpoint answers with idToken, the keys are served as a JWKS.
+type stubProvider struct {
+	srv        *httptest.Server
+	issuer     string
+	keys       []jsonWebKey
+	idToken    string
+	tokenCode  int
+	tokenForm  url.Values
+	keyFetches atomic.Int32
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	t.Helper()
+
+	p := &stubProvider{tokenCode: http.StatusOK}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Metadata{
+			Issuer:                p.issuer,
+			AuthorizationEndpoint: p.srv.URL + "/authorize",
+			TokenEndpoint:         p.srv.URL + "/token",
+			JWKSURI:               p.srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		p.tokenForm = r.PostForm
+
+		if p.tokenCode != http.StatusOK {
+			writeJSON(w, p.tokenCode, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id_token": p.idToken})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		p.keyFetches.Add(1)
+		writeJSON(w, http.StatusOK, map[string]any{"keys": p.keys})
+	})
+
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	p.issuer = p.srv.URL
+
+	return p
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (p *stubProvider) provider() *Provider {
+	return New(Config{
+		Issuer:       p.srv.URL + "/",
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "https://sso.example.com/callback",
+		Scopes:       []string{"email"},
+	})
+}
+
+func rsaKey(t *testing.T, kid string) (*rsa.PrivateKey, jsonWebKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return key, jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func sign(t *testing.T, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func validClaims(issuer string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   issuer,
+		"aud":   testClientID,
+		"sub":   "user-1",
+		"email": "user@example.com",
+		"nonce": testNonce,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	stub := newStubProvider(t)
+
+	raw, err := stub.provider().AuthCodeURL(context.Background(), "state", testNonce, "verifier")
+	require.NoError(t, err)
+
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, stub.srv.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+
+	q := u.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, testClientID, q.Get("client_id"))
+	assert.Equal(t, "https://sso.example.com/callback", q.Get("redirect_uri"))
+	assert.Equal(t, "openid email", q.Get("scope"))
+	assert.Equal(t, "state", q.Get("state"))
+	assert.Equal(t, testNonce, q.Get("nonce"))
+	assert.Equal(t, CodeChallenge("verifier"), q.Get("code_challenge"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+}
+
+func TestDiscovery(t *testing.T) {
+	stub := newStubProvider(t)
+	stub.issuer = "https://evil.example.com"
+
+	_, err := stub.provider().AuthCodeURL(context.Background(), "state", testNonce, "verifier")
+	assert.ErrorIs(t, err, ErrDiscovery)
+
+	_, err = New(Config{Issuer: stub.srv.URL + "/missing"}).AuthCodeURL(context.Background(), "state", testNonce, "verifier")
+	assert.ErrorIs(t, err, ErrDiscovery)
+}
+
+func TestExchange(t *testing.T) {
+	stub := newStubProvider(t)
+	key, jwk := rsaKey(t, "k1")
+	otherKey, _ := rsaKey(t, "k1")
+	stub.keys = []jsonWebKey{jwk}
+
+	expired := validClaims(stub.srv.URL)
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	otherAudience := validClaims(stub.srv.URL)
+	otherAudience["aud"] = "another-client"
+	otherIssuer := validClaims("https://evil.example.com")
+	otherNonce := validClaims(stub.srv.URL)
+	otherNonce["nonce"] = "replayed"
+	noSubject := validClaims(stub.srv.URL)
+	delete(noSubject, "sub")
+
+	tests := []struct {
+		name      string
+		idToken   string
+		tokenCode int
+		wantErr   error
+	}{
+		{name: "valid", idToken: sign(t, key, "k1", validClaims(stub.srv.URL))},
+		{name: "without a key id", idToken: sign(t, key, "", validClaims(stub.srv.URL))},
+		{name: "expired", idToken: sign(t, key, "k1", expired), wantErr: ErrInvalidToken},
+		{name: "another audience", idToken: sign(t, key, "k1", otherAudience), wantErr: ErrInvalidToken},
+		{name: "another issuer", idToken: sign(t, key, "k1", otherIssuer), wantErr: ErrInvalidToken},
+		{name: "another nonce", idToken: sign(t, key, "k1", otherNonce), wantErr: ErrInvalidToken},
+		{name: "no subject", idToken: sign(t, key, "k1", noSubject), wantErr: ErrInvalidToken},
+		{name: "forged", idToken: sign(t, otherKey, "k1", validClaims(stub.srv.URL)), wantErr: ErrInvalidToken},
+		{name: "unsigned", idToken: unsigned(t, validClaims(stub.srv.URL)), wantErr: ErrInvalidToken},
+		{name: "code rejected", tokenCode: http.StatusBadRequest, wantErr: ErrTokenExchange},
+		{name: "no id token", wantErr: ErrTokenExchange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub.idToken = tt.idToken
+			stub.tokenCode = http.StatusOK
+			if tt.tokenCode != 0 {
+				stub.tokenCode = tt.tokenCode
+			}
+
+			claims, err := stub.provider().Exchange(context.Background(), "code", "verifier", testNonce)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims["sub"])
+			assert.Equal(t, "user@example.com", claims["email"])
+
+			assert.Equal(t, "authorization_code", stub.tokenForm.Get("grant_type"))
+			assert.Equal(t, "code", stub.tokenForm.Get("code"))
+			assert.Equal(t, "verifier", stub.tokenForm.Get("code_verifier"))
+			assert.Equal(t, testClientID, stub.tokenForm.Get("client_id"))
+		})
+	}
+}
+
+func unsigned(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	return token
+}
+
+func TestExchange_KeyRotation(t *testing.T) {
+	stub := newStubProvider(t)
+	oldKey, oldJWK := rsaKey(t, "k1")
+	stub.keys = []jsonWebKey{oldJWK}
+	provider := stub.provider()
+
+	stub.idToken = sign(t, oldKey, "k1", validClaims(stub.srv.URL))
+	_, err := provider.Exchange(context.Background(), "code", "verifier", testNonce)
+	require.NoError(t, err)
+
+	// a new key is fetched once the provider uses it
+	newKey, newJWK := rsaKey(t, "k2")
+	stub.keys = []jsonWebKey{oldJWK, newJWK}
+	provider.keysFetched = time.Now().Add(-keysRefreshInterval)
+
+	stub.idToken = sign(t, newKey, "k2", validClaims(stub.srv.URL))
+	_, err = provider.Exchange(context.Background(), "code", "verifier", testNonce)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), stub.keyFetches.Load())
+
+	// unknown key ids don't hammer the provider
+	stub.idToken = sign(t, newKey, "k3", validClaims(stub.srv.URL))
+	_, err = provider.Exchange(context.Background(), "code", "verifier", testNonce)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, int32(2), stub.keyFetches.Load())
+}
+
+func TestExchange_ECKey(t *testing.T) {
+	stub := newStubProvider(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	stub.keys = []jsonWebKey{{
+		Kty: "EC",
+		Kid: "ec",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+	}}
+
+	stub.idToken = sign(t, key, "ec", validClaims(stub.srv.URL))
+	claims, err := stub.provider().Exchange(context.Background(), "code", "verifier", testNonce)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims["sub"])
+}
+
+func TestPublicKey(t *testing.T) {
+	_, jwk := rsaKey(t, "k1")
+
+	tests := []struct {
+		name    string
+		key     jsonWebKey
+		wantErr bool
+	}{
+		{name: "rsa", key: jwk},
+		{name: "unsupported type", key: jsonWebKey{Kty: "oct"}, wantErr: true},
+		{name: "unsupported curve", key: jsonWebKey{Kty: "EC", Crv: "P-192", X: "AQ", Y: "AQ"}, wantErr: true},
+		{name: "point off the curve", key: jsonWebKey{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}, wantErr: true},
+		{name: "missing modulus", key: jsonWebKey{Kty: "RSA", E: "AQAB"}, wantErr: true},
+		{name: "huge exponent", key: jsonWebKey{Kty: "RSA", N: jwk.N, E: "AQAAAAAAAAAA"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.key.publicKey()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package password checks passwords against a configurable policy.
+package password
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	RuleMinLength  = "min_length"
+	RuleMaxLength  = "max_length"
+	RuleLower      = "lower"
+	RuleUpper      = "upper"
+	RuleDigit      = "digit"
+	RuleSymbol     = "symbol"
+	RuleDenylist   = "denylist"
+	RuleEmail      = "email"
+	RuleStrength   = "strength"
+	RuleBreached   = "breached"
+	RuleHistory    = "history"
+	minEmailLength = 3
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// denylist holds the embedded common passwords, lowercased.
+var denylist = func() map[string]struct{} {
+	list := make(map[string]struct{})
+	for _, p := range strings.Fields(commonPasswords) {
+		list[strings.ToLower(p)] = struct{}{}
+	}
+
+	return list
+}()
+
+// Policy is a set of password rules, zero fields are not applied.
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Denylist rejects the embedded list of common passwords.
+	Denylist bool
+	// ForbidEmail rejects passwords containing the local part of the email.
+	ForbidEmail bool
+	// MinScore is the minimal Strength score, 0 to 4.
+	MinScore int
+}
+
+// Violation is a broken rule.
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+// PolicyError lists every rule the password breaks.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+
+	return "password violates " + strings.Join(rules, ", ")
+}
+
+// Check returns a *PolicyError if the password breaks any rule.
+func (p Policy) Check(password string, email string) error {
+	var violations []Violation
+	add := func(rule string, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Description: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		add(RuleMinLength, "must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(RuleMaxLength, "must be at most %d characters long", p.MaxLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireLower && !lower {
+		add(RuleLower, "must contain a lowercase letter")
+	}
+	if p.RequireUpper && !upper {
+		add(RuleUpper, "must contain an uppercase letter")
+	}
+	if p.RequireDigit && !digit {
+		add(RuleDigit, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add(RuleSymbol, "must contain a symbol")
+	}
+
+	if p.Denylist && Common(password) {
+		add(RuleDenylist, "is a commonly used password")
+	}
+
+	if p.ForbidEmail {
+		local, _, _ := strings.Cut(strings.ToLower(email), "@")
+		if len(local) >= minEmailLength && strings.Contains(strings.ToLower(password), local) {
+			add(RuleEmail, "must not contain the email")
+		}
+	}
+
+	if p.MinScore > 0 {
+		if score := Strength(password); score < p.MinScore {
+			add(RuleStrength, "is too weak, strength %d of 4, at least %d is required", score, p.MinScore)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Common reports whether the password is in the embedded denylist.
+func Common(password string) bool {
+	_, ok := denylist[strings.ToLower(password)]
+
+	return ok
+}
@@ -0,0 +1,91 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rules returns the rules the password breaks, nil if none.
+func rules(t *testing.T, p Policy, password, email string) []string {
+	t.Helper()
+
+	err := p.Check(password, email)
+	if err == nil {
+		return nil
+	}
+
+	var policyErr *PolicyError
+	require.ErrorAs(t, err, &policyErr)
+
+	var got []string
+	for _, v := range policyErr.Violations {
+		assert.NotEmpty(t, v.Description)
+		got = append(got, v.Rule)
+	}
+
+	return got
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, Policy{}.Check("", ""))
+
+	p := Policy{MinLength: 8, MaxLength: 16, RequireLower: true, RequireUpper: true, RequireDigit: true, RequireSymbol: true}
+	assert.Nil(t, rules(t, p, "Tr0ub4dor&3", ""))
+	// every broken rule is reported at once
+	assert.Equal(t, []string{RuleMinLength, RuleUpper, RuleDigit, RuleSymbol}, rules(t, p, "abc", ""))
+	assert.Equal(t, []string{RuleMaxLength, RuleLower}, rules(t, p, "TR0UB4DOR&3TR0UB4DOR&3", ""))
+	// the length is in characters, not bytes
+	assert.Nil(t, rules(t, Policy{MaxLength: 6}, "пароль", ""))
+	assert.Equal(t, []string{RuleMinLength}, rules(t, Policy{MinLength: 5}, "пар", ""))
+
+	assert.Equal(t, []string{RuleDenylist}, rules(t, Policy{Denylist: true}, "PassWord", ""))
+	assert.Nil(t, rules(t, Policy{Denylist: true}, "password-of-mine", ""))
+
+	email := Policy{ForbidEmail: true}
+	assert.Equal(t, []string{RuleEmail}, rules(t, email, "Alice2024!", "alice@example.com"))
+	assert.Nil(t, rules(t, email, "Tr0ub4dor&3", "alice@example.com"))
+	// short local parts would forbid too much
+	assert.Nil(t, rules(t, email, "Alice2024!", "al@example.com"))
+
+	assert.Equal(t, []string{RuleStrength}, rules(t, Policy{MinScore: 3}, "password2024", ""))
+	assert.Nil(t, rules(t, Policy{MinScore: 3}, "correct horse battery staple", ""))
+}
+
+func TestPolicyError(t *testing.T) {
+	err := &PolicyError{Violations: []Violation{{Rule: RuleMinLength}, {Rule: RuleBreached}}}
+
+	assert.Equal(t, "password violates min_length, breached", err.Error())
+}
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{password: "", want: 0},
+		{password: "aaaaaaaaaaaa", want: 0},
+		{password: "abcdefgh", want: 0},
+		{password: "qwertyuiop", want: 0},
+		{password: "1987", want: 0},
+		{password: "P@ssw0rd", want: 0},
+		{password: "password2024", want: 1},
+		{password: "zkqjvbnwxf", want: 4},
+		{password: "Tr0ub4dor&3", want: 4},
+		{password: "correct horse battery staple", want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			assert.Equal(t, tt.want, Strength(tt.password))
+		})
+	}
+}
+
+func TestCommon(t *testing.T) {
+	assert.True(t, Common("password"))
+	assert.True(t, Common("QWERTY"))
+	assert.False(t, Common("Tr0ub4dor&3"))
+	assert.False(t, Common(""))
+}
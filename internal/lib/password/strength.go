@@ -0,0 +1,154 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// keyboardRows are scanned for runs of neighbouring keys like "qwer".
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+var leet = strings.NewReplacer("4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+
+const minPatternLength = 3
+
+// Strength scores the password from 0 (too guessable) to 4 (very
+// unguessable) like zxcvbn does. The password is split greedily into
+// patterns, repeats, sequences, keyboard runs, years and common passwords,
+// which
+// are cheap to guess, and the rest is brute forced over its character set.
+func Strength(password string) int {
+	guesses := 0.0
+
+	runes := []rune(password)
+	lower := []rune(strings.ToLower(password))
+	// the replacements keep one rune per rune, so the positions match
+	unleet := []rune(leet.Replace(string(lower)))
+
+	charset := math.Log10(float64(charsetSize(runes)))
+
+	for i := 0; i < len(runes); {
+		n, cost := match(lower, unleet, i)
+		if n == 0 {
+			guesses += charset
+			i++
+			continue
+		}
+
+		guesses += cost
+		i += n
+	}
+
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+
+	return 4
+}
+
+// match returns the length of the longest pattern at position i and the
+// log10 of the guesses needed for it, 0 if nothing matches. unleet is s with
+// l33t substitutions undone.
+func match(s []rune, unleet []rune, i int) (int, float64) {
+	best, cost := 0, 0.0
+	try := func(n int, c float64) {
+		if n >= minPatternLength && n > best {
+			best, cost = n, c
+		}
+	}
+
+	// common passwords and their parts, e.g. "password" in "password2024"
+	for _, word := range [][]rune{s, unleet} {
+		for j := len(word); j-i >= minPatternLength+1; j-- {
+			if _, ok := denylist[string(word[i:j])]; ok {
+				try(j-i, math.Log10(float64(len(denylist))))
+				break
+			}
+		}
+	}
+
+	if i+4 <= len(s) {
+		if year := string(s[i : i+4]); (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) &&
+			unicode.IsDigit(s[i+2]) && unicode.IsDigit(s[i+3]) {
+			try(4, math.Log10(200))
+		}
+	}
+
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	try(n, math.Log10(float64(charsetSize(s[i:i+1]))*float64(n)))
+
+	for _, step := range []rune{1, -1} {
+		n = 1
+		for i+n < len(s) && s[i+n]-s[i+n-1] == step {
+			n++
+		}
+		try(n, math.Log10(26*float64(n)))
+	}
+
+	for _, row := range keyboardRows {
+		for _, dir := range []int{1, -1} {
+			n = 1
+			for i+n < len(s) && adjacent(row, s[i+n-1], s[i+n], dir) {
+				n++
+			}
+			try(n, math.Log10(float64(len(row))*2*float64(n)))
+		}
+	}
+
+	return best, cost
+}
+
+func adjacent(row string, a, b rune, dir int) bool {
+	ia := strings.IndexRune(row, a)
+	ib := strings.IndexRune(row, b)
+
+	return ia >= 0 && ib >= 0 && ib-ia == dir
+}
+
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+
+	return max(size, 1)
+}
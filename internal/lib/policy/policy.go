@@ -0,0 +1,618 @@
+// Package policy implements a small expression language used by ABAC rules.
+//
+// An expression is evaluated against an environment of attributes, usually
+// "user", "resource", "context" and "action", for example:
+//
+//	"editor" in user.roles && user.department == resource.department &&
+//	    context.hour >= 9 && context.hour < 18
+//
+// Supported: string, number, bool and null literals, lists ([a, b]),
+// attribute access (a.b.c), ! && ||, == != < <= > >=, and "in" for lists,
+// maps and substrings. Missing attributes evaluate to null, every comparison
+// with null is false.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrSyntax = errors.New("policy syntax error")
+	ErrType   = errors.New("policy type error")
+)
+
+// Program is a compiled expression ready to be evaluated.
+type Program struct {
+	root node
+}
+
+// Eval evaluates the program, the result must be a boolean or null, which
+// is treated as false.
+func (p *Program) Eval(env map[string]any) (bool, error) {
+	return evalBool(p.root, env)
+}
+
+// Compile parses the expression into a Program.
+func Compile(expr string) (*Program, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("%w: unexpected %q at %d", ErrSyntax, p.peek().val, p.peek().pos)
+	}
+
+	return &Program{root: root}, nil
+}
+
+// maxCached bounds the compiled expressions an Engine keeps, the cache is
+// dropped when it's full, e.g. after many policies were replaced.
+const maxCached = 1024
+
+// Engine is the built-in evaluator, it caches compiled expressions.
+type Engine struct {
+	mu    sync.RWMutex
+	cache map[string]*Program
+}
+
+func NewEngine() *Engine {
+	return &Engine{cache: make(map[string]*Program)}
+}
+
+// Validate checks that the expression compiles.
+func (e *Engine) Validate(expr string) error {
+	_, err := e.program(expr)
+
+	return err
+}
+
+func (e *Engine) Evaluate(expr string, env map[string]any) (bool, error) {
+	prog, err := e.program(expr)
+	if err != nil {
+		return false, err
+	}
+
+	return prog.Eval(env)
+}
+
+func (e *Engine) program(expr string) (*Program, error) {
+	e.mu.RLock()
+	prog, ok := e.cache[expr]
+	e.mu.RUnlock()
+	if ok {
+		return prog, nil
+	}
+
+	prog, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	if len(e.cache) >= maxCached {
+		e.cache = make(map[string]*Program)
+	}
+	e.cache[expr] = prog
+	e.mu.Unlock()
+
+	return prog, nil
+}
+
+// lexer
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	val  string
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isLetter(c):
+			j := i
+			for j < len(src) && (isLetter(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, val: src[i:j], pos: i})
+			i = j
+		case isDigit(c):
+			j := i
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{kind: tokNumber, val: src[i:j], pos: i})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("%w: unterminated string at %d", ErrSyntax, i)
+			}
+			toks = append(toks, token{kind: tokString, val: sb.String(), pos: i})
+			i = j + 1
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ",", "."} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("%w: unexpected character %q at %d", ErrSyntax, c, i)
+			}
+			toks = append(toks, token{kind: tokOp, val: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parser
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) accept(val string) bool {
+	if t := p.peek(); (t.kind == tokOp || t.kind == tokIdent) && t.val == val {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(val string) error {
+	if !p.accept(val) {
+		return fmt.Errorf("%w: expected %q at %d", ErrSyntax, val, p.peek().pos)
+	}
+
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.accept("!") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notNode{inner: inner}, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+
+			return &compareNode{op: op, left: left, right: right}, nil
+		}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad number %q at %d", ErrSyntax, t.val, t.pos)
+		}
+		return &literalNode{val: f}, nil
+	case tokString:
+		return &literalNode{val: t.val}, nil
+	case tokIdent:
+		switch t.val {
+		case "true":
+			return &literalNode{val: true}, nil
+		case "false":
+			return &literalNode{val: false}, nil
+		case "null":
+			return &literalNode{val: nil}, nil
+		}
+
+		path := []string{t.val}
+		for p.accept(".") {
+			field := p.next()
+			if field.kind != tokIdent {
+				return nil, fmt.Errorf("%w: expected attribute name at %d", ErrSyntax, field.pos)
+			}
+			path = append(path, field.val)
+		}
+		return &attrNode{path: path}, nil
+	case tokOp:
+		switch t.val {
+		case "(":
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			list := &listNode{}
+			if p.accept("]") {
+				return list, nil
+			}
+			for {
+				item, err := p.parsePrimary()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if p.accept("]") {
+					return list, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: unexpected %q at %d", ErrSyntax, t.val, t.pos)
+}
+
+// evaluation
+
+type node interface {
+	eval(env map[string]any) (any, error)
+}
+
+type literalNode struct {
+	val any
+}
+
+func (n *literalNode) eval(map[string]any) (any, error) {
+	return n.val, nil
+}
+
+type attrNode struct {
+	path []string
+}
+
+func (n *attrNode) eval(env map[string]any) (any, error) {
+	var cur any = env
+
+	for _, key := range n.path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+		cur = m[key]
+	}
+
+	return normalize(cur), nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(env map[string]any) (any, error) {
+	res := make([]any, 0, len(n.items))
+
+	for _, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+
+	return res, nil
+}
+
+type notNode struct {
+	inner node
+}
+
+// eval negates the inner condition, null is false as in evalBool, so the
+// negation of a missing attribute is true.
+func (n *notNode) eval(env map[string]any) (any, error) {
+	b, err := evalBool(n.inner, env)
+	if err != nil {
+		return nil, err
+	}
+
+	return !b, nil
+}
+
+type logicNode struct {
+	op          string
+	left, right node
+}
+
+func (n *logicNode) eval(env map[string]any) (any, error) {
+	l, err := evalBool(n.left, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "&&" && !l {
+		return false, nil
+	}
+	if n.op == "||" && l {
+		return true, nil
+	}
+
+	return evalBool(n.right, env)
+}
+
+func evalBool(n node, env map[string]any) (bool, error) {
+	v, err := n.eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	// missing attributes never satisfy a condition
+	if v == nil {
+		return false, nil
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: expected bool, got %T", ErrType, v)
+	}
+
+	return b, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(env map[string]any) (any, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// a missing attribute satisfies no comparison, not even with another
+	// missing one or null, so leaving attributes out can't match a rule
+	if l == nil || r == nil {
+		return false, nil
+	}
+
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		return contains(r, l), nil
+	}
+
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot compare number with %T", ErrType, r)
+		}
+		return order(n.op, cmpFloat(lv, rv)), nil
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot compare string with %T", ErrType, r)
+		}
+		return order(n.op, strings.Compare(lv, rv)), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s is not defined for %T", ErrType, n.op, l)
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+func order(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+
+	return false
+}
+
+// equal compares two values, null equals nothing.
+func equal(a, b any) bool {
+	switch av := a.(type) {
+	case float64, string, bool:
+		return a == b
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+func contains(container, item any) bool {
+	switch c := container.(type) {
+	case []any:
+		for _, v := range c {
+			if equal(v, item) {
+				return true
+			}
+		}
+	case map[string]any:
+		key, ok := item.(string)
+		if ok {
+			_, found := c[key]
+			return found
+		}
+	case string:
+		sub, ok := item.(string)
+		if ok {
+			return strings.Contains(c, sub)
+		}
+	}
+
+	return false
+}
+
+// normalize converts Go values coming from callers to the types the
+// evaluator works with.
+func normalize(v any) any {
+	switch val := v.(type) {
+	case int:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case float32:
+		return float64(val)
+	case []string:
+		res := make([]any, len(val))
+		for i, s := range val {
+			res[i] = s
+		}
+		return res
+	case []any:
+		res := make([]any, len(val))
+		for i, item := range val {
+			res[i] = normalize(item)
+		}
+		return res
+	}
+
+	return v
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval(t *testing.T) {
+	env := map[string]any{
+		"user": map[string]any{
+			"roles":      []any{"editor"},
+			"department": "sales",
+			"verified":   true,
+		},
+		"resource": map[string]any{"department": "sales", "owner": 7},
+		"context":  map[string]any{"hour": 10},
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    bool
+		wantErr error
+	}{
+		{name: "role and department", expr: `"editor" in user.roles && user.department == resource.department`, want: true},
+		{name: "office hours", expr: `context.hour >= 9 && context.hour < 18`, want: true},
+		{name: "number equality", expr: `resource.owner == 7`, want: true},
+		{name: "missing attribute is false", expr: `user.suspended`, want: false},
+		{name: "negated missing attribute is true", expr: `!user.suspended`, want: true},
+		{name: "negation", expr: `!user.verified`, want: false},
+		{name: "null comparison", expr: `user.suspended == null`, want: false},
+		{name: "missing attributes are not equal", expr: `user.team == resource.team`, want: false},
+		{name: "missing attributes are not unequal", expr: `user.team != resource.team`, want: false},
+		{name: "missing attribute in a list", expr: `user.team in [null, "ops"]`, want: false},
+		{name: "order with null", expr: `user.age > 18`, want: false},
+		{name: "not a bool", expr: `user.department`, wantErr: ErrType},
+		{name: "negated non bool", expr: `!user.department`, wantErr: ErrType},
+		{name: "order of mixed types", expr: `context.hour > "9"`, wantErr: ErrType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := Compile(tt.expr)
+			require.NoError(t, err)
+
+			got, err := prog.Eval(env)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCompile_SyntaxError(t *testing.T) {
+	for _, expr := range []string{`user.department ==`, `(user.verified`, `"unterminated`, `user.`} {
+		_, err := Compile(expr)
+		assert.ErrorIs(t, err, ErrSyntax, expr)
+	}
+}
+
+func TestEngine_CacheIsBounded(t *testing.T) {
+	e := NewEngine()
+
+	for i := 0; i < maxCached+10; i++ {
+		ok, err := e.Evaluate(fmt.Sprintf("context.hour == %d", i), map[string]any{"context": map[string]any{"hour": i}})
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	assert.LessOrEqual(t, len(e.cache), maxCached)
+}
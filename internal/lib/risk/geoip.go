@@ -0,0 +1,200 @@
+package risk
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Location is where an address is, as precise as the database.
+type Location struct {
+	Country   string
+	Latitude  float64
+	Longitude float64
+}
+
+// earthRadius in km
+const earthRadius = 6371
+
+// Distance returns the great-circle distance between the locations in km.
+func (l Location) Distance(to Location) float64 {
+	lat1, lat2 := radians(l.Latitude), radians(to.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(to.Longitude - l.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// GeoIP is an offline address to location database loaded from a CSV file
+// with "<network>,<country>,<latitude>,<longitude>" lines, e.g.
+// "81.2.69.0/24,GB,51.5142,-0.0931". The network columns of the GeoLite2
+// City blocks file joined with its locations give this format. A header
+// line, empty lines and "#" comments are skipped.
+type GeoIP struct {
+	// networks by prefix length, longest first
+	bits     []int
+	networks map[int]map[netip.Prefix]Location
+}
+
+func LoadGeoIP(path string) (*GeoIP, error) {
+	const op = "risk.LoadGeoIP"
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	db := &GeoIP{networks: make(map[int]map[netip.Prefix]Location)}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || (n == 1 && strings.HasPrefix(line, "network")) {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s: line %d: want 4 fields, got %d", op, n, len(fields))
+		}
+
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", op, n, err)
+		}
+		lat, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", op, n, err)
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(fields[3]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", op, n, err)
+		}
+
+		prefix = prefix.Masked()
+		if db.networks[prefix.Bits()] == nil {
+			db.networks[prefix.Bits()] = make(map[netip.Prefix]Location)
+			db.bits = append(db.bits, prefix.Bits())
+		}
+		db.networks[prefix.Bits()][prefix] = Location{
+			Country:   strings.TrimSpace(fields[1]),
+			Latitude:  lat,
+			Longitude: lon,
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(db.bits)))
+
+	return db, nil
+}
+
+// Lookup returns the location of the most specific network containing ip.
+func (db *GeoIP) Lookup(ip string) (Location, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, false
+	}
+
+	return lookup(addr.Unmap(), db.bits, db.networks)
+}
+
+// IPList is a set of addresses and networks, one per line in its file, e.g.
+// a local IP reputation feed. Empty lines and "#" comments are skipped.
+type IPList struct {
+	bits     []int
+	networks map[int]map[netip.Prefix]struct{}
+}
+
+func LoadIPList(path string) (*IPList, error) {
+	const op = "risk.LoadIPList"
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	list := &IPList{networks: make(map[int]map[netip.Prefix]struct{})}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var prefix netip.Prefix
+		if strings.Contains(line, "/") {
+			prefix, err = netip.ParsePrefix(line)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(line)
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", op, n, err)
+		}
+
+		prefix = prefix.Masked()
+		if list.networks[prefix.Bits()] == nil {
+			list.networks[prefix.Bits()] = make(map[netip.Prefix]struct{})
+			list.bits = append(list.bits, prefix.Bits())
+		}
+		list.networks[prefix.Bits()][prefix] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(list.bits)))
+
+	return list, nil
+}
+
+// Contains reports whether ip is listed.
+func (l *IPList) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	_, ok := lookup(addr.Unmap(), l.bits, l.networks)
+
+	return ok
+}
+
+func lookup[V any](addr netip.Addr, bits []int, networks map[int]map[netip.Prefix]V) (V, bool) {
+	for _, b := range bits {
+		if b > addr.BitLen() {
+			continue
+		}
+
+		prefix, err := addr.Prefix(b)
+		if err != nil {
+			continue
+		}
+		if v, ok := networks[b][prefix]; ok {
+			return v, true
+		}
+	}
+
+	var zero V
+
+	return zero, false
+}
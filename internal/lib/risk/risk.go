@@ -0,0 +1,120 @@
+// Package risk scores login attempts. Every Signal looks at one aspect of
+// the attempt, e.g. the device or the location, and adds points to the
+// score. The score is compared with the thresholds of the app to decide
+// whether the login is allowed, needs a step-up or is denied.
+package risk
+
+import (
+	"context"
+	"time"
+)
+
+type Decision string
+
+const (
+	Allow  Decision = "allow"
+	StepUp Decision = "step_up"
+	Deny   Decision = "deny"
+)
+
+// Attempt is a login attempt with a verified password.
+type Attempt struct {
+	UserID    int64
+	AppID     int64
+	Email     string
+	IP        string
+	UserAgent string
+	DeviceID  string
+	Time      time.Time
+}
+
+// Signal scores one aspect of an attempt. A zero score means the signal saw
+// nothing unusual, reason says what it saw otherwise.
+type Signal interface {
+	Name() string
+	Score(ctx context.Context, attempt Attempt) (score int, reason string, err error)
+}
+
+// Thresholds are the scores from which a login needs a step-up or is
+// denied, a zero threshold is never reached.
+type Thresholds struct {
+	StepUp int
+	Deny   int
+}
+
+func (t Thresholds) decide(score int) Decision {
+	switch {
+	case t.Deny > 0 && score >= t.Deny:
+		return Deny
+	case t.StepUp > 0 && score >= t.StepUp:
+		return StepUp
+	}
+
+	return Allow
+}
+
+// Result is what a signal contributed to an assessment, Err is set when the
+// signal failed and didn't count.
+type Result struct {
+	Signal string
+	Score  int
+	Reason string
+	Err    error
+}
+
+// Assessment is the decision on an attempt with the signals behind it.
+type Assessment struct {
+	Score    int
+	Decision Decision
+	Results  []Result
+}
+
+// Engine evaluates attempts with its signals.
+type Engine struct {
+	signals    []Signal
+	thresholds Thresholds
+	apps       map[int64]Thresholds
+}
+
+// NewEngine returns an engine deciding with thresholds, apps overrides them
+// per app id.
+func NewEngine(thresholds Thresholds, apps map[int64]Thresholds, signals ...Signal) *Engine {
+	return &Engine{
+		signals:    signals,
+		thresholds: thresholds,
+		apps:       apps,
+	}
+}
+
+// Evaluate scores the attempt with all signals. A failing signal counts as
+// zero, so a broken data source doesn't lock users out.
+func (e *Engine) Evaluate(ctx context.Context, attempt Attempt) Assessment {
+	var assessment Assessment
+
+	for _, signal := range e.signals {
+		score, reason, err := signal.Score(ctx, attempt)
+		if err != nil {
+			assessment.Results = append(assessment.Results, Result{Signal: signal.Name(), Err: err})
+			continue
+		}
+		if score == 0 {
+			continue
+		}
+
+		assessment.Score += score
+		assessment.Results = append(assessment.Results, Result{Signal: signal.Name(), Score: score, Reason: reason})
+	}
+
+	assessment.Decision = e.Thresholds(attempt.AppID).decide(assessment.Score)
+
+	return assessment
+}
+
+// Thresholds returns the thresholds of the app.
+func (e *Engine) Thresholds(appID int64) Thresholds {
+	if t, ok := e.apps[appID]; ok {
+		return t
+	}
+
+	return e.thresholds
+}
@@ -0,0 +1,148 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sso/internal/domain/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedSignal struct {
+	name  string
+	score int
+	err   error
+}
+
+func (s fixedSignal) Name() string {
+	return s.name
+}
+
+func (s fixedSignal) Score(context.Context, Attempt) (int, string, error) {
+	return s.score, s.name, s.err
+}
+
+func TestThresholds(t *testing.T) {
+	th := Thresholds{StepUp: 30, Deny: 70}
+	assert.Equal(t, Allow, th.decide(29))
+	assert.Equal(t, StepUp, th.decide(30))
+	assert.Equal(t, StepUp, th.decide(69))
+	assert.Equal(t, Deny, th.decide(70))
+
+	// a zero threshold is switched off
+	assert.Equal(t, Allow, Thresholds{Deny: 70}.decide(50))
+	assert.Equal(t, StepUp, Thresholds{StepUp: 30}.decide(1000))
+	assert.Equal(t, Allow, Thresholds{}.decide(1000))
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	errDown := errors.New("geoip is down")
+
+	e := NewEngine(Thresholds{StepUp: 30, Deny: 70}, map[int64]Thresholds{2: {StepUp: 60}},
+		fixedSignal{name: "new_device", score: 20},
+		fixedSignal{name: "velocity"},
+		fixedSignal{name: "impossible_travel", score: 50, err: errDown},
+		fixedSignal{name: "unusual_hour", score: 10},
+	)
+
+	got := e.Evaluate(context.Background(), Attempt{UserID: 1, AppID: 1})
+	assert.Equal(t, 30, got.Score)
+	assert.Equal(t, StepUp, got.Decision)
+	assert.Equal(t, []Result{
+		{Signal: "new_device", Score: 20, Reason: "new_device"},
+		{Signal: "impossible_travel", Err: errDown},
+		{Signal: "unusual_hour", Score: 10, Reason: "unusual_hour"},
+	}, got.Results)
+
+	// the app has its own thresholds
+	got = e.Evaluate(context.Background(), Attempt{UserID: 1, AppID: 2})
+	assert.Equal(t, Allow, got.Decision)
+}
+
+func TestLocation_Distance(t *testing.T) {
+	london := Location{Latitude: 51.5142, Longitude: -0.0931}
+
+	tests := []struct {
+		name string
+		to   Location
+		want float64
+	}{
+		{name: "same place", to: london, want: 0},
+		{name: "paris", to: Location{Latitude: 48.8566, Longitude: 2.3522}, want: 343},
+		{name: "new york", to: Location{Latitude: 40.7128, Longitude: -74.0060}, want: 5570},
+		{name: "sydney", to: Location{Latitude: -33.8688, Longitude: 151.2093}, want: 16990},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, london.Distance(tt.to), 15)
+			assert.InDelta(t, tt.want, tt.to.Distance(london), 15)
+		})
+	}
+}
+
+type fakeHistory []models.LoginAttempt
+
+func (h fakeHistory) LoginHistory(context.Context, int64, int64, int) ([]models.LoginAttempt, error) {
+	return h, nil
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.csv")
+	require.NoError(t, os.WriteFile(path, []byte(`network,country,latitude,longitude
+81.2.69.0/24,GB,51.5142,-0.0931
+81.2.69.128/25,GB,51.5074,-0.1278
+82.64.0.0/16,FR,48.8566,2.3522
+8.8.8.0/24,US,40.7128,-74.0060
+`), 0o600))
+
+	geoip, err := LoadGeoIP(path)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	login := func(ip string, ago time.Duration, success bool) models.LoginAttempt {
+		return models.LoginAttempt{IP: ip, Success: success, CreatedAt: now.Add(-ago)}
+	}
+
+	score := func(ip string, maxSpeed float64, history ...models.LoginAttempt) int {
+		t.Helper()
+
+		s := ImpossibleTravel{GeoIP: geoip, History: fakeHistory(history), MaxSpeed: maxSpeed, Weight: 25}
+
+		score, reason, err := s.Score(context.Background(), Attempt{UserID: 1, IP: ip, Time: now})
+		require.NoError(t, err)
+		if score > 0 {
+			assert.Contains(t, reason, "km from GB")
+		}
+
+		return score
+	}
+
+	assert.Equal(t, 0, score("8.8.8.8", 0))
+	assert.Equal(t, 0, score("81.2.69.10", 0, login("81.2.69.20", time.Minute, true)))
+	// the /25 is a few km away from the /24 it is part of
+	assert.Equal(t, 0, score("81.2.69.200", 0, login("81.2.69.20", time.Minute, true)))
+
+	// london to new york
+	assert.Equal(t, 25, score("8.8.8.8", 0, login("81.2.69.20", time.Hour, true)))
+	assert.Equal(t, 0, score("8.8.8.8", 0, login("81.2.69.20", 24*time.Hour, true)))
+
+	// london to paris in half an hour is a plane, unless trains are the limit
+	assert.Equal(t, 0, score("82.64.1.1", 0, login("81.2.69.20", 30*time.Minute, true)))
+	assert.Equal(t, 25, score("82.64.1.1", 300, login("81.2.69.20", 30*time.Minute, true)))
+
+	// only the last successful login counts
+	assert.Equal(t, 0, score("8.8.8.8", 0,
+		login("82.64.1.1", time.Minute, false),
+		login("8.8.4.4", time.Hour, false),
+		login("8.8.8.9", 2*time.Hour, true),
+	))
+
+	assert.Equal(t, 0, score("8.8.8.8", 0, login("10.0.0.1", time.Minute, true)))
+	assert.Equal(t, 0, score("10.0.0.1", 0, login("81.2.69.20", time.Minute, true)))
+}
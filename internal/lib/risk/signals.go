@@ -0,0 +1,209 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"sso/internal/domain/models"
+	"time"
+)
+
+// historySize is how many past logins the signals look at.
+const historySize = 50
+
+// DeviceProvider tells whether the user logged in from a device before.
+type DeviceProvider interface {
+	KnownDevice(ctx context.Context, userID int64, deviceID string) (known bool, others bool, err error)
+}
+
+// LoginHistory returns the past login attempts of a user, newest first.
+type LoginHistory interface {
+	LoginHistory(ctx context.Context, userID int64, beforeID int64, limit int) (attempts []models.LoginAttempt, err error)
+}
+
+// NewDevice scores logins from a device the user hasn't used before. The
+// first device of a user and logins without a device id don't count.
+type NewDevice struct {
+	Devices DeviceProvider
+	Weight  int
+}
+
+func (s NewDevice) Name() string {
+	return "new_device"
+}
+
+func (s NewDevice) Score(ctx context.Context, attempt Attempt) (int, string, error) {
+	if attempt.DeviceID == "" {
+		return 0, "", nil
+	}
+
+	known, others, err := s.Devices.KnownDevice(ctx, attempt.UserID, attempt.DeviceID)
+	if err != nil {
+		return 0, "", err
+	}
+	if known || !others {
+		return 0, "", nil
+	}
+
+	return s.Weight, "device " + attempt.DeviceID, nil
+}
+
+// ImpossibleTravel scores logins from a place the user couldn't have reached
+// since the last successful login, faster than MaxSpeed km/h.
+type ImpossibleTravel struct {
+	GeoIP   *GeoIP
+	History LoginHistory
+	// MaxSpeed in km/h, about the speed of an airliner by default.
+	MaxSpeed float64
+	Weight   int
+}
+
+const defaultMaxSpeed = 900
+
+func (s ImpossibleTravel) Name() string {
+	return "impossible_travel"
+}
+
+func (s ImpossibleTravel) Score(ctx context.Context, attempt Attempt) (int, string, error) {
+	to, ok := s.GeoIP.Lookup(attempt.IP)
+	if !ok {
+		return 0, "", nil
+	}
+
+	attempts, err := s.History.LoginHistory(ctx, attempt.UserID, 0, historySize)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for _, last := range attempts {
+		if !last.Success {
+			continue
+		}
+
+		from, ok := s.GeoIP.Lookup(last.IP)
+		if !ok {
+			return 0, "", nil
+		}
+
+		distance := from.Distance(to)
+		hours := attempt.Time.Sub(last.CreatedAt).Hours()
+
+		maxSpeed := s.MaxSpeed
+		if maxSpeed <= 0 {
+			maxSpeed = defaultMaxSpeed
+		}
+
+		// nearby places are within the precision of the database
+		if distance < 100 || distance <= maxSpeed*hours {
+			return 0, "", nil
+		}
+
+		return s.Weight, fmt.Sprintf("%.0f km from %s in %s", distance, from.Country,
+			attempt.Time.Sub(last.CreatedAt).Round(time.Minute)), nil
+	}
+
+	return 0, "", nil
+}
+
+// Velocity scores logins after many failed attempts on the account within
+// Window.
+type Velocity struct {
+	History  LoginHistory
+	Window   time.Duration
+	Failures int
+	Weight   int
+}
+
+func (s Velocity) Name() string {
+	return "velocity"
+}
+
+func (s Velocity) Score(ctx context.Context, attempt Attempt) (int, string, error) {
+	if s.Failures <= 0 {
+		return 0, "", nil
+	}
+
+	attempts, err := s.History.LoginHistory(ctx, attempt.UserID, 0, historySize)
+	if err != nil {
+		return 0, "", err
+	}
+
+	since := attempt.Time.Add(-s.Window)
+
+	var failures int
+	for _, past := range attempts {
+		if past.CreatedAt.Before(since) {
+			break
+		}
+		if !past.Success {
+			failures++
+		}
+	}
+
+	if failures < s.Failures {
+		return 0, "", nil
+	}
+
+	return s.Weight, fmt.Sprintf("%d failed attempts in %s", failures, s.Window), nil
+}
+
+// UnusualHour scores logins at an hour the user hasn't logged in at, within
+// an hour either side, in the last successful logins. Users with fewer than
+// MinLogins logins have no habits yet and don't count.
+type UnusualHour struct {
+	History   LoginHistory
+	MinLogins int
+	Weight    int
+}
+
+func (s UnusualHour) Name() string {
+	return "unusual_hour"
+}
+
+func (s UnusualHour) Score(ctx context.Context, attempt Attempt) (int, string, error) {
+	attempts, err := s.History.LoginHistory(ctx, attempt.UserID, 0, historySize)
+	if err != nil {
+		return 0, "", err
+	}
+
+	hour := attempt.Time.UTC().Hour()
+
+	var logins int
+	for _, past := range attempts {
+		if !past.Success {
+			continue
+		}
+		logins++
+
+		diff := past.CreatedAt.UTC().Hour() - hour
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= 1 || diff == 23 {
+			return 0, "", nil
+		}
+	}
+
+	if logins < s.MinLogins {
+		return 0, "", nil
+	}
+
+	return s.Weight, fmt.Sprintf("login at %02d:00 UTC", hour), nil
+}
+
+// IPReputation scores logins from addresses on a list of known bad ones.
+type IPReputation struct {
+	List   *IPList
+	Weight int
+}
+
+func (s IPReputation) Name() string {
+	return "ip_reputation"
+}
+
+func (s IPReputation) Score(ctx context.Context, attempt Attempt) (int, string, error) {
+	if !s.List.Contains(attempt.IP) {
+		return 0, "", nil
+	}
+
+	return s.Weight, "listed " + attempt.IP, nil
+}
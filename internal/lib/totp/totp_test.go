@@ -0,0 +1,68 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	// the last 6 of the 8 digits of RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, Code(rfcSecret, Step(time.Unix(tt.unix, 0))))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	got, err := Validate(rfcSecret, "050471", now, 1)
+	require.NoError(t, err)
+	assert.Equal(t, step, got)
+
+	// a code of the previous step is still fine with a skew
+	got, err = Validate(rfcSecret, Code(rfcSecret, step-1), now, 1)
+	require.NoError(t, err)
+	assert.Equal(t, step-1, got)
+
+	_, err = Validate(rfcSecret, Code(rfcSecret, step-2), now, 1)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+	_, err = Validate(rfcSecret, Code(rfcSecret, step-1), now, 0)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+	_, err = Validate(rfcSecret, "50471", now, 1)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+	_, err = Validate([]byte("another secret"), "050471", now, 1)
+	assert.ErrorIs(t, err, ErrInvalidCode)
+}
+
+func TestURL(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, SecretLen)
+
+	u := URL("sso", "user@example.com", secret)
+	assert.True(t, strings.HasPrefix(u, "otpauth://totp/sso:user@example.com?"), u)
+	assert.Contains(t, u, "secret="+Encode(secret))
+	assert.NotContains(t, Encode(secret), "=")
+}
@@ -0,0 +1,491 @@
+package admin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/services/audit"
+	"sso/internal/services/storage"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+var (
+	ErrPermissionDenied    = errors.New("permission denied")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrLastAdmin           = errors.New("can't revoke the last admin")
+	ErrAlreadyBootstrapped = errors.New("admin already exist")
+	ErrInvalidStatus       = errors.New("invalid user status")
+	ErrReasonRequired      = errors.New("reason is required")
+	ErrInvalidPermission   = errors.New("unknown permission")
+	ErrInvalidOrg          = errors.New("invalid org")
+)
+
+type Admin struct {
+	log         *slog.Logger
+	usrProvider UserProvider
+	usrSaver    UserSaver
+	registrar   Registrar
+}
+
+type UserProvider interface {
+	User(ctx context.Context, email string) (modelU models.User, err error)
+	UserByID(ctx context.Context, userID int64) (modelU models.User, err error)
+	IsAdmin(ctx context.Context, userID int64) (isAdmin bool, err error)
+	ListUsers(ctx context.Context, page models.UserPage) (users []models.User, err error)
+	Admins(ctx context.Context) (admins []models.User, err error)
+}
+
+// UserSaver changes the users. Every change is stored along with its audit
+// event, so it is never missing from the log.
+type UserSaver interface {
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool, event models.AuditEvent) error
+	SetUserStatus(ctx context.Context, userID int64, status string, reason string, until time.Time,
+		event models.AuditEvent) error
+	SetUserOrg(ctx context.Context, userID int64, orgID int64, event models.AuditEvent) error
+	SetPermission(ctx context.Context, userID int64, permission string, granted bool, event models.AuditEvent) error
+}
+
+// Registrar creates users, it is used to bootstrap the first admin.
+type Registrar interface {
+	RegisterNewUser(ctx context.Context, email string, password string) (userID int64, err error)
+}
+
+// NewAdmin returns a new object of the Admin struct
+func NewAdmin(log *slog.Logger, usrProvider UserProvider, usrSaver UserSaver,
+	registrar Registrar) *Admin {
+	return &Admin{
+		log:         log,
+		usrProvider: usrProvider,
+		usrSaver:    usrSaver,
+		registrar:   registrar,
+	}
+}
+
+// ListUsers returns a page of users and the cursor of the next page, which
+// is empty on the last one. The cursor must be used with the same filter
+// and sort order.
+func (a *Admin) ListUsers(ctx context.Context, actorID int64, page models.UserPage, cursor string) ([]models.User, string, error) {
+	const op = "admin.ListUsers"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("actorId", actorID))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		log.Warn("not an admin")
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if page.SortBy == "" {
+		page.SortBy = models.SortUsersByID
+	}
+	if page.Limit <= 0 {
+		page.Limit = defaultPageSize
+	}
+	if page.Limit > maxPageSize {
+		page.Limit = maxPageSize
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor, page)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		page.After = &after
+	}
+
+	limit := page.Limit
+	page.Limit++
+
+	users, err := a.usrProvider.ListUsers(ctx, page)
+	if err != nil {
+		log.Error("failed to list users: " + err.Error())
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(users) <= limit {
+		return users, "", nil
+	}
+
+	users = users[:limit]
+
+	next, err := encodeCursor(users[limit-1], page)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, next, nil
+}
+
+func (a *Admin) GetUser(ctx context.Context, actorID int64, userID int64) (models.User, error) {
+	const op = "admin.GetUser"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("actorId", actorID), slog.Int64("userId", userID))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		log.Warn("not an admin")
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("user not found")
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to get user: " + err.Error())
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user.PassHash = nil
+
+	return user, nil
+}
+
+// SetAdmin grants or revokes admin rights of the user. The last active admin
+// can't be demoted. A change that can't be written to the audit log fails.
+func (a *Admin) SetAdmin(ctx context.Context, actorID int64, userID int64, isAdmin bool, reason string) error {
+	const op = "admin.SetAdmin"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actorId", actorID),
+		slog.Int64("userId", userID),
+		slog.Bool("isAdmin", isAdmin),
+	)
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		log.Warn("not an admin")
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	eventType := models.AuditAdminGranted
+	if !isAdmin {
+		eventType = models.AuditAdminRevoked
+	}
+
+	event := audit.Complete(ctx, models.AuditEvent{
+		Type:      eventType,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Metadata:  map[string]string{"reason": reason},
+	})
+
+	if err := a.usrSaver.SetAdmin(ctx, userID, isAdmin, event); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("user not found")
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		if errors.Is(err, storage.ErrLastAdmin) {
+			log.Warn("refused to revoke the last admin")
+			return fmt.Errorf("%s: %w", op, ErrLastAdmin)
+		}
+		log.Error("failed to set admin: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success set admin")
+
+	return nil
+}
+
+func (a *Admin) ListAdmins(ctx context.Context, actorID int64) ([]models.User, error) {
+	const op = "admin.ListAdmins"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("actorId", actorID))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		log.Warn("not an admin")
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	admins, err := a.usrProvider.Admins(ctx)
+	if err != nil {
+		log.Error("failed to get admins: " + err.Error())
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return admins, nil
+}
+
+// SetUserStatus changes the status of the user, a non-active status needs a
+// reason and ends at until unless it is zero. Admins can't deactivate
+// themselves. A change that can't be written to the audit log fails.
+func (a *Admin) SetUserStatus(ctx context.Context, actorID int64, userID int64,
+	status string, reason string, until time.Time) error {
+	const op = "admin.SetUserStatus"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actorId", actorID),
+		slog.Int64("userId", userID),
+		slog.String("status", status),
+	)
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		log.Warn("not an admin")
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !models.ValidUserStatus(status) {
+		return fmt.Errorf("%s: %w: %q", op, ErrInvalidStatus, status)
+	}
+
+	if status == models.UserStatusActive {
+		reason, until = "", time.Time{}
+	} else {
+		if reason == "" {
+			return fmt.Errorf("%s: %w", op, ErrReasonRequired)
+		}
+		if actorID == userID {
+			return fmt.Errorf("%s: %w: can't deactivate yourself", op, ErrPermissionDenied)
+		}
+	}
+
+	metadata := map[string]string{"status": status, "reason": reason}
+	if !until.IsZero() {
+		metadata["until"] = until.UTC().Format(time.RFC3339)
+	}
+
+	event := audit.Complete(ctx, models.AuditEvent{
+		Type:      models.AuditUserStatus,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Metadata:  metadata,
+	})
+
+	if err := a.usrSaver.SetUserStatus(ctx, userID, status, reason, until, event); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("user not found")
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to set user status: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success set user status")
+
+	return nil
+}
+
+// SetUserOrg moves the user to the org, 0 removes it from its org. A change
+// that can't be written to the audit log fails.
+func (a *Admin) SetUserOrg(ctx context.Context, actorID int64, userID int64, orgID int64, reason string) error {
+	const op = "admin.SetUserOrg"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actorId", actorID),
+		slog.Int64("userId", userID),
+		slog.Int64("orgId", orgID),
+	)
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		log.Warn("not an admin")
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if orgID < 0 {
+		return fmt.Errorf("%s: %w: %d", op, ErrInvalidOrg, orgID)
+	}
+
+	event := audit.Complete(ctx, models.AuditEvent{
+		Type:      models.AuditUserOrg,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Metadata:  map[string]string{"org_id": strconv.FormatInt(orgID, 10), "reason": reason},
+	})
+
+	if err := a.usrSaver.SetUserOrg(ctx, userID, orgID, event); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("user not found")
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to set user org: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success set user org")
+
+	return nil
+}
+
+// SetPermission grants or revokes an admin permission of the user, see
+// models.Permissions. Admins can't change their own permissions, so a
+// sensitive permission always takes two admins. A change that can't be
+// written to the audit log fails.
+func (a *Admin) SetPermission(ctx context.Context, actorID int64, userID int64, permission string,
+	granted bool, reason string) error {
+	const op = "admin.SetPermission"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actorId", actorID),
+		slog.Int64("userId", userID),
+		slog.String("permission", permission),
+		slog.Bool("granted", granted),
+	)
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		log.Warn("not an admin")
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !slices.Contains(models.Permissions, permission) {
+		return fmt.Errorf("%s: %w: %q", op, ErrInvalidPermission, permission)
+	}
+	if reason == "" {
+		return fmt.Errorf("%s: %w", op, ErrReasonRequired)
+	}
+	if actorID == userID {
+		return fmt.Errorf("%s: %w: can't change your own permissions", op, ErrPermissionDenied)
+	}
+
+	eventType := models.AuditPermissionGranted
+	if !granted {
+		eventType = models.AuditPermissionRevoked
+	}
+
+	event := audit.Complete(ctx, models.AuditEvent{
+		Type:      eventType,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Metadata:  map[string]string{"permission": permission, "reason": reason},
+	})
+
+	if err := a.usrSaver.SetPermission(ctx, userID, permission, granted, event); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("user not found")
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to set permission: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success set permission")
+
+	return nil
+}
+
+// Bootstrap makes the user with the email the first admin, the user is
+// registered with password when missing. It only works while there are no
+// admins at all.
+func (a *Admin) Bootstrap(ctx context.Context, email string, password string) (int64, error) {
+	const op = "admin.Bootstrap"
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email))
+
+	admins, err := a.usrProvider.Admins(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(admins) > 0 {
+		return 0, fmt.Errorf("%s: %w", op, ErrAlreadyBootstrapped)
+	}
+
+	var userID int64
+
+	user, err := a.usrProvider.User(ctx, email)
+	switch {
+	case err == nil:
+		userID = user.ID
+	case errors.Is(err, storage.ErrUserNotFound):
+		if password == "" {
+			return 0, fmt.Errorf("%s: %w: password is required to create the admin", op, ErrUserNotFound)
+		}
+
+		if _, err := a.registrar.RegisterNewUser(ctx, email, password); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// the registration may hide the id, see auth.Options
+		user, err = a.usrProvider.User(ctx, email)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		userID = user.ID
+	default:
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	event := audit.Complete(ctx, models.AuditEvent{Type: models.AuditAdminBootstrap, SubjectID: userID})
+
+	if err := a.usrSaver.SetAdmin(ctx, userID, true, event); err != nil {
+		log.Error("failed to set admin: " + err.Error())
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success bootstrap admin", slog.Int64("userId", userID))
+
+	return userID, nil
+}
+
+func (a *Admin) requireAdmin(ctx context.Context, actorID int64) error {
+	isAdmin, err := a.usrProvider.IsAdmin(ctx, actorID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+
+	if !isAdmin {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+type userCursor struct {
+	SortBy    string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	ID        int64     `json:"id"`
+	Email     string    `json:"e,omitempty"`
+	CreatedAt time.Time `json:"c,omitempty"`
+}
+
+func encodeCursor(last models.User, page models.UserPage) (string, error) {
+	c := userCursor{SortBy: page.SortBy, Desc: page.Desc, ID: last.ID}
+
+	switch page.SortBy {
+	case models.SortUsersByEmail:
+		c.Email = last.Email
+	case models.SortUsersByCreatedAt:
+		c.CreatedAt = last.CreatedAt
+	}
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(cursor string, page models.UserPage) (models.User, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return models.User{}, ErrInvalidCursor
+	}
+
+	var c userCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return models.User{}, ErrInvalidCursor
+	}
+
+	if c.SortBy != page.SortBy || c.Desc != page.Desc {
+		return models.User{}, fmt.Errorf("%w: sort order changed", ErrInvalidCursor)
+	}
+
+	return models.User{ID: c.ID, Email: c.Email, CreatedAt: c.CreatedAt}, nil
+}
@@ -0,0 +1,217 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUsers stores the admin changes with their audit events, as the
+// storages do in one transaction.
+type fakeUsers struct {
+	admins map[int64]bool
+	err    error
+	events []models.AuditEvent
+}
+
+func (f *fakeUsers) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	return f.admins[userID], nil
+}
+
+func (f *fakeUsers) SetAdmin(_ context.Context, userID int64, isAdmin bool, event models.AuditEvent) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.admins[userID] = isAdmin
+	f.events = append(f.events, event)
+
+	return nil
+}
+
+func (f *fakeUsers) SetPermission(_ context.Context, _ int64, _ string, _ bool, event models.AuditEvent) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.events = append(f.events, event)
+
+	return nil
+}
+
+func (f *fakeUsers) SetUserStatus(_ context.Context, _ int64, _ string, _ string, _ time.Time,
+	event models.AuditEvent) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.events = append(f.events, event)
+
+	return nil
+}
+
+func (f *fakeUsers) SetUserOrg(_ context.Context, _ int64, _ int64, event models.AuditEvent) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.events = append(f.events, event)
+
+	return nil
+}
+
+func (f *fakeUsers) User(context.Context, string) (models.User, error) {
+	return models.User{}, storage.ErrUserNotFound
+}
+
+func (f *fakeUsers) UserByID(context.Context, int64) (models.User, error) {
+	return models.User{}, storage.ErrUserNotFound
+}
+
+func (f *fakeUsers) ListUsers(context.Context, models.UserPage) ([]models.User, error) {
+	return nil, nil
+}
+
+func (f *fakeUsers) Admins(context.Context) ([]models.User, error) {
+	return nil, nil
+}
+
+func TestSetAdmin(t *testing.T) {
+	errAudit := errors.New("audit log is unavailable")
+
+	tests := []struct {
+		name      string
+		isAdmin   bool
+		err       error
+		wantErr   error
+		wantEvent string
+	}{
+		{name: "grant", isAdmin: true, wantEvent: models.AuditAdminGranted},
+		{name: "revoke", isAdmin: false, wantEvent: models.AuditAdminRevoked},
+		{name: "last admin", err: storage.ErrLastAdmin, wantErr: ErrLastAdmin},
+		{name: "audit write fails", isAdmin: true, err: errAudit, wantErr: errAudit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUsers{admins: map[int64]bool{1: true}, err: tt.err}
+			a := NewAdmin(slog.New(slog.NewTextHandler(io.Discard, nil)), users, users, nil)
+
+			err := a.SetAdmin(context.Background(), 1, 2, tt.isAdmin, "on call")
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.False(t, users.admins[2])
+				assert.Empty(t, users.events)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.isAdmin, users.admins[2])
+			require.Len(t, users.events, 1)
+			assert.Equal(t, tt.wantEvent, users.events[0].Type)
+			assert.Equal(t, int64(1), users.events[0].ActorID)
+			assert.Equal(t, int64(2), users.events[0].SubjectID)
+			assert.Equal(t, "on call", users.events[0].Metadata["reason"])
+			assert.Equal(t, models.AuditSuccess, users.events[0].Outcome)
+			assert.False(t, users.events[0].CreatedAt.IsZero())
+		})
+	}
+}
+
+func TestSetUserStatus(t *testing.T) {
+	errAudit := errors.New("audit log is unavailable")
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		status    string
+		reason    string
+		err       error
+		wantErr   error
+		wantUntil string
+	}{
+		{name: "lock", status: models.UserStatusLocked, reason: "fraud", wantUntil: "2030-01-02T03:04:05Z"},
+		{name: "reactivate", status: models.UserStatusActive},
+		{name: "no reason", status: models.UserStatusDisabled, wantErr: ErrReasonRequired},
+		{name: "unknown status", status: "deleted", reason: "fraud", wantErr: ErrInvalidStatus},
+		{name: "audit write fails", status: models.UserStatusLocked, reason: "fraud", err: errAudit, wantErr: errAudit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUsers{admins: map[int64]bool{1: true}, err: tt.err}
+			a := NewAdmin(slog.New(slog.NewTextHandler(io.Discard, nil)), users, users, nil)
+
+			err := a.SetUserStatus(context.Background(), 1, 2, tt.status, tt.reason, until)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, users.events)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Len(t, users.events, 1)
+			assert.Equal(t, models.AuditUserStatus, users.events[0].Type)
+			assert.Equal(t, int64(1), users.events[0].ActorID)
+			assert.Equal(t, int64(2), users.events[0].SubjectID)
+			assert.Equal(t, tt.status, users.events[0].Metadata["status"])
+			assert.Equal(t, tt.wantUntil, users.events[0].Metadata["until"])
+			assert.Equal(t, models.AuditSuccess, users.events[0].Outcome)
+		})
+	}
+}
+
+func TestSetUserOrg(t *testing.T) {
+	tests := []struct {
+		name    string
+		actorID int64
+		orgID   int64
+		err     error
+		wantErr error
+	}{
+		{name: "move", actorID: 1, orgID: 5},
+		{name: "remove", actorID: 1, orgID: 0},
+		{name: "not an admin", actorID: 3, orgID: 5, wantErr: ErrPermissionDenied},
+		{name: "negative org", actorID: 1, orgID: -1, wantErr: ErrInvalidOrg},
+		{name: "unknown user", actorID: 1, orgID: 5, err: storage.ErrUserNotFound, wantErr: ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUsers{admins: map[int64]bool{1: true}, err: tt.err}
+			a := NewAdmin(slog.New(slog.NewTextHandler(io.Discard, nil)), users, users, nil)
+
+			err := a.SetUserOrg(context.Background(), tt.actorID, 2, tt.orgID, "moved teams")
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, users.events)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Len(t, users.events, 1)
+			assert.Equal(t, models.AuditUserOrg, users.events[0].Type)
+			assert.Equal(t, int64(2), users.events[0].SubjectID)
+			assert.Equal(t, strconv.FormatInt(tt.orgID, 10), users.events[0].Metadata["org_id"])
+			assert.Equal(t, "moved teams", users.events[0].Metadata["reason"])
+		})
+	}
+}
+
+func TestSetAdmin_RequiresAdmin(t *testing.T) {
+	users := &fakeUsers{admins: map[int64]bool{}}
+	a := NewAdmin(slog.New(slog.NewTextHandler(io.Discard, nil)), users, users, nil)
+
+	err := a.SetAdmin(context.Background(), 1, 2, true, "on call")
+	require.ErrorIs(t, err, ErrPermissionDenied)
+	assert.Empty(t, users.events)
+}
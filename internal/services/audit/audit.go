@@ -0,0 +1,260 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/clientinfo"
+	"sso/internal/services/storage"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	chainBatch      = 500
+)
+
+type Audit struct {
+	log         *slog.Logger
+	saver       AuditSaver
+	provider    AuditProvider
+	purger      AuditPurger
+	usrProvider UserProvider
+	retention   time.Duration
+}
+
+type AuditSaver interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
+type AuditProvider interface {
+	AuditEvents(ctx context.Context, filter models.AuditFilter, beforeID int64, limit int) (events []models.AuditEvent, err error)
+	AuditChain(ctx context.Context, afterID int64, limit int) (events []models.AuditEvent, err error)
+}
+
+type AuditPurger interface {
+	DeleteAuditEvents(ctx context.Context, before time.Time) (deleted int64, err error)
+}
+
+type UserProvider interface {
+	IsAdmin(ctx context.Context, userID int64) (isAdmin bool, err error)
+}
+
+// NewAudit returns a new object of the Audit struct, a zero retention keeps
+// the events forever.
+func NewAudit(log *slog.Logger, saver AuditSaver, provider AuditProvider, purger AuditPurger,
+	usrProvider UserProvider, retention time.Duration) *Audit {
+	return &Audit{
+		log:         log,
+		saver:       saver,
+		provider:    provider,
+		purger:      purger,
+		usrProvider: usrProvider,
+		retention:   retention,
+	}
+}
+
+// SaveAuditEvent appends the event to the log, see Complete.
+func (a *Audit) SaveAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	const op = "audit.SaveAuditEvent"
+
+	if err := a.saver.SaveAuditEvent(ctx, Complete(ctx, event)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Complete fills in the fields the event doesn't set: the caller IP and
+// user agent are taken from the context, the outcome is a success and the
+// time is now. Events stored along with another change go through it too.
+func Complete(ctx context.Context, event models.AuditEvent) models.AuditEvent {
+	client := clientinfo.From(ctx)
+	if event.IP == "" {
+		event.IP = client.IP
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = client.UserAgent
+	}
+	if event.Outcome == "" {
+		event.Outcome = models.AuditSuccess
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	return event
+}
+
+// Query returns a page of events matching the filter, newest first, and the
+// cursor of the next page, empty on the last one. Only admins can read the
+// log.
+func (a *Audit) Query(ctx context.Context, actorID int64, filter models.AuditFilter,
+	limit int, cursor string) ([]models.AuditEvent, string, error) {
+	const op = "audit.Query"
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var beforeID int64
+	if cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCursor)
+		}
+		beforeID = id
+	}
+
+	switch {
+	case limit <= 0:
+		limit = defaultPageSize
+	case limit > maxPageSize:
+		limit = maxPageSize
+	}
+
+	// one more event tells whether there is a next page
+	events, err := a.provider.AuditEvents(ctx, filter, beforeID, limit+1)
+	if err != nil {
+		a.log.Error("failed to query audit log: "+err.Error(), slog.String("op", op))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var next string
+	if len(events) > limit {
+		events = events[:limit]
+		next = strconv.FormatInt(events[len(events)-1].ID, 10)
+	}
+
+	return events, next, nil
+}
+
+// Verify walks the hash chain from the oldest kept event and returns how
+// many events it checked and the id of the first changed, inserted or
+// removed one, zero if the chain is intact. Events written before the chain
+// was introduced are skipped.
+func (a *Audit) Verify(ctx context.Context, actorID int64) (int64, int64, error) {
+	const op = "audit.Verify"
+
+	log := a.log.With(slog.String("op", op))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var (
+		checked, afterID int64
+		prev             string
+		started          bool
+	)
+	for {
+		events, err := a.provider.AuditChain(ctx, afterID, chainBatch)
+		if err != nil {
+			log.Error("failed to read audit log: " + err.Error())
+			return checked, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		for _, e := range events {
+			afterID = e.ID
+
+			if e.Hash == "" && !started {
+				continue
+			}
+			// the first kept event anchors the chain, the ones before it
+			// may be gone to the retention
+			if (started && e.PrevHash != prev) || e.ChainHash(e.PrevHash) != e.Hash {
+				log.Warn("audit log chain is broken", slog.Int64("eventId", e.ID))
+				return checked, e.ID, nil
+			}
+
+			prev, started = e.Hash, true
+			checked++
+		}
+	}
+
+	return checked, 0, nil
+}
+
+// Purge removes the events older than the retention and records how many
+// were removed.
+func (a *Audit) Purge(ctx context.Context) (int64, error) {
+	const op = "audit.Purge"
+
+	if a.retention <= 0 {
+		return 0, nil
+	}
+
+	before := time.Now().Add(-a.retention)
+
+	deleted, err := a.purger.DeleteAuditEvents(ctx, before)
+	if err != nil {
+		a.log.Error("failed to purge audit log: "+err.Error(), slog.String("op", op))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	err = a.SaveAuditEvent(ctx, models.AuditEvent{
+		Type: models.AuditRetention,
+		Metadata: map[string]string{
+			"before":  before.UTC().Format(time.RFC3339),
+			"deleted": strconv.FormatInt(deleted, 10),
+		},
+	})
+	if err != nil {
+		a.log.Error("failed to save audit event: "+err.Error(), slog.String("op", op))
+	}
+
+	a.log.Info("audit log purged", slog.String("op", op), slog.Int64("deleted", deleted))
+
+	return deleted, nil
+}
+
+// RunRetention purges the log every interval until ctx is done.
+func (a *Audit) RunRetention(ctx context.Context, interval time.Duration) {
+	if a.retention <= 0 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = a.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Audit) requireAdmin(ctx context.Context, actorID int64) error {
+	isAdmin, err := a.usrProvider.IsAdmin(ctx, actorID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+
+	if !isAdmin {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
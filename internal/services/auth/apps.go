@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAppsPageSize = 50
+	maxAppsPageSize     = 500
+	appSecretLen        = 32
+)
+
+// AppUpdate holds the app fields to change, nil fields are kept.
+type AppUpdate struct {
+	Name   *string
+	Scopes *[]string
+	// MinACR is the lowest acr accepted at login, empty accepts any.
+	MinACR *string
+}
+
+// GetApp returns the app without its secrets, only admins can see apps.
+func (a *Auth) GetApp(ctx context.Context, actorID int64, appID int64) (models.App, error) {
+	const op = "auth.GetApp"
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return withoutSecrets(app), nil
+}
+
+// ListApps returns a page of apps ordered by id and the cursor of the next
+// page, empty on the last one.
+func (a *Auth) ListApps(ctx context.Context, actorID int64, limit int, cursor string) ([]models.App, string, error) {
+	const op = "auth.ListApps"
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var afterID int64
+	if cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id < 0 {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCursor)
+		}
+		afterID = id
+	}
+
+	switch {
+	case limit <= 0:
+		limit = defaultAppsPageSize
+	case limit > maxAppsPageSize:
+		limit = maxAppsPageSize
+	}
+
+	// one more app tells whether there is a next page
+	apps, err := a.appProvider.Apps(ctx, afterID, limit+1)
+	if err != nil {
+		a.log.Error("failed to list apps: "+err.Error(), slog.String("op", op))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var next string
+	if len(apps) > limit {
+		apps = apps[:limit]
+		next = strconv.Itoa(apps[len(apps)-1].Id)
+	}
+
+	for i := range apps {
+		apps[i] = withoutSecrets(apps[i])
+	}
+
+	return apps, next, nil
+}
+
+// UpdateApp changes the name or the scopes of the app. Consents already
+// granted for removed scopes don't widen the tokens, the scopes are checked
+// against the app at login.
+func (a *Auth) UpdateApp(ctx context.Context, actorID int64, appID int64, upd AppUpdate) (models.App, error) {
+	const op = "auth.UpdateApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("appId", appID))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditApp(ctx, log, models.AuditAppUpdated, actorID, appID, models.AuditDenied, nil)
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if upd.Name != nil {
+		app.Name = *upd.Name
+	}
+	if upd.Scopes != nil {
+		for _, scope := range *upd.Scopes {
+			if scope == "" || strings.ContainsAny(scope, ", ") {
+				return models.App{}, fmt.Errorf("%s: %w: %q", op, ErrInvalidScope, scope)
+			}
+		}
+		app.Scopes = *upd.Scopes
+	}
+	if upd.MinACR != nil {
+		if *upd.MinACR != "" && models.ACRLevel(*upd.MinACR) == 0 {
+			return models.App{}, fmt.Errorf("%s: %w: %q", op, ErrInvalidACR, *upd.MinACR)
+		}
+		app.MinACR = *upd.MinACR
+	}
+
+	if err := a.appSaver.UpdateApp(ctx, app); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAppExist):
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppExist)
+		case errors.Is(err, storage.ErrAppNotFound):
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to update app: " + err.Error())
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app updated", slog.Int64("actorId", actorID))
+
+	a.auditApp(ctx, log, models.AuditAppUpdated, actorID, appID, models.AuditSuccess, map[string]string{
+		"name":    app.Name,
+		"scopes":  strings.Join(app.Scopes, " "),
+		"min_acr": app.MinACR,
+	})
+
+	return withoutSecrets(app), nil
+}
+
+// DeleteApp removes the app with its consents, policies and relations, the
+// tokens issued for it stop validating.
+func (a *Auth) DeleteApp(ctx context.Context, actorID int64, appID int64) error {
+	const op = "auth.DeleteApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("appId", appID))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditApp(ctx, log, models.AuditAppDeleted, actorID, appID, models.AuditDenied, nil)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.appSaver.DeleteApp(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to delete app: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app deleted", slog.Int64("actorId", actorID))
+
+	a.auditApp(ctx, log, models.AuditAppDeleted, actorID, appID, models.AuditSuccess, nil)
+
+	return nil
+}
+
+// RotateAppSecret replaces the app secret with a generated one and returns
+// it, the secret isn't shown again. The previous secret keeps verifying the
+// tokens for AppSecretGrace, the returned time is when it stops.
+func (a *Auth) RotateAppSecret(ctx context.Context, actorID int64, appID int64) (string, time.Time, error) {
+	const op = "auth.RotateAppSecret"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("appId", appID))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditApp(ctx, log, models.AuditAppSecretRotated, actorID, appID, models.AuditDenied, nil)
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := newAppSecret()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	stored, err := a.encryptSecret(secret, appSecretAAD)
+	if err != nil {
+		log.Error("failed to encrypt app secret: " + err.Error())
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	previousExpiresAt := time.Now().Add(a.opts.AppSecretGrace)
+
+	if err := a.appSaver.RotateAppSecret(ctx, appID, stored, previousExpiresAt); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", time.Time{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to rotate app secret: " + err.Error())
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app secret rotated", slog.Int64("actorId", actorID), slog.Time("previousExpiresAt", previousExpiresAt))
+
+	a.auditApp(ctx, log, models.AuditAppSecretRotated, actorID, appID, models.AuditSuccess, map[string]string{
+		"previous_expires_at": previousExpiresAt.UTC().Format(time.RFC3339),
+	})
+
+	return secret, previousExpiresAt, nil
+}
+
+func (a *Auth) auditApp(ctx context.Context, log *slog.Logger, eventType string, actorID int64, appID int64,
+	outcome string, metadata map[string]string) {
+	a.audit(ctx, log, models.AuditEvent{
+		Type:     eventType,
+		ActorID:  actorID,
+		AppID:    appID,
+		Outcome:  outcome,
+		Metadata: metadata,
+	})
+}
+
+func (a *Auth) requireAdmin(ctx context.Context, actorID int64) error {
+	isAdmin, err := a.usrProvider.IsAdmin(ctx, actorID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+
+	if !isAdmin {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+func newAppSecret() (string, error) {
+	raw := make([]byte, appSecretLen)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func withoutSecrets(app models.App) models.App {
+	app.Secret = nil
+	app.PreviousSecret = nil
+
+	return app
+}
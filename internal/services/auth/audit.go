@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/domain/models"
+	"time"
+)
+
+type AuditSaver interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
+// audit records the event, a failure is logged and doesn't fail the
+// operation.
+func (a *Auth) audit(ctx context.Context, log *slog.Logger, event models.AuditEvent) {
+	if event.Outcome == "" {
+		event.Outcome = models.AuditSuccess
+	}
+	event.CreatedAt = time.Now()
+
+	if err := a.auditSaver.SaveAuditEvent(ctx, event); err != nil {
+		log.Error("failed to save audit event: "+err.Error(), slog.String("event", event.Type))
+	}
+}
+
+// auditLogin records a login attempt in the audit log and the login
+// history, reason says why it failed.
+func (a *Auth) auditLogin(ctx context.Context, log *slog.Logger, userID int64, appID int64,
+	email string, outcome string, reason string) {
+	metadata := map[string]string{"email": email}
+	if reason != "" {
+		metadata["reason"] = reason
+	}
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditLogin,
+		ActorID:   userID,
+		SubjectID: userID,
+		AppID:     appID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+
+	a.recordLogin(ctx, log, models.LoginAttempt{
+		UserID:  userID,
+		AppID:   appID,
+		Email:   email,
+		Success: outcome == models.AuditSuccess,
+		Reason:  reason,
+	})
+}
+
+// auditPassword records a password change or reset of the user.
+func (a *Auth) auditPassword(ctx context.Context, log *slog.Logger, eventType string, userID int64,
+	outcome string, reason string) {
+	event := models.AuditEvent{
+		Type:      eventType,
+		ActorID:   userID,
+		SubjectID: userID,
+		Outcome:   outcome,
+	}
+	if reason != "" {
+		event.Metadata = map[string]string{"reason": reason}
+	}
+
+	a.audit(ctx, log, event)
+}
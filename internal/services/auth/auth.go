@@ -5,12 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sso/internal/domain/models"
 	jwtlocal "sso/internal/lib"
+	"sso/internal/lib/hasher"
+	"sso/internal/lib/notify"
+	"sso/internal/lib/password"
+	"sso/internal/lib/risk"
 	"sso/internal/services/storage"
+	"strings"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -19,50 +23,261 @@ var (
 	ErrInvalidAppID       = errors.New("invalid appID")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrAppExist           = errors.New("app already exist")
+	ErrInvalidScope       = errors.New("invalid scope")
+	ErrConsentRequired    = errors.New("consent required")
+	ErrConsentNotFound    = errors.New("consent not found")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrUserDisabled       = errors.New("user is disabled")
+	ErrUserLocked         = errors.New("user is locked")
+	ErrUserNotVerified    = errors.New("user is pending verification")
+	ErrWeakPassword       = errors.New("password doesn't meet the policy")
+	ErrInvalidResetToken  = errors.New("invalid password reset token")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrAppNotFound        = errors.New("app not found")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrLoginDenied        = errors.New("login denied as too risky")
+	ErrStepUpRequired     = errors.New("step-up authentication required")
+	ErrInvalidACR         = errors.New("invalid acr")
+	ErrReasonRequired     = errors.New("reason is required")
 )
 
 type Auth struct {
-	log         *slog.Logger
-	usrSaver    UserSaver
-	usrProvider UserProvider
-	appProvider AppProvider
-	appSaver    AppSaver
-	tokenTTL    time.Duration
+	log           *slog.Logger
+	usrSaver      UserSaver
+	usrProvider   UserProvider
+	appProvider   AppProvider
+	appSaver      AppSaver
+	cnsSaver      ConsentSaver
+	cnsProvider   ConsentProvider
+	rstStore      PasswordResetStore
+	sessStore     SessionStore
+	loginStore    LoginHistoryStore
+	patStore      PATStore
+	saStore       ServiceAccountStore
+	identityStore IdentityStore
+	totpStore     TOTPStore
+	notifier      Notifier
+	auditSaver    AuditSaver
+	tokenTTL      time.Duration
+	opts          Options
+	dummyHash     []byte
+	backends      []Authenticator
+}
+
+// Options tune the behaviour of Auth.
+type Options struct {
+	// EnumerationSafeRegistration makes RegisterNewUser answer the same
+	// whether the email is taken or not, the owner of a taken email gets a
+	// notification instead. The returned user id is always zero then.
+	EnumerationSafeRegistration bool
+	// Hasher hashes new passwords, stored hashes of other algorithms or
+	// parameters are replaced at login. Bcrypt with the default cost if nil.
+	Hasher hasher.PasswordHasher
+	// PasswordPolicy is checked for new passwords, OrgPasswordPolicies
+	// replaces it for the users of an org.
+	PasswordPolicy      password.Policy
+	OrgPasswordPolicies map[int64]password.Policy
+	// BreachedPasswords rejects new passwords found in breaches, nil
+	// disables the check.
+	BreachedPasswords BreachChecker
+	// EnforceBreachedAtLogin flags users logging in with a breached password
+	// for a forced password change.
+	EnforceBreachedAtLogin bool
+	// PasswordResetTTL is the lifetime of a password reset token, an hour if
+	// zero.
+	PasswordResetTTL time.Duration
+	// PasswordHistory is how many of the last passwords can't be reused,
+	// the current one included.
+	PasswordHistory int
+	// MaxPasswordAge makes passwords expire, zero disables the expiry.
+	MaxPasswordAge time.Duration
+	// Secrets encrypts the app secrets at rest, nil stores them as is.
+	Secrets SecretBox
+	// TokenKey signs the tokens of the SSO itself, see models.SSOAppID.
+	// Without it no such token is issued or accepted.
+	TokenKey []byte
+	// AppSecretGrace is how long the previous app secret still verifies
+	// tokens after a rotation, a day if zero.
+	AppSecretGrace time.Duration
+	// PasswordChangeTokenTTL is the lifetime of the token issued when the
+	// password must be changed, 10 minutes if zero.
+	PasswordChangeTokenTTL time.Duration
+	// NotifyNewDevice sends a notification when a user logs in from a device
+	// not seen before.
+	NotifyNewDevice bool
+	// StepUpTokenTTL is the lifetime of the tokens issued by StepUp and of
+	// the token issued at login when the app needs a step-up, 5 minutes if
+	// zero.
+	StepUpTokenTTL time.Duration
+	// ImpersonationTTL is the lifetime of the tokens issued by Impersonate,
+	// 15 minutes if zero.
+	ImpersonationTTL time.Duration
+	// Policies are the app policies, a matching deny policy for the
+	// "sso:impersonate" action disables impersonation in the app, only
+	// admins manage the policies. Nil allows it in all apps.
+	Policies PolicyChecker
+	// ExchangeRules are the trusted source and target apps of the token
+	// exchange, without rules no token can be exchanged.
+	ExchangeRules []ExchangeRule
+	// ExchangeTokenTTL is the longest lifetime of the tokens issued by
+	// TokenExchange, 5 minutes if zero. They never outlive the subject token.
+	ExchangeTokenTTL time.Duration
+	// PATMaxTTL is the longest lifetime of a personal access token, a year
+	// if zero.
+	PATMaxTTL time.Duration
+	// ServiceAccountTokenTTL is the lifetime of the tokens issued to service
+	// accounts, an hour if zero.
+	ServiceAccountTokenTTL time.Duration
+	// AssertionAudience is the "aud" claim the private_key_jwt assertions
+	// of service accounts must have, "sso" if empty.
+	AssertionAudience string
+	// FederatedProviders are the upstream identity providers of the orgs.
+	FederatedProviders []FederatedProvider
+	// FederationStateTTL is how long a federated login may take at the
+	// provider, 10 minutes if zero.
+	FederationStateTTL time.Duration
+	// AuthBackends are the names of the backends Login checks the password
+	// with, in order: BackendLocal and BackendLDAP. Only local if empty.
+	AuthBackends []string
+	// LDAP configures BackendLDAP.
+	LDAP *LDAPOptions
+	// Risk scores logins with a verified password and decides whether they
+	// are allowed, need a step-up or are denied, nil allows all.
+	Risk RiskEngine
+}
+
+type BreachChecker interface {
+	Contains(password string) (breached bool, err error)
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg notify.Message) error
 }
 
 type UserSaver interface {
 	SaveUser(ctx context.Context, email string, passHash []byte) (uid int64, err error)
+	UpdatePassword(ctx context.Context, userID int64, passHash []byte) error
+	ChangePassword(ctx context.Context, userID int64, passHash []byte, keepHistory int) error
+	SetPasswordChangeRequired(ctx context.Context, userID int64, required bool) error
+	SetUserOrg(ctx context.Context, userID int64, orgID int64, event models.AuditEvent) error
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (modelU models.User, err error)
+	UserByID(ctx context.Context, userID int64) (modelU models.User, err error)
 	IsAdmin(ctx context.Context, userID int64) (isAdmin bool, err error)
+	PasswordHistory(ctx context.Context, userID int64, limit int) (hashes [][]byte, err error)
+	HasPermission(ctx context.Context, userID int64, permission string) (granted bool, err error)
 }
 
 type AppSaver interface {
-	SaveApp(ctx context.Context, name string, secret string) (appId int64, err error)
+	SaveApp(ctx context.Context, name string, secret string, scopes []string) (appId int64, err error)
+	UpdateApp(ctx context.Context, app models.App) error
+	DeleteApp(ctx context.Context, appID int64) error
+	RotateAppSecret(ctx context.Context, appID int64, secret string, previousExpiresAt time.Time) error
 }
 
 type AppProvider interface {
 	App(ctx context.Context, appID int64) (modelA models.App, err error)
+	Apps(ctx context.Context, afterID int64, limit int) (apps []models.App, err error)
+}
+
+type ConsentSaver interface {
+	SaveConsent(ctx context.Context, consent models.Consent) error
+	DeleteConsent(ctx context.Context, userID int64, appID int64) error
+}
+
+type ConsentProvider interface {
+	Consent(ctx context.Context, userID int64, appID int64) (consent models.Consent, err error)
+	Consents(ctx context.Context, userID int64) (consents []models.Consent, err error)
+}
+
+type PasswordResetStore interface {
+	SavePasswordReset(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error
+	PasswordReset(ctx context.Context, tokenHash string, now time.Time) (userID int64, err error)
 }
 
 // New returns a new object of the Auth struct
 func NewAuth(log *slog.Logger, usrSaver UserSaver,
 	usrProvider UserProvider, appProvider AppProvider,
-	appSaver AppSaver, tokenTTL time.Duration) *Auth {
-	return &Auth{
-		log:         log,
-		usrSaver:    usrSaver,
-		usrProvider: usrProvider,
-		appProvider: appProvider,
-		appSaver:    appSaver,
-		tokenTTL:    tokenTTL,
+	appSaver AppSaver, cnsSaver ConsentSaver, cnsProvider ConsentProvider,
+	rstStore PasswordResetStore, sessStore SessionStore, loginStore LoginHistoryStore, patStore PATStore,
+	saStore ServiceAccountStore, identityStore IdentityStore, totpStore TOTPStore, notifier Notifier, auditSaver AuditSaver, tokenTTL time.Duration, opts Options) *Auth {
+	if opts.Hasher == nil {
+		opts.Hasher = hasher.Bcrypt{}
+	}
+	if opts.PasswordResetTTL == 0 {
+		opts.PasswordResetTTL = time.Hour
+	}
+	if opts.AppSecretGrace == 0 {
+		opts.AppSecretGrace = 24 * time.Hour
+	}
+	if opts.PasswordChangeTokenTTL == 0 {
+		opts.PasswordChangeTokenTTL = 10 * time.Minute
+	}
+	if opts.ImpersonationTTL == 0 {
+		opts.ImpersonationTTL = 15 * time.Minute
+	}
+	if opts.PATMaxTTL == 0 {
+		opts.PATMaxTTL = 365 * 24 * time.Hour
+	}
+	if opts.ExchangeTokenTTL == 0 {
+		opts.ExchangeTokenTTL = 5 * time.Minute
+	}
+	if opts.ServiceAccountTokenTTL == 0 {
+		opts.ServiceAccountTokenTTL = time.Hour
+	}
+	if opts.FederationStateTTL == 0 {
+		opts.FederationStateTTL = 10 * time.Minute
 	}
+	if opts.AssertionAudience == "" {
+		opts.AssertionAudience = "sso"
+	}
+	if opts.StepUpTokenTTL == 0 {
+		opts.StepUpTokenTTL = 5 * time.Minute
+	}
+
+	// compared against when the user doesn't exist, so that an unknown email
+	// takes as long as a wrong password
+	dummyHash, err := opts.Hasher.Hash([]byte("dummy password"))
+	if err != nil {
+		log.Error("failed to generate dummy hash: " + err.Error())
+	}
+
+	a := &Auth{
+		log:           log,
+		usrSaver:      usrSaver,
+		usrProvider:   usrProvider,
+		appProvider:   appProvider,
+		appSaver:      appSaver,
+		cnsSaver:      cnsSaver,
+		cnsProvider:   cnsProvider,
+		rstStore:      rstStore,
+		sessStore:     sessStore,
+		loginStore:    loginStore,
+		patStore:      patStore,
+		saStore:       saStore,
+		identityStore: identityStore,
+		totpStore:     totpStore,
+		notifier:      notifier,
+		auditSaver:    auditSaver,
+		tokenTTL:      tokenTTL,
+		opts:          opts,
+		dummyHash:     dummyHash,
+	}
+	a.backends = a.authenticators(opts.AuthBackends)
+
+	return a
 }
 
+// Login checks the user credentials with the backends of AuthBackends and
+// returns a token for the app. When scopes are requested the user must have
+// granted them to the app before, or approve them now with consent. When the
+// password must be changed, the token only permits ChangePassword. A login
+// the risk engine or the app's minimum acr wants stepped up gets a token that
+// only permits StepUp.
 func (a *Auth) Login(ctx context.Context,
-	email string, password string, appID int64) (string, error) {
+	email string, password string, appID int64, scopes []string, consent bool) (models.LoginResult, error) {
 	const op = "auth.Login"
 
 	log := a.log.With(
@@ -72,35 +287,148 @@ func (a *Auth) Login(ctx context.Context,
 
 	log.Info("attempting to login user")
 
-	user, err := a.usrProvider.User(ctx, email)
+	authn, err := a.authenticate(ctx, log, email, password)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
+		user := authn.User
+
+		switch {
+		case errors.Is(err, ErrNoPassword):
+			// users of identity providers log in there
+			log.Error("user has no password")
+			a.auditLogin(ctx, log, user.ID, appID, email, models.AuditFailure, "no_password")
+		case errors.Is(err, ErrNoAccount):
+			log.Error("not corrected login/password")
+			a.auditLogin(ctx, log, user.ID, appID, email, models.AuditFailure, "unknown_user")
+		case errors.Is(err, ErrInvalidCredentials):
 			log.Error("not corrected login/password")
-			return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			a.auditLogin(ctx, log, user.ID, appID, email, models.AuditFailure, "invalid_password")
+		case errors.Is(err, ErrIdentityNotLinked), errors.Is(err, ErrEmailNotAllowed):
+			log.Warn("directory user can't log in", slog.String("err", err.Error()))
+			a.auditLogin(ctx, log, user.ID, appID, email, models.AuditDenied, "not_linked")
+		default:
+			log.Error("failed to authenticate user: " + err.Error())
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
 		}
-		log.Error("failed to get user")
-		return "", fmt.Errorf("%s: %w", op, err)
+
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 	}
+	user := authn.User
+	log = log.With(slog.String("backend", authn.Backend))
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		log.Error("not corrected login/password")
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	if err := checkStatus(user); err != nil {
+		log.Warn("user is not active", slog.String("status", user.Status))
+		a.auditLogin(ctx, log, user.ID, appID, email, models.AuditDenied, "user_"+user.StatusAt(time.Now()))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	app, err := a.appProvider.App(ctx, appID)
+	app, err := a.tokenApp(ctx, appID)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		a.auditLogin(ctx, log, user.ID, appID, email, models.AuditFailure, "unknown_app")
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	decision := a.assessRisk(ctx, log, user, appID)
+	if decision == risk.Deny {
+		log.Warn("login denied as too risky")
+		a.auditLogin(ctx, log, user.ID, appID, email, models.AuditDenied, "risk_denied")
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, ErrLoginDenied)
+	}
+
+	authTime := time.Now()
+
+	// the passwords of other backends are managed there
+	local := authn.Backend == BackendLocal
+
+	if local && !a.opts.Hasher.Current(user.PassHash) {
+		a.rehash(ctx, log, user.ID, password)
+	}
+
+	if local && a.opts.EnforceBreachedAtLogin && !user.PasswordChangeRequired && a.flagBreached(ctx, log, user.ID, password) {
+		user.PasswordChangeRequired = true
+	}
+
+	if local && a.passwordChangeRequired(user) {
+		log.Info("password change required")
+
+		// the token has a session like any other, the tokens of the SSO
+		// itself need one
+		session, err := a.startSession(ctx, user.ID, appID, 0, a.opts.PasswordChangeTokenTTL)
+		if err != nil {
+			log.Error("failed to save session: " + err.Error())
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		token, err := jwtlocal.NewToken(user, app, a.opts.PasswordChangeTokenTTL, jwtlocal.TokenOptions{
+			SessionID:          session.ID,
+			AuthTime:           authTime,
+			ACR:                models.ACRPassword,
+			AMR:                []string{models.AMRPassword},
+			PasswordChangeOnly: true,
+		})
+		if err != nil {
+			log.Error("cannot generate token")
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		a.trackDevice(ctx, log, user)
+		a.auditLogin(ctx, log, user.ID, appID, email, models.AuditSuccess, "password_change_required")
+
+		return models.LoginResult{Token: token, PasswordChangeRequired: true}, nil
+	}
+
+	if len(scopes) > 0 {
+		if err := a.checkConsent(ctx, user, app, scopes, consent); err != nil {
+			log.Warn("scopes are not granted", slog.String("err", err.Error()))
+			a.auditLogin(ctx, log, user.ID, appID, email, models.AuditDenied, "consent")
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	session, err := a.startSession(ctx, user.ID, appID, 0, a.tokenTTL)
+	if err != nil {
+		log.Error("failed to save session: " + err.Error())
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokenOpts := jwtlocal.TokenOptions{
+		Scopes:    scopes,
+		SessionID: session.ID,
+		AuthTime:  authTime,
+		ACR:       models.ACRPassword,
+		AMR:       []string{models.AMRPassword},
+		Roles:     authn.Roles,
+	}
+
+	// a risky login gets the same step-up only token as one below the acr
+	// the app requires
+	if decision == risk.StepUp || models.ACRLevel(app.MinACR) > models.ACRLevel(tokenOpts.ACR) {
+		log.Info("login needs a step-up", slog.String("minAcr", app.MinACR), slog.String("risk", string(decision)))
+
+		tokenOpts.StepUpOnly = true
+		token, err := jwtlocal.NewToken(user, app, a.opts.StepUpTokenTTL, tokenOpts)
+		if err != nil {
+			log.Error("cannot generate token")
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		a.trackDevice(ctx, log, user)
+		a.auditLogin(ctx, log, user.ID, appID, email, models.AuditSuccess, "step_up_required")
+
+		return models.LoginResult{Token: token, StepUpRequired: true}, nil
 	}
 
 	log.Info("successfully login user")
 
-	token, err := jwtlocal.NewToken(user, app, a.tokenTTL)
+	token, err := jwtlocal.NewToken(user, app, a.tokenTTL, tokenOpts)
 	if err != nil {
 		log.Error("cannot generate token")
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return token, nil
+	a.trackDevice(ctx, log, user)
+	a.auditLogin(ctx, log, user.ID, appID, email, models.AuditSuccess, "")
+
+	return models.LoginResult{Token: token}, nil
 }
 
 func (a *Auth) RegisterNewUser(ctx context.Context, email string, password string) (int64, error) {
@@ -113,7 +441,13 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, password strin
 
 	log.Info("registering new user")
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	// new users don't belong to an org yet
+	if err := a.checkNewPassword(password, email, 0); err != nil {
+		log.Warn("password rejected", slog.String("err", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := a.opts.Hasher.Hash([]byte(password))
 	if err != nil {
 		log.Error("failed to generate password hash")
 		return 0, fmt.Errorf("%s: %w", op, err)
@@ -123,6 +457,17 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, password strin
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExist) {
 			log.Error("user already exist")
+			a.audit(ctx, log, models.AuditEvent{
+				Type:     models.AuditRegister,
+				Outcome:  models.AuditFailure,
+				Metadata: map[string]string{"email": email, "reason": "user_exists"},
+			})
+
+			if a.opts.EnumerationSafeRegistration {
+				go a.notifyRegistrationAttempt(email)
+				return 0, nil
+			}
+
 			return 0, fmt.Errorf("%s: %w", op, ErrUserExists)
 		}
 		log.Error("failed to save user: " + err.Error())
@@ -131,9 +476,41 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, password strin
 
 	log.Info("successfully register user")
 
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditRegister,
+		ActorID:   id,
+		SubjectID: id,
+		Metadata:  map[string]string{"email": email},
+	})
+
+	if a.opts.EnumerationSafeRegistration {
+		return 0, nil
+	}
+
 	return id, nil
 }
 
+// notifyRegistrationAttempt tells the owner of the email about a
+// registration with it. It runs in the background, the time of sending
+// mustn't show in the answer of RegisterNewUser.
+func (a *Auth) notifyRegistrationAttempt(email string) {
+	const op = "auth.notifyRegistrationAttempt"
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := a.notifier.Notify(ctx, notify.Message{
+		To:      email,
+		Subject: "Registration attempt",
+		Body: "Someone tried to register a new account with your email address. " +
+			"You already have an account, you can log in or reset your password. " +
+			"If it wasn't you, you can ignore this message.",
+	})
+	if err != nil {
+		a.log.Error("failed to notify user: "+err.Error(), slog.String("op", op))
+	}
+}
+
 func (a *Auth) IsAdmin(ctx context.Context, userId int64) (bool, error) {
 	const op = "auth.IsAdmin"
 
@@ -154,22 +531,282 @@ func (a *Auth) IsAdmin(ctx context.Context, userId int64) (bool, error) {
 	return result, nil
 }
 
-func (a *Auth) CreateApp(ctx context.Context, name string, secret string) (int64, error) {
+// CreateApp creates an app with a generated secret and returns it with the
+// app id, the secret isn't shown again. Only admins can create apps.
+func (a *Auth) CreateApp(ctx context.Context, actorID int64, name string, scopes []string) (int64, string, error) {
 	const op = "auth.NewApp"
 
 	log := slog.With(slog.String("op", op), slog.String("username", name))
 
-	appId, err := a.appSaver.SaveApp(ctx, name, secret)
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.audit(ctx, log, models.AuditEvent{
+			Type:     models.AuditAppCreated,
+			ActorID:  actorID,
+			Outcome:  models.AuditDenied,
+			Metadata: map[string]string{"name": name},
+		})
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, scope := range scopes {
+		if scope == "" || strings.ContainsAny(scope, ", ") {
+			return 0, "", fmt.Errorf("%s: %w: %q", op, ErrInvalidScope, scope)
+		}
+	}
+
+	secret, err := newAppSecret()
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	stored, err := a.encryptSecret(secret, appSecretAAD)
+	if err != nil {
+		log.Error("failed to encrypt app secret: " + err.Error())
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	appId, err := a.appSaver.SaveApp(ctx, name, stored, scopes)
 	if err != nil {
 		if errors.Is(err, storage.ErrAppExist) {
 			log.Error("app already exist")
-			return 0, fmt.Errorf("%s: %w", op, ErrAppExist)
+			return 0, "", fmt.Errorf("%s: %w", op, ErrAppExist)
 		}
 		log.Error("error adding a new app to the database: " + err.Error())
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success create new app", slog.String("name", name), slog.Int64("actorId", actorID))
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:     models.AuditAppCreated,
+		ActorID:  actorID,
+		AppID:    appId,
+		Metadata: map[string]string{"name": name, "scopes": strings.Join(scopes, " ")},
+	})
+
+	return appId, secret, nil
+}
+
+// ListConsents returns the consents of the user, only admins can list the
+// consents of others.
+func (a *Auth) ListConsents(ctx context.Context, actorID int64, userID int64) ([]models.Consent, error) {
+	const op = "auth.ListConsents"
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	consents, err := a.cnsProvider.Consents(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to get consents", slog.String("op", op), slog.String("err", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return consents, nil
+}
+
+// RevokeConsent removes the consent of the user for the app, only admins can
+// revoke the consents of others.
+func (a *Auth) RevokeConsent(ctx context.Context, actorID int64, userID int64, appID int64) error {
+	const op = "auth.RevokeConsent"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userId", userID), slog.Int64("appId", appID))
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		a.audit(ctx, log, models.AuditEvent{
+			Type:      models.AuditConsentRevoked,
+			ActorID:   actorID,
+			SubjectID: userID,
+			AppID:     appID,
+			Outcome:   models.AuditDenied,
+		})
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.cnsSaver.DeleteConsent(ctx, userID, appID); err != nil {
+		if errors.Is(err, storage.ErrConsentNotFound) {
+			log.Error("consent not found")
+			return fmt.Errorf("%s: %w", op, ErrConsentNotFound)
+		}
+		log.Error("failed to delete consent: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success revoke consent")
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditConsentRevoked,
+		ActorID:   actorID,
+		SubjectID: userID,
+		AppID:     appID,
+	})
+
+	return nil
+}
+
+// checkConsent makes sure the app declared the scopes and the user granted
+// them, approved scopes are added to the stored consent.
+func (a *Auth) checkConsent(ctx context.Context, user models.User, app models.App, scopes []string, approved bool) error {
+	declared := models.Consent{Scopes: app.Scopes}
+	if !declared.Covers(scopes) {
+		return fmt.Errorf("%w: app %d doesn't declare %s", ErrInvalidScope, app.Id, strings.Join(scopes, " "))
+	}
+
+	consent, err := a.cnsProvider.Consent(ctx, user.ID, int64(app.Id))
+	if err != nil && !errors.Is(err, storage.ErrConsentNotFound) {
+		return err
+	}
+
+	if consent.Covers(scopes) {
+		return nil
+	}
+
+	if !approved {
+		return ErrConsentRequired
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			consent.Scopes = append(consent.Scopes, scope)
+		}
+	}
+	consent.UserID = user.ID
+	consent.AppID = int64(app.Id)
+	consent.GrantedAt = time.Now()
+
+	if err := a.cnsSaver.SaveConsent(ctx, consent); err != nil {
+		return err
 	}
 
-	log.Info("success create new app", slog.String("name", name))
+	a.audit(ctx, a.log, models.AuditEvent{
+		Type:      models.AuditConsentGranted,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		AppID:     consent.AppID,
+		Metadata:  map[string]string{"scopes": strings.Join(consent.Scopes, " ")},
+	})
+
+	return nil
+}
+
+// checkStatus returns the error matching a non-active status of the user.
+func checkStatus(user models.User) error {
+	switch user.StatusAt(time.Now()) {
+	case models.UserStatusActive:
+		return nil
+	case models.UserStatusLocked:
+		if !user.StatusUntil.IsZero() {
+			return fmt.Errorf("%w until %s", ErrUserLocked, user.StatusUntil.Format(time.RFC3339))
+		}
+		return ErrUserLocked
+	case models.UserStatusPendingVerification:
+		return ErrUserNotVerified
+	default:
+		return ErrUserDisabled
+	}
+}
+
+// ValidateToken checks a token issued by Login, a token of a service account
+// or a personal access token and returns its owner. Tokens of users that are
+// no longer active are invalid, and so are the tokens of the SSO itself
+// without an active session.
+func (a *Auth) ValidateToken(ctx context.Context, token string) (models.Principal, error) {
+	const op = "auth.ValidateToken"
+
+	if strings.HasPrefix(token, PATPrefix) {
+		principal, err := a.validatePAT(ctx, token)
+		if err != nil {
+			a.log.Debug("invalid personal access token", slog.String("op", op), slog.String("err", err.Error()))
+			return models.Principal{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return principal, nil
+	}
+
+	claims, err := jwtlocal.ParseToken(token, func(appID int64) ([][]byte, error) {
+		app, err := a.tokenApp(ctx, appID)
+		if err != nil {
+			return nil, err
+		}
+
+		return app.VerificationSecrets(time.Now()), nil
+	})
+	if err != nil {
+		a.log.Debug("invalid token", slog.String("op", op), slog.String("err", err.Error()))
+		return models.Principal{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	if claims.ServiceAccountID != 0 {
+		principal, err := a.validateServiceAccountToken(ctx, claims)
+		if err != nil {
+			a.log.Debug("invalid service account token", slog.String("op", op), slog.String("err", err.Error()))
+			return models.Principal{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return principal, nil
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.Principal{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return models.Principal{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		a.log.Debug("token of inactive user", slog.String("op", op), slog.Int64("userId", user.ID))
+		return models.Principal{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+
+	// a token of the SSO itself is only as good as its session
+	if claims.AppID == models.SSOAppID && claims.SessionID == "" {
+		a.log.Debug("token of the sso without a session", slog.String("op", op))
+		return models.Principal{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	if claims.SessionID != "" {
+		if err := a.checkSession(ctx, claims.SessionID, claims.UserID); err != nil {
+			a.log.Debug("token of inactive session", slog.String("op", op), slog.String("err", err.Error()))
+			return models.Principal{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return models.Principal{
+		UserID:             claims.UserID,
+		Email:              claims.Email,
+		AppID:              claims.AppID,
+		Scopes:             claims.Scopes,
+		ExpiresAt:          claims.ExpiresAt,
+		SessionID:          claims.SessionID,
+		AuthTime:           claims.AuthTime,
+		ACR:                claims.ACR,
+		AMR:                claims.AMR,
+		PasswordChangeOnly: claims.PasswordChangeOnly,
+		StepUpOnly:         claims.StepUpOnly,
+		Actor:              claims.Actor,
+		Roles:              claims.Roles,
+	}, nil
+}
+
+// IntrospectToken reports whether the token is active and returns its owner,
+// an inactive token is not an error. Tokens that only permit a password
+// change or a step-up, and the tokens of the SSO itself, are inactive for
+// the apps.
+func (a *Auth) IntrospectToken(ctx context.Context, token string) (models.Principal, bool, error) {
+	const op = "auth.IntrospectToken"
+
+	principal, err := a.ValidateToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return models.Principal{}, false, nil
+		}
+		return models.Principal{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if principal.PasswordChangeOnly || principal.StepUpOnly || principal.SSO() {
+		return models.Principal{}, false, nil
+	}
 
-	return appId, nil
+	return principal, true, nil
 }
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/lib/hasher"
+	"sso/internal/lib/ldap"
+	"sso/internal/services/storage"
+	"strings"
+)
+
+var (
+	// ErrNoAccount means the backend doesn't know the user, Login asks the
+	// next one.
+	ErrNoAccount = errors.New("no account in the backend")
+	// ErrNoPassword means the local user has no password, e.g. it shadows
+	// a directory user or was provisioned by an identity provider.
+	ErrNoPassword = fmt.Errorf("%w: user has no password", ErrNoAccount)
+)
+
+const (
+	BackendLocal = "local"
+	BackendLDAP  = "ldap"
+)
+
+// Authenticator checks the password of a user against a backend. It returns
+// ErrNoAccount when it doesn't know the user and ErrInvalidCredentials when
+// the password is wrong, other errors mean the backend is unavailable.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, email string, password string) (Authentication, error)
+	// Probe takes as long as Authenticate of the email without checking a
+	// password or changing anything, e.g. it mustn't count against a
+	// lockout of the backend.
+	Probe(ctx context.Context, email string)
+}
+
+// Authentication is a checked password. User is the local user, a backend
+// that knows the user but rejects the password may return it too.
+type Authentication struct {
+	User    models.User
+	Backend string
+	// Roles are granted by the backend, e.g. for the directory groups of
+	// the user. They are the "roles" claim of the token.
+	Roles []string
+}
+
+// Directory checks passwords against an LDAP directory, e.g. an ldap.Client.
+type Directory interface {
+	Authenticate(ctx context.Context, username string, password string) (entry ldap.Entry, err error)
+	Probe(ctx context.Context, username string) error
+}
+
+// LDAPOptions configure the LDAP backend.
+type LDAPOptions struct {
+	Directory Directory
+	// GroupRoles maps the DNs of the directory groups to the roles of their
+	// members, DNs compare case-insensitively.
+	GroupRoles map[string][]string
+	// LinkByEmail shadows a directory user with the existing local user of
+	// the same email, without it that user can't log in through LDAP.
+	LinkByEmail bool
+	// AllowedDomains limits the emails of new shadow users, empty allows
+	// any.
+	AllowedDomains []string
+}
+
+// authenticators returns the backends in the order of the names, unknown
+// names and an unconfigured LDAP backend are skipped.
+func (a *Auth) authenticators(names []string) []Authenticator {
+	if len(names) == 0 {
+		names = []string{BackendLocal}
+	}
+
+	var backends []Authenticator
+	for _, name := range names {
+		switch {
+		case name == BackendLocal:
+			backends = append(backends, localAuthenticator{a: a})
+		case name == BackendLDAP && a.opts.LDAP != nil:
+			backends = append(backends, ldapAuthenticator{a: a, opts: *a.opts.LDAP})
+		default:
+			a.log.Error("unknown authentication backend", slog.String("backend", name))
+		}
+	}
+
+	return backends
+}
+
+// authenticate asks the backends in order, the first that knows the user
+// decides. An unavailable backend is skipped, so the local admins can log
+// in while the directory is down, but when no other backend knows the user
+// the error is returned rather than claiming the credentials are wrong.
+//
+// A failed login probes the backends after the deciding one, so it takes
+// as long as for an email no backend knows and the time doesn't tell
+// whether the account exists.
+func (a *Auth) authenticate(ctx context.Context, log *slog.Logger, email string, password string) (Authentication, error) {
+	var (
+		known       models.User
+		noAccount   = ErrNoAccount
+		unavailable error
+	)
+
+	for i, backend := range a.backends {
+		res, err := backend.Authenticate(ctx, email, password)
+		if err == nil {
+			res.Backend = backend.Name()
+			return res, nil
+		}
+
+		switch {
+		case errors.Is(err, ErrNoAccount):
+			if res.User.ID != 0 && known.ID == 0 {
+				known, noAccount = res.User, err
+			}
+		case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrIdentityNotLinked), errors.Is(err, ErrEmailNotAllowed):
+			for _, rest := range a.backends[i+1:] {
+				rest.Probe(ctx, email)
+			}
+
+			res.Backend = backend.Name()
+			return res, err
+		default:
+			log.Error("authentication backend is unavailable",
+				slog.String("backend", backend.Name()), slog.String("err", err.Error()))
+			unavailable = err
+		}
+	}
+
+	if unavailable != nil {
+		return Authentication{User: known}, unavailable
+	}
+
+	return Authentication{User: known}, noAccount
+}
+
+// loginName returns the email the backends know the user by. The shadow
+// user of a directory user keeps its first email, the directory is asked
+// for the last one it sent, so its user filter must match the emails.
+func (a *Auth) loginName(ctx context.Context, user models.User) (string, error) {
+	if user.HasPassword() {
+		return user.Email, nil
+	}
+
+	identities, err := a.identityStore.Identities(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	for _, identity := range identities {
+		if identity.Provider == BackendLDAP && identity.Email != "" {
+			return identity.Email, nil
+		}
+	}
+
+	return user.Email, nil
+}
+
+// localAuthenticator checks the password hashes of the users.
+type localAuthenticator struct {
+	a *Auth
+}
+
+func (localAuthenticator) Name() string {
+	return BackendLocal
+}
+
+func (l localAuthenticator) Authenticate(ctx context.Context, email string, password string) (Authentication, error) {
+	user, err := l.a.usrProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			// an unknown email takes as long as a wrong password
+			_ = l.a.opts.Hasher.Verify(l.a.dummyHash, []byte(password))
+			return Authentication{}, ErrNoAccount
+		}
+		return Authentication{}, err
+	}
+
+	if !user.HasPassword() {
+		_ = l.a.opts.Hasher.Verify(l.a.dummyHash, []byte(password))
+		return Authentication{User: user}, ErrNoPassword
+	}
+
+	if err := l.a.opts.Hasher.Verify(user.PassHash, []byte(password)); err != nil {
+		if !errors.Is(err, hasher.ErrMismatch) {
+			l.a.log.Error("failed to verify password: "+err.Error(), slog.Int64("userId", user.ID))
+		}
+		return Authentication{User: user}, ErrInvalidCredentials
+	}
+
+	return Authentication{User: user}, nil
+}
+
+// Probe looks the user up and verifies the password against the dummy hash,
+// as Authenticate does for an unknown email.
+func (l localAuthenticator) Probe(ctx context.Context, email string) {
+	_, _ = l.a.usrProvider.User(ctx, email)
+	_ = l.a.opts.Hasher.Verify(l.a.dummyHash, []byte(email))
+}
+
+// ldapAuthenticator checks the passwords in the directory. Every directory
+// user is shadowed by a local user without a password, linked by the
+// stable id of the entry, so the user id survives renames in the directory.
+type ldapAuthenticator struct {
+	a    *Auth
+	opts LDAPOptions
+}
+
+func (ldapAuthenticator) Name() string {
+	return BackendLDAP
+}
+
+func (l ldapAuthenticator) Authenticate(ctx context.Context, email string, password string) (Authentication, error) {
+	entry, err := l.opts.Directory.Authenticate(ctx, email, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, ldap.ErrUserNotFound):
+			return Authentication{}, ErrNoAccount
+		case errors.Is(err, ldap.ErrInvalidCredentials):
+			return Authentication{}, ErrInvalidCredentials
+		}
+		return Authentication{}, err
+	}
+
+	log := l.a.log.With(slog.String("op", "auth.ldapAuthenticator"), slog.String("dn", entry.DN))
+
+	if entry.Email == "" {
+		entry.Email = email
+	}
+
+	user, err := l.a.federatedUser(ctx, log, FederatedProvider{
+		ID:             BackendLDAP,
+		AutoProvision:  true,
+		LinkByEmail:    l.opts.LinkByEmail,
+		AllowedDomains: l.opts.AllowedDomains,
+	}, externalIdentity{
+		Subject:       entry.UID,
+		Email:         entry.Email,
+		EmailVerified: true,
+	})
+	if err != nil {
+		return Authentication{}, err
+	}
+
+	return Authentication{User: user, Roles: l.roles(entry.Groups)}, nil
+}
+
+func (l ldapAuthenticator) Probe(ctx context.Context, email string) {
+	if err := l.opts.Directory.Probe(ctx, email); err != nil {
+		l.a.log.Debug("failed to probe the directory", slog.String("err", err.Error()))
+	}
+}
+
+// roles returns the roles of the groups, sorted and without duplicates.
+func (l ldapAuthenticator) roles(groups []string) []string {
+	var roles []string
+	for dn, granted := range l.opts.GroupRoles {
+		if slices.ContainsFunc(groups, func(group string) bool { return strings.EqualFold(group, dn) }) {
+			roles = append(roles, granted...)
+		}
+	}
+	slices.Sort(roles)
+
+	return slices.Compact(roles)
+}
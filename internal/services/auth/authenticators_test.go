@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend answers Authenticate with err and records the calls.
+type fakeBackend struct {
+	name   string
+	err    error
+	calls  []string
+	probes []string
+}
+
+func (f *fakeBackend) Name() string {
+	return f.name
+}
+
+func (f *fakeBackend) Authenticate(ctx context.Context, email string, password string) (Authentication, error) {
+	f.calls = append(f.calls, email)
+
+	return Authentication{}, f.err
+}
+
+func (f *fakeBackend) Probe(ctx context.Context, email string) {
+	f.probes = append(f.probes, email)
+}
+
+func TestAuthenticate_ProbesAfterFailure(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	unavailable := errors.New("dial: connection refused")
+
+	tests := []struct {
+		name       string
+		local      error
+		ldap       error
+		wantErr    error
+		wantLDAP   int
+		wantProbes int
+	}{
+		{
+			name:     "unknown email asks every backend",
+			local:    ErrNoAccount,
+			ldap:     ErrNoAccount,
+			wantErr:  ErrNoAccount,
+			wantLDAP: 1,
+		},
+		{
+			name:       "wrong local password probes the directory",
+			local:      ErrInvalidCredentials,
+			ldap:       nil,
+			wantErr:    ErrInvalidCredentials,
+			wantProbes: 1,
+		},
+		{
+			name:     "user without password falls through",
+			local:    ErrNoPassword,
+			ldap:     ErrInvalidCredentials,
+			wantErr:  ErrInvalidCredentials,
+			wantLDAP: 1,
+		},
+		{
+			name:     "unavailable directory is returned",
+			local:    ErrNoAccount,
+			ldap:     unavailable,
+			wantErr:  unavailable,
+			wantLDAP: 1,
+		},
+		{
+			name:  "local success stops",
+			local: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := &fakeBackend{name: BackendLocal, err: tt.local}
+			directory := &fakeBackend{name: BackendLDAP, err: tt.ldap}
+
+			a := NewAuth(log, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, time.Hour, Options{})
+			a.backends = []Authenticator{local, directory}
+
+			_, err := a.authenticate(context.Background(), log, "user@example.com", "password")
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.wantErr)
+			}
+			assert.Len(t, local.calls, 1)
+			assert.Len(t, directory.calls, tt.wantLDAP)
+			assert.Len(t, directory.probes, tt.wantProbes)
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	jwtlocal "sso/internal/lib"
+	"sso/internal/services/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Token types of the token exchange (RFC 8693, section 3). The tokens of
+// the service are JWT access tokens, so both name the same thing.
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+var (
+	ErrUnsupportedTokenType = errors.New("unsupported token type")
+	ErrInvalidSubjectToken  = errors.New("invalid subject token")
+	ErrInvalidActorToken    = errors.New("invalid actor token")
+	ErrActorTokenRequired   = errors.New("actor token is required")
+	ErrExchangeNotAllowed   = errors.New("token exchange is not allowed")
+	// ErrExchangeCaller means the caller isn't a service account of the app
+	// the subject token was issued for.
+	ErrExchangeCaller = errors.New("caller is not a client of the source app")
+)
+
+// ExchangeRule trusts the source app to exchange the tokens issued for it
+// for tokens of the target app.
+type ExchangeRule struct {
+	SourceAppID int64
+	TargetAppID int64
+	// Scopes caps the scopes of the new tokens, empty keeps the scopes of
+	// the subject token.
+	Scopes []string
+	// RequireActor refuses exchanges without an actor token, so the new
+	// token always names the service acting for the user.
+	RequireActor bool
+}
+
+// TokenExchangeRequest is a token exchange request, empty token types mean
+// access tokens. Caller is the client asking for the exchange.
+type TokenExchangeRequest struct {
+	Caller             models.Principal
+	SubjectToken       string
+	SubjectTokenType   string
+	ActorToken         string
+	ActorTokenType     string
+	AppID              int64
+	Scopes             []string
+	RequestedTokenType string
+}
+
+// TokenExchange issues a token of the subject token's user for the target
+// app. The caller must be a service account of the subject token's app, a
+// leaked subject token alone can't be exchanged. The new token keeps the
+// session and the authentication of the subject token, its scopes are the
+// requested ones, which must be within the subject token, the target app
+// and the rule. The actor token's user or service account becomes the
+// actor, with the actors of the subject token nested in it.
+func (a *Auth) TokenExchange(ctx context.Context, req TokenExchangeRequest) (models.ExchangedToken, error) {
+	const op = "auth.TokenExchange"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("appId", req.AppID),
+	)
+
+	for _, tokenType := range []string{req.SubjectTokenType, req.ActorTokenType, req.RequestedTokenType} {
+		if tokenType != "" && tokenType != TokenTypeAccessToken && tokenType != TokenTypeJWT {
+			return models.ExchangedToken{}, fmt.Errorf("%s: %w: %q", op, ErrUnsupportedTokenType, tokenType)
+		}
+	}
+
+	subject, err := a.exchangedPrincipal(ctx, req.SubjectToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, ErrInvalidSubjectToken)
+		}
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	// a service account acts for itself, it has no user to pass on
+	if subject.ServiceAccountID != 0 {
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w: token of a service account", op,
+			ErrInvalidSubjectToken)
+	}
+
+	log = log.With(slog.Int64("userId", subject.UserID), slog.Int64("sourceAppId", subject.AppID))
+
+	// the client of the source app authenticates itself
+	if req.Caller.ServiceAccountID == 0 || req.Caller.AppID != subject.AppID {
+		log.Warn("exchange by a caller of another app", slog.Int64("callerAppId", req.Caller.AppID),
+			slog.Int64("callerServiceAccountId", req.Caller.ServiceAccountID))
+		a.auditExchange(ctx, log, req.Caller, subject, req.AppID, models.AuditDenied, map[string]string{
+			"reason": "invalid_caller",
+		})
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, ErrExchangeCaller)
+	}
+
+	var actor *models.Principal
+	if req.ActorToken != "" {
+		principal, err := a.exchangedPrincipal(ctx, req.ActorToken)
+		if err != nil {
+			if errors.Is(err, ErrInvalidToken) {
+				return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, ErrInvalidActorToken)
+			}
+			return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+		}
+		// the actor proves it's a party of the source app
+		if principal.AppID != subject.AppID {
+			return models.ExchangedToken{}, fmt.Errorf("%s: %w: issued for app %d", op,
+				ErrInvalidActorToken, principal.AppID)
+		}
+		actor = &principal
+	}
+
+	actorPrincipal := req.Caller
+	if actor != nil {
+		actorPrincipal = *actor
+	}
+
+	rule, ok := a.exchangeRule(subject.AppID, req.AppID)
+	if !ok {
+		log.Warn("no trust rule for the exchange")
+		a.auditExchange(ctx, log, actorPrincipal, subject, req.AppID, models.AuditDenied, nil)
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w: from app %d to app %d", op,
+			ErrExchangeNotAllowed, subject.AppID, req.AppID)
+	}
+	if rule.RequireActor && actor == nil {
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, ErrActorTokenRequired)
+	}
+
+	app, err := a.app(ctx, req.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if models.ACRLevel(app.MinACR) > models.ACRLevel(subject.ACR) {
+		log.Warn("target app requires a step-up", slog.String("minAcr", app.MinACR))
+		a.auditExchange(ctx, log, actorPrincipal, subject, req.AppID, models.AuditDenied, map[string]string{
+			"reason": "step_up_required",
+		})
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, ErrStepUpRequired)
+	}
+
+	scopes, err := exchangeScopes(subject.Scopes, app.Scopes, rule.Scopes, req.Scopes)
+	if err != nil {
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the subject token's actors acted before the new one
+	act := subject.Actor
+	if actor != nil {
+		act = &models.Actor{
+			UserID:           actor.UserID,
+			Email:            actor.Email,
+			ServiceAccountID: actor.ServiceAccountID,
+			Actor:            subject.Actor,
+		}
+	}
+
+	ttl := a.opts.ExchangeTokenTTL
+	if left := time.Until(subject.ExpiresAt); left < ttl {
+		ttl = left
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	token, err := jwtlocal.NewToken(models.User{ID: subject.UserID, Email: subject.Email}, app, ttl,
+		jwtlocal.TokenOptions{
+			Scopes:    scopes,
+			SessionID: subject.SessionID,
+			AuthTime:  subject.AuthTime,
+			ACR:       subject.ACR,
+			AMR:       subject.AMR,
+			Actor:     act,
+		})
+	if err != nil {
+		log.Error("cannot generate token")
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("token exchanged", slog.Int64("actorId", actorPrincipal.UserID),
+		slog.Int64("actorServiceAccountId", actorPrincipal.ServiceAccountID))
+
+	a.auditExchange(ctx, log, actorPrincipal, subject, req.AppID, models.AuditSuccess, map[string]string{
+		"scopes":     strings.Join(scopes, " "),
+		"session_id": subject.SessionID,
+	})
+
+	tokenType := req.RequestedTokenType
+	if tokenType == "" {
+		tokenType = TokenTypeAccessToken
+	}
+
+	return models.ExchangedToken{
+		Token:     token,
+		TokenType: tokenType,
+		ExpiresAt: expiresAt,
+		Scopes:    scopes,
+	}, nil
+}
+
+// exchangedPrincipal validates a token given to the exchange, tokens that
+// only permit a password change or a step-up and the tokens of the SSO
+// itself are invalid there.
+func (a *Auth) exchangedPrincipal(ctx context.Context, token string) (models.Principal, error) {
+	principal, err := a.ValidateToken(ctx, token)
+	if err != nil {
+		return models.Principal{}, err
+	}
+
+	if principal.PasswordChangeOnly || principal.StepUpOnly || principal.SSO() {
+		return models.Principal{}, ErrInvalidToken
+	}
+
+	return principal, nil
+}
+
+func (a *Auth) exchangeRule(sourceAppID int64, targetAppID int64) (ExchangeRule, bool) {
+	for _, rule := range a.opts.ExchangeRules {
+		if rule.SourceAppID == sourceAppID && rule.TargetAppID == targetAppID {
+			return rule, true
+		}
+	}
+
+	return ExchangeRule{}, false
+}
+
+// exchangeScopes returns the requested scopes, at least one must be
+// requested. A scope is allowed when the subject token has it, the target
+// app declares it and the rule, if it caps the scopes, lists it.
+func exchangeScopes(subject []string, declared []string, capped []string, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("%w: no scopes requested", ErrInvalidScope)
+	}
+
+	var allowed []string
+	for _, scope := range subject {
+		if !slices.Contains(declared, scope) {
+			continue
+		}
+		if len(capped) > 0 && !slices.Contains(capped, scope) {
+			continue
+		}
+		allowed = append(allowed, scope)
+	}
+
+	for _, scope := range requested {
+		if !slices.Contains(allowed, scope) {
+			return nil, fmt.Errorf("%w: %q can't be exchanged", ErrInvalidScope, scope)
+		}
+	}
+
+	return requested, nil
+}
+
+// auditExchange records an exchange, the actor is a user or a service
+// account.
+func (a *Auth) auditExchange(ctx context.Context, log *slog.Logger, actor models.Principal, subject models.Principal,
+	targetAppID int64, outcome string, metadata map[string]string) {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata["source_app_id"] = strconv.FormatInt(subject.AppID, 10)
+
+	actorID, actorType := actor.UserID, ""
+	if actor.ServiceAccountID != 0 {
+		actorID, actorType = actor.ServiceAccountID, models.AuditActorServiceAccount
+	}
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditTokenExchanged,
+		ActorID:   actorID,
+		ActorType: actorType,
+		SubjectID: subject.UserID,
+		AppID:     targetAppID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeScopes(t *testing.T) {
+	subject := []string{"orders.read", "orders.write", "profile"}
+	declared := []string{"orders.read", "orders.write"}
+
+	tests := []struct {
+		name      string
+		capped    []string
+		requested []string
+		want      []string
+		wantErr   error
+	}{
+		{name: "requested", requested: []string{"orders.read"}, want: []string{"orders.read"}},
+		{name: "none requested", wantErr: ErrInvalidScope},
+		{name: "not in the subject token", requested: []string{"orders.delete"}, wantErr: ErrInvalidScope},
+		{name: "not declared by the target", requested: []string{"profile"}, wantErr: ErrInvalidScope},
+		{
+			name:      "capped by the rule",
+			capped:    []string{"orders.read"},
+			requested: []string{"orders.write"},
+			wantErr:   ErrInvalidScope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := exchangeScopes(subject, declared, tt.capped, tt.requested)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
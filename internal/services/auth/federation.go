@@ -0,0 +1,478 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	jwtlocal "sso/internal/lib"
+	"sso/internal/services/audit"
+	"sso/internal/services/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	federationStateLen        = 32
+	federationNonceLen        = 32
+	federationCodeVerifierLen = 48
+)
+
+var (
+	ErrProviderNotFound       = errors.New("identity provider not found")
+	ErrInvalidFederationState = errors.New("invalid federation state")
+	ErrFederationFailed       = errors.New("federated login failed")
+	ErrIdentityNotLinked      = errors.New("identity is not linked to a user")
+	ErrEmailNotAllowed        = errors.New("email domain is not allowed")
+)
+
+// IdentityProviderClient talks to an upstream identity provider, e.g. an
+// oidc.Provider.
+type IdentityProviderClient interface {
+	AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (url string, err error)
+	// Exchange redeems the code and returns the claims of the verified ID
+	// token.
+	Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (claims map[string]any, err error)
+}
+
+// FederatedProvider is an upstream identity provider the users of an org
+// log in with.
+type FederatedProvider struct {
+	ID     string
+	Name   string
+	OrgID  int64
+	Client IdentityProviderClient
+	// Claims names the claims of the ID token the user attributes are taken
+	// from.
+	Claims ClaimMapping
+	// AutoProvision creates a user without a password on the first login of
+	// an unknown identity.
+	AutoProvision bool
+	// LinkByEmail links an unknown identity to the existing user with the
+	// same email. Enable it only for providers that own the emails they
+	// vouch for.
+	LinkByEmail bool
+	// TrustEmail treats the emails of the provider as verified when it
+	// doesn't send the verified claim.
+	TrustEmail bool
+	// AllowedDomains limits the emails of new identities, empty allows any.
+	AllowedDomains []string
+}
+
+// ClaimMapping names the claims of the user attributes, empty names mean
+// the standard claims "sub", "email" and "email_verified".
+type ClaimMapping struct {
+	Subject       string
+	Email         string
+	EmailVerified string
+}
+
+type IdentityStore interface {
+	SaveIdentity(ctx context.Context, identity models.Identity) (identityID int64, err error)
+	Identity(ctx context.Context, provider string, subject string) (identity models.Identity, err error)
+	Identities(ctx context.Context, userID int64) (identities []models.Identity, err error)
+	TouchIdentity(ctx context.Context, identityID int64, email string, loginAt time.Time) error
+	SaveFederationState(ctx context.Context, state models.FederationState) error
+	TakeFederationState(ctx context.Context, stateHash string, now time.Time) (state models.FederationState, err error)
+}
+
+// externalIdentity holds the user attributes taken from an ID token.
+type externalIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// ListIdentityProviders returns the identity providers of the org.
+func (a *Auth) ListIdentityProviders(orgID int64) []models.IdentityProvider {
+	var providers []models.IdentityProvider
+	for _, provider := range a.opts.FederatedProviders {
+		if provider.OrgID == orgID {
+			providers = append(providers, models.IdentityProvider{
+				ID:    provider.ID,
+				Name:  provider.Name,
+				OrgID: provider.OrgID,
+			})
+		}
+	}
+
+	return providers
+}
+
+// StartFederatedLogin starts a login at the identity provider for the app
+// and returns the URL to send the user to. The provider sends the user back
+// to its redirect URL with a state and a code for CompleteFederatedLogin.
+func (a *Auth) StartFederatedLogin(ctx context.Context, providerID string, appID int64) (string, error) {
+	const op = "auth.StartFederatedLogin"
+
+	log := a.log.With(slog.String("op", op), slog.String("provider", providerID), slog.Int64("appId", appID))
+
+	provider, ok := a.federatedProvider(providerID)
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, ErrProviderNotFound)
+	}
+
+	state, err := randomString(federationStateLen)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	nonce, err := randomString(federationNonceLen)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	codeVerifier, err := randomString(federationCodeVerifierLen)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	authURL, err := provider.Client.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		log.Error("failed to build authorization url: " + err.Error())
+		return "", fmt.Errorf("%s: %w: %w", op, ErrFederationFailed, err)
+	}
+
+	err = a.identityStore.SaveFederationState(ctx, models.FederationState{
+		StateHash:    hashToken(state),
+		Provider:     provider.ID,
+		AppID:        appID,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(a.opts.FederationStateTTL),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to save federation state: " + err.Error())
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("federated login started")
+
+	return authURL, nil
+}
+
+// CompleteFederatedLogin redeems the code the identity provider sent back
+// with the state and logs the user of the identity in to the app of the
+// state. An unknown identity is linked to a user by its email or gets a new
+// user, as the provider allows.
+func (a *Auth) CompleteFederatedLogin(ctx context.Context, state string, code string) (models.LoginResult, error) {
+	const op = "auth.CompleteFederatedLogin"
+
+	log := a.log.With(slog.String("op", op))
+
+	pending, err := a.identityStore.TakeFederationState(ctx, hashToken(state), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrFederationStateNotFound) {
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidFederationState)
+		}
+		log.Error("failed to get federation state: " + err.Error())
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.String("provider", pending.Provider), slog.Int64("appId", pending.AppID))
+
+	provider, ok := a.federatedProvider(pending.Provider)
+	if !ok {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, ErrProviderNotFound)
+	}
+
+	claims, err := provider.Client.Exchange(ctx, code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		log.Warn("failed to redeem the code: " + err.Error())
+		a.auditFederatedLogin(ctx, log, 0, pending.AppID, provider.ID, "", models.AuditFailure, "exchange_failed")
+		return models.LoginResult{}, fmt.Errorf("%s: %w: %w", op, ErrFederationFailed, err)
+	}
+
+	ext := provider.Claims.identity(claims)
+	if ext.Subject == "" {
+		return models.LoginResult{}, fmt.Errorf("%s: %w: subject claim is missing", op, ErrFederationFailed)
+	}
+
+	log = log.With(slog.String("subject", ext.Subject))
+
+	user, err := a.federatedUser(ctx, log, provider, ext)
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotLinked) || errors.Is(err, ErrEmailNotAllowed) {
+			log.Warn("identity can't log in", slog.String("err", err.Error()))
+			a.auditFederatedLogin(ctx, log, 0, pending.AppID, provider.ID, ext.Subject, models.AuditDenied,
+				"not_linked")
+		}
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkStatus(user); err != nil {
+		log.Warn("user is not active", slog.String("status", user.Status))
+		a.auditFederatedLogin(ctx, log, user.ID, pending.AppID, provider.ID, ext.Subject, models.AuditDenied,
+			"user_"+user.StatusAt(time.Now()))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.tokenApp(ctx, pending.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the provider's authentication counts as a login, there is no local
+	// password to step up with
+	if models.ACRLevel(app.MinACR) > models.ACRLevel(models.ACRPassword) {
+		log.Warn("app requires a step-up", slog.String("minAcr", app.MinACR))
+		a.auditFederatedLogin(ctx, log, user.ID, pending.AppID, provider.ID, ext.Subject, models.AuditDenied,
+			"step_up_required")
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, ErrStepUpRequired)
+	}
+
+	authTime := time.Now()
+
+	session, err := a.startSession(ctx, user.ID, pending.AppID, 0, a.tokenTTL)
+	if err != nil {
+		log.Error("failed to save session: " + err.Error())
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := jwtlocal.NewToken(user, app, a.tokenTTL, jwtlocal.TokenOptions{
+		SessionID: session.ID,
+		AuthTime:  authTime,
+		ACR:       models.ACRPassword,
+		AMR:       []string{models.AMRFederated},
+	})
+	if err != nil {
+		log.Error("cannot generate token")
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("successfully login user", slog.Int64("userId", user.ID))
+
+	a.trackDevice(ctx, log, user)
+	a.auditFederatedLogin(ctx, log, user.ID, pending.AppID, provider.ID, ext.Subject, models.AuditSuccess, "")
+	a.recordLogin(ctx, log, models.LoginAttempt{
+		UserID:  user.ID,
+		AppID:   pending.AppID,
+		Email:   user.Email,
+		Success: true,
+	})
+
+	return models.LoginResult{Token: token}, nil
+}
+
+// ListIdentities returns the identities linked to the user. Users see their
+// own identities, admins anyone's.
+func (a *Auth) ListIdentities(ctx context.Context, actorID int64, userID int64) ([]models.Identity, error) {
+	const op = "auth.ListIdentities"
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	identities, err := a.identityStore.Identities(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to get identities: "+err.Error(), slog.String("op", op))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return identities, nil
+}
+
+// federatedUser returns the user linked to the identity, linking or
+// provisioning one on the first login. Only a verified email of an allowed
+// domain links or provisions a user.
+func (a *Auth) federatedUser(ctx context.Context, log *slog.Logger, provider FederatedProvider,
+	ext externalIdentity) (models.User, error) {
+	now := time.Now()
+
+	identity, err := a.identityStore.Identity(ctx, provider.ID, ext.Subject)
+	switch {
+	case err == nil:
+		if err := a.identityStore.TouchIdentity(ctx, identity.ID, ext.Email, now); err != nil {
+			log.Error("failed to touch identity: " + err.Error())
+		}
+
+		user, err := a.usrProvider.UserByID(ctx, identity.UserID)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return models.User{}, ErrIdentityNotLinked
+			}
+			return models.User{}, err
+		}
+
+		return user, nil
+	case !errors.Is(err, storage.ErrIdentityNotFound):
+		return models.User{}, err
+	}
+
+	if ext.Email == "" {
+		return models.User{}, fmt.Errorf("%w: the provider sent no email", ErrIdentityNotLinked)
+	}
+	if !ext.EmailVerified && !provider.TrustEmail {
+		return models.User{}, fmt.Errorf("%w: the email isn't verified", ErrIdentityNotLinked)
+	}
+	if !provider.allowsEmail(ext.Email) {
+		return models.User{}, fmt.Errorf("%w: %s", ErrEmailNotAllowed, ext.Email)
+	}
+
+	provisioned := false
+
+	user, err := a.usrProvider.User(ctx, ext.Email)
+	switch {
+	case err == nil:
+		if !provider.LinkByEmail {
+			return models.User{}, fmt.Errorf("%w: a user with the email exists", ErrIdentityNotLinked)
+		}
+	case errors.Is(err, storage.ErrUserNotFound):
+		if !provider.AutoProvision {
+			return models.User{}, fmt.Errorf("%w: no user with the email", ErrIdentityNotLinked)
+		}
+
+		uid, err := a.usrSaver.SaveUser(ctx, ext.Email, []byte(models.NoPasswordHash))
+		if err != nil {
+			if errors.Is(err, storage.ErrUserExist) {
+				return models.User{}, fmt.Errorf("%w: a user with the email exists", ErrIdentityNotLinked)
+			}
+			return models.User{}, err
+		}
+
+		// the provisioned user joins the org of the provider
+		if provider.OrgID != 0 {
+			err := a.usrSaver.SetUserOrg(ctx, uid, provider.OrgID, audit.Complete(ctx, models.AuditEvent{
+				Type:      models.AuditUserOrg,
+				ActorID:   uid,
+				SubjectID: uid,
+				Metadata:  map[string]string{"org_id": strconv.FormatInt(provider.OrgID, 10), "provider": provider.ID},
+			}))
+			if err != nil {
+				return models.User{}, err
+			}
+		}
+
+		user, err = a.usrProvider.UserByID(ctx, uid)
+		if err != nil {
+			return models.User{}, err
+		}
+		provisioned = true
+	default:
+		return models.User{}, err
+	}
+
+	identity = models.Identity{
+		Provider:    provider.ID,
+		Subject:     ext.Subject,
+		UserID:      user.ID,
+		Email:       ext.Email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}
+
+	identity.ID, err = a.identityStore.SaveIdentity(ctx, identity)
+	if err != nil {
+		// a concurrent first login linked the identity already
+		if errors.Is(err, storage.ErrIdentityExist) {
+			return a.federatedUser(ctx, log, provider, ext)
+		}
+		return models.User{}, err
+	}
+
+	log.Info("identity linked", slog.Int64("userId", user.ID), slog.Bool("provisioned", provisioned))
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditIdentityLinked,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Metadata: map[string]string{
+			"provider":    provider.ID,
+			"subject":     ext.Subject,
+			"email":       ext.Email,
+			"provisioned": fmt.Sprint(provisioned),
+		},
+	})
+
+	return user, nil
+}
+
+func (a *Auth) federatedProvider(providerID string) (FederatedProvider, bool) {
+	for _, provider := range a.opts.FederatedProviders {
+		if provider.ID == providerID {
+			return provider, true
+		}
+	}
+
+	return FederatedProvider{}, false
+}
+
+func (p FederatedProvider) allowsEmail(email string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return false
+	}
+
+	return slices.Contains(p.AllowedDomains, strings.ToLower(domain))
+}
+
+// identity takes the user attributes from the claims. Some providers send
+// email_verified as a string.
+func (m ClaimMapping) identity(claims map[string]any) externalIdentity {
+	subject, email, verified := m.Subject, m.Email, m.EmailVerified
+	if subject == "" {
+		subject = "sub"
+	}
+	if email == "" {
+		email = "email"
+	}
+	if verified == "" {
+		verified = "email_verified"
+	}
+
+	var ext externalIdentity
+	ext.Subject, _ = claims[subject].(string)
+	if s, ok := claims[email].(string); ok {
+		ext.Email = strings.TrimSpace(s)
+	}
+	switch v := claims[verified].(type) {
+	case bool:
+		ext.EmailVerified = v
+	case string:
+		ext.EmailVerified = v == "true"
+	}
+
+	return ext
+}
+
+func (a *Auth) auditFederatedLogin(ctx context.Context, log *slog.Logger, userID int64, appID int64,
+	providerID string, subject string, outcome string, reason string) {
+	metadata := map[string]string{"provider": providerID}
+	if subject != "" {
+		metadata["subject"] = subject
+	}
+	if reason != "" {
+		metadata["reason"] = reason
+	}
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditFederatedLogin,
+		ActorID:   userID,
+		SubjectID: userID,
+		AppID:     appID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+}
+
+func randomString(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	jwtlocal "sso/internal/lib"
+	"sso/internal/services/storage"
+	"strings"
+	"time"
+)
+
+// ActionImpersonate is the policy action checked before an admin
+// impersonates a user in an app.
+const ActionImpersonate = "sso:impersonate"
+
+var (
+	ErrImpersonationDisabled = errors.New("impersonation is disabled for the app")
+	ErrNotImpersonating      = errors.New("token is not an impersonation")
+)
+
+// PolicyChecker evaluates the app policies, see authz.Authz.
+type PolicyChecker interface {
+	Authorize(ctx context.Context, appID int64, userID int64, action string,
+		user map[string]any, resource map[string]any, reqCtx map[string]any) (decision models.Decision, err error)
+}
+
+// Impersonate issues a token of the user for the app to the admin, the token
+// carries the admin in its "act" claim and has its own session. The admin
+// needs the impersonate permission, admins can't be impersonated, and an app
+// policy can forbid it. The reason is written to the audit log.
+func (a *Auth) Impersonate(ctx context.Context, actor models.Principal, userID int64, appID int64,
+	reason string) (models.Impersonation, error) {
+	const op = "auth.Impersonate"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actorId", actor.UserID),
+		slog.Int64("userId", userID),
+		slog.Int64("appId", appID),
+	)
+
+	if strings.TrimSpace(reason) == "" {
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, ErrReasonRequired)
+	}
+
+	if err := a.canImpersonate(ctx, actor, userID); err != nil {
+		log.Warn("impersonation refused", slog.String("err", err.Error()))
+		a.auditImpersonation(ctx, log, models.AuditImpersonationStarted, actor.UserID, userID, appID,
+			models.AuditDenied, map[string]string{"reason": reason})
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.Impersonation{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.IsAdmin {
+		log.Warn("admins can't be impersonated")
+		a.auditImpersonation(ctx, log, models.AuditImpersonationStarted, actor.UserID, userID, appID,
+			models.AuditDenied, map[string]string{"reason": reason})
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	if err := checkStatus(user); err != nil {
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.app(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.Impersonation{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkImpersonationPolicy(ctx, actor, user, appID); err != nil {
+		log.Warn("impersonation refused by policy", slog.String("err", err.Error()))
+		a.auditImpersonation(ctx, log, models.AuditImpersonationStarted, actor.UserID, userID, appID,
+			models.AuditDenied, map[string]string{"reason": reason})
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session, err := a.startSession(ctx, userID, appID, actor.UserID, a.opts.ImpersonationTTL)
+	if err != nil {
+		log.Error("failed to save session: " + err.Error())
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := jwtlocal.NewToken(user, app, a.opts.ImpersonationTTL, jwtlocal.TokenOptions{
+		SessionID: session.ID,
+		Actor:     &models.Actor{UserID: actor.UserID, Email: actor.Email},
+	})
+	if err != nil {
+		log.Error("cannot generate token")
+		return models.Impersonation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("impersonation started", slog.String("sessionId", session.ID))
+
+	a.auditImpersonation(ctx, log, models.AuditImpersonationStarted, actor.UserID, userID, appID,
+		models.AuditSuccess, map[string]string{
+			"reason":     reason,
+			"session_id": session.ID,
+			"expires_at": session.ExpiresAt.UTC().Format(time.RFC3339),
+		})
+
+	return models.Impersonation{Token: token, SessionID: session.ID, ExpiresAt: session.ExpiresAt}, nil
+}
+
+// EndImpersonation ends the impersonation session of the token, the tokens
+// of the session stop validating.
+func (a *Auth) EndImpersonation(ctx context.Context, principal models.Principal, reason string) error {
+	const op = "auth.EndImpersonation"
+
+	if principal.Actor == nil || principal.SessionID == "" {
+		return fmt.Errorf("%s: %w", op, ErrNotImpersonating)
+	}
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("actorId", principal.Actor.UserID),
+		slog.Int64("userId", principal.UserID),
+	)
+
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("%s: %w", op, ErrReasonRequired)
+	}
+
+	err := a.sessStore.RevokeSession(ctx, principal.UserID, principal.SessionID, time.Now())
+	if err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+		log.Error("failed to revoke session: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("impersonation ended", slog.String("sessionId", principal.SessionID))
+
+	a.auditImpersonation(ctx, log, models.AuditImpersonationEnded, principal.Actor.UserID, principal.UserID,
+		principal.AppID, models.AuditSuccess, map[string]string{
+			"reason":     reason,
+			"session_id": principal.SessionID,
+		})
+
+	return nil
+}
+
+// canImpersonate checks the admin may impersonate the user. Impersonation
+// tokens can't start another impersonation.
+func (a *Auth) canImpersonate(ctx context.Context, actor models.Principal, userID int64) error {
+	if actor.Actor != nil || actor.UserID == userID {
+		return ErrPermissionDenied
+	}
+
+	if err := a.requireAdmin(ctx, actor.UserID); err != nil {
+		return err
+	}
+
+	granted, err := a.usrProvider.HasPermission(ctx, actor.UserID, models.PermissionImpersonate)
+	if err != nil {
+		return err
+	}
+	if !granted {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// checkImpersonationPolicy evaluates the app policies for the impersonate
+// action with the admin as the user and the target as the resource. Only a
+// matching deny policy forbids it, apps without one allow impersonation.
+// Only admins create and delete policies, so a user can't lift the deny.
+func (a *Auth) checkImpersonationPolicy(ctx context.Context, actor models.Principal, user models.User,
+	appID int64) error {
+	if a.opts.Policies == nil {
+		return nil
+	}
+
+	decision, err := a.opts.Policies.Authorize(ctx, appID, actor.UserID, ActionImpersonate, nil,
+		map[string]any{"id": user.ID, "email": user.Email}, nil)
+	if err != nil {
+		return err
+	}
+
+	if decision.Policy.ID != 0 && !decision.Allowed {
+		return ErrImpersonationDisabled
+	}
+
+	return nil
+}
+
+func (a *Auth) auditImpersonation(ctx context.Context, log *slog.Logger, eventType string, actorID int64,
+	userID int64, appID int64, outcome string, metadata map[string]string) {
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      eventType,
+		ActorID:   actorID,
+		SubjectID: userID,
+		AppID:     appID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/clientinfo"
+	"sso/internal/lib/notify"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLoginHistoryPageSize = 50
+	maxLoginHistoryPageSize     = 500
+)
+
+type LoginHistoryStore interface {
+	SaveLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error
+	LoginHistory(ctx context.Context, userID int64, beforeID int64, limit int) (attempts []models.LoginAttempt, err error)
+	TrackDevice(ctx context.Context, userID int64, deviceID string, seenAt time.Time) (known bool, others bool, err error)
+}
+
+// GetLoginHistory returns a page of the login attempts of the user, newest
+// first, and the cursor of the next page, empty on the last one. Users see
+// their own history, admins anyone's.
+func (a *Auth) GetLoginHistory(ctx context.Context, actorID int64, userID int64,
+	limit int, cursor string) ([]models.LoginAttempt, string, error) {
+	const op = "auth.GetLoginHistory"
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var beforeID int64
+	if cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCursor)
+		}
+		beforeID = id
+	}
+
+	switch {
+	case limit <= 0:
+		limit = defaultLoginHistoryPageSize
+	case limit > maxLoginHistoryPageSize:
+		limit = maxLoginHistoryPageSize
+	}
+
+	// one more attempt tells whether there is a next page
+	attempts, err := a.loginStore.LoginHistory(ctx, userID, beforeID, limit+1)
+	if err != nil {
+		a.log.Error("failed to get login history: "+err.Error(), slog.String("op", op))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var next string
+	if len(attempts) > limit {
+		attempts = attempts[:limit]
+		next = strconv.FormatInt(attempts[len(attempts)-1].ID, 10)
+	}
+
+	return attempts, next, nil
+}
+
+// recordLogin saves the login attempt to the login history, a failure is
+// logged and doesn't fail the login.
+func (a *Auth) recordLogin(ctx context.Context, log *slog.Logger, attempt models.LoginAttempt) {
+	client := clientinfo.From(ctx)
+	attempt.DeviceID = client.DeviceID
+	attempt.IP = client.IP
+	attempt.UserAgent = client.UserAgent
+	attempt.CreatedAt = time.Now()
+
+	if err := a.loginStore.SaveLoginAttempt(ctx, attempt); err != nil {
+		log.Error("failed to save login attempt: " + err.Error())
+	}
+}
+
+// trackDevice remembers the device of a successful login and tells the user
+// when it is a new one. The first device of a user is not reported, nor are
+// logins without a device id.
+func (a *Auth) trackDevice(ctx context.Context, log *slog.Logger, user models.User) {
+	client := clientinfo.From(ctx)
+	if client.DeviceID == "" {
+		return
+	}
+
+	known, others, err := a.loginStore.TrackDevice(ctx, user.ID, client.DeviceID, time.Now())
+	if err != nil {
+		log.Error("failed to track device: " + err.Error())
+		return
+	}
+	if known || !others {
+		return
+	}
+
+	log.Info("login from a new device", slog.String("deviceId", client.DeviceID))
+
+	if a.opts.NotifyNewDevice {
+		go a.notifyNewDevice(user.Email, client)
+	}
+}
+
+// notifyNewDevice tells the user about a login from a new device. It runs in
+// the background so a slow notifier doesn't hold the login.
+func (a *Auth) notifyNewDevice(email string, client clientinfo.Info) {
+	const op = "auth.notifyNewDevice"
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := a.notifier.Notify(ctx, notify.Message{
+		To:      email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf("Your account was just used to sign in from a new device.\n"+
+			"Time: %s\nIP address: %s\nUser agent: %s\n"+
+			"If it wasn't you, change your password and revoke your sessions.",
+			time.Now().UTC().Format(time.RFC1123), orUnknown(client.IP), orUnknown(client.UserAgent)),
+	})
+	if err != nil {
+		a.log.Error("failed to notify user: "+err.Error(), slog.String("op", op))
+	}
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+
+	return s
+}
@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/notify"
+	"sso/internal/lib/password"
+	"sso/internal/services/storage"
+	"time"
+)
+
+const resetTokenLen = 32
+
+// ChangePassword replaces the password of the user, the current one must be
+// given. The other sessions of the user are ended, sessionID of the caller
+// is kept.
+func (a *Auth) ChangePassword(ctx context.Context, userID int64, sessionID string, oldPass string, newPass string) error {
+	const op = "auth.ChangePassword"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userId", userID))
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("user not found")
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to get user: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.opts.Hasher.Verify(user.PassHash, []byte(oldPass)); err != nil {
+		log.Error("not corrected password")
+		a.auditPassword(ctx, log, models.AuditPasswordChanged, userID, models.AuditFailure, "invalid_password")
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	if err := a.setPassword(ctx, user, newPass); err != nil {
+		log.Warn("failed to change password", slog.String("err", err.Error()))
+		a.auditPassword(ctx, log, models.AuditPasswordChanged, userID, models.AuditFailure, "rejected")
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success change password")
+
+	a.auditPassword(ctx, log, models.AuditPasswordChanged, userID, models.AuditSuccess, "")
+
+	a.revokeSessionsAfterPasswordChange(ctx, log, userID, sessionID)
+
+	return nil
+}
+
+// RequestPasswordReset mails a single use reset token to the user. It
+// doesn't tell whether the email exists: the token is saved and mailed in
+// the background, so the answer and its timing are the same either way.
+func (a *Auth) RequestPasswordReset(ctx context.Context, email string) error {
+	const op = "auth.RequestPasswordReset"
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email))
+
+	user, err := a.usrProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("password reset for unknown email")
+			a.audit(ctx, log, models.AuditEvent{
+				Type:     models.AuditPasswordResetRequested,
+				Outcome:  models.AuditFailure,
+				Metadata: map[string]string{"email": email, "reason": "unknown_user"},
+			})
+			return nil
+		}
+		log.Error("failed to get user: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.auditPassword(ctx, log, models.AuditPasswordResetRequested, user.ID, models.AuditSuccess, "")
+
+	go a.sendPasswordReset(user)
+
+	return nil
+}
+
+// sendPasswordReset saves a reset token of the user and mails it, failures
+// are only logged.
+func (a *Auth) sendPasswordReset(user models.User) {
+	const op = "auth.sendPasswordReset"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userId", user.ID))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	raw := make([]byte, resetTokenLen)
+	if _, err := rand.Read(raw); err != nil {
+		log.Error("failed to generate reset token: " + err.Error())
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	expiresAt := time.Now().Add(a.opts.PasswordResetTTL)
+	if err := a.rstStore.SavePasswordReset(ctx, hashToken(token), user.ID, expiresAt); err != nil {
+		log.Error("failed to save password reset: " + err.Error())
+		return
+	}
+
+	err := a.notifier.Notify(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Use this token to reset your password: %s\n"+
+			"It expires at %s. If you didn't ask for a reset, ignore this message.",
+			token, expiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		log.Error("failed to send password reset: " + err.Error())
+		return
+	}
+
+	log.Info("password reset sent")
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset,
+// all sessions of the user are ended.
+func (a *Auth) ResetPassword(ctx context.Context, token string, newPass string) error {
+	const op = "auth.ResetPassword"
+
+	log := a.log.With(slog.String("op", op))
+
+	userID, err := a.rstStore.PasswordReset(ctx, hashToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrPasswordResetNotFound) {
+			log.Warn("invalid password reset token")
+			a.auditPassword(ctx, log, models.AuditPasswordReset, 0, models.AuditFailure, "invalid_token")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+		log.Error("failed to get password reset: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		log.Error("failed to get user: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.setPassword(ctx, user, newPass); err != nil {
+		log.Warn("failed to reset password", slog.String("err", err.Error()))
+		a.auditPassword(ctx, log, models.AuditPasswordReset, userID, models.AuditFailure, "rejected")
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success reset password", slog.Int64("userId", userID))
+
+	a.auditPassword(ctx, log, models.AuditPasswordReset, userID, models.AuditSuccess, "")
+
+	a.revokeSessionsAfterPasswordChange(ctx, log, userID, "")
+
+	return nil
+}
+
+// setPassword checks and stores a new password chosen by the user.
+func (a *Auth) setPassword(ctx context.Context, user models.User, newPass string) error {
+	if err := a.checkNewPassword(newPass, user.Email, user.OrgID); err != nil {
+		return err
+	}
+
+	if err := a.checkReuse(ctx, user, newPass); err != nil {
+		return err
+	}
+
+	passHash, err := a.opts.Hasher.Hash([]byte(newPass))
+	if err != nil {
+		return err
+	}
+
+	// the current hash goes to the history, it holds the rest of the last
+	// PasswordHistory passwords
+	if err := a.usrSaver.ChangePassword(ctx, user.ID, passHash, max(a.opts.PasswordHistory-1, 0)); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// checkNewPassword applies the password policy of the org and the breached
+// passwords check, a rejected password fails with ErrWeakPassword and a
+// *password.PolicyError.
+func (a *Auth) checkNewPassword(pass string, email string, orgID int64) error {
+	if err := a.passwordPolicy(orgID).Check(pass, email); err != nil {
+		return fmt.Errorf("%w: %w", ErrWeakPassword, err)
+	}
+
+	if a.opts.BreachedPasswords == nil {
+		return nil
+	}
+
+	breached, err := a.opts.BreachedPasswords.Contains(pass)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return fmt.Errorf("%w: %w", ErrWeakPassword, &password.PolicyError{Violations: []password.Violation{{
+			Rule:        password.RuleBreached,
+			Description: "appears in a known data breach",
+		}}})
+	}
+
+	return nil
+}
+
+// passwordPolicy returns the password policy of the users of the org, the
+// global one unless the org has its own.
+func (a *Auth) passwordPolicy(orgID int64) password.Policy {
+	if policy, ok := a.opts.OrgPasswordPolicies[orgID]; ok && orgID != 0 {
+		return policy
+	}
+
+	return a.opts.PasswordPolicy
+}
+
+// checkReuse rejects the current password and the previous ones kept in the
+// history.
+func (a *Auth) checkReuse(ctx context.Context, user models.User, newPass string) error {
+	if a.opts.PasswordHistory <= 0 {
+		return nil
+	}
+
+	hashes := [][]byte{user.PassHash}
+	if a.opts.PasswordHistory > 1 {
+		history, err := a.usrProvider.PasswordHistory(ctx, user.ID, a.opts.PasswordHistory-1)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, history...)
+	}
+
+	for _, hash := range hashes {
+		if err := a.opts.Hasher.Verify(hash, []byte(newPass)); err == nil {
+			return fmt.Errorf("%w: %w", ErrWeakPassword, &password.PolicyError{Violations: []password.Violation{{
+				Rule:        password.RuleHistory,
+				Description: fmt.Sprintf("must differ from the last %d passwords", a.opts.PasswordHistory),
+			}}})
+		}
+	}
+
+	return nil
+}
+
+// passwordChangeRequired reports whether the user must change the password
+// before getting a regular token.
+func (a *Auth) passwordChangeRequired(user models.User) bool {
+	if user.PasswordChangeRequired {
+		return true
+	}
+
+	return a.opts.MaxPasswordAge > 0 && !user.PasswordChangedAt.IsZero() &&
+		time.Since(user.PasswordChangedAt) > a.opts.MaxPasswordAge
+}
+
+// flagBreached requires a password change from a user who logged in with a
+// breached password and reports whether it did, a failure doesn't fail the
+// login.
+func (a *Auth) flagBreached(ctx context.Context, log *slog.Logger, userID int64, pass string) bool {
+	if a.opts.BreachedPasswords == nil {
+		return false
+	}
+
+	breached, err := a.opts.BreachedPasswords.Contains(pass)
+	if err != nil {
+		log.Error("failed to check breached password: " + err.Error())
+		return false
+	}
+	if !breached {
+		return false
+	}
+
+	if err := a.usrSaver.SetPasswordChangeRequired(ctx, userID, true); err != nil {
+		log.Error("failed to require password change: " + err.Error())
+		return false
+	}
+
+	log.Warn("breached password, password change required")
+
+	return true
+}
+
+// rehash replaces the password hash made with an outdated algorithm or
+// parameters, a failure doesn't fail the login.
+func (a *Auth) rehash(ctx context.Context, log *slog.Logger, userID int64, password string) {
+	passHash, err := a.opts.Hasher.Hash([]byte(password))
+	if err != nil {
+		log.Error("failed to rehash password: " + err.Error())
+		return
+	}
+
+	if err := a.usrSaver.UpdatePassword(ctx, userID, passHash); err != nil {
+		log.Error("failed to save rehashed password: " + err.Error())
+		return
+	}
+
+	log.Info("password rehashed")
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
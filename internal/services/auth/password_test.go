@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/hasher"
+	"sso/internal/lib/notify"
+	"sso/internal/lib/password"
+	"sso/internal/services/storage"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNewPassword_OrgPolicy(t *testing.T) {
+	a := &Auth{opts: Options{
+		PasswordPolicy:      password.Policy{MinLength: 8, MaxLength: 128},
+		OrgPasswordPolicies: map[int64]password.Policy{5: {MinLength: 16, MaxLength: 128}},
+	}}
+
+	tests := []struct {
+		name    string
+		pass    string
+		orgID   int64
+		wantErr bool
+	}{
+		{name: "global policy", pass: "correct-horse", orgID: 0},
+		{name: "org without a policy", pass: "correct-horse", orgID: 7},
+		{name: "org policy", pass: "correct-horse-battery", orgID: 5},
+		{name: "too short for the org", pass: "correct-horse", orgID: 5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.checkNewPassword(tt.pass, "user@example.com", tt.orgID)
+			if !tt.wantErr {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrWeakPassword)
+
+			var policyErr *password.PolicyError
+			require.True(t, errors.As(err, &policyErr))
+			assert.Equal(t, password.RuleMinLength, policyErr.Violations[0].Rule)
+		})
+	}
+}
+
+// fakePasswordStore keeps one user, its password resets and whether its
+// sessions were revoked. The embedded interfaces are nil, the tests only
+// reach the methods below.
+type fakePasswordStore struct {
+	UserProvider
+	UserSaver
+	SessionStore
+
+	mu       sync.Mutex
+	user     models.User
+	resets   map[string]int64
+	revoked  []string
+	messages []notify.Message
+	sent     chan struct{}
+}
+
+func newFakePasswordStore() *fakePasswordStore {
+	return &fakePasswordStore{
+		user:   models.User{ID: 7, Email: "user@example.com", PassHash: []byte("old password")},
+		resets: map[string]int64{},
+		sent:   make(chan struct{}, 1),
+	}
+}
+
+func (f *fakePasswordStore) User(_ context.Context, email string) (models.User, error) {
+	if email != f.user.Email {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return f.user, nil
+}
+
+func (f *fakePasswordStore) UserByID(context.Context, int64) (models.User, error) {
+	return f.user, nil
+}
+
+func (f *fakePasswordStore) ChangePassword(_ context.Context, _ int64, passHash []byte, _ int) error {
+	f.user.PassHash = passHash
+
+	return nil
+}
+
+func (f *fakePasswordStore) RevokeSessions(_ context.Context, _ int64, exceptID string, _ time.Time) (int64, error) {
+	f.revoked = append(f.revoked, exceptID)
+
+	return 2, nil
+}
+
+func (f *fakePasswordStore) SavePasswordReset(_ context.Context, tokenHash string, userID int64, _ time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.resets[tokenHash] = userID
+
+	return nil
+}
+
+func (f *fakePasswordStore) PasswordReset(_ context.Context, tokenHash string, _ time.Time) (int64, error) {
+	userID, ok := f.resets[tokenHash]
+	if !ok {
+		return 0, storage.ErrPasswordResetNotFound
+	}
+
+	return userID, nil
+}
+
+func (f *fakePasswordStore) Notify(_ context.Context, msg notify.Message) error {
+	f.mu.Lock()
+	f.messages = append(f.messages, msg)
+	f.mu.Unlock()
+
+	f.sent <- struct{}{}
+
+	return nil
+}
+
+func (f *fakePasswordStore) SaveAuditEvent(context.Context, models.AuditEvent) error {
+	return nil
+}
+
+// plainHasher stores the passwords as they are.
+type plainHasher struct{}
+
+func (plainHasher) Hash(password []byte) ([]byte, error) {
+	return password, nil
+}
+
+func (plainHasher) Verify(hash []byte, password []byte) error {
+	if string(hash) != string(password) {
+		return hasher.ErrMismatch
+	}
+
+	return nil
+}
+
+func (plainHasher) Current([]byte) bool {
+	return true
+}
+
+func newPasswordAuth(store *fakePasswordStore) *Auth {
+	return &Auth{
+		log:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		usrProvider: store,
+		usrSaver:    store,
+		rstStore:    store,
+		sessStore:   store,
+		notifier:    store,
+		auditSaver:  store,
+		opts: Options{
+			Hasher:           plainHasher{},
+			PasswordPolicy:   password.Policy{MinLength: 8, MaxLength: 128},
+			PasswordResetTTL: time.Hour,
+		},
+	}
+}
+
+func TestChangePassword_RevokesOtherSessions(t *testing.T) {
+	store := newFakePasswordStore()
+	a := newPasswordAuth(store)
+
+	err := a.ChangePassword(context.Background(), 7, "current", "wrong password", "new password")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Empty(t, store.revoked)
+
+	require.NoError(t, a.ChangePassword(context.Background(), 7, "current", "old password", "new password"))
+	assert.Equal(t, "new password", string(store.user.PassHash))
+	assert.Equal(t, []string{"current"}, store.revoked)
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	store := newFakePasswordStore()
+	a := newPasswordAuth(store)
+
+	// unknown emails get the same answer and no mail
+	require.NoError(t, a.RequestPasswordReset(context.Background(), "unknown@example.com"))
+	require.NoError(t, a.RequestPasswordReset(context.Background(), "user@example.com"))
+
+	select {
+	case <-store.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reset mail wasn't sent")
+	}
+
+	store.mu.Lock()
+	require.Len(t, store.messages, 1)
+	msg := store.messages[0]
+	store.mu.Unlock()
+	assert.Equal(t, "user@example.com", msg.To)
+
+	// the token of the mail resets the password and ends every session
+	token := strings.TrimPrefix(strings.SplitN(msg.Body, "\n", 2)[0], "Use this token to reset your password: ")
+	require.NoError(t, a.ResetPassword(context.Background(), token, "new password"))
+	assert.Equal(t, "new password", string(store.user.PassHash))
+	assert.Equal(t, []string{""}, store.revoked)
+
+	require.ErrorIs(t, a.ResetPassword(context.Background(), "forged", "another password"), ErrInvalidResetToken)
+}
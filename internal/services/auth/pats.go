@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/clientinfo"
+	"sso/internal/services/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// PATPrefix starts every personal access token, so secret scanners can
+	// find leaked ones.
+	PATPrefix  = "ssopat_"
+	patLen     = 32
+	patHintLen = 4
+	// patTouchInterval limits how often the last use of a token is written.
+	patTouchInterval = time.Minute
+	maxPATNameLen    = 128
+)
+
+var (
+	ErrPATNotFound    = errors.New("personal access token not found")
+	ErrInvalidPATName = errors.New("invalid personal access token name")
+	ErrInvalidExpiry  = errors.New("invalid expiry")
+)
+
+type PATStore interface {
+	SavePAT(ctx context.Context, pat models.PAT) (patID int64, err error)
+	PAT(ctx context.Context, tokenHash string) (pat models.PAT, err error)
+	PATs(ctx context.Context, userID int64) (pats []models.PAT, err error)
+	TouchPAT(ctx context.Context, patID int64, usedAt time.Time, ip string) error
+	RevokePAT(ctx context.Context, userID int64, patID int64, revokedAt time.Time) error
+}
+
+// CreatePAT creates a personal access token of the caller for the app and
+// returns it with the token, the token isn't shown again. The app must
+// declare the scopes, a zero expiresAt means the longest lifetime allowed.
+func (a *Auth) CreatePAT(ctx context.Context, principal models.Principal, appID int64, name string,
+	scopes []string, expiresAt time.Time) (models.PAT, string, error) {
+	const op = "auth.CreatePAT"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("userId", principal.UserID),
+		slog.Int64("appId", appID),
+	)
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxPATNameLen {
+		return models.PAT{}, "", fmt.Errorf("%s: %w", op, ErrInvalidPATName)
+	}
+
+	now := time.Now()
+	maxExpiresAt := now.Add(a.opts.PATMaxTTL)
+	switch {
+	case expiresAt.IsZero():
+		expiresAt = maxExpiresAt
+	case !expiresAt.After(now) || expiresAt.After(maxExpiresAt):
+		return models.PAT{}, "", fmt.Errorf("%s: %w: must be within %s", op, ErrInvalidExpiry, a.opts.PATMaxTTL)
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.PAT{}, "", fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return models.PAT{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	declared := models.Consent{Scopes: app.Scopes}
+	if !declared.Covers(scopes) {
+		return models.PAT{}, "", fmt.Errorf("%s: %w: app %d doesn't declare %s", op, ErrInvalidScope,
+			appID, strings.Join(scopes, " "))
+	}
+
+	// a token can't get around the authentication the app requires
+	if models.ACRLevel(app.MinACR) > models.ACRLevel(principal.ACR) {
+		return models.PAT{}, "", fmt.Errorf("%s: %w", op, ErrStepUpRequired)
+	}
+
+	raw := make([]byte, patLen)
+	if _, err := rand.Read(raw); err != nil {
+		return models.PAT{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	token := PATPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	pat := models.PAT{
+		UserID:    principal.UserID,
+		AppID:     appID,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Hint:      token[len(token)-patHintLen:],
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	pat.ID, err = a.patStore.SavePAT(ctx, pat)
+	if err != nil {
+		log.Error("failed to save personal access token: " + err.Error())
+		return models.PAT{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("personal access token created", slog.Int64("patId", pat.ID))
+
+	a.auditPAT(ctx, log, models.AuditPATCreated, principal.UserID, principal.UserID, appID, models.AuditSuccess,
+		map[string]string{
+			"pat_id":     strconv.FormatInt(pat.ID, 10),
+			"name":       name,
+			"scopes":     strings.Join(scopes, " "),
+			"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		})
+
+	pat.TokenHash = ""
+
+	return pat, token, nil
+}
+
+// ListPATs returns the personal access tokens of the user that aren't
+// revoked, without their hashes. Users see their own tokens, admins anyone's.
+func (a *Auth) ListPATs(ctx context.Context, actorID int64, userID int64) ([]models.PAT, error) {
+	const op = "auth.ListPATs"
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pats, err := a.patStore.PATs(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to get personal access tokens: "+err.Error(), slog.String("op", op))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range pats {
+		pats[i].TokenHash = ""
+	}
+
+	return pats, nil
+}
+
+// RevokePAT revokes a personal access token of the user, it stops validating
+// at once.
+func (a *Auth) RevokePAT(ctx context.Context, actorID int64, userID int64, patID int64) error {
+	const op = "auth.RevokePAT"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userId", userID), slog.Int64("patId", patID))
+
+	metadata := map[string]string{"pat_id": strconv.FormatInt(patID, 10)}
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		a.auditPAT(ctx, log, models.AuditPATRevoked, actorID, userID, 0, models.AuditDenied, metadata)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.patStore.RevokePAT(ctx, userID, patID, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrPATNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrPATNotFound)
+		}
+		log.Error("failed to revoke personal access token: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("personal access token revoked", slog.Int64("actorId", actorID))
+
+	a.auditPAT(ctx, log, models.AuditPATRevoked, actorID, userID, 0, models.AuditSuccess, metadata)
+
+	return nil
+}
+
+// validatePAT returns the owner of an active personal access token and
+// updates when it was last used.
+func (a *Auth) validatePAT(ctx context.Context, token string) (models.Principal, error) {
+	pat, err := a.patStore.PAT(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrPATNotFound) {
+			return models.Principal{}, ErrInvalidToken
+		}
+		return models.Principal{}, err
+	}
+
+	now := time.Now()
+	if !pat.ActiveAt(now) {
+		return models.Principal{}, ErrInvalidToken
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, pat.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.Principal{}, ErrInvalidToken
+		}
+		return models.Principal{}, err
+	}
+
+	if err := checkStatus(user); err != nil {
+		return models.Principal{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if now.Sub(pat.LastUsedAt) > patTouchInterval {
+		if err := a.patStore.TouchPAT(ctx, pat.ID, now, clientinfo.From(ctx).IP); err != nil {
+			a.log.Error("failed to touch personal access token: "+err.Error(), slog.Int64("patId", pat.ID))
+		}
+	}
+
+	return models.Principal{
+		UserID:    user.ID,
+		Email:     user.Email,
+		AppID:     pat.AppID,
+		Scopes:    pat.Scopes,
+		ExpiresAt: pat.ExpiresAt,
+		PATID:     pat.ID,
+	}, nil
+}
+
+func (a *Auth) auditPAT(ctx context.Context, log *slog.Logger, eventType string, actorID int64, userID int64,
+	appID int64, outcome string, metadata map[string]string) {
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      eventType,
+		ActorID:   actorID,
+		SubjectID: userID,
+		AppID:     appID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+}
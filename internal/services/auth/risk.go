@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/clientinfo"
+	"sso/internal/lib/risk"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RiskEngine interface {
+	Evaluate(ctx context.Context, attempt risk.Attempt) risk.Assessment
+}
+
+// assessRisk scores the login of the user to the app. The decision and the
+// signals behind it are logged and audited, so the weights and thresholds
+// can be tuned.
+func (a *Auth) assessRisk(ctx context.Context, log *slog.Logger, user models.User, appID int64) risk.Decision {
+	if a.opts.Risk == nil {
+		return risk.Allow
+	}
+
+	client := clientinfo.From(ctx)
+
+	assessment := a.opts.Risk.Evaluate(ctx, risk.Attempt{
+		UserID:    user.ID,
+		AppID:     appID,
+		Email:     user.Email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		DeviceID:  client.DeviceID,
+		Time:      time.Now(),
+	})
+
+	signals := make([]string, 0, len(assessment.Results))
+	metadata := map[string]string{
+		"score":    strconv.Itoa(assessment.Score),
+		"decision": string(assessment.Decision),
+	}
+	for _, res := range assessment.Results {
+		if res.Err != nil {
+			log.Error("risk signal failed: "+res.Err.Error(), slog.String("signal", res.Signal))
+			continue
+		}
+		signals = append(signals, res.Signal+"="+strconv.Itoa(res.Score))
+		metadata["signal."+res.Signal] = res.Reason
+	}
+	metadata["signals"] = strings.Join(signals, " ")
+
+	log.Info("login risk assessed",
+		slog.Int("score", assessment.Score),
+		slog.String("decision", string(assessment.Decision)),
+		slog.String("signals", metadata["signals"]),
+	)
+
+	outcome := models.AuditSuccess
+	if assessment.Decision != risk.Allow {
+		outcome = models.AuditDenied
+	}
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditLoginRisk,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		AppID:     appID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+
+	return assessment.Decision
+}
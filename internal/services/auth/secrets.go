@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"sso/internal/domain/models"
+	"sso/internal/lib/keyring"
+	"sso/internal/services/storage"
+	"time"
+)
+
+// The AADs bind the encrypted secrets to their columns.
+var (
+	appSecretAAD  = []byte("apps.secret")
+	totpSecretAAD = []byte("user_totp.secret")
+)
+
+// SecretBox encrypts sensitive values before they are stored.
+type SecretBox interface {
+	Encrypt(plaintext, aad []byte) (string, error)
+	Decrypt(value string, aad []byte) ([]byte, error)
+}
+
+// app returns the app with the decrypted secrets. The SSO itself is no app
+// tokens are issued for with a secret, see tokenApp.
+func (a *Auth) app(ctx context.Context, appID int64) (models.App, error) {
+	if appID == models.SSOAppID {
+		return models.App{}, storage.ErrAppNotFound
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return app, err
+	}
+
+	if app.Secret, err = a.decryptSecret(app.Secret, appSecretAAD); err != nil {
+		return app, err
+	}
+	// an expired previous secret verifies nothing, its key may be gone
+	if !time.Now().Before(app.PreviousSecretExpiresAt) {
+		app.PreviousSecret = nil
+	}
+	if app.PreviousSecret, err = a.decryptSecret(app.PreviousSecret, appSecretAAD); err != nil {
+		return app, err
+	}
+
+	return app, nil
+}
+
+// tokenApp returns the app the tokens for appID are issued for: the SSO
+// itself, signed with the TokenKey, for models.SSOAppID and the stored app
+// otherwise.
+func (a *Auth) tokenApp(ctx context.Context, appID int64) (models.App, error) {
+	if appID != models.SSOAppID {
+		return a.app(ctx, appID)
+	}
+	if len(a.opts.TokenKey) == 0 {
+		return models.App{}, storage.ErrAppNotFound
+	}
+
+	return models.App{Id: models.SSOAppID, Name: "sso", Secret: a.opts.TokenKey}, nil
+}
+
+// encryptSecret encrypts a secret of the column aad before it is stored,
+// without a SecretBox it is stored as is.
+func (a *Auth) encryptSecret(secret string, aad []byte) (string, error) {
+	if a.opts.Secrets == nil {
+		return secret, nil
+	}
+
+	return a.opts.Secrets.Encrypt([]byte(secret), aad)
+}
+
+// decryptSecret opens a stored secret of the column aad. Secrets stored
+// before the encryption was turned on are plaintext and returned as is.
+func (a *Auth) decryptSecret(secret []byte, aad []byte) ([]byte, error) {
+	if !keyring.IsEncrypted(string(secret)) {
+		return secret, nil
+	}
+	if a.opts.Secrets == nil {
+		return nil, keyring.ErrUnknownKey
+	}
+
+	return a.opts.Secrets.Decrypt(string(secret), aad)
+}
@@ -0,0 +1,761 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	jwtlocal "sso/internal/lib"
+	"sso/internal/services/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// ServiceAccountSecretPrefix starts every client secret of a service
+	// account, so secret scanners can find leaked ones.
+	ServiceAccountSecretPrefix = "ssosa_"
+	// ClientAssertionTypeJWTBearer is the client assertion type of
+	// private_key_jwt (RFC 7523, section 2.2).
+	ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	serviceAccountSecretLen     = 32
+	serviceAccountKeyIDLen      = 12
+	maxServiceAccountNameLen    = 128
+	defaultServiceAccountsPage  = 50
+	maxServiceAccountsPage      = 500
+	minServiceAccountRSAKeyBits = 2048
+	// maxAssertionTTL is the longest lifetime of an assertion, the ids of
+	// used assertions are kept until they expire.
+	maxAssertionTTL = 5 * time.Minute
+)
+
+var (
+	ErrServiceAccountNotFound    = errors.New("service account not found")
+	ErrServiceAccountKeyNotFound = errors.New("service account key not found")
+	ErrInvalidServiceAccount     = errors.New("invalid service account")
+	ErrInvalidRole               = errors.New("invalid role")
+	ErrInvalidPublicKey          = errors.New("invalid public key")
+	ErrInvalidClientCredentials  = errors.New("invalid client credentials")
+	ErrUnsupportedAssertionType  = errors.New("unsupported client assertion type")
+)
+
+type ServiceAccountStore interface {
+	SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (accountID int64, err error)
+	ServiceAccount(ctx context.Context, accountID int64) (account models.ServiceAccount, err error)
+	ServiceAccounts(ctx context.Context, afterID int64, limit int) (accounts []models.ServiceAccount, err error)
+	UpdateServiceAccount(ctx context.Context, account models.ServiceAccount) error
+	SetServiceAccountSecret(ctx context.Context, accountID int64, secretHash string) error
+	DeleteServiceAccount(ctx context.Context, accountID int64) error
+	SaveServiceAccountKey(ctx context.Context, key models.ServiceAccountKey) error
+	ServiceAccountKeys(ctx context.Context, accountID int64) (keys []models.ServiceAccountKey, err error)
+	DeleteServiceAccountKey(ctx context.Context, accountID int64, keyID string) error
+	UseAssertion(ctx context.Context, accountID int64, jti string, expiresAt time.Time, now time.Time) error
+}
+
+// ServiceAccountUpdate holds the service account fields to change, nil
+// fields are kept.
+type ServiceAccountUpdate struct {
+	Name     *string
+	Roles    *[]string
+	Disabled *bool
+}
+
+// ServiceAccountTokenRequest authenticates a service account with its
+// client secret, or with a client assertion signed by one of its keys.
+type ServiceAccountTokenRequest struct {
+	ServiceAccountID    int64
+	ClientSecret        string
+	ClientAssertion     string
+	ClientAssertionType string
+	AppID               int64
+	Scopes              []string
+}
+
+// CreateServiceAccount creates a service account owned by the app or the org
+// of the account and returns it with its client secret, the secret isn't
+// shown again.
+func (a *Auth) CreateServiceAccount(ctx context.Context, actorID int64,
+	account models.ServiceAccount) (models.ServiceAccount, string, error) {
+	const op = "auth.CreateServiceAccount"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("appId", account.AppID), slog.Int64("orgId", account.OrgID))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditServiceAccount(ctx, log, models.AuditServiceAccountCreated, actorID, account, models.AuditDenied, nil)
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" || len(account.Name) > maxServiceAccountNameLen {
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w: name must be 1 to %d characters", op,
+			ErrInvalidServiceAccount, maxServiceAccountNameLen)
+	}
+	if (account.AppID == 0) == (account.OrgID == 0) {
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w: exactly one of app and org must own it", op,
+			ErrInvalidServiceAccount)
+	}
+	if err := validateRoles(account.Roles); err != nil {
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := newServiceAccountSecret()
+	if err != nil {
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	account.SecretHash = hashToken(secret)
+	account.Disabled = false
+	account.CreatedAt = time.Now()
+
+	account.ID, err = a.saStore.SaveServiceAccount(ctx, account)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to save service account: " + err.Error())
+		return models.ServiceAccount{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("service account created", slog.Int64("serviceAccountId", account.ID), slog.Int64("actorId", actorID))
+
+	a.auditServiceAccount(ctx, log, models.AuditServiceAccountCreated, actorID, account, models.AuditSuccess,
+		map[string]string{
+			"name":  account.Name,
+			"roles": strings.Join(account.Roles, " "),
+		})
+
+	account.SecretHash = ""
+
+	return account, secret, nil
+}
+
+// GetServiceAccount returns the service account without its secret hash.
+func (a *Auth) GetServiceAccount(ctx context.Context, actorID int64, accountID int64) (models.ServiceAccount, error) {
+	const op = "auth.GetServiceAccount"
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := a.serviceAccount(ctx, accountID)
+	if err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account.SecretHash = ""
+
+	return account, nil
+}
+
+// ListServiceAccounts returns a page of service accounts ordered by id and
+// the cursor of the next page, empty on the last one.
+func (a *Auth) ListServiceAccounts(ctx context.Context, actorID int64, limit int,
+	cursor string) ([]models.ServiceAccount, string, error) {
+	const op = "auth.ListServiceAccounts"
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var afterID int64
+	if cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id < 0 {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidCursor)
+		}
+		afterID = id
+	}
+
+	switch {
+	case limit <= 0:
+		limit = defaultServiceAccountsPage
+	case limit > maxServiceAccountsPage:
+		limit = maxServiceAccountsPage
+	}
+
+	// one more account tells whether there is a next page
+	accounts, err := a.saStore.ServiceAccounts(ctx, afterID, limit+1)
+	if err != nil {
+		a.log.Error("failed to list service accounts: "+err.Error(), slog.String("op", op))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var next string
+	if len(accounts) > limit {
+		accounts = accounts[:limit]
+		next = strconv.FormatInt(accounts[len(accounts)-1].ID, 10)
+	}
+
+	for i := range accounts {
+		accounts[i].SecretHash = ""
+	}
+
+	return accounts, next, nil
+}
+
+// UpdateServiceAccount changes the name, the roles or the disabled flag of
+// the service account. The tokens of a disabled account stop validating, the
+// roles of the tokens are the account's current ones.
+func (a *Auth) UpdateServiceAccount(ctx context.Context, actorID int64, accountID int64,
+	upd ServiceAccountUpdate) (models.ServiceAccount, error) {
+	const op = "auth.UpdateServiceAccount"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("serviceAccountId", accountID))
+
+	account := models.ServiceAccount{ID: accountID}
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditServiceAccount(ctx, log, models.AuditServiceAccountUpdated, actorID, account, models.AuditDenied, nil)
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	account, err := a.serviceAccount(ctx, accountID)
+	if err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if upd.Name != nil {
+		name := strings.TrimSpace(*upd.Name)
+		if name == "" || len(name) > maxServiceAccountNameLen {
+			return models.ServiceAccount{}, fmt.Errorf("%s: %w: name must be 1 to %d characters", op,
+				ErrInvalidServiceAccount, maxServiceAccountNameLen)
+		}
+		account.Name = name
+	}
+	if upd.Roles != nil {
+		if err := validateRoles(*upd.Roles); err != nil {
+			return models.ServiceAccount{}, fmt.Errorf("%s: %w", op, err)
+		}
+		account.Roles = *upd.Roles
+	}
+	if upd.Disabled != nil {
+		account.Disabled = *upd.Disabled
+	}
+
+	if err := a.saStore.UpdateServiceAccount(ctx, account); err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return models.ServiceAccount{}, fmt.Errorf("%s: %w", op, ErrServiceAccountNotFound)
+		}
+		log.Error("failed to update service account: " + err.Error())
+		return models.ServiceAccount{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("service account updated", slog.Int64("actorId", actorID))
+
+	a.auditServiceAccount(ctx, log, models.AuditServiceAccountUpdated, actorID, account, models.AuditSuccess,
+		map[string]string{
+			"name":     account.Name,
+			"roles":    strings.Join(account.Roles, " "),
+			"disabled": strconv.FormatBool(account.Disabled),
+		})
+
+	account.SecretHash = ""
+
+	return account, nil
+}
+
+// DeleteServiceAccount removes the service account with its keys, its tokens
+// stop validating.
+func (a *Auth) DeleteServiceAccount(ctx context.Context, actorID int64, accountID int64) error {
+	const op = "auth.DeleteServiceAccount"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("serviceAccountId", accountID))
+
+	account := models.ServiceAccount{ID: accountID}
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditServiceAccount(ctx, log, models.AuditServiceAccountDeleted, actorID, account, models.AuditDenied, nil)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.saStore.DeleteServiceAccount(ctx, accountID); err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrServiceAccountNotFound)
+		}
+		log.Error("failed to delete service account: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("service account deleted", slog.Int64("actorId", actorID))
+
+	a.auditServiceAccount(ctx, log, models.AuditServiceAccountDeleted, actorID, account, models.AuditSuccess, nil)
+
+	return nil
+}
+
+// RotateServiceAccountSecret replaces the client secret of the service
+// account with a generated one and returns it, the secret isn't shown again.
+// The previous secret stops working at once, the tokens issued with it stay
+// valid until they expire.
+func (a *Auth) RotateServiceAccountSecret(ctx context.Context, actorID int64, accountID int64) (string, error) {
+	const op = "auth.RotateServiceAccountSecret"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("serviceAccountId", accountID))
+
+	account := models.ServiceAccount{ID: accountID}
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditServiceAccount(ctx, log, models.AuditServiceAccountSecretRotated, actorID, account,
+			models.AuditDenied, nil)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := newServiceAccountSecret()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.saStore.SetServiceAccountSecret(ctx, accountID, hashToken(secret)); err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrServiceAccountNotFound)
+		}
+		log.Error("failed to rotate service account secret: " + err.Error())
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("service account secret rotated", slog.Int64("actorId", actorID))
+
+	a.auditServiceAccount(ctx, log, models.AuditServiceAccountSecretRotated, actorID, account,
+		models.AuditSuccess, nil)
+
+	return secret, nil
+}
+
+// AddServiceAccountKey registers a PEM encoded RSA or ECDSA public key of the
+// service account and returns it with its generated id, the "kid" header of
+// the assertions the key verifies.
+func (a *Auth) AddServiceAccountKey(ctx context.Context, actorID int64, accountID int64,
+	publicKey string) (models.ServiceAccountKey, error) {
+	const op = "auth.AddServiceAccountKey"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("serviceAccountId", accountID))
+
+	account := models.ServiceAccount{ID: accountID}
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditServiceAccount(ctx, log, models.AuditServiceAccountKeyAdded, actorID, account, models.AuditDenied, nil)
+		return models.ServiceAccountKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := parsePublicKey(publicKey); err != nil {
+		return models.ServiceAccountKey{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidPublicKey, err)
+	}
+
+	raw := make([]byte, serviceAccountKeyIDLen)
+	if _, err := rand.Read(raw); err != nil {
+		return models.ServiceAccountKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key := models.ServiceAccountKey{
+		ID:               base64.RawURLEncoding.EncodeToString(raw),
+		ServiceAccountID: accountID,
+		PublicKey:        publicKey,
+		CreatedAt:        time.Now(),
+	}
+
+	if err := a.saStore.SaveServiceAccountKey(ctx, key); err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return models.ServiceAccountKey{}, fmt.Errorf("%s: %w", op, ErrServiceAccountNotFound)
+		}
+		log.Error("failed to save service account key: " + err.Error())
+		return models.ServiceAccountKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("service account key added", slog.String("keyId", key.ID), slog.Int64("actorId", actorID))
+
+	a.auditServiceAccount(ctx, log, models.AuditServiceAccountKeyAdded, actorID, account, models.AuditSuccess,
+		map[string]string{"key_id": key.ID})
+
+	return key, nil
+}
+
+func (a *Auth) ListServiceAccountKeys(ctx context.Context, actorID int64,
+	accountID int64) ([]models.ServiceAccountKey, error) {
+	const op = "auth.ListServiceAccountKeys"
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.serviceAccount(ctx, accountID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys, err := a.saStore.ServiceAccountKeys(ctx, accountID)
+	if err != nil {
+		a.log.Error("failed to get service account keys: "+err.Error(), slog.String("op", op))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// DeleteServiceAccountKey removes a key of the service account, the
+// assertions signed with it are refused at once.
+func (a *Auth) DeleteServiceAccountKey(ctx context.Context, actorID int64, accountID int64, keyID string) error {
+	const op = "auth.DeleteServiceAccountKey"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("serviceAccountId", accountID), slog.String("keyId", keyID))
+
+	account := models.ServiceAccount{ID: accountID}
+	metadata := map[string]string{"key_id": keyID}
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		a.auditServiceAccount(ctx, log, models.AuditServiceAccountKeyDeleted, actorID, account,
+			models.AuditDenied, metadata)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.saStore.DeleteServiceAccountKey(ctx, accountID, keyID); err != nil {
+		if errors.Is(err, storage.ErrServiceAccountKeyNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrServiceAccountKeyNotFound)
+		}
+		log.Error("failed to delete service account key: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("service account key deleted", slog.Int64("actorId", actorID))
+
+	a.auditServiceAccount(ctx, log, models.AuditServiceAccountKeyDeleted, actorID, account,
+		models.AuditSuccess, metadata)
+
+	return nil
+}
+
+// ServiceAccountToken issues a token of the service account for the app.
+// The account authenticates with its client secret, or with a client
+// assertion when one is given. An account owned by an app only gets tokens
+// for that app, the app must declare the scopes.
+func (a *Auth) ServiceAccountToken(ctx context.Context, req ServiceAccountTokenRequest) (models.ServiceAccountToken, error) {
+	const op = "auth.ServiceAccountToken"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("appId", req.AppID))
+
+	method := "client_secret"
+	if req.ClientAssertion != "" {
+		method = "private_key_jwt"
+	}
+
+	var (
+		account models.ServiceAccount
+		err     error
+	)
+	if req.ClientAssertion != "" {
+		if req.ClientAssertionType != ClientAssertionTypeJWTBearer {
+			return models.ServiceAccountToken{}, fmt.Errorf("%s: %w: %q", op, ErrUnsupportedAssertionType,
+				req.ClientAssertionType)
+		}
+		account, err = a.verifyAssertion(ctx, req.ClientAssertion)
+	} else {
+		account, err = a.verifyClientSecret(ctx, req.ServiceAccountID, req.ClientSecret)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidClientCredentials) {
+			log.Warn("service account authentication failed", slog.String("err", err.Error()))
+			a.auditServiceAccountToken(ctx, log, account.ID, req.AppID, models.AuditFailure, map[string]string{
+				"method": method,
+			})
+			return models.ServiceAccountToken{}, fmt.Errorf("%s: %w", op, ErrInvalidClientCredentials)
+		}
+		log.Error("failed to authenticate service account: " + err.Error())
+		return models.ServiceAccountToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("serviceAccountId", account.ID))
+
+	if account.Disabled {
+		log.Warn("service account is disabled")
+		a.auditServiceAccountToken(ctx, log, account.ID, req.AppID, models.AuditDenied, map[string]string{
+			"method": method,
+			"reason": "disabled",
+		})
+		return models.ServiceAccountToken{}, fmt.Errorf("%s: %w", op, ErrInvalidClientCredentials)
+	}
+
+	if account.AppID != 0 && account.AppID != req.AppID {
+		log.Warn("service account is owned by another app", slog.Int64("ownerAppId", account.AppID))
+		a.auditServiceAccountToken(ctx, log, account.ID, req.AppID, models.AuditDenied, map[string]string{
+			"method": method,
+			"reason": "other_app",
+		})
+		return models.ServiceAccountToken{}, fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	app, err := a.app(ctx, req.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.ServiceAccountToken{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return models.ServiceAccountToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	declared := models.Consent{Scopes: app.Scopes}
+	if !declared.Covers(req.Scopes) {
+		return models.ServiceAccountToken{}, fmt.Errorf("%s: %w: app %d doesn't declare %s", op, ErrInvalidScope,
+			req.AppID, strings.Join(req.Scopes, " "))
+	}
+
+	expiresAt := time.Now().Add(a.opts.ServiceAccountTokenTTL)
+
+	token, err := jwtlocal.NewToken(models.User{}, app, a.opts.ServiceAccountTokenTTL, jwtlocal.TokenOptions{
+		Scopes:           req.Scopes,
+		ServiceAccountID: account.ID,
+		Roles:            account.Roles,
+	})
+	if err != nil {
+		log.Error("cannot generate token")
+		return models.ServiceAccountToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("service account token issued", slog.String("method", method))
+
+	a.auditServiceAccountToken(ctx, log, account.ID, req.AppID, models.AuditSuccess, map[string]string{
+		"method": method,
+		"scopes": strings.Join(req.Scopes, " "),
+	})
+
+	return models.ServiceAccountToken{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		Scopes:    req.Scopes,
+	}, nil
+}
+
+// verifyClientSecret returns the service account the secret belongs to. An
+// unknown account is reported as invalid credentials, so the ids can't be
+// probed.
+func (a *Auth) verifyClientSecret(ctx context.Context, accountID int64, secret string) (models.ServiceAccount, error) {
+	account, err := a.saStore.ServiceAccount(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return models.ServiceAccount{ID: accountID}, ErrInvalidClientCredentials
+		}
+		return models.ServiceAccount{}, err
+	}
+
+	if account.SecretHash == "" ||
+		subtle.ConstantTimeCompare([]byte(account.SecretHash), []byte(hashToken(secret))) != 1 {
+		return account, ErrInvalidClientCredentials
+	}
+
+	return account, nil
+}
+
+// verifyAssertion checks a private_key_jwt assertion and returns the service
+// account that signed it. The "iss" and "sub" claims are the account id, the
+// "aud" claim is the AssertionAudience, the "kid" header names the key. The
+// assertion must expire within maxAssertionTTL and its "jti" can be used
+// once.
+func (a *Auth) verifyAssertion(ctx context.Context, assertion string) (models.ServiceAccount, error) {
+	var (
+		account models.ServiceAccount
+		// storeErr is a failure of the store while looking up the key, it
+		// doesn't make the assertion invalid
+		storeErr error
+	)
+
+	token, err := jwt.Parse(assertion, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("kid header is missing")
+		}
+
+		sub, err := token.Claims.GetSubject()
+		if err != nil {
+			return nil, err
+		}
+		iss, err := token.Claims.GetIssuer()
+		if err != nil {
+			return nil, err
+		}
+		if iss != sub {
+			return nil, errors.New("iss and sub claims differ")
+		}
+
+		accountID, err := strconv.ParseInt(sub, 10, 64)
+		if err != nil {
+			return nil, errors.New("sub claim is not a service account id")
+		}
+
+		account, err = a.saStore.ServiceAccount(ctx, accountID)
+		if err != nil {
+			if !errors.Is(err, storage.ErrServiceAccountNotFound) {
+				storeErr = err
+			}
+			return nil, err
+		}
+
+		keys, err := a.saStore.ServiceAccountKeys(ctx, accountID)
+		if err != nil {
+			storeErr = err
+			return nil, err
+		}
+
+		for _, key := range keys {
+			if key.ID == kid {
+				return parsePublicKey(key.PublicKey)
+			}
+		}
+
+		return nil, fmt.Errorf("unknown key %q", kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(a.opts.AssertionAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if storeErr != nil {
+		return account, storeErr
+	}
+	if err != nil {
+		return account, fmt.Errorf("%w: %w", ErrInvalidClientCredentials, err)
+	}
+
+	mapClaims := token.Claims.(jwt.MapClaims)
+
+	jti, _ := mapClaims["jti"].(string)
+	if jti == "" {
+		return account, fmt.Errorf("%w: jti claim is missing", ErrInvalidClientCredentials)
+	}
+
+	exp, err := mapClaims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return account, fmt.Errorf("%w: exp claim is missing", ErrInvalidClientCredentials)
+	}
+
+	now := time.Now()
+	if exp.Sub(now) > maxAssertionTTL {
+		return account, fmt.Errorf("%w: assertion must expire within %s", ErrInvalidClientCredentials,
+			maxAssertionTTL)
+	}
+
+	if err := a.saStore.UseAssertion(ctx, account.ID, jti, exp.Time, now); err != nil {
+		if errors.Is(err, storage.ErrAssertionReplayed) {
+			return account, fmt.Errorf("%w: assertion was already used", ErrInvalidClientCredentials)
+		}
+		return account, err
+	}
+
+	return account, nil
+}
+
+// validateServiceAccountToken returns the service account of a token issued
+// by ServiceAccountToken. Tokens of deleted or disabled accounts are invalid,
+// the roles are the account's current ones.
+func (a *Auth) validateServiceAccountToken(ctx context.Context, claims jwtlocal.Claims) (models.Principal, error) {
+	account, err := a.saStore.ServiceAccount(ctx, claims.ServiceAccountID)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return models.Principal{}, ErrInvalidToken
+		}
+		return models.Principal{}, err
+	}
+
+	if account.Disabled {
+		return models.Principal{}, fmt.Errorf("%w: service account is disabled", ErrInvalidToken)
+	}
+	if account.AppID != 0 && account.AppID != claims.AppID {
+		return models.Principal{}, ErrInvalidToken
+	}
+
+	return models.Principal{
+		AppID:            claims.AppID,
+		Scopes:           claims.Scopes,
+		ExpiresAt:        claims.ExpiresAt,
+		ServiceAccountID: account.ID,
+		Roles:            account.Roles,
+	}, nil
+}
+
+func (a *Auth) serviceAccount(ctx context.Context, accountID int64) (models.ServiceAccount, error) {
+	account, err := a.saStore.ServiceAccount(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, storage.ErrServiceAccountNotFound) {
+			return models.ServiceAccount{}, ErrServiceAccountNotFound
+		}
+		return models.ServiceAccount{}, err
+	}
+
+	return account, nil
+}
+
+func newServiceAccountSecret() (string, error) {
+	raw := make([]byte, serviceAccountSecretLen)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return ServiceAccountSecretPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// validateRoles checks the roles can be stored, they are kept comma
+// separated.
+func validateRoles(roles []string) error {
+	for _, role := range roles {
+		if role == "" || strings.ContainsAny(role, ", ") {
+			return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+		}
+	}
+
+	return nil
+}
+
+// parsePublicKey parses a PEM encoded RSA or ECDSA public key, RSA keys
+// shorter than 2048 bits are refused.
+func parsePublicKey(publicKey string) (any, error) {
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey)); err == nil {
+		return checkRSAKey(rsaKey)
+	}
+
+	ecKey, err := jwt.ParseECPublicKeyFromPEM([]byte(publicKey))
+	if err != nil {
+		return nil, errors.New("not a PEM encoded RSA or ECDSA public key")
+	}
+
+	return ecKey, nil
+}
+
+func checkRSAKey(key *rsa.PublicKey) (*rsa.PublicKey, error) {
+	if key.N.BitLen() < minServiceAccountRSAKeyBits {
+		return nil, fmt.Errorf("RSA key must have at least %d bits", minServiceAccountRSAKeyBits)
+	}
+
+	return key, nil
+}
+
+func (a *Auth) auditServiceAccount(ctx context.Context, log *slog.Logger, eventType string, actorID int64,
+	account models.ServiceAccount, outcome string, metadata map[string]string) {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata["service_account_id"] = strconv.FormatInt(account.ID, 10)
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:     eventType,
+		ActorID:  actorID,
+		AppID:    account.AppID,
+		Outcome:  outcome,
+		Metadata: metadata,
+	})
+}
+
+// auditServiceAccountToken records a token request of a service account,
+// the account is the actor.
+func (a *Auth) auditServiceAccountToken(ctx context.Context, log *slog.Logger, accountID int64, appID int64,
+	outcome string, metadata map[string]string) {
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditServiceAccountToken,
+		ActorID:   accountID,
+		ActorType: models.AuditActorServiceAccount,
+		AppID:     appID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/clientinfo"
+	"sso/internal/services/storage"
+	"strconv"
+	"time"
+)
+
+const (
+	sessionIDLen = 16
+	// sessionTouchInterval limits how often a session's last seen time is
+	// written, not every request needs a write.
+	sessionTouchInterval = time.Minute
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionStore interface {
+	SaveSession(ctx context.Context, session models.Session) error
+	Session(ctx context.Context, sessionID string) (session models.Session, err error)
+	Sessions(ctx context.Context, userID int64, now time.Time) (sessions []models.Session, err error)
+	TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error
+	RevokeSession(ctx context.Context, userID int64, sessionID string, revokedAt time.Time) error
+	RevokeSessions(ctx context.Context, userID int64, exceptID string, revokedAt time.Time) (revoked int64, err error)
+}
+
+// ListSessions returns the active sessions of the user. Users see their own
+// sessions, admins anyone's.
+func (a *Auth) ListSessions(ctx context.Context, actorID int64, userID int64) ([]models.Session, error) {
+	const op = "auth.ListSessions"
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sessions, err := a.sessStore.Sessions(ctx, userID, time.Now())
+	if err != nil {
+		a.log.Error("failed to get sessions: "+err.Error(), slog.String("op", op))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends a session of the user, its tokens stop validating.
+func (a *Auth) RevokeSession(ctx context.Context, actorID int64, userID int64, sessionID string) error {
+	const op = "auth.RevokeSession"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userId", userID))
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		a.auditSessions(ctx, log, models.AuditSessionRevoked, actorID, userID, models.AuditDenied, nil)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.sessStore.RevokeSession(ctx, userID, sessionID, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+		}
+		log.Error("failed to revoke session: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("session revoked", slog.Int64("actorId", actorID))
+
+	a.auditSessions(ctx, log, models.AuditSessionRevoked, actorID, userID, models.AuditSuccess,
+		map[string]string{"session_id": sessionID})
+
+	return nil
+}
+
+// RevokeAllSessions ends all sessions of the user but exceptID, e.g. the
+// session of the caller, and returns how many were ended.
+func (a *Auth) RevokeAllSessions(ctx context.Context, actorID int64, userID int64, exceptID string) (int64, error) {
+	const op = "auth.RevokeAllSessions"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userId", userID))
+
+	if err := a.requireSelfOrAdmin(ctx, actorID, userID); err != nil {
+		a.auditSessions(ctx, log, models.AuditSessionsRevoked, actorID, userID, models.AuditDenied, nil)
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := a.sessStore.RevokeSessions(ctx, userID, exceptID, time.Now())
+	if err != nil {
+		log.Error("failed to revoke sessions: " + err.Error())
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("sessions revoked", slog.Int64("actorId", actorID), slog.Int64("revoked", revoked))
+
+	a.auditSessions(ctx, log, models.AuditSessionsRevoked, actorID, userID, models.AuditSuccess,
+		map[string]string{"revoked": strconv.FormatInt(revoked, 10), "kept": exceptID})
+
+	return revoked, nil
+}
+
+// revokeSessionsAfterPasswordChange ends the sessions of the user but
+// exceptID, whoever knew the old password is logged out. The password is
+// changed already, so a failure is only logged.
+func (a *Auth) revokeSessionsAfterPasswordChange(ctx context.Context, log *slog.Logger, userID int64, exceptID string) {
+	revoked, err := a.sessStore.RevokeSessions(ctx, userID, exceptID, time.Now())
+	if err != nil {
+		log.Error("failed to revoke sessions: " + err.Error())
+		return
+	}
+
+	log.Info("sessions revoked", slog.Int64("revoked", revoked))
+
+	a.auditSessions(ctx, log, models.AuditSessionsRevoked, userID, userID, models.AuditSuccess,
+		map[string]string{"revoked": strconv.FormatInt(revoked, 10), "kept": exceptID, "reason": "password_changed"})
+}
+
+// startSession saves a new session of the user for the app lasting ttl,
+// actorID is the admin impersonating the user or zero.
+func (a *Auth) startSession(ctx context.Context, userID int64, appID int64, actorID int64,
+	ttl time.Duration) (models.Session, error) {
+	raw := make([]byte, sessionIDLen)
+	if _, err := rand.Read(raw); err != nil {
+		return models.Session{}, err
+	}
+
+	client := clientinfo.From(ctx)
+	now := time.Now()
+
+	session := models.Session{
+		ID:         base64.RawURLEncoding.EncodeToString(raw),
+		UserID:     userID,
+		AppID:      appID,
+		DeviceID:   client.DeviceID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+		ActorID:    actorID,
+	}
+
+	if err := a.sessStore.SaveSession(ctx, session); err != nil {
+		return models.Session{}, err
+	}
+
+	return session, nil
+}
+
+// checkSession makes sure the session of a token is still active and
+// updates when it was last seen.
+func (a *Auth) checkSession(ctx context.Context, sessionID string, userID int64) error {
+	session, err := a.sessStore.Session(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+
+	now := time.Now()
+	if session.UserID != userID || !session.ActiveAt(now) {
+		return ErrInvalidToken
+	}
+
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := a.sessStore.TouchSession(ctx, sessionID, now); err != nil {
+			a.log.Error("failed to touch session: "+err.Error(), slog.String("sessionId", sessionID))
+		}
+	}
+
+	return nil
+}
+
+func (a *Auth) requireSelfOrAdmin(ctx context.Context, actorID int64, userID int64) error {
+	if actorID == userID {
+		return nil
+	}
+
+	return a.requireAdmin(ctx, actorID)
+}
+
+func (a *Auth) auditSessions(ctx context.Context, log *slog.Logger, eventType string, actorID int64, userID int64,
+	outcome string, metadata map[string]string) {
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      eventType,
+		ActorID:   actorID,
+		SubjectID: userID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+}
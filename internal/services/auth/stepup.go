@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	jwtlocal "sso/internal/lib"
+	"sso/internal/services/storage"
+	"time"
+)
+
+var ErrSessionRequired = errors.New("token has no session")
+
+// StepUp re-authenticates the caller of a session with the password and a
+// code of the enrolled authenticator app and returns a short-lived token of
+// the session with the step-up acr. The token carries the scopes of the
+// caller's token.
+func (a *Auth) StepUp(ctx context.Context, principal models.Principal, password string,
+	code string) (string, time.Time, error) {
+	const op = "auth.StepUp"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("userId", principal.UserID),
+	)
+
+	if principal.SessionID == "" {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, ErrSessionRequired)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, principal.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", time.Time{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	loginName, err := a.loginName(ctx, user)
+	if err != nil {
+		log.Error("failed to get identities: " + err.Error())
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the password is checked by the backends of Login, it must be the
+	// caller's own
+	authn, err := a.authenticate(ctx, log, loginName, password)
+	if err == nil && authn.User.ID != user.ID {
+		err = ErrInvalidCredentials
+	}
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCredentials) && !errors.Is(err, ErrNoAccount) &&
+			!errors.Is(err, ErrIdentityNotLinked) && !errors.Is(err, ErrEmailNotAllowed) {
+			log.Error("failed to authenticate user: " + err.Error())
+			return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+		}
+		log.Warn("step-up with a wrong password")
+		a.auditStepUp(ctx, log, principal, models.AuditFailure, "invalid_password")
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	if err := checkStatus(user); err != nil {
+		a.auditStepUp(ctx, log, principal, models.AuditDenied, "user_"+user.StatusAt(time.Now()))
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the password alone is what the session was opened with
+	if err := a.verifyTOTP(ctx, user.ID, code, true); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidTOTPCode):
+			log.Warn("step-up with a wrong authenticator code")
+			a.auditStepUp(ctx, log, principal, models.AuditFailure, "invalid_totp")
+		case errors.Is(err, ErrTOTPNotEnrolled):
+			a.auditStepUp(ctx, log, principal, models.AuditDenied, "totp_not_enrolled")
+		default:
+			log.Error("failed to verify totp: " + err.Error())
+		}
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.tokenApp(ctx, principal.AppID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(a.opts.StepUpTokenTTL)
+
+	token, err := jwtlocal.NewToken(user, app, a.opts.StepUpTokenTTL, jwtlocal.TokenOptions{
+		Scopes:    principal.Scopes,
+		SessionID: principal.SessionID,
+		AuthTime:  now,
+		ACR:       models.ACRStepUp,
+		AMR:       []string{models.AMRPassword, models.AMROTP},
+		Roles:     authn.Roles,
+	})
+	if err != nil {
+		log.Error("cannot generate token")
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("stepped up")
+
+	a.auditStepUp(ctx, log, principal, models.AuditSuccess, "")
+
+	return token, expiresAt, nil
+}
+
+// auditStepUp records a step-up in the audit log and the login history, so
+// wrong passwords and codes count like failed logins.
+func (a *Auth) auditStepUp(ctx context.Context, log *slog.Logger, principal models.Principal,
+	outcome string, reason string) {
+	metadata := map[string]string{"session_id": principal.SessionID}
+	if reason != "" {
+		metadata["reason"] = reason
+	}
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditStepUp,
+		ActorID:   principal.UserID,
+		SubjectID: principal.UserID,
+		AppID:     principal.AppID,
+		Outcome:   outcome,
+		Metadata:  metadata,
+	})
+
+	if reason != "" {
+		reason = "step_up_" + reason
+	}
+
+	a.recordLogin(ctx, log, models.LoginAttempt{
+		UserID:  principal.UserID,
+		AppID:   principal.AppID,
+		Email:   principal.Email,
+		Success: outcome == models.AuditSuccess,
+		Reason:  reason,
+	})
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/totp"
+	"sso/internal/services/storage"
+	"time"
+)
+
+const (
+	totpIssuer = "sso"
+	// totpSkew is the number of steps a code may be off, for the clock of
+	// the phone.
+	totpSkew = 1
+)
+
+var (
+	ErrTOTPExist       = errors.New("authenticator already enrolled")
+	ErrTOTPNotEnrolled = errors.New("authenticator not enrolled")
+	ErrInvalidTOTPCode = errors.New("invalid authenticator code")
+)
+
+type TOTPStore interface {
+	SaveTOTP(ctx context.Context, totp models.TOTP) error
+	TOTP(ctx context.Context, userID int64) (totp models.TOTP, err error)
+	UseTOTP(ctx context.Context, userID int64, step int64) error
+}
+
+// EnrollTOTP starts the enrollment of an authenticator app for the user and
+// returns its secret. A pending enrollment is replaced, it is confirmed
+// with a code of the app by ConfirmTOTP.
+func (a *Auth) EnrollTOTP(ctx context.Context, userID int64) (models.TOTPEnrollment, error) {
+	const op = "auth.EnrollTOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("userId", userID),
+	)
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	encrypted, err := a.encryptSecret(totp.Encode(secret), totpSecretAAD)
+	if err != nil {
+		log.Error("failed to encrypt secret: " + err.Error())
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.totpStore.SaveTOTP(ctx, models.TOTP{
+		UserID:    userID,
+		Secret:    []byte(encrypted),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPExist) {
+			return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, ErrTOTPExist)
+		}
+		log.Error("failed to save totp: " + err.Error())
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enrollment started")
+
+	return models.TOTPEnrollment{
+		Secret: totp.Encode(secret),
+		URL:    totp.URL(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP finishes the enrollment with a code of the authenticator app.
+func (a *Auth) ConfirmTOTP(ctx context.Context, userID int64, code string) error {
+	const op = "auth.ConfirmTOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("userId", userID),
+	)
+
+	if err := a.verifyTOTP(ctx, userID, code, false); err != nil {
+		if errors.Is(err, ErrInvalidTOTPCode) {
+			log.Warn("totp confirmation with a wrong code")
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enrolled")
+
+	a.audit(ctx, log, models.AuditEvent{
+		Type:      models.AuditTOTPEnrolled,
+		ActorID:   userID,
+		SubjectID: userID,
+	})
+
+	return nil
+}
+
+// verifyTOTP checks a code of the user's authenticator app, confirmed says
+// whether the enrollment must be confirmed already. Every code is accepted
+// once only.
+func (a *Auth) verifyTOTP(ctx context.Context, userID int64, code string, confirmed bool) error {
+	t, err := a.totpStore.TOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTOTPNotFound) {
+			return ErrTOTPNotEnrolled
+		}
+		return err
+	}
+	if t.Confirmed != confirmed {
+		if t.Confirmed {
+			return ErrTOTPExist
+		}
+		return ErrTOTPNotEnrolled
+	}
+
+	encoded, err := a.decryptSecret(t.Secret, totpSecretAAD)
+	if err != nil {
+		return err
+	}
+	secret, err := totp.Decode(string(encoded))
+	if err != nil {
+		return err
+	}
+
+	step, err := totp.Validate(secret, code, time.Now(), totpSkew)
+	if err != nil {
+		return ErrInvalidTOTPCode
+	}
+	if step <= t.LastStep {
+		return ErrInvalidTOTPCode
+	}
+
+	if err := a.totpStore.UseTOTP(ctx, userID, step); err != nil {
+		if errors.Is(err, storage.ErrTOTPReplayed) {
+			return ErrInvalidTOTPCode
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidPolicy  = errors.New("invalid policy")
+	ErrPolicyExist    = errors.New("policy already exist")
+	ErrPolicyNotFound = errors.New("policy not found")
+	ErrInvalidAppID   = errors.New("invalid appID")
+	ErrUserNotFound   = errors.New("user not found")
+	// ErrPermissionDenied means the caller isn't an admin, only admins
+	// manage the policies, or has no token of the app it authorizes for.
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+type Authz struct {
+	log         *slog.Logger
+	plcSaver    PolicySaver
+	plcProvider PolicyProvider
+	usrProvider UserProvider
+	evaluator   Evaluator
+}
+
+type PolicySaver interface {
+	SavePolicy(ctx context.Context, policy models.Policy) (policyID int64, err error)
+	DeletePolicy(ctx context.Context, appID int64, policyID int64) error
+}
+
+type PolicyProvider interface {
+	Policies(ctx context.Context, appID int64) (policies []models.Policy, err error)
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userID int64) (modelU models.User, err error)
+	IsAdmin(ctx context.Context, userID int64) (isAdmin bool, err error)
+}
+
+// Evaluator evaluates policy expressions, see sso/internal/lib/policy for the
+// built-in rule language.
+type Evaluator interface {
+	Validate(expr string) error
+	Evaluate(expr string, env map[string]any) (bool, error)
+}
+
+// NewAuthz returns a new object of the Authz struct
+func NewAuthz(log *slog.Logger, plcSaver PolicySaver,
+	plcProvider PolicyProvider, usrProvider UserProvider, evaluator Evaluator) *Authz {
+	return &Authz{
+		log:         log,
+		plcSaver:    plcSaver,
+		plcProvider: plcProvider,
+		usrProvider: usrProvider,
+		evaluator:   evaluator,
+	}
+}
+
+// AuthorizeCaller is Authorize for a caller outside the SSO, which must hold
+// a token of the app. A service account of the app is its backend and may
+// ask for any user with the user attributes it knows, a user may only ask
+// for itself and gets the stored attributes only, so it can't make up the
+// ones the policies check.
+func (a *Authz) AuthorizeCaller(ctx context.Context, caller models.Principal, appID int64, userID int64,
+	action string, user map[string]any, resource map[string]any, reqCtx map[string]any) (models.Decision, error) {
+	const op = "authz.AuthorizeCaller"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("appId", appID),
+		slog.Int64("userId", userID),
+		slog.Int64("callerId", caller.UserID),
+		slog.Int64("callerAppId", caller.AppID),
+	)
+
+	if caller.AppID != appID {
+		log.Warn("token of another app")
+		return models.Decision{}, fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+	if caller.ServiceAccountID == 0 {
+		if userID != 0 && userID != caller.UserID {
+			log.Warn("user authorizing for another user")
+			return models.Decision{}, fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+		}
+		userID, user = caller.UserID, nil
+	}
+
+	decision, err := a.Authorize(ctx, appID, userID, action, user, resource, reqCtx)
+	if err != nil {
+		return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return decision, nil
+}
+
+// Authorize checks the app policies in priority order, the first policy
+// whose actions and expression match decides. Without a match access is
+// denied. A policy that fails to evaluate denies access. The user
+// attributes are trusted, see AuthorizeCaller for the callers outside the
+// SSO.
+func (a *Authz) Authorize(ctx context.Context, appID int64, userID int64, action string,
+	user map[string]any, resource map[string]any, reqCtx map[string]any) (models.Decision, error) {
+	const op = "authz.Authorize"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("appId", appID),
+		slog.Int64("userId", userID),
+		slog.String("action", action),
+	)
+
+	env, err := a.environment(ctx, userID, action, user, resource, reqCtx)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Error("user not found")
+			return models.Decision{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to build environment: " + err.Error())
+		return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	policies, err := a.plcProvider.Policies(ctx, appID)
+	if err != nil {
+		log.Error("failed to get policies: " + err.Error())
+		return models.Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, policy := range policies {
+		if !matchAction(policy.Actions, action) {
+			continue
+		}
+
+		ok, err := a.evaluator.Evaluate(policy.Expression, env)
+		if err != nil {
+			log.Warn("failed to evaluate policy", slog.Int64("policyId", policy.ID), slog.String("err", err.Error()))
+			return models.Decision{Allowed: false, Policy: policy}, nil
+		}
+		if !ok {
+			continue
+		}
+
+		decision := models.Decision{Allowed: policy.Effect == models.EffectAllow, Policy: policy}
+
+		log.Info("policy matched",
+			slog.Int64("policyId", policy.ID),
+			slog.String("policy", policy.Name),
+			slog.Bool("allowed", decision.Allowed),
+		)
+
+		return decision, nil
+	}
+
+	log.Info("no policy matched, access denied")
+
+	return models.Decision{Allowed: false}, nil
+}
+
+func (a *Authz) CreatePolicy(ctx context.Context, actorID int64, policy models.Policy) (int64, error) {
+	const op = "authz.CreatePolicy"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("actorId", actorID),
+		slog.Int64("appId", policy.AppID), slog.String("name", policy.Name))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if policy.Effect != models.EffectAllow && policy.Effect != models.EffectDeny {
+		return 0, fmt.Errorf("%s: %w: unknown effect %q", op, ErrInvalidPolicy, policy.Effect)
+	}
+
+	if err := a.evaluator.Validate(policy.Expression); err != nil {
+		log.Error("invalid policy expression: " + err.Error())
+		return 0, fmt.Errorf("%s: %w: %s", op, ErrInvalidPolicy, err.Error())
+	}
+
+	id, err := a.plcSaver.SavePolicy(ctx, policy)
+	if err != nil {
+		if errors.Is(err, storage.ErrPolicyExist) {
+			log.Error("policy already exist")
+			return 0, fmt.Errorf("%s: %w", op, ErrPolicyExist)
+		}
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Error("app not found")
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("failed to save policy: " + err.Error())
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success create policy", slog.Int64("policyId", id))
+
+	return id, nil
+}
+
+func (a *Authz) Policies(ctx context.Context, actorID int64, appID int64) ([]models.Policy, error) {
+	const op = "authz.Policies"
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	policies, err := a.plcProvider.Policies(ctx, appID)
+	if err != nil {
+		a.log.Error("failed to get policies", slog.String("op", op), slog.String("err", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return policies, nil
+}
+
+func (a *Authz) DeletePolicy(ctx context.Context, actorID int64, appID int64, policyID int64) error {
+	const op = "authz.DeletePolicy"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("actorId", actorID),
+		slog.Int64("appId", appID), slog.Int64("policyId", policyID))
+
+	if err := a.requireAdmin(ctx, actorID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.plcSaver.DeletePolicy(ctx, appID, policyID); err != nil {
+		if errors.Is(err, storage.ErrPolicyNotFound) {
+			log.Error("policy not found")
+			return fmt.Errorf("%s: %w", op, ErrPolicyNotFound)
+		}
+		log.Error("failed to delete policy: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success delete policy")
+
+	return nil
+}
+
+func (a *Authz) requireAdmin(ctx context.Context, actorID int64) error {
+	isAdmin, err := a.usrProvider.IsAdmin(ctx, actorID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+
+	if !isAdmin {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// environment builds the attributes available to policy expressions. Known
+// user fields override the ones sent by the caller, the request time is
+// added to the context unless the caller provided it.
+func (a *Authz) environment(ctx context.Context, userID int64, action string,
+	user map[string]any, resource map[string]any, reqCtx map[string]any) (map[string]any, error) {
+	if user == nil {
+		user = make(map[string]any)
+	}
+	if resource == nil {
+		resource = make(map[string]any)
+	}
+	if reqCtx == nil {
+		reqCtx = make(map[string]any)
+	}
+
+	if userID != 0 {
+		u, err := a.usrProvider.UserByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		user["id"] = u.ID
+		user["email"] = u.Email
+		user["is_admin"] = u.IsAdmin
+	}
+
+	now := time.Now()
+	if _, ok := reqCtx["time"]; !ok {
+		reqCtx["time"] = now.Format(time.RFC3339)
+	}
+	if _, ok := reqCtx["hour"]; !ok {
+		reqCtx["hour"] = now.Hour()
+	}
+	if _, ok := reqCtx["weekday"]; !ok {
+		reqCtx["weekday"] = strings.ToLower(now.Weekday().String())
+	}
+
+	return map[string]any{
+		"user":     user,
+		"resource": resource,
+		"context":  reqCtx,
+		"action":   action,
+	}, nil
+}
+
+func matchAction(actions []string, action string) bool {
+	if len(actions) == 0 {
+		return true
+	}
+
+	for _, a := range actions {
+		if a == "*" || a == action {
+			return true
+		}
+	}
+
+	return false
+}
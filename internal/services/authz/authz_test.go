@@ -0,0 +1,92 @@
+package authz
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/policy"
+	"sso/internal/services/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePolicies []models.Policy
+
+func (f fakePolicies) Policies(context.Context, int64) ([]models.Policy, error) {
+	return f, nil
+}
+
+type fakeUsers map[int64]models.User
+
+func (f fakeUsers) UserByID(_ context.Context, userID int64) (models.User, error) {
+	user, ok := f[userID]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (f fakeUsers) IsAdmin(_ context.Context, userID int64) (bool, error) {
+	return f[userID].IsAdmin, nil
+}
+
+func TestAuthorizeCaller(t *testing.T) {
+	policies := fakePolicies{{
+		ID:         1,
+		AppID:      2,
+		Effect:     models.EffectAllow,
+		Expression: `user.department == resource.department`,
+	}}
+	users := fakeUsers{7: {ID: 7, Email: "user@example.com"}, 8: {ID: 8, Email: "other@example.com"}}
+
+	tests := []struct {
+		name    string
+		caller  models.Principal
+		userID  int64
+		want    bool
+		wantErr error
+	}{
+		{
+			name:   "service account with user attributes",
+			caller: models.Principal{AppID: 2, ServiceAccountID: 3},
+			userID: 7,
+			want:   true,
+		},
+		{
+			name:   "user with made up attributes",
+			caller: models.Principal{UserID: 7, AppID: 2},
+			want:   false,
+		},
+		{
+			name:    "user for another user",
+			caller:  models.Principal{UserID: 7, AppID: 2},
+			userID:  8,
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name:    "token of another app",
+			caller:  models.Principal{AppID: 5, ServiceAccountID: 3},
+			userID:  7,
+			wantErr: ErrPermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAuthz(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, policies, users, policy.NewEngine())
+
+			decision, err := a.AuthorizeCaller(context.Background(), tt.caller, 2, tt.userID, "edit",
+				map[string]any{"department": "sales"}, map[string]any{"department": "sales"}, nil)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, decision.Allowed)
+		})
+	}
+}
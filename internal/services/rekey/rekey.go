@@ -0,0 +1,213 @@
+// Package rekey moves the encrypted columns to the current master key after
+// a rotation. Peppered password hashes can't be redone without the passwords,
+// they move to the current key on the next login.
+package rekey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/keyring"
+	"sso/internal/services/storage"
+	"time"
+)
+
+// The AADs must match the ones used by the auth service.
+var (
+	appSecretAAD  = []byte("apps.secret")
+	totpSecretAAD = []byte("user_totp.secret")
+)
+
+// ErrSecretsChanged means apps rotated their secrets or users enrolled their
+// authenticators again while the rekey ran, their secrets were left alone
+// and a new run picks them up.
+var ErrSecretsChanged = errors.New("secrets changed during the rekey, run it again")
+
+type AppSecretStore interface {
+	AppSecrets(ctx context.Context) (apps []models.App, err error)
+	UpdateAppSecrets(ctx context.Context, old models.App, secrets models.App) error
+}
+
+type TOTPSecretStore interface {
+	TOTPSecrets(ctx context.Context) (totps []models.TOTP, err error)
+	UpdateTOTPSecret(ctx context.Context, old models.TOTP, secret []byte) error
+}
+
+type Keyring interface {
+	Encrypt(plaintext, aad []byte) (string, error)
+	Rewrap(value string) (rewrapped string, changed bool, err error)
+}
+
+type Rekey struct {
+	log       *slog.Logger
+	store     AppSecretStore
+	totpStore TOTPSecretStore
+	keys      Keyring
+}
+
+// NewRekey returns a new object of the Rekey struct
+func NewRekey(log *slog.Logger, store AppSecretStore, totpStore TOTPSecretStore, keys Keyring) *Rekey {
+	return &Rekey{
+		log:       log,
+		store:     store,
+		totpStore: totpStore,
+		keys:      keys,
+	}
+}
+
+// Run rewraps the current and the previous app secrets and the
+// authenticator secrets under the current key and encrypts the ones still
+// stored as plaintext, expired previous app secrets are cleared instead. It
+// returns how many apps and authenticators were updated, a failed run can be
+// repeated.
+func (r *Rekey) Run(ctx context.Context) (int, error) {
+	const op = "rekey.Run"
+
+	apps, appsErr := r.apps(ctx)
+	if appsErr != nil && !errors.Is(appsErr, ErrSecretsChanged) {
+		return apps, fmt.Errorf("%s: %w", op, appsErr)
+	}
+
+	totps, err := r.totps(ctx)
+	if err != nil {
+		return apps + totps, fmt.Errorf("%s: %w", op, err)
+	}
+	if appsErr != nil {
+		return apps + totps, fmt.Errorf("%s: %w", op, appsErr)
+	}
+
+	return apps + totps, nil
+}
+
+// apps rekeys the app secrets.
+func (r *Rekey) apps(ctx context.Context) (int, error) {
+	const op = "rekey.apps"
+
+	log := r.log.With(slog.String("op", op))
+
+	apps, err := r.store.AppSecrets(ctx)
+	if err != nil {
+		log.Error("failed to get app secrets: " + err.Error())
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var updated, skipped int
+	for _, app := range apps {
+		secrets, changed, err := r.rekey(app, time.Now())
+		if err != nil {
+			log.Error("failed to rekey app secret: "+err.Error(), slog.Int("appId", app.Id))
+			return updated, fmt.Errorf("%s: app %d: %w", op, app.Id, err)
+		}
+		if !changed {
+			continue
+		}
+
+		// a rotation since AppSecrets wins, its secrets aren't overwritten
+		if err := r.store.UpdateAppSecrets(ctx, app, secrets); err != nil {
+			if errors.Is(err, storage.ErrAppSecretChanged) {
+				log.Warn("app secret changed during the rekey", slog.Int("appId", app.Id))
+				skipped++
+				continue
+			}
+			log.Error("failed to update app secret: "+err.Error(), slog.Int("appId", app.Id))
+			return updated, fmt.Errorf("%s: app %d: %w", op, app.Id, err)
+		}
+		updated++
+	}
+
+	log.Info("app secrets rekeyed", slog.Int("updated", updated), slog.Int("skipped", skipped),
+		slog.Int("total", len(apps)))
+
+	if skipped > 0 {
+		return updated, fmt.Errorf("%s: %w", op, ErrSecretsChanged)
+	}
+
+	return updated, nil
+}
+
+// totps rekeys the authenticator secrets.
+func (r *Rekey) totps(ctx context.Context) (int, error) {
+	const op = "rekey.totps"
+
+	log := r.log.With(slog.String("op", op))
+
+	totps, err := r.totpStore.TOTPSecrets(ctx)
+	if err != nil {
+		log.Error("failed to get totp secrets: " + err.Error())
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var updated, skipped int
+	for _, totp := range totps {
+		secret, changed, err := r.value(totp.Secret, totpSecretAAD)
+		if err != nil {
+			log.Error("failed to rekey totp secret: "+err.Error(), slog.Int64("userId", totp.UserID))
+			return updated, fmt.Errorf("%s: user %d: %w", op, totp.UserID, err)
+		}
+		if !changed {
+			continue
+		}
+
+		if err := r.totpStore.UpdateTOTPSecret(ctx, totp, secret); err != nil {
+			if errors.Is(err, storage.ErrTOTPSecretChanged) {
+				log.Warn("totp secret changed during the rekey", slog.Int64("userId", totp.UserID))
+				skipped++
+				continue
+			}
+			log.Error("failed to update totp secret: "+err.Error(), slog.Int64("userId", totp.UserID))
+			return updated, fmt.Errorf("%s: user %d: %w", op, totp.UserID, err)
+		}
+		updated++
+	}
+
+	log.Info("totp secrets rekeyed", slog.Int("updated", updated), slog.Int("skipped", skipped),
+		slog.Int("total", len(totps)))
+
+	if skipped > 0 {
+		return updated, fmt.Errorf("%s: %w", op, ErrSecretsChanged)
+	}
+
+	return updated, nil
+}
+
+// rekey returns the secrets of the app under the current key and whether
+// they changed. The previous secret is dropped once it expired at now.
+func (r *Rekey) rekey(app models.App, now time.Time) (models.App, bool, error) {
+	secret, changed, err := r.value(app.Secret, appSecretAAD)
+	if err != nil {
+		return app, false, err
+	}
+	app.Secret = secret
+
+	if len(app.PreviousSecret) == 0 {
+		return app, changed, nil
+	}
+	if !now.Before(app.PreviousSecretExpiresAt) {
+		app.PreviousSecret = nil
+		app.PreviousSecretExpiresAt = time.Time{}
+		return app, true, nil
+	}
+
+	previous, previousChanged, err := r.value(app.PreviousSecret, appSecretAAD)
+	if err != nil {
+		return app, false, fmt.Errorf("previous secret: %w", err)
+	}
+	app.PreviousSecret = previous
+
+	return app, changed || previousChanged, nil
+}
+
+// value rewraps an encrypted secret and encrypts a plaintext one of the
+// column aad.
+func (r *Rekey) value(secret []byte, aad []byte) ([]byte, bool, error) {
+	if keyring.IsEncrypted(string(secret)) {
+		value, changed, err := r.keys.Rewrap(string(secret))
+		return []byte(value), changed, err
+	}
+
+	value, err := r.keys.Encrypt(secret, aad)
+
+	return []byte(value), true, err
+}
@@ -0,0 +1,150 @@
+package rekey
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/keyring"
+	"sso/internal/services/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	apps  map[int]models.App
+	totps map[int64]models.TOTP
+	// rotate changes the secret of the app between AppSecrets and
+	// UpdateAppSecrets, as a concurrent rotation would.
+	rotate int
+}
+
+func (s *fakeStore) AppSecrets(context.Context) ([]models.App, error) {
+	var apps []models.App
+	for _, app := range s.apps {
+		apps = append(apps, app)
+	}
+
+	if app, ok := s.apps[s.rotate]; ok {
+		app.PreviousSecret, app.Secret = app.Secret, []byte("rotated")
+		s.apps[s.rotate] = app
+	}
+
+	return apps, nil
+}
+
+func (s *fakeStore) UpdateAppSecrets(_ context.Context, old models.App, secrets models.App) error {
+	stored := s.apps[old.Id]
+	if !bytes.Equal(stored.Secret, old.Secret) || !bytes.Equal(stored.PreviousSecret, old.PreviousSecret) {
+		return storage.ErrAppSecretChanged
+	}
+
+	s.apps[old.Id] = secrets
+
+	return nil
+}
+
+func (s *fakeStore) TOTPSecrets(context.Context) ([]models.TOTP, error) {
+	var totps []models.TOTP
+	for _, totp := range s.totps {
+		totps = append(totps, totp)
+	}
+
+	return totps, nil
+}
+
+func (s *fakeStore) UpdateTOTPSecret(_ context.Context, old models.TOTP, secret []byte) error {
+	stored := s.totps[old.UserID]
+	if !bytes.Equal(stored.Secret, old.Secret) {
+		return storage.ErrTOTPSecretChanged
+	}
+
+	stored.Secret = secret
+	s.totps[old.UserID] = stored
+
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	before, err := keyring.New("k1", map[string][]byte{"k1": oldKey})
+	require.NoError(t, err)
+	after, err := keyring.New("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	require.NoError(t, err)
+	rotated, err := keyring.New("k2", map[string][]byte{"k2": newKey})
+	require.NoError(t, err)
+
+	encrypt := func(secret string) []byte {
+		value, err := before.Encrypt([]byte(secret), appSecretAAD)
+		require.NoError(t, err)
+		return []byte(value)
+	}
+	encryptTOTP := func(secret string) []byte {
+		value, err := before.Encrypt([]byte(secret), totpSecretAAD)
+		require.NoError(t, err)
+		return []byte(value)
+	}
+
+	store := &fakeStore{apps: map[int]models.App{
+		1: {Id: 1, Secret: encrypt("current")},
+		2: {Id: 2, Secret: encrypt("current"), PreviousSecret: encrypt("previous"),
+			PreviousSecretExpiresAt: time.Now().Add(time.Hour)},
+		3: {Id: 3, Secret: encrypt("current"), PreviousSecret: encrypt("expired"),
+			PreviousSecretExpiresAt: time.Now().Add(-time.Hour)},
+		4: {Id: 4, Secret: []byte("plaintext")},
+	}, totps: map[int64]models.TOTP{
+		1: {UserID: 1, Secret: encryptTOTP("totp")},
+		2: {UserID: 2, Secret: []byte("plaintext")},
+	}}
+
+	updated, err := NewRekey(slog.New(slog.NewTextHandler(io.Discard, nil)), store, store, after).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 6, updated)
+
+	// the old key can go now
+	decrypt := func(value []byte) string {
+		plaintext, err := rotated.Decrypt(string(value), appSecretAAD)
+		require.NoError(t, err)
+		return string(plaintext)
+	}
+
+	assert.Equal(t, "current", decrypt(store.apps[1].Secret))
+	assert.Equal(t, "current", decrypt(store.apps[2].Secret))
+	assert.Equal(t, "previous", decrypt(store.apps[2].PreviousSecret))
+	assert.Equal(t, "current", decrypt(store.apps[3].Secret))
+	assert.Empty(t, store.apps[3].PreviousSecret)
+	assert.True(t, store.apps[3].PreviousSecretExpiresAt.IsZero())
+	assert.Equal(t, "plaintext", decrypt(store.apps[4].Secret))
+
+	decryptTOTP := func(value []byte) string {
+		plaintext, err := rotated.Decrypt(string(value), totpSecretAAD)
+		require.NoError(t, err)
+		return string(plaintext)
+	}
+
+	assert.Equal(t, "totp", decryptTOTP(store.totps[1].Secret))
+	assert.Equal(t, "plaintext", decryptTOTP(store.totps[2].Secret))
+
+	updated, err = NewRekey(slog.New(slog.NewTextHandler(io.Discard, nil)), store, store, after).Run(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, updated)
+}
+
+func TestRun_ConcurrentRotation(t *testing.T) {
+	key, err := keyring.New("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+
+	store := &fakeStore{apps: map[int]models.App{1: {Id: 1, Secret: []byte("plaintext")}}, rotate: 1}
+
+	updated, err := NewRekey(slog.New(slog.NewTextHandler(io.Discard, nil)), store, store, key).Run(context.Background())
+	require.ErrorIs(t, err, ErrSecretsChanged)
+	assert.Zero(t, updated)
+	assert.Equal(t, "rotated", string(store.apps[1].Secret))
+	assert.Equal(t, "plaintext", string(store.apps[1].PreviousSecret))
+}
@@ -0,0 +1,505 @@
+package relations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidTuple      = errors.New("invalid relation tuple")
+	ErrInvalidNamespace  = errors.New("invalid namespace")
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrUnknownRelation   = errors.New("unknown relation")
+	ErrDepthExceeded     = errors.New("max check depth exceeded")
+	ErrInvalidToken      = errors.New("invalid consistency token")
+	ErrInvalidAppID      = errors.New("invalid appID")
+)
+
+type Relations struct {
+	log         *slog.Logger
+	tplSaver    TupleSaver
+	tplProvider TupleProvider
+	nsSaver     NamespaceSaver
+	nsProvider  NamespaceProvider
+	maxDepth    int
+}
+
+type TupleSaver interface {
+	WriteTuples(ctx context.Context, appID int64, tuples []models.RelationTuple) (revision int64, err error)
+	DeleteTuples(ctx context.Context, appID int64, tuples []models.RelationTuple) (revision int64, err error)
+}
+
+type TupleProvider interface {
+	RelationTuples(ctx context.Context, appID int64, object models.Object, relation string) (tuples []models.RelationTuple, err error)
+	ObjectIDs(ctx context.Context, appID int64, objectType string) (ids []string, err error)
+	Revision(ctx context.Context, appID int64) (revision int64, err error)
+}
+
+type NamespaceSaver interface {
+	SaveNamespace(ctx context.Context, ns models.Namespace) error
+}
+
+type NamespaceProvider interface {
+	Namespace(ctx context.Context, appID int64, name string) (ns models.Namespace, err error)
+}
+
+// NewRelations returns a new object of the Relations struct, maxDepth bounds
+// the recursion of Check, Expand and ListObjects.
+func NewRelations(log *slog.Logger, tplSaver TupleSaver, tplProvider TupleProvider,
+	nsSaver NamespaceSaver, nsProvider NamespaceProvider, maxDepth int) *Relations {
+	return &Relations{
+		log:         log,
+		tplSaver:    tplSaver,
+		tplProvider: tplProvider,
+		nsSaver:     nsSaver,
+		nsProvider:  nsProvider,
+		maxDepth:    maxDepth,
+	}
+}
+
+func (r *Relations) WriteNamespace(ctx context.Context, ns models.Namespace) error {
+	const op = "relations.WriteNamespace"
+
+	log := r.log.With(slog.String("op", op), slog.Int64("appId", ns.AppID), slog.String("namespace", ns.Name))
+
+	if err := validateNamespace(ns); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.nsSaver.SaveNamespace(ctx, ns); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Error("app not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("failed to save namespace: " + err.Error())
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success write namespace")
+
+	return nil
+}
+
+// WriteTuples stores the tuples and returns a consistency token of the write.
+func (r *Relations) WriteTuples(ctx context.Context, appID int64, tuples []models.RelationTuple) (string, error) {
+	const op = "relations.WriteTuples"
+
+	return r.changeTuples(ctx, op, appID, tuples, r.tplSaver.WriteTuples)
+}
+
+// DeleteTuples removes the tuples and returns a consistency token of the write.
+func (r *Relations) DeleteTuples(ctx context.Context, appID int64, tuples []models.RelationTuple) (string, error) {
+	const op = "relations.DeleteTuples"
+
+	return r.changeTuples(ctx, op, appID, tuples, r.tplSaver.DeleteTuples)
+}
+
+func (r *Relations) changeTuples(ctx context.Context, op string, appID int64, tuples []models.RelationTuple,
+	change func(ctx context.Context, appID int64, tuples []models.RelationTuple) (int64, error)) (string, error) {
+	log := r.log.With(slog.String("op", op), slog.Int64("appId", appID), slog.Int("tuples", len(tuples)))
+
+	namespaces := make(map[string]models.Namespace)
+	for _, t := range tuples {
+		ns, err := r.namespace(ctx, appID, t.Object.Type, namespaces)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		if _, ok := ns.Relation(t.Relation); !ok {
+			return "", fmt.Errorf("%s: %w: %s", op, ErrUnknownRelation, t)
+		}
+	}
+
+	revision, err := change(ctx, appID, tuples)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Error("app not found")
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("failed to change tuples: " + err.Error())
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("success change tuples", slog.Int64("revision", revision))
+
+	return formatToken(revision), nil
+}
+
+// Check reports whether subject has relation on object. The token returned
+// by a write guarantees the check sees that write, an empty token means the
+// latest data.
+func (r *Relations) Check(ctx context.Context, appID int64, object models.Object, relation string,
+	subject models.Subject, token string) (bool, string, error) {
+	const op = "relations.Check"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.Int64("appId", appID),
+		slog.String("object", object.String()),
+		slog.String("relation", relation),
+		slog.String("subject", subject.String()),
+	)
+
+	revision, err := r.snapshot(ctx, appID, token)
+	if err != nil {
+		return false, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	c := r.newChecker(appID)
+
+	ok, err := c.check(ctx, object, relation, subject, 0)
+	if err != nil {
+		log.Error("failed to check relation: " + err.Error())
+		return false, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Debug("relation checked", slog.Bool("allowed", ok))
+
+	return ok, formatToken(revision), nil
+}
+
+// Expand returns the tree of subjects that have relation on object.
+func (r *Relations) Expand(ctx context.Context, appID int64, object models.Object, relation string,
+	token string) (models.UsersetTree, string, error) {
+	const op = "relations.Expand"
+
+	revision, err := r.snapshot(ctx, appID, token)
+	if err != nil {
+		return models.UsersetTree{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	c := r.newChecker(appID)
+
+	tree, err := c.expand(ctx, object, relation, 0)
+	if err != nil {
+		r.log.Error("failed to expand relation", slog.String("op", op), slog.String("err", err.Error()))
+		return models.UsersetTree{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tree, formatToken(revision), nil
+}
+
+// ListObjects returns the ids of objects of objectType on which subject has
+// relation. Every object of the type that has tuples is checked.
+func (r *Relations) ListObjects(ctx context.Context, appID int64, objectType string, relation string,
+	subject models.Subject, token string) ([]string, string, error) {
+	const op = "relations.ListObjects"
+
+	revision, err := r.snapshot(ctx, appID, token)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	ids, err := r.tplProvider.ObjectIDs(ctx, appID, objectType)
+	if err != nil {
+		r.log.Error("failed to get objects", slog.String("op", op), slog.String("err", err.Error()))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	c := r.newChecker(appID)
+
+	var res []string
+	for _, id := range ids {
+		ok, err := c.check(ctx, models.Object{Type: objectType, ID: id}, relation, subject, 0)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		if ok {
+			res = append(res, id)
+		}
+	}
+
+	return res, formatToken(revision), nil
+}
+
+// snapshot returns the current revision, which must not be older than the
+// one in token.
+func (r *Relations) snapshot(ctx context.Context, appID int64, token string) (int64, error) {
+	revision, err := r.tplProvider.Revision(ctx, appID)
+	if err != nil {
+		return 0, err
+	}
+
+	if token == "" {
+		return revision, nil
+	}
+
+	want, err := parseToken(token)
+	if err != nil {
+		return 0, err
+	}
+	if want > revision {
+		return 0, fmt.Errorf("%w: revision %d is not known yet", ErrInvalidToken, want)
+	}
+
+	return revision, nil
+}
+
+func (r *Relations) namespace(ctx context.Context, appID int64, name string, cache map[string]models.Namespace) (models.Namespace, error) {
+	if ns, ok := cache[name]; ok {
+		return ns, nil
+	}
+
+	ns, err := r.nsProvider.Namespace(ctx, appID, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNamespaceNotFound) {
+			return ns, fmt.Errorf("%w: %s", ErrNamespaceNotFound, name)
+		}
+		return ns, err
+	}
+
+	cache[name] = ns
+
+	return ns, nil
+}
+
+type checker struct {
+	r          *Relations
+	appID      int64
+	namespaces map[string]models.Namespace
+	visiting   map[string]bool
+}
+
+func (r *Relations) newChecker(appID int64) *checker {
+	return &checker{
+		r:          r,
+		appID:      appID,
+		namespaces: make(map[string]models.Namespace),
+		visiting:   make(map[string]bool),
+	}
+}
+
+func (c *checker) relation(ctx context.Context, object models.Object, relation string) (models.RelationConfig, error) {
+	ns, err := c.r.namespace(ctx, c.appID, object.Type, c.namespaces)
+	if err != nil {
+		return models.RelationConfig{}, err
+	}
+
+	rel, ok := ns.Relation(relation)
+	if !ok {
+		return rel, fmt.Errorf("%w: %s#%s", ErrUnknownRelation, object.Type, relation)
+	}
+
+	return rel, nil
+}
+
+func (c *checker) check(ctx context.Context, object models.Object, relation string, subject models.Subject, depth int) (bool, error) {
+	if depth > c.r.maxDepth {
+		return false, ErrDepthExceeded
+	}
+
+	// a cycle in the relations can't grant anything new
+	key := object.String() + "#" + relation
+	if c.visiting[key] {
+		return false, nil
+	}
+	c.visiting[key] = true
+	defer delete(c.visiting, key)
+
+	rel, err := c.relation(ctx, object, relation)
+	if err != nil {
+		return false, err
+	}
+
+	tuples, err := c.r.tplProvider.RelationTuples(ctx, c.appID, object, relation)
+	if err != nil {
+		return false, err
+	}
+
+	for _, t := range tuples {
+		if t.Subject == subject {
+			return true, nil
+		}
+	}
+
+	for _, t := range tuples {
+		if t.Subject.Relation == "" {
+			continue
+		}
+
+		ok, err := c.check(ctx, models.Object{Type: t.Subject.Type, ID: t.Subject.ID}, t.Subject.Relation, subject, depth+1)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	for _, computed := range rel.Union {
+		ok, err := c.check(ctx, object, computed, subject, depth+1)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	for _, ttu := range rel.TupleToUserset {
+		related, err := c.r.tplProvider.RelationTuples(ctx, c.appID, object, ttu.Tupleset)
+		if err != nil {
+			return false, err
+		}
+
+		for _, t := range related {
+			ok, err := c.check(ctx, models.Object{Type: t.Subject.Type, ID: t.Subject.ID}, ttu.ComputedRelation, subject, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (c *checker) expand(ctx context.Context, object models.Object, relation string, depth int) (models.UsersetTree, error) {
+	tree := models.UsersetTree{Object: object, Relation: relation}
+
+	if depth > c.r.maxDepth {
+		return tree, ErrDepthExceeded
+	}
+
+	key := object.String() + "#" + relation
+	if c.visiting[key] {
+		return tree, nil
+	}
+	c.visiting[key] = true
+	defer delete(c.visiting, key)
+
+	rel, err := c.relation(ctx, object, relation)
+	if err != nil {
+		return tree, err
+	}
+
+	tuples, err := c.r.tplProvider.RelationTuples(ctx, c.appID, object, relation)
+	if err != nil {
+		return tree, err
+	}
+
+	for _, t := range tuples {
+		tree.Subjects = append(tree.Subjects, t.Subject)
+
+		if t.Subject.Relation != "" {
+			child, err := c.expand(ctx, models.Object{Type: t.Subject.Type, ID: t.Subject.ID}, t.Subject.Relation, depth+1)
+			if err != nil {
+				return tree, err
+			}
+			tree.Children = append(tree.Children, child)
+		}
+	}
+
+	for _, computed := range rel.Union {
+		child, err := c.expand(ctx, object, computed, depth+1)
+		if err != nil {
+			return tree, err
+		}
+		tree.Children = append(tree.Children, child)
+	}
+
+	for _, ttu := range rel.TupleToUserset {
+		related, err := c.r.tplProvider.RelationTuples(ctx, c.appID, object, ttu.Tupleset)
+		if err != nil {
+			return tree, err
+		}
+
+		for _, t := range related {
+			child, err := c.expand(ctx, models.Object{Type: t.Subject.Type, ID: t.Subject.ID}, ttu.ComputedRelation, depth+1)
+			if err != nil {
+				return tree, err
+			}
+			tree.Children = append(tree.Children, child)
+		}
+	}
+
+	return tree, nil
+}
+
+func validateNamespace(ns models.Namespace) error {
+	if ns.Name == "" || strings.ContainsAny(ns.Name, ":#@") {
+		return fmt.Errorf("%w: bad name %q", ErrInvalidNamespace, ns.Name)
+	}
+
+	defined := make(map[string]bool, len(ns.Relations))
+	for _, rel := range ns.Relations {
+		if rel.Name == "" || strings.ContainsAny(rel.Name, ":#@") {
+			return fmt.Errorf("%w: bad relation name %q", ErrInvalidNamespace, rel.Name)
+		}
+		defined[rel.Name] = true
+	}
+
+	for _, rel := range ns.Relations {
+		for _, computed := range rel.Union {
+			if !defined[computed] {
+				return fmt.Errorf("%w: %s refers to unknown relation %s", ErrInvalidNamespace, rel.Name, computed)
+			}
+		}
+		for _, ttu := range rel.TupleToUserset {
+			if !defined[ttu.Tupleset] || ttu.ComputedRelation == "" {
+				return fmt.Errorf("%w: bad tuple to userset in %s", ErrInvalidNamespace, rel.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseTuple parses "type:id#relation@type:id" and
+// "type:id#relation@type:id#relation".
+func ParseTuple(s string) (models.RelationTuple, error) {
+	var t models.RelationTuple
+
+	left, right, ok := strings.Cut(s, "@")
+	if !ok {
+		return t, fmt.Errorf("%w: %q", ErrInvalidTuple, s)
+	}
+
+	objStr, relation, ok := strings.Cut(left, "#")
+	if !ok || relation == "" {
+		return t, fmt.Errorf("%w: %q", ErrInvalidTuple, s)
+	}
+
+	object, err := ParseObject(objStr)
+	if err != nil {
+		return t, err
+	}
+
+	subject, err := ParseSubject(right)
+	if err != nil {
+		return t, err
+	}
+
+	return models.RelationTuple{Object: object, Relation: relation, Subject: subject}, nil
+}
+
+func ParseObject(s string) (models.Object, error) {
+	typ, id, ok := strings.Cut(s, ":")
+	if !ok || typ == "" || id == "" || strings.ContainsAny(s, "#@") {
+		return models.Object{}, fmt.Errorf("%w: bad object %q", ErrInvalidTuple, s)
+	}
+
+	return models.Object{Type: typ, ID: id}, nil
+}
+
+func ParseSubject(s string) (models.Subject, error) {
+	objStr, relation, _ := strings.Cut(s, "#")
+
+	object, err := ParseObject(objStr)
+	if err != nil {
+		return models.Subject{}, err
+	}
+
+	return models.Subject{Type: object.Type, ID: object.ID, Relation: relation}, nil
+}
+
+func formatToken(revision int64) string {
+	return strconv.FormatInt(revision, 10)
+}
+
+func parseToken(token string) (int64, error) {
+	revision, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || revision < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidToken, token)
+	}
+
+	return revision, nil
+}
@@ -3,8 +3,36 @@ package storage
 import "errors"
 
 var (
-	ErrUserExist    = errors.New("user already exist")
-	ErrUserNotFound = errors.New("user not found")
-	ErrAppNotFound  = errors.New("app not found")
-	ErrAppExist     = errors.New("app already exist")
+	ErrUserExist      = errors.New("user already exist")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrAppNotFound    = errors.New("app not found")
+	ErrAppExist       = errors.New("app already exist")
+	ErrPolicyExist    = errors.New("policy already exist")
+	ErrPolicyNotFound = errors.New("policy not found")
+
+	ErrNamespaceNotFound     = errors.New("namespace not found")
+	ErrConsentNotFound       = errors.New("consent not found")
+	ErrPasswordResetNotFound = errors.New("password reset not found")
+	ErrLastAdmin             = errors.New("last admin")
+	ErrSessionNotFound       = errors.New("session not found")
+	ErrPATNotFound           = errors.New("personal access token not found")
+
+	ErrServiceAccountNotFound    = errors.New("service account not found")
+	ErrServiceAccountKeyNotFound = errors.New("service account key not found")
+	ErrAssertionReplayed         = errors.New("assertion already used")
+
+	ErrIdentityNotFound        = errors.New("identity not found")
+	ErrIdentityExist           = errors.New("identity already exist")
+	ErrFederationStateNotFound = errors.New("federation state not found")
+
+	ErrTOTPNotFound = errors.New("totp not found")
+	ErrTOTPExist    = errors.New("totp already confirmed")
+	ErrTOTPReplayed = errors.New("totp code already used")
+
+	// ErrAppSecretChanged means the secrets of the app were changed since
+	// they were read, e.g. by a rotation.
+	ErrAppSecretChanged = errors.New("app secret changed")
+	// ErrTOTPSecretChanged means the authenticator of the user was enrolled
+	// again since its secret was read.
+	ErrTOTPSecretChanged = errors.New("totp secret changed")
 )
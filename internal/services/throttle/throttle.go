@@ -0,0 +1,211 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"time"
+)
+
+var ErrLocked = errors.New("too many attempts")
+
+// Limit is the threshold of failed attempts in the window for one key kind,
+// a zero field disables that step.
+type Limit struct {
+	// DelayAfter failures the next attempts are delayed, the delay doubles
+	// with every further failure.
+	DelayAfter int
+	// LockoutAfter failures the key is locked.
+	LockoutAfter int
+}
+
+// Rules configure the throttling, Limits are keyed by models.ThrottleBy*.
+type Rules struct {
+	Window    time.Duration
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Lockout   time.Duration
+	Limits    map[string]Limit
+}
+
+// Store keeps the failure counters, split into buckets of one window, and
+// the lockouts.
+type Store interface {
+	// IncrCounter increments the counter of the bucket and drops the buckets
+	// of the key older than expired.
+	IncrCounter(ctx context.Context, key string, bucket time.Time, expired time.Time) (count int64, err error)
+	Counter(ctx context.Context, key string, bucket time.Time) (count int64, err error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil returns the zero time if the key isn't locked.
+	LockedUntil(ctx context.Context, key string) (until time.Time, err error)
+	ResetCounters(ctx context.Context, key string) error
+}
+
+type Throttle struct {
+	log   *slog.Logger
+	store Store
+	rules Rules
+	now   func() time.Time
+}
+
+// NewThrottle returns a new object of the Throttle struct
+func NewThrottle(log *slog.Logger, store Store, rules Rules) *Throttle {
+	return &Throttle{
+		log:   log,
+		store: store,
+		rules: rules,
+		now:   time.Now,
+	}
+}
+
+// Check returns the delay to wait before the attempt. When one of the keys
+// is locked it fails with ErrLocked and the time left until the lockout ends.
+func (t *Throttle) Check(ctx context.Context, keys []models.ThrottleKey) (delay time.Duration, retryAfter time.Duration, err error) {
+	const op = "throttle.Check"
+
+	now := t.now()
+
+	for _, key := range keys {
+		limit, ok := t.rules.Limits[key.Kind]
+		if !ok {
+			continue
+		}
+
+		until, err := t.store.LockedUntil(ctx, key.String())
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if until.After(now) {
+			retryAfter = max(retryAfter, until.Sub(now))
+			continue
+		}
+
+		if limit.DelayAfter <= 0 {
+			continue
+		}
+
+		failures, err := t.failures(ctx, key, now)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		delay = max(delay, t.delay(failures, limit))
+	}
+
+	if retryAfter > 0 {
+		return 0, retryAfter, fmt.Errorf("%s: %w", op, ErrLocked)
+	}
+
+	return delay, 0, nil
+}
+
+// Fail records a failed attempt for every key and locks the keys that
+// reached their limit.
+func (t *Throttle) Fail(ctx context.Context, keys []models.ThrottleKey) error {
+	const op = "throttle.Fail"
+
+	log := t.log.With(slog.String("op", op))
+
+	now := t.now()
+
+	for _, key := range keys {
+		limit, ok := t.rules.Limits[key.Kind]
+		if !ok {
+			continue
+		}
+
+		locked, err := t.fail(ctx, key, limit, now)
+		if err != nil {
+			log.Error("failed to count attempt: "+err.Error(), slog.String("key", key.String()))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if locked {
+			log.Warn("login attempts locked", slog.String("key", key.String()), slog.Duration("lockout", t.rules.Lockout))
+		}
+	}
+
+	return nil
+}
+
+func (t *Throttle) fail(ctx context.Context, key models.ThrottleKey, limit Limit, now time.Time) (bool, error) {
+	bucket := now.Truncate(t.rules.Window)
+
+	if _, err := t.store.IncrCounter(ctx, key.String(), bucket, bucket.Add(-t.rules.Window)); err != nil {
+		return false, err
+	}
+
+	if limit.LockoutAfter <= 0 {
+		return false, nil
+	}
+
+	failures, err := t.failures(ctx, key, now)
+	if err != nil {
+		return false, err
+	}
+
+	if failures < float64(limit.LockoutAfter) {
+		return false, nil
+	}
+
+	if err := t.store.Lock(ctx, key.String(), now.Add(t.rules.Lockout)); err != nil {
+		return false, err
+	}
+
+	return true, t.store.ResetCounters(ctx, key.String())
+}
+
+// Succeed resets the counters of the account after a successful attempt,
+// the IP and app counters keep counting.
+func (t *Throttle) Succeed(ctx context.Context, keys []models.ThrottleKey) error {
+	const op = "throttle.Succeed"
+
+	for _, key := range keys {
+		if key.Kind != models.ThrottleByEmail {
+			continue
+		}
+
+		if err := t.store.ResetCounters(ctx, key.String()); err != nil {
+			t.log.Error("failed to reset attempts: "+err.Error(), slog.String("op", op), slog.String("key", key.String()))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// failures estimates the failures in the sliding window ending at now from
+// the counters of the current and the previous bucket.
+func (t *Throttle) failures(ctx context.Context, key models.ThrottleKey, now time.Time) (float64, error) {
+	bucket := now.Truncate(t.rules.Window)
+
+	current, err := t.store.Counter(ctx, key.String(), bucket)
+	if err != nil {
+		return 0, err
+	}
+
+	previous, err := t.store.Counter(ctx, key.String(), bucket.Add(-t.rules.Window))
+	if err != nil {
+		return 0, err
+	}
+
+	weight := 1 - float64(now.Sub(bucket))/float64(t.rules.Window)
+
+	return float64(current) + float64(previous)*weight, nil
+}
+
+func (t *Throttle) delay(failures float64, limit Limit) time.Duration {
+	over := int(failures) - limit.DelayAfter
+	if over < 0 {
+		return 0
+	}
+
+	delay := t.rules.BaseDelay
+	for i := 0; i < over && delay < t.rules.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, t.rules.MaxDelay)
+}
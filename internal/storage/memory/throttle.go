@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often IncrCounter drops the expired counters and
+// lockouts of all keys, so keys that are never seen again don't pile up.
+const sweepInterval = time.Minute
+
+// ThrottleStore keeps the login throttling counters in memory, it is meant
+// for a single instance of the service.
+type ThrottleStore struct {
+	mu        sync.Mutex
+	counters  map[string]map[time.Time]int64
+	lockouts  map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewThrottleStore() *ThrottleStore {
+	return &ThrottleStore{
+		counters: make(map[string]map[time.Time]int64),
+		lockouts: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+func (s *ThrottleStore) IncrCounter(ctx context.Context, key string, bucket time.Time, expired time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets, ok := s.counters[key]
+	if !ok {
+		buckets = make(map[time.Time]int64)
+		s.counters[key] = buckets
+	}
+
+	for b := range buckets {
+		if b.Before(expired) {
+			delete(buckets, b)
+		}
+	}
+
+	buckets[bucket]++
+	count := buckets[bucket]
+
+	if now := s.now(); now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now, expired)
+		s.lastSweep = now
+	}
+
+	return count, nil
+}
+
+// sweep drops the buckets older than expired and the lockouts that ended
+// before now, and the keys left without any.
+func (s *ThrottleStore) sweep(now time.Time, expired time.Time) {
+	for key, buckets := range s.counters {
+		for b := range buckets {
+			if b.Before(expired) {
+				delete(buckets, b)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(s.counters, key)
+		}
+	}
+
+	for key, until := range s.lockouts {
+		if !until.After(now) {
+			delete(s.lockouts, key)
+		}
+	}
+}
+
+func (s *ThrottleStore) Counter(ctx context.Context, key string, bucket time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counters[key][bucket], nil
+}
+
+func (s *ThrottleStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lockouts[key] = until
+
+	return nil
+}
+
+func (s *ThrottleStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.lockouts[key]
+	if ok && !until.After(s.now()) {
+		delete(s.lockouts, key)
+		return time.Time{}, nil
+	}
+
+	return until, nil
+}
+
+func (s *ThrottleStore) ResetCounters(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+
+	return nil
+}
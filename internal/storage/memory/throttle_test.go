@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottleStore_Sweep(t *testing.T) {
+	ctx := context.Background()
+	window := 15 * time.Minute
+
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	s := NewThrottleStore()
+	s.now = func() time.Time { return now }
+
+	incr := func(key string) int64 {
+		bucket := now.Truncate(window)
+		count, err := s.IncrCounter(ctx, key, bucket, bucket.Add(-window))
+		require.NoError(t, err)
+		return count
+	}
+
+	assert.Equal(t, int64(1), incr("email:gone@example.com"))
+	assert.Equal(t, int64(2), incr("email:gone@example.com"))
+	require.NoError(t, s.Lock(ctx, "email:gone@example.com", now.Add(window)))
+
+	// within the sweep interval nothing is dropped
+	now = now.Add(sweepInterval / 2)
+	incr("email:other@example.com")
+	assert.Len(t, s.counters, 2)
+
+	// two windows later the first key's bucket and lockout have expired
+	now = now.Add(2 * window)
+	assert.Equal(t, int64(1), incr("email:other@example.com"))
+
+	assert.Len(t, s.counters, 1)
+	assert.Contains(t, s.counters, "email:other@example.com")
+	assert.Empty(t, s.lockouts)
+}
+
+func TestThrottleStore_LockedUntil(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Date(2024, 11, 1, 12, 0, 0, 0, time.UTC)
+	s := NewThrottleStore()
+	s.now = func() time.Time { return now }
+
+	until := now.Add(time.Minute)
+	require.NoError(t, s.Lock(ctx, "ip:127.0.0.1", until))
+
+	got, err := s.LockedUntil(ctx, "ip:127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, until, got)
+
+	now = until
+	got, err = s.LockedUntil(ctx, "ip:127.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, got.IsZero())
+}
@@ -0,0 +1,195 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"strings"
+	"time"
+)
+
+const (
+	auditTable   = "audit_log"
+	auditColumns = "id, event_type, actor_id, actor_type, subject_id, app_id, ip, user_agent, outcome, metadata, created_at, prev_hash, hash"
+)
+
+// SaveAuditEvent appends the event to the log and links it to the last one.
+func (s *Storage) SaveAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	const op = "storage.postgresql.SaveAuditEvent"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := saveAuditEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// saveAuditEvent appends the event in the transaction, so the event and the
+// change it records are stored together or not at all.
+func saveAuditEvent(ctx context.Context, tx *sql.Tx, event models.AuditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	if event.Metadata == nil {
+		metadata = []byte("{}")
+	}
+
+	// the database keeps microseconds, the hash must match what is read back
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	// events are chained one by one, concurrent appends wait for each other
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", auditTable); err != nil {
+		return err
+	}
+
+	var prev string
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT hash FROM %s ORDER BY id DESC LIMIT 1", auditTable)).Scan(&prev)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	prev = strings.TrimSpace(prev)
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s
+		(event_type, actor_id, actor_type, subject_id, app_id, ip, user_agent, outcome, metadata, created_at, prev_hash, hash)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`, auditTable),
+		event.Type, event.ActorID, event.ActorType, event.SubjectID, event.AppID, event.IP, event.UserAgent, event.Outcome,
+		string(metadata), event.CreatedAt, prev, event.ChainHash(prev))
+
+	return err
+}
+
+// AuditEvents returns up to limit events matching the filter, newest first.
+// A non-zero beforeID skips the events from it on.
+func (s *Storage) AuditEvents(ctx context.Context, filter models.AuditFilter, beforeID int64, limit int) ([]models.AuditEvent, error) {
+	const op = "storage.postgresql.AuditEvents"
+
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(filter.Types) > 0 {
+		in := make([]string, 0, len(filter.Types))
+		for _, t := range filter.Types {
+			in = append(in, arg(t))
+		}
+		where = append(where, "event_type IN ("+strings.Join(in, ", ")+")")
+	}
+	if filter.ActorID != 0 {
+		where = append(where, "actor_id = "+arg(filter.ActorID))
+	}
+	if filter.ActorType != "" {
+		where = append(where, "actor_type = "+arg(filter.ActorType))
+	}
+	if filter.SubjectID != 0 {
+		where = append(where, "subject_id = "+arg(filter.SubjectID))
+	}
+	if filter.AppID != 0 {
+		where = append(where, "app_id = "+arg(filter.AppID))
+	}
+	if filter.Outcome != "" {
+		where = append(where, "outcome = "+arg(filter.Outcome))
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.Since.UTC()))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at < "+arg(filter.Until.UTC()))
+	}
+	if beforeID != 0 {
+		where = append(where, "id < "+arg(beforeID))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", auditColumns, auditTable)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT " + arg(limit)
+
+	return s.queryAuditEvents(ctx, op, query, args...)
+}
+
+// AuditChain returns up to limit events with ids greater than afterID, oldest
+// first, to walk the hash chain.
+func (s *Storage) AuditChain(ctx context.Context, afterID int64, limit int) ([]models.AuditEvent, error) {
+	const op = "storage.postgresql.AuditChain"
+
+	return s.queryAuditEvents(ctx, op, fmt.Sprintf("SELECT %s FROM %s WHERE id > $1 ORDER BY id LIMIT $2",
+		auditColumns, auditTable), afterID, limit)
+}
+
+// DeleteAuditEvents removes the events created before the time and returns
+// how many were removed.
+func (s *Storage) DeleteAuditEvents(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.postgresql.DeleteAuditEvents"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE created_at < $1", auditTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return n, nil
+}
+
+func (s *Storage) queryAuditEvents(ctx context.Context, op string, query string, args ...any) ([]models.AuditEvent, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var (
+			event    models.AuditEvent
+			metadata string
+		)
+		if err := rows.Scan(&event.ID, &event.Type, &event.ActorID, &event.ActorType, &event.SubjectID, &event.AppID, &event.IP,
+			&event.UserAgent, &event.Outcome, &metadata, &event.CreatedAt, &event.PrevHash, &event.Hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := json.Unmarshal([]byte(metadata), &event.Metadata); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		event.CreatedAt = event.CreatedAt.UTC()
+		event.PrevHash = strings.TrimSpace(event.PrevHash)
+		event.Hash = strings.TrimSpace(event.Hash)
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,155 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strings"
+	"time"
+)
+
+const (
+	patsTable  = "personal_access_tokens"
+	patColumns = "id, user_id, app_id, name, token_hash, hint, scopes, created_at, expires_at, last_used_at, last_used_ip, revoked_at"
+)
+
+func (s *Storage) SavePAT(ctx context.Context, pat models.PAT) (int64, error) {
+	const op = "storage.postgresql.SavePAT"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s
+		(user_id, app_id, name, token_hash, hint, scopes, created_at, expires_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`, patsTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var id int64
+	err = stmt.QueryRowContext(ctx, pat.UserID, pat.AppID, pat.Name, pat.TokenHash, pat.Hint,
+		strings.Join(pat.Scopes, ","), pat.CreatedAt, pat.ExpiresAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// PAT returns the personal access token with the hash.
+func (s *Storage) PAT(ctx context.Context, tokenHash string) (models.PAT, error) {
+	const op = "storage.postgresql.PAT"
+
+	var pat models.PAT
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE token_hash=$1", patColumns, patsTable))
+	if err != nil {
+		return pat, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := scanPAT(stmt.QueryRowContext(ctx, tokenHash), &pat); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return pat, storage.ErrPATNotFound
+		}
+
+		return pat, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pat, nil
+}
+
+// PATs returns the personal access tokens of the user that aren't revoked,
+// the newest first.
+func (s *Storage) PATs(ctx context.Context, userID int64) ([]models.PAT, error) {
+	const op = "storage.postgresql.PATs"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT %s FROM %s
+		WHERE user_id=$1 AND revoked_at IS NULL ORDER BY id DESC`, patColumns, patsTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var pats []models.PAT
+	for rows.Next() {
+		var pat models.PAT
+		if err := scanPAT(rows, &pat); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		pats = append(pats, pat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pats, nil
+}
+
+func (s *Storage) TouchPAT(ctx context.Context, patID int64, usedAt time.Time, ip string) error {
+	const op = "storage.postgresql.TouchPAT"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET last_used_at=$1, last_used_ip=$2 WHERE id=$3", patsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, usedAt, ip, patID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokePAT revokes a personal access token of the user that isn't revoked
+// yet.
+func (s *Storage) RevokePAT(ctx context.Context, userID int64, patID int64, revokedAt time.Time) error {
+	const op = "storage.postgresql.RevokePAT"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`UPDATE %s SET revoked_at=$1
+		WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL`, patsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, revokedAt, patID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrPATNotFound
+	}
+
+	return nil
+}
+
+func scanPAT(row interface{ Scan(dest ...any) error }, pat *models.PAT) error {
+	var (
+		scopes     string
+		lastUsedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+
+	if err := row.Scan(&pat.ID, &pat.UserID, &pat.AppID, &pat.Name, &pat.TokenHash, &pat.Hint, &scopes,
+		&pat.CreatedAt, &pat.ExpiresAt, &lastUsedAt, &pat.LastUsedIP, &revokedAt); err != nil {
+		return err
+	}
+	if scopes != "" {
+		pat.Scopes = strings.Split(scopes, ",")
+	}
+	pat.LastUsedAt = lastUsedAt.Time
+	pat.RevokedAt = revokedAt.Time
+
+	return nil
+}
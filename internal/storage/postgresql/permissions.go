@@ -0,0 +1,73 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"time"
+)
+
+const permissionsTable = "admin_permissions"
+
+// SetPermission grants or revokes the admin permission of the user and
+// appends the audit event of the change in the same transaction.
+func (s *Storage) SetPermission(ctx context.Context, userID int64, permission string, granted bool,
+	event models.AuditEvent) error {
+	const op = "storage.postgresql.SetPermission"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT id FROM %s WHERE id=$1", usersTable), userID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrUserNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if granted {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (user_id, permission, granted_at)
+			values ($1, $2, $3) ON CONFLICT DO NOTHING`, permissionsTable), userID, permission, time.Now())
+	} else {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE user_id=$1 AND permission=$2",
+			permissionsTable), userID, permission)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := saveAuditEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	const op = "storage.postgresql.HasPermission"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE user_id=$1 AND permission=$2",
+		permissionsTable))
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var count int64
+	if err := stmt.QueryRowContext(ctx, userID, permission).Scan(&count); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count > 0, nil
+}
@@ -8,6 +8,7 @@ import (
 	"sso/internal/config"
 	"sso/internal/domain/models"
 	"sso/internal/services/storage"
+	"strings"
 
 	"github.com/lib/pq"
 )
@@ -66,12 +67,33 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 
 	var us models.User
 
-	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT id, email, password_hash FROM %s WHERE email=$1", usersTable))
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s, password_hash FROM %s WHERE email=$1", userColumns, usersTable))
 	if err != nil {
 		return us, fmt.Errorf("%s: %s", op, err.Error())
 	}
 
-	if err = stmt.QueryRowContext(ctx, email).Scan(&us.ID, &us.Email, &us.PassHash); err != nil {
+	if err = scanUser(stmt.QueryRowContext(ctx, email), &us, &us.PassHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return us, storage.ErrUserNotFound
+		}
+
+		return us, fmt.Errorf("%s: %s", op, err.Error())
+	}
+
+	return us, nil
+}
+
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "storage.postgresql.UserByID"
+
+	var us models.User
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s, password_hash FROM %s WHERE id=$1", userColumns, usersTable))
+	if err != nil {
+		return us, fmt.Errorf("%s: %s", op, err.Error())
+	}
+
+	if err = scanUser(stmt.QueryRowContext(ctx, userID), &us, &us.PassHash); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return us, storage.ErrUserNotFound
 		}
@@ -87,14 +109,12 @@ func (s *Storage) App(ctx context.Context, appID int64) (models.App, error) {
 
 	var app models.App
 
-	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT id, name, secret FROM %s WHERE id=$1", appsTable))
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE id=$1", appColumns, appsTable))
 	if err != nil {
 		return app, fmt.Errorf("%s: %s", op, err.Error())
 	}
 
-	result := stmt.QueryRowContext(ctx, appID)
-
-	if err = result.Scan(&app.Id, &app.Name, &app.Secret); err != nil {
+	if err = scanApp(stmt.QueryRowContext(ctx, appID), &app); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return app, storage.ErrAppNotFound
 		}
@@ -128,16 +148,16 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	return res, nil
 }
 
-func (s *Storage) SaveApp(ctx context.Context, name string, secret string) (int64, error) {
+func (s *Storage) SaveApp(ctx context.Context, name string, secret string, scopes []string) (int64, error) {
 	const op = "storage.postgresql.CreateApp"
 
-	stmt, err := s.db.Prepare(fmt.Sprintf("INSERT INTO %s (name, secret) values ($1, $2) RETURNING id", appsTable))
+	stmt, err := s.db.Prepare(fmt.Sprintf("INSERT INTO %s (name, secret, scopes) values ($1, $2, $3) RETURNING id", appsTable))
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
 	var id int64
-	if err := stmt.QueryRowContext(ctx, name, secret).Scan(&id); err != nil {
+	if err := stmt.QueryRowContext(ctx, name, secret, strings.Join(scopes, ",")).Scan(&id); err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
 			return 0, storage.ErrAppExist
 		}
@@ -0,0 +1,138 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+)
+
+// AppSecrets returns the stored secrets of all apps but the SSO itself,
+// which has none, only the id and the secret fields of the apps are set.
+func (s *Storage) AppSecrets(ctx context.Context) ([]models.App, error) {
+	const op = "storage.postgresql.AppSecrets"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT id, secret, previous_secret, previous_secret_expires_at FROM %s WHERE id > 0",
+		appsTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		var (
+			app           models.App
+			previousUntil sql.NullTime
+		)
+		if err := rows.Scan(&app.Id, &app.Secret, &app.PreviousSecret, &previousUntil); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		app.PreviousSecretExpiresAt = previousUntil.Time
+
+		apps = append(apps, app)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
+
+// UpdateAppSecrets replaces the stored secrets of the app with the ones of
+// secrets if they are still the ones of old, otherwise it returns
+// storage.ErrAppSecretChanged.
+func (s *Storage) UpdateAppSecrets(ctx context.Context, old models.App, secrets models.App) error {
+	const op = "storage.postgresql.UpdateAppSecrets"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`UPDATE %s SET secret=$1, previous_secret=$2, previous_secret_expires_at=$3
+		WHERE id=$4 AND secret=$5 AND previous_secret=$6`, appsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	previousUntil := sql.NullTime{Time: secrets.PreviousSecretExpiresAt, Valid: !secrets.PreviousSecretExpiresAt.IsZero()}
+
+	res, err := stmt.ExecContext(ctx, string(secrets.Secret), string(secrets.PreviousSecret), previousUntil,
+		old.Id, string(old.Secret), string(old.PreviousSecret))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrAppSecretChanged
+	}
+
+	return nil
+}
+
+// TOTPSecrets returns the stored authenticator secrets, only the user id and
+// the secret fields are set.
+func (s *Storage) TOTPSecrets(ctx context.Context) ([]models.TOTP, error) {
+	const op = "storage.postgresql.TOTPSecrets"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT user_id, secret FROM %s", totpTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var totps []models.TOTP
+	for rows.Next() {
+		var totp models.TOTP
+		if err := rows.Scan(&totp.UserID, &totp.Secret); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		totps = append(totps, totp)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return totps, nil
+}
+
+// UpdateTOTPSecret replaces the stored authenticator secret of the user with
+// secret if it is still the one of old, otherwise it returns
+// storage.ErrTOTPSecretChanged.
+func (s *Storage) UpdateTOTPSecret(ctx context.Context, old models.TOTP, secret []byte) error {
+	const op = "storage.postgresql.UpdateTOTPSecret"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET secret=$1 WHERE user_id=$2 AND secret=$3", totpTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, string(secret), old.UserID, string(old.Secret))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrTOTPSecretChanged
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"time"
+)
+
+const (
+	sessionsTable  = "sessions"
+	sessionColumns = "id, user_id, app_id, device_id, ip, user_agent, created_at, last_seen_at, expires_at, revoked_at, actor_id"
+)
+
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "storage.postgresql.SaveSession"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s
+		(id, user_id, app_id, device_id, ip, user_agent, created_at, last_seen_at, expires_at, actor_id)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`, sessionsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, session.ID, session.UserID, session.AppID, session.DeviceID, session.IP,
+		session.UserAgent, session.CreatedAt, session.LastSeenAt, session.ExpiresAt, session.ActorID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Session(ctx context.Context, sessionID string) (models.Session, error) {
+	const op = "storage.postgresql.Session"
+
+	var session models.Session
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE id=$1", sessionColumns, sessionsTable))
+	if err != nil {
+		return session, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := scanSession(stmt.QueryRowContext(ctx, sessionID), &session); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return session, storage.ErrSessionNotFound
+		}
+
+		return session, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// Sessions returns the sessions of the user that are active at now, the
+// most recently seen first.
+func (s *Storage) Sessions(ctx context.Context, userID int64, now time.Time) ([]models.Session, error) {
+	const op = "storage.postgresql.Sessions"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT %s FROM %s
+		WHERE user_id=$1 AND revoked_at IS NULL AND expires_at>$2 ORDER BY last_seen_at DESC`,
+		sessionColumns, sessionsTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		if err := scanSession(rows, &session); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+func (s *Storage) TouchSession(ctx context.Context, sessionID string, seenAt time.Time) error {
+	const op = "storage.postgresql.TouchSession"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET last_seen_at=$1 WHERE id=$2", sessionsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, seenAt, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeSession revokes an active session of the user.
+func (s *Storage) RevokeSession(ctx context.Context, userID int64, sessionID string, revokedAt time.Time) error {
+	const op = "storage.postgresql.RevokeSession"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`UPDATE %s SET revoked_at=$1
+		WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL AND expires_at>$1`, sessionsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, revokedAt, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeSessions revokes all active sessions of the user but exceptID and
+// returns how many were revoked.
+func (s *Storage) RevokeSessions(ctx context.Context, userID int64, exceptID string, revokedAt time.Time) (int64, error) {
+	const op = "storage.postgresql.RevokeSessions"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`UPDATE %s SET revoked_at=$1
+		WHERE user_id=$2 AND id<>$3 AND revoked_at IS NULL AND expires_at>$1`, sessionsTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, revokedAt, userID, exceptID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return n, nil
+}
+
+func scanSession(row interface{ Scan(dest ...any) error }, session *models.Session) error {
+	var revokedAt sql.NullTime
+
+	if err := row.Scan(&session.ID, &session.UserID, &session.AppID, &session.DeviceID, &session.IP,
+		&session.UserAgent, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &revokedAt,
+		&session.ActorID); err != nil {
+		return err
+	}
+	session.RevokedAt = revokedAt.Time
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	throttleCountersTable = "throttle_counters"
+	throttleLockoutsTable = "throttle_lockouts"
+)
+
+// IncrCounter increments the failure counter of the bucket, the buckets of
+// the key older than expired are dropped in the same transaction.
+func (s *Storage) IncrCounter(ctx context.Context, key string, bucket time.Time, expired time.Time) (int64, error) {
+	const op = "storage.postgresql.IncrCounter"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE key=$1 AND bucket<$2", throttleCountersTable), key, expired)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var count int64
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`INSERT INTO %s (key, bucket, count) values ($1, $2, 1)
+		ON CONFLICT (key, bucket) DO UPDATE SET count = %s.count + 1 RETURNING count`,
+		throttleCountersTable, throttleCountersTable), key, bucket).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count, nil
+}
+
+func (s *Storage) Counter(ctx context.Context, key string, bucket time.Time) (int64, error) {
+	const op = "storage.postgresql.Counter"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT count FROM %s WHERE key=$1 AND bucket=$2", throttleCountersTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var count int64
+	if err := stmt.QueryRowContext(ctx, key, bucket).Scan(&count); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count, nil
+}
+
+func (s *Storage) Lock(ctx context.Context, key string, until time.Time) error {
+	const op = "storage.postgresql.Lock"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s (key, until) values ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET until = EXCLUDED.until`, throttleLockoutsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, key, until); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LockedUntil returns the end of the lockout of the key, the zero time if
+// the key isn't locked.
+func (s *Storage) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	const op = "storage.postgresql.LockedUntil"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT until FROM %s WHERE key=$1", throttleLockoutsTable))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var until time.Time
+	if err := stmt.QueryRowContext(ctx, key).Scan(&until); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return until, nil
+}
+
+func (s *Storage) ResetCounters(ctx context.Context, key string) error {
+	const op = "storage.postgresql.ResetCounters"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE key=$1", throttleCountersTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+)
+
+const totpTable = "user_totp"
+
+// SaveTOTP starts the enrollment of an authenticator app, a pending one is
+// replaced while a confirmed one is kept.
+func (s *Storage) SaveTOTP(ctx context.Context, totp models.TOTP) error {
+	const op = "storage.postgresql.SaveTOTP"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %[1]s (user_id, secret, confirmed, last_step, created_at)
+		values ($1, $2, FALSE, 0, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret=$2, last_step=0, created_at=$3
+		WHERE %[1]s.confirmed = FALSE`, totpTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, totp.UserID, string(totp.Secret), totp.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrTOTPExist
+	}
+
+	return nil
+}
+
+func (s *Storage) TOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	const op = "storage.postgresql.TOTP"
+
+	var totp models.TOTP
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT user_id, secret, confirmed, last_step, created_at
+		FROM %s WHERE user_id=$1`, totpTable))
+	if err != nil {
+		return totp, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var secret string
+	err = stmt.QueryRowContext(ctx, userID).Scan(&totp.UserID, &secret, &totp.Confirmed, &totp.LastStep,
+		&totp.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return totp, storage.ErrTOTPNotFound
+		}
+
+		return totp, fmt.Errorf("%s: %w", op, err)
+	}
+	totp.Secret = []byte(secret)
+
+	return totp, nil
+}
+
+// UseTOTP records the time step of an accepted code and confirms a pending
+// enrollment. A step that isn't after the last one was used already.
+func (s *Storage) UseTOTP(ctx context.Context, userID int64, step int64) error {
+	const op = "storage.postgresql.UseTOTP"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`UPDATE %s SET last_step=$1, confirmed=TRUE
+		WHERE user_id=$2 AND last_step < $1`, totpTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, step, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrTOTPReplayed
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strings"
+	"time"
+)
+
+// ListUsers returns a page of users using keyset pagination, every filter and
+// sort order is backed by an index.
+func (s *Storage) ListUsers(ctx context.Context, page models.UserPage) ([]models.User, error) {
+	const op = "storage.postgresql.ListUsers"
+
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	f := page.Filter
+	if f.EmailPrefix != "" {
+		where = append(where, "email LIKE "+arg(likePrefix(f.EmailPrefix)))
+	}
+	if f.IsAdmin != nil {
+		where = append(where, "is_admin = "+arg(*f.IsAdmin))
+	}
+	if f.Status != "" {
+		where = append(where, statusFilter(f.Status, time.Now(), arg))
+	}
+	if !f.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= "+arg(f.CreatedAfter))
+	}
+	if !f.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(f.CreatedBefore))
+	}
+	if f.OrgID != 0 {
+		where = append(where, "org_id = "+arg(f.OrgID))
+	}
+
+	cmp, order := ">", "ASC"
+	if page.Desc {
+		cmp, order = "<", "DESC"
+	}
+
+	orderBy := "id " + order
+	if after := page.After; after != nil {
+		switch page.SortBy {
+		case models.SortUsersByEmail:
+			where = append(where, fmt.Sprintf("(email, id) %s (%s, %s)", cmp, arg(after.Email), arg(after.ID)))
+		case models.SortUsersByCreatedAt:
+			where = append(where, fmt.Sprintf("(created_at, id) %s (%s, %s)", cmp, arg(after.CreatedAt), arg(after.ID)))
+		default:
+			where = append(where, fmt.Sprintf("id %s %s", cmp, arg(after.ID)))
+		}
+	}
+	switch page.SortBy {
+	case models.SortUsersByEmail:
+		orderBy = fmt.Sprintf("email %s, id %s", order, order)
+	case models.SortUsersByCreatedAt:
+		orderBy = fmt.Sprintf("created_at %s, id %s", order, order)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", userColumns, usersTable)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %s", orderBy, arg(page.Limit))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var us models.User
+		if err := scanUser(rows, &us); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		users = append(users, us)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// likePrefix escapes the LIKE wildcards of prefix.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+	return r.Replace(prefix) + "%"
+}
+
+// SetUserStatus changes the status of the user and appends the audit event
+// of the change in the same transaction, a zero until is stored as NULL.
+func (s *Storage) SetUserStatus(ctx context.Context, userID int64, status string, reason string, until time.Time,
+	event models.AuditEvent) error {
+	const op = "storage.postgresql.SetUserStatus"
+
+	var untilValue sql.NullTime
+	if !until.IsZero() {
+		untilValue = sql.NullTime{Time: until, Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET status=$1, status_reason=$2, status_until=$3 WHERE id=$4", usersTable),
+		status, reason, untilValue, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	if err := saveAuditEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetUserOrg moves the user to the org, 0 removes it from its org. The
+// audit event of the change is appended in the same transaction.
+func (s *Storage) SetUserOrg(ctx context.Context, userID int64, orgID int64, event models.AuditEvent) error {
+	const op = "storage.postgresql.SetUserOrg"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET org_id=$1 WHERE id=$2", usersTable), orgID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	if err := saveAuditEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ChangePassword sets a new password chosen by the user, it clears
+// the password change requirement and the pending password resets. The
+// replaced hash is moved to the history, which keeps the last keepHistory
+// hashes.
+func (s *Storage) ChangePassword(ctx context.Context, userID int64, passHash []byte, keepHistory int) error {
+	const op = "storage.postgresql.ChangePassword"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if keepHistory > 0 {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (user_id, password_hash, created_at)
+			SELECT id, password_hash, $2 FROM %s WHERE id=$1`, passwordHistoryTable, usersTable), userID, time.Now())
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id=$1 AND id NOT IN
+			(SELECT id FROM %s WHERE user_id=$1 ORDER BY id DESC LIMIT $2)`, passwordHistoryTable, passwordHistoryTable),
+			userID, keepHistory)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET password_hash=$1, password_change_required=FALSE,
+		password_changed_at=$2 WHERE id=$3`, usersTable), passHash, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE user_id=$1", passwordResetsTable), userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordHistory returns the last hashes of the previous passwords, newest
+// first.
+func (s *Storage) PasswordHistory(ctx context.Context, userID int64, limit int) ([][]byte, error) {
+	const op = "storage.postgresql.PasswordHistory"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT password_hash FROM %s WHERE user_id=$1 ORDER BY id DESC LIMIT $2",
+		passwordHistoryTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return hashes, nil
+}
+
+func (s *Storage) SetPasswordChangeRequired(ctx context.Context, userID int64, required bool) error {
+	const op = "storage.postgresql.SetPasswordChangeRequired"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET password_change_required=$1 WHERE id=$2", usersTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, required, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UpdatePassword replaces the hash of the same password, e.g. after a
+// rehash.
+func (s *Storage) UpdatePassword(ctx context.Context, userID int64, passHash []byte) error {
+	const op = "storage.postgresql.UpdatePassword"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET password_hash=$1 WHERE id=$2", usersTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, passHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// statusFilter matches the users with the status at now, an expired status
+// is active again, see models.User.StatusAt.
+func statusFilter(status string, now time.Time, arg func(v any) string) string {
+	if status == models.UserStatusActive {
+		return fmt.Sprintf("(status = %s OR (status_until IS NOT NULL AND status_until <= %s))", arg(status), arg(now))
+	}
+
+	return fmt.Sprintf("(status = %s AND (status_until IS NULL OR status_until > %s))", arg(status), arg(now))
+}
+
+// userColumns are the columns read by scanUser, the password hash is
+// selected separately where it is needed.
+const userColumns = "id, email, is_admin, created_at, status, status_reason, status_until, password_change_required, password_changed_at, org_id"
+
+func scanUser(row interface{ Scan(dest ...any) error }, us *models.User, dest ...any) error {
+	var until sql.NullTime
+
+	if err := row.Scan(append([]any{&us.ID, &us.Email, &us.IsAdmin, &us.CreatedAt,
+		&us.Status, &us.StatusReason, &until, &us.PasswordChangeRequired,
+		&us.PasswordChangedAt, &us.OrgID}, dest...)...); err != nil {
+		return err
+	}
+
+	us.StatusUntil = until.Time
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"time"
+)
+
+// SetAdmin grants or revokes admin rights and appends the audit event of the
+// change in the same transaction. Revoking them from the last active admin
+// fails with storage.ErrLastAdmin, admins that can't log in don't count.
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool, event models.AuditEvent) error {
+	const op = "storage.sqlite.SetAdmin"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if !isAdmin {
+		// no row locks in sqlite, a concurrent writer fails with SQLITE_BUSY
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, status, status_until FROM %s WHERE is_admin", usersTable))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		var (
+			demoted bool
+			others  int
+			now     = time.Now()
+		)
+		for rows.Next() {
+			var (
+				admin models.User
+				until sql.NullTime
+			)
+			if err := rows.Scan(&admin.ID, &admin.Status, &until); err != nil {
+				rows.Close()
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			admin.StatusUntil = until.Time
+
+			switch {
+			case admin.ID == userID:
+				demoted = true
+			case admin.StatusAt(now) == models.UserStatusActive:
+				others++
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if demoted && others == 0 {
+			return storage.ErrLastAdmin
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET is_admin=$1 WHERE id=$2", usersTable), isAdmin, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	if err := saveAuditEvent(ctx, tx, event); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Admins(ctx context.Context) ([]models.User, error) {
+	const op = "storage.sqlite.Admins"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE is_admin ORDER BY id", userColumns, usersTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var admins []models.User
+	for rows.Next() {
+		var us models.User
+		if err := scanUser(rows, &us); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		admins = append(admins, us)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return admins, nil
+}
@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const appColumns = "id, name, secret, scopes, previous_secret, previous_secret_expires_at, secret_rotated_at, created_at, min_acr"
+
+func scanApp(row interface{ Scan(dest ...any) error }, app *models.App) error {
+	var (
+		scopes                 string
+		previousUntil, rotated sql.NullTime
+	)
+
+	if err := row.Scan(&app.Id, &app.Name, &app.Secret, &scopes, &app.PreviousSecret,
+		&previousUntil, &rotated, &app.CreatedAt, &app.MinACR); err != nil {
+		return err
+	}
+
+	if scopes != "" {
+		app.Scopes = strings.Split(scopes, ",")
+	}
+	app.PreviousSecretExpiresAt = previousUntil.Time
+	app.SecretRotatedAt = rotated.Time
+
+	return nil
+}
+
+// Apps returns up to limit apps with ids greater than afterID, ordered by id.
+func (s *Storage) Apps(ctx context.Context, afterID int64, limit int) ([]models.App, error) {
+	const op = "storage.sqlite.Apps"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE id > $1 ORDER BY id LIMIT $2", appColumns, appsTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		var app models.App
+		if err := scanApp(rows, &app); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		apps = append(apps, app)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
+
+// UpdateApp stores the name and the scopes of the app.
+func (s *Storage) UpdateApp(ctx context.Context, app models.App) error {
+	const op = "storage.sqlite.UpdateApp"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET name=$1, scopes=$2, min_acr=$3 WHERE id=$4", appsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, app.Name, strings.Join(app.Scopes, ","), app.MinACR, app.Id)
+	if err != nil {
+		var sqlliteErr sqlite3.Error
+		if errors.As(err, &sqlliteErr) && sqlliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return storage.ErrAppExist
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return appAffected(op, res)
+}
+
+func (s *Storage) DeleteApp(ctx context.Context, appID int64) error {
+	const op = "storage.sqlite.DeleteApp"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE id=$1", appsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return appAffected(op, res)
+}
+
+// RotateAppSecret replaces the app secret, the current one becomes the
+// previous secret until previousExpiresAt.
+func (s *Storage) RotateAppSecret(ctx context.Context, appID int64, secret string, previousExpiresAt time.Time) error {
+	const op = "storage.sqlite.RotateAppSecret"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`UPDATE %s SET previous_secret=secret, previous_secret_expires_at=$1,
+		secret=$2, secret_rotated_at=$3 WHERE id=$4`, appsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, previousExpiresAt, secret, time.Now(), appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return appAffected(op, res)
+}
+
+func appAffected(op string, res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrAppNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strings"
+)
+
+const consentsTable = "consents"
+
+// SaveConsent creates or replaces the user's consent for the app.
+func (s *Storage) SaveConsent(ctx context.Context, consent models.Consent) error {
+	const op = "storage.sqlite.SaveConsent"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s (user_id, app_id, scopes, granted_at) values ($1, $2, $3, $4)
+		ON CONFLICT (user_id, app_id) DO UPDATE SET scopes = EXCLUDED.scopes, granted_at = EXCLUDED.granted_at`, consentsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, consent.UserID, consent.AppID, strings.Join(consent.Scopes, ","), consent.GrantedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Consent(ctx context.Context, userID int64, appID int64) (models.Consent, error) {
+	const op = "storage.sqlite.Consent"
+
+	consent := models.Consent{UserID: userID, AppID: appID}
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT scopes, granted_at FROM %s WHERE user_id=$1 AND app_id=$2", consentsTable))
+	if err != nil {
+		return consent, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var scopes string
+	if err := stmt.QueryRowContext(ctx, userID, appID).Scan(&scopes, &consent.GrantedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return consent, storage.ErrConsentNotFound
+		}
+
+		return consent, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if scopes != "" {
+		consent.Scopes = strings.Split(scopes, ",")
+	}
+
+	return consent, nil
+}
+
+func (s *Storage) Consents(ctx context.Context, userID int64) ([]models.Consent, error) {
+	const op = "storage.sqlite.Consents"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT app_id, scopes, granted_at FROM %s WHERE user_id=$1 ORDER BY app_id", consentsTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var consents []models.Consent
+	for rows.Next() {
+		var scopes string
+
+		consent := models.Consent{UserID: userID}
+		if err := rows.Scan(&consent.AppID, &scopes, &consent.GrantedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if scopes != "" {
+			consent.Scopes = strings.Split(scopes, ",")
+		}
+
+		consents = append(consents, consent)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return consents, nil
+}
+
+func (s *Storage) DeleteConsent(ctx context.Context, userID int64, appID int64) error {
+	const op = "storage.sqlite.DeleteConsent"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE user_id=$1 AND app_id=$2", consentsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, userID, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrConsentNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	identitiesTable       = "identities"
+	federationStatesTable = "federation_states"
+	identityColumns       = "id, provider, subject, user_id, email, created_at, last_login_at"
+)
+
+func (s *Storage) SaveIdentity(ctx context.Context, identity models.Identity) (int64, error) {
+	const op = "storage.sqlite.SaveIdentity"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s (provider, subject, user_id, email, created_at, last_login_at)
+		values ($1, $2, $3, $4, $5, $6)`, identitiesTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, identity.Provider, identity.Subject, identity.UserID, identity.Email,
+		identity.CreatedAt, identity.LastLoginAt)
+	if err != nil {
+		var sqlliteErr sqlite3.Error
+
+		if errors.As(err, &sqlliteErr) {
+			switch sqlliteErr.ExtendedCode {
+			case sqlite3.ErrConstraintUnique:
+				return 0, storage.ErrIdentityExist
+			case sqlite3.ErrConstraintForeignKey:
+				return 0, storage.ErrUserNotFound
+			}
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// Identity returns the identity of the subject at the provider.
+func (s *Storage) Identity(ctx context.Context, provider string, subject string) (models.Identity, error) {
+	const op = "storage.sqlite.Identity"
+
+	var identity models.Identity
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE provider=$1 AND subject=$2",
+		identityColumns, identitiesTable))
+	if err != nil {
+		return identity, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = stmt.QueryRowContext(ctx, provider, subject).Scan(&identity.ID, &identity.Provider, &identity.Subject,
+		&identity.UserID, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return identity, storage.ErrIdentityNotFound
+		}
+
+		return identity, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return identity, nil
+}
+
+// Identities returns the identities linked to the user, the oldest first.
+func (s *Storage) Identities(ctx context.Context, userID int64) ([]models.Identity, error) {
+	const op = "storage.sqlite.Identities"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE user_id=$1 ORDER BY id",
+		identityColumns, identitiesTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var identities []models.Identity
+	for rows.Next() {
+		var identity models.Identity
+		if err := rows.Scan(&identity.ID, &identity.Provider, &identity.Subject, &identity.UserID, &identity.Email,
+			&identity.CreatedAt, &identity.LastLoginAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return identities, nil
+}
+
+// TouchIdentity records a login with the identity and the email the
+// provider sent with it.
+func (s *Storage) TouchIdentity(ctx context.Context, identityID int64, email string, loginAt time.Time) error {
+	const op = "storage.sqlite.TouchIdentity"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET email=$1, last_login_at=$2 WHERE id=$3", identitiesTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, email, loginAt, identityID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveFederationState(ctx context.Context, state models.FederationState) error {
+	const op = "storage.sqlite.SaveFederationState"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s (state_hash, provider, app_id, nonce, code_verifier, expires_at)
+		values ($1, $2, $3, $4, $5, $6)`, federationStatesTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, state.StateHash, state.Provider, state.AppID, state.Nonce, state.CodeVerifier,
+		state.ExpiresAt)
+	if err != nil {
+		var sqlliteErr sqlite3.Error
+
+		if errors.As(err, &sqlliteErr) && sqlliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+			return storage.ErrAppNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeFederationState removes the state and returns it if it hasn't expired,
+// so a state is used once. Expired states are removed along.
+func (s *Storage) TakeFederationState(ctx context.Context, stateHash string, now time.Time) (models.FederationState, error) {
+	const op = "storage.sqlite.TakeFederationState"
+
+	var state models.FederationState
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return state, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT state_hash, provider, app_id, nonce, code_verifier, expires_at
+		FROM %s WHERE state_hash=$1`, federationStatesTable), stateHash).
+		Scan(&state.StateHash, &state.Provider, &state.AppID, &state.Nonce, &state.CodeVerifier, &state.ExpiresAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return state, fmt.Errorf("%s: %w", op, err)
+	}
+	found := err == nil
+
+	if found {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE state_hash=$1", federationStatesTable),
+			stateHash); err != nil {
+			return state, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at<=$1", federationStatesTable),
+		now); err != nil {
+		return state, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return state, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !found || !state.ExpiresAt.After(now) {
+		return models.FederationState{}, storage.ErrFederationStateNotFound
+	}
+
+	return state, nil
+}
@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sso/internal/domain/models"
+	"time"
+)
+
+const (
+	loginHistoryTable = "login_history"
+	userDevicesTable  = "user_devices"
+)
+
+func (s *Storage) SaveLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	const op = "storage.sqlite.SaveLoginAttempt"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s
+		(user_id, app_id, email, device_id, ip, user_agent, success, reason, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, loginHistoryTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, attempt.UserID, attempt.AppID, attempt.Email, attempt.DeviceID, attempt.IP,
+		attempt.UserAgent, attempt.Success, attempt.Reason, attempt.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LoginHistory returns up to limit login attempts of the user with ids below
+// beforeID, or the latest ones when it is 0, newest first.
+func (s *Storage) LoginHistory(ctx context.Context, userID int64, beforeID int64, limit int) ([]models.LoginAttempt, error) {
+	const op = "storage.sqlite.LoginHistory"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT
+		id, user_id, app_id, email, device_id, ip, user_agent, success, reason, created_at
+		FROM %s WHERE user_id=$1 AND ($2=0 OR id<$2) ORDER BY id DESC LIMIT $3`, loginHistoryTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, userID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var attempts []models.LoginAttempt
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		if err := rows.Scan(&attempt.ID, &attempt.UserID, &attempt.AppID, &attempt.Email, &attempt.DeviceID,
+			&attempt.IP, &attempt.UserAgent, &attempt.Success, &attempt.Reason, &attempt.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		attempts = append(attempts, attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attempts, nil
+}
+
+// TrackDevice records that the user logged in from the device. It reports
+// whether the device was seen before and whether the user has other devices.
+func (s *Storage) TrackDevice(ctx context.Context, userID int64, deviceID string, seenAt time.Time) (bool, bool, error) {
+	const op = "storage.sqlite.TrackDevice"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var devices, known int64
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*),
+		COALESCE(SUM(CASE WHEN device_id=$2 THEN 1 ELSE 0 END), 0) FROM %s WHERE user_id=$1`, userDevicesTable),
+		userID, deviceID).Scan(&devices, &known)
+	if err != nil {
+		return false, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (user_id, device_id, first_seen_at, last_seen_at)
+		values ($1, $2, $3, $3) ON CONFLICT (user_id, device_id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at`,
+		userDevicesTable), userID, deviceID, seenAt)
+	if err != nil {
+		return false, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return known > 0, devices > known, nil
+}
+
+// KnownDevice reports whether the user logged in from the device before and
+// whether the user has other devices.
+func (s *Storage) KnownDevice(ctx context.Context, userID int64, deviceID string) (bool, bool, error) {
+	const op = "storage.sqlite.KnownDevice"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT COUNT(*),
+		COALESCE(SUM(CASE WHEN device_id=$2 THEN 1 ELSE 0 END), 0) FROM %s WHERE user_id=$1`, userDevicesTable))
+	if err != nil {
+		return false, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var devices, known int64
+	if err := stmt.QueryRowContext(ctx, userID, deviceID).Scan(&devices, &known); err != nil {
+		return false, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return known > 0, devices > known, nil
+}
@@ -0,0 +1,53 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/services/storage"
+	"time"
+)
+
+const (
+	passwordResetsTable  = "password_resets"
+	passwordHistoryTable = "password_history"
+)
+
+func (s *Storage) SavePasswordReset(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
+	const op = "storage.sqlite.SavePasswordReset"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("INSERT INTO %s (token_hash, user_id, expires_at) values ($1, $2, $3)",
+		passwordResetsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, tokenHash, userID, expiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordReset returns the user of a reset token that hasn't expired yet.
+func (s *Storage) PasswordReset(ctx context.Context, tokenHash string, now time.Time) (int64, error) {
+	const op = "storage.sqlite.PasswordReset"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT user_id FROM %s WHERE token_hash=$1 AND expires_at>$2",
+		passwordResetsTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var userID int64
+	if err := stmt.QueryRowContext(ctx, tokenHash, now).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storage.ErrPasswordResetNotFound
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const policiesTable = "policies"
+
+func (s *Storage) SavePolicy(ctx context.Context, policy models.Policy) (int64, error) {
+	const op = "storage.sqlite.SavePolicy"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s (app_id, name, effect, actions, expression, priority)
+		values ($1, $2, $3, $4, $5, $6)`, policiesTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, policy.AppID, policy.Name, policy.Effect,
+		strings.Join(policy.Actions, ","), policy.Expression, policy.Priority)
+	if err != nil {
+		var sqlliteErr sqlite3.Error
+
+		if errors.As(err, &sqlliteErr) {
+			switch sqlliteErr.ExtendedCode {
+			case sqlite3.ErrConstraintUnique:
+				return 0, storage.ErrPolicyExist
+			case sqlite3.ErrConstraintForeignKey:
+				return 0, storage.ErrAppNotFound
+			}
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// Policies returns the app policies ordered by priority, highest first.
+func (s *Storage) Policies(ctx context.Context, appID int64) ([]models.Policy, error) {
+	const op = "storage.sqlite.Policies"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT id, app_id, name, effect, actions, expression, priority
+		FROM %s WHERE app_id=$1 ORDER BY priority DESC, id`, policiesTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var policies []models.Policy
+	for rows.Next() {
+		var (
+			p       models.Policy
+			actions string
+		)
+
+		if err := rows.Scan(&p.ID, &p.AppID, &p.Name, &p.Effect, &actions, &p.Expression, &p.Priority); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if actions != "" {
+			p.Actions = strings.Split(actions, ",")
+		}
+
+		policies = append(policies, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return policies, nil
+}
+
+func (s *Storage) DeletePolicy(ctx context.Context, appID int64, policyID int64) error {
+	const op = "storage.sqlite.DeletePolicy"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE id=$1 AND app_id=$2", policiesTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, policyID, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return storage.ErrPolicyNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	namespacesTable = "relation_namespaces"
+	tuplesTable     = "relation_tuples"
+	revisionsTable  = "relation_revisions"
+)
+
+func (s *Storage) SaveNamespace(ctx context.Context, ns models.Namespace) error {
+	const op = "storage.sqlite.SaveNamespace"
+
+	config, err := json.Marshal(ns.Relations)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s (app_id, name, config) values ($1, $2, $3)
+		ON CONFLICT (app_id, name) DO UPDATE SET config = EXCLUDED.config`, namespacesTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, ns.AppID, ns.Name, string(config)); err != nil {
+		var sqlliteErr sqlite3.Error
+
+		if errors.As(err, &sqlliteErr) && sqlliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+			return storage.ErrAppNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Namespace(ctx context.Context, appID int64, name string) (models.Namespace, error) {
+	const op = "storage.sqlite.Namespace"
+
+	ns := models.Namespace{AppID: appID, Name: name}
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT config FROM %s WHERE app_id=$1 AND name=$2", namespacesTable))
+	if err != nil {
+		return ns, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var config string
+	if err := stmt.QueryRowContext(ctx, appID, name).Scan(&config); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ns, storage.ErrNamespaceNotFound
+		}
+
+		return ns, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := json.Unmarshal([]byte(config), &ns.Relations); err != nil {
+		return ns, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ns, nil
+}
+
+// WriteTuples stores the tuples, existing ones are ignored, and returns the
+// new revision of the app relations.
+func (s *Storage) WriteTuples(ctx context.Context, appID int64, tuples []models.RelationTuple) (int64, error) {
+	const op = "storage.sqlite.WriteTuples"
+
+	return s.changeTuples(ctx, op, appID, tuples, fmt.Sprintf(`INSERT INTO %s
+		(app_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+		values ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`, tuplesTable))
+}
+
+// DeleteTuples removes the tuples and returns the new revision of the app
+// relations.
+func (s *Storage) DeleteTuples(ctx context.Context, appID int64, tuples []models.RelationTuple) (int64, error) {
+	const op = "storage.sqlite.DeleteTuples"
+
+	return s.changeTuples(ctx, op, appID, tuples, fmt.Sprintf(`DELETE FROM %s
+		WHERE app_id=$1 AND object_type=$2 AND object_id=$3 AND relation=$4
+		AND subject_type=$5 AND subject_id=$6 AND subject_relation=$7`, tuplesTable))
+}
+
+func (s *Storage) changeTuples(ctx context.Context, op string, appID int64, tuples []models.RelationTuple, query string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	for _, t := range tuples {
+		_, err := stmt.ExecContext(ctx, appID, t.Object.Type, t.Object.ID, t.Relation,
+			t.Subject.Type, t.Subject.ID, t.Subject.Relation)
+		if err != nil {
+			var sqlliteErr sqlite3.Error
+
+			if errors.As(err, &sqlliteErr) && sqlliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+				return 0, storage.ErrAppNotFound
+			}
+
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var revision int64
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`INSERT INTO %s (app_id, revision) values ($1, 1)
+		ON CONFLICT (app_id) DO UPDATE SET revision = %s.revision + 1 RETURNING revision`, revisionsTable, revisionsTable),
+		appID).Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revision, nil
+}
+
+// RelationTuples returns the tuples of object#relation.
+func (s *Storage) RelationTuples(ctx context.Context, appID int64, object models.Object, relation string) ([]models.RelationTuple, error) {
+	const op = "storage.sqlite.RelationTuples"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT subject_type, subject_id, subject_relation FROM %s
+		WHERE app_id=$1 AND object_type=$2 AND object_id=$3 AND relation=$4`, tuplesTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, appID, object.Type, object.ID, relation)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var tuples []models.RelationTuple
+	for rows.Next() {
+		t := models.RelationTuple{Object: object, Relation: relation}
+
+		if err := rows.Scan(&t.Subject.Type, &t.Subject.ID, &t.Subject.Relation); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		tuples = append(tuples, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tuples, nil
+}
+
+// ObjectIDs returns the ids of all objects of the type that have tuples.
+func (s *Storage) ObjectIDs(ctx context.Context, appID int64, objectType string) ([]string, error) {
+	const op = "storage.sqlite.ObjectIDs"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT DISTINCT object_id FROM %s
+		WHERE app_id=$1 AND object_type=$2 ORDER BY object_id`, tuplesTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, appID, objectType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
+
+func (s *Storage) Revision(ctx context.Context, appID int64) (int64, error) {
+	const op = "storage.sqlite.Revision"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT revision FROM %s WHERE app_id=$1", revisionsTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var revision int64
+	if err := stmt.QueryRowContext(ctx, appID).Scan(&revision); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revision, nil
+}
@@ -0,0 +1,307 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/storage"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	serviceAccountsTable          = "service_accounts"
+	serviceAccountKeysTable       = "service_account_keys"
+	serviceAccountAssertionsTable = "service_account_assertions"
+	serviceAccountColumns         = "id, name, app_id, org_id, roles, secret_hash, disabled, created_at"
+)
+
+func (s *Storage) SaveServiceAccount(ctx context.Context, account models.ServiceAccount) (int64, error) {
+	const op = "storage.sqlite.SaveServiceAccount"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s (name, app_id, org_id, roles, secret_hash, created_at)
+		values ($1, $2, $3, $4, $5, $6)`, serviceAccountsTable))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, account.Name, sql.NullInt64{Int64: account.AppID, Valid: account.AppID != 0},
+		account.OrgID, strings.Join(account.Roles, ","), account.SecretHash, account.CreatedAt)
+	if err != nil {
+		var sqlliteErr sqlite3.Error
+
+		if errors.As(err, &sqlliteErr) && sqlliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+			return 0, storage.ErrAppNotFound
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) ServiceAccount(ctx context.Context, accountID int64) (models.ServiceAccount, error) {
+	const op = "storage.sqlite.ServiceAccount"
+
+	var account models.ServiceAccount
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE id=$1", serviceAccountColumns, serviceAccountsTable))
+	if err != nil {
+		return account, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := scanServiceAccount(stmt.QueryRowContext(ctx, accountID), &account); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return account, storage.ErrServiceAccountNotFound
+		}
+
+		return account, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return account, nil
+}
+
+// ServiceAccounts returns up to limit service accounts with ids greater than
+// afterID, ordered by id.
+func (s *Storage) ServiceAccounts(ctx context.Context, afterID int64, limit int) ([]models.ServiceAccount, error) {
+	const op = "storage.sqlite.ServiceAccounts"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE id > $1 ORDER BY id LIMIT $2",
+		serviceAccountColumns, serviceAccountsTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var accounts []models.ServiceAccount
+	for rows.Next() {
+		var account models.ServiceAccount
+		if err := scanServiceAccount(rows, &account); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accounts, nil
+}
+
+// UpdateServiceAccount stores the name, the roles and the disabled flag of
+// the service account.
+func (s *Storage) UpdateServiceAccount(ctx context.Context, account models.ServiceAccount) error {
+	const op = "storage.sqlite.UpdateServiceAccount"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET name=$1, roles=$2, disabled=$3 WHERE id=$4",
+		serviceAccountsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, account.Name, strings.Join(account.Roles, ","), account.Disabled, account.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return serviceAccountAffected(op, res)
+}
+
+func (s *Storage) SetServiceAccountSecret(ctx context.Context, accountID int64, secretHash string) error {
+	const op = "storage.sqlite.SetServiceAccountSecret"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("UPDATE %s SET secret_hash=$1 WHERE id=$2", serviceAccountsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, secretHash, accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return serviceAccountAffected(op, res)
+}
+
+// DeleteServiceAccount removes the service account with its keys.
+func (s *Storage) DeleteServiceAccount(ctx context.Context, accountID int64) error {
+	const op = "storage.sqlite.DeleteServiceAccount"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE id=$1", serviceAccountsTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return serviceAccountAffected(op, res)
+}
+
+func (s *Storage) SaveServiceAccountKey(ctx context.Context, key models.ServiceAccountKey) error {
+	const op = "storage.sqlite.SaveServiceAccountKey"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`INSERT INTO %s (id, service_account_id, public_key, created_at)
+		values ($1, $2, $3, $4)`, serviceAccountKeysTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, key.ID, key.ServiceAccountID, key.PublicKey, key.CreatedAt)
+	if err != nil {
+		var sqlliteErr sqlite3.Error
+
+		if errors.As(err, &sqlliteErr) && sqlliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+			return storage.ErrServiceAccountNotFound
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ServiceAccountKeys returns the keys of the service account, the oldest
+// first.
+func (s *Storage) ServiceAccountKeys(ctx context.Context, accountID int64) ([]models.ServiceAccountKey, error) {
+	const op = "storage.sqlite.ServiceAccountKeys"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf(`SELECT id, service_account_id, public_key, created_at FROM %s
+		WHERE service_account_id=$1 ORDER BY created_at`, serviceAccountKeysTable))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []models.ServiceAccountKey
+	for rows.Next() {
+		var key models.ServiceAccountKey
+		if err := rows.Scan(&key.ID, &key.ServiceAccountID, &key.PublicKey, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) DeleteServiceAccountKey(ctx context.Context, accountID int64, keyID string) error {
+	const op = "storage.sqlite.DeleteServiceAccountKey"
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("DELETE FROM %s WHERE id=$1 AND service_account_id=$2",
+		serviceAccountKeysTable))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, keyID, accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrServiceAccountKeyNotFound
+	}
+
+	return nil
+}
+
+// UseAssertion records the id of an assertion of the service account until
+// it expires. It fails with ErrAssertionReplayed when the id was used before.
+func (s *Storage) UseAssertion(ctx context.Context, accountID int64, jti string, expiresAt time.Time, now time.Time) error {
+	const op = "storage.sqlite.UseAssertion"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE service_account_id=$1 AND expires_at<=$2",
+		serviceAccountAssertionsTable), accountID, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (service_account_id, jti, expires_at)
+		values ($1, $2, $3) ON CONFLICT DO NOTHING`, serviceAccountAssertionsTable), accountID, jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrAssertionReplayed
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanServiceAccount(row interface{ Scan(dest ...any) error }, account *models.ServiceAccount) error {
+	var (
+		appID sql.NullInt64
+		roles string
+	)
+
+	if err := row.Scan(&account.ID, &account.Name, &appID, &account.OrgID, &roles, &account.SecretHash,
+		&account.Disabled, &account.CreatedAt); err != nil {
+		return err
+	}
+	account.AppID = appID.Int64
+	if roles != "" {
+		account.Roles = strings.Split(roles, ",")
+	}
+
+	return nil
+}
+
+func serviceAccountAffected(op string, res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return storage.ErrServiceAccountNotFound
+	}
+
+	return nil
+}
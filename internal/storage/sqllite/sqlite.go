@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sso/internal/domain/models"
 	"sso/internal/services/storage"
+	"strings"
 
 	"github.com/mattn/go-sqlite3"
 )
@@ -65,17 +66,38 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 
 	var us models.User
 
-	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT id, email, password_hash FROM %s WHERE email=$1", usersTable))
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s, password_hash FROM %s WHERE email=$1", userColumns, usersTable))
 	if err != nil {
 		return us, fmt.Errorf("%s: %s", op, err.Error())
 	}
 
-	result := stmt.QueryRowContext(ctx, email)
+	if err = scanUser(stmt.QueryRowContext(ctx, email), &us, &us.PassHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return us, storage.ErrUserNotFound
+		}
+
+		return us, fmt.Errorf("%s: %s", op, err.Error())
+	}
 
-	if err = result.Scan(&us.ID, &us.Email, &us.PassHash); err != nil {
+	return us, nil
+}
+
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "storage.sqlite.UserByID"
+
+	var us models.User
+
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s, password_hash FROM %s WHERE id=$1", userColumns, usersTable))
+	if err != nil {
+		return us, fmt.Errorf("%s: %s", op, err.Error())
+	}
+
+	if err = scanUser(stmt.QueryRowContext(ctx, userID), &us, &us.PassHash); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return us, storage.ErrUserNotFound
 		}
+
+		return us, fmt.Errorf("%s: %s", op, err.Error())
 	}
 
 	return us, nil
@@ -86,17 +108,17 @@ func (s *Storage) App(ctx context.Context, appID int64) (models.App, error) {
 
 	var app models.App
 
-	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT id, name, secret FROM %s WHERE id=$1", appsTable))
+	stmt, err := s.db.Prepare(fmt.Sprintf("SELECT %s FROM %s WHERE id=$1", appColumns, appsTable))
 	if err != nil {
 		return app, fmt.Errorf("%s: %s", op, err.Error())
 	}
 
-	result := stmt.QueryRowContext(ctx, appID)
-
-	if err = result.Scan(&app.Id, &app.Name, &app.Secret); err != nil {
+	if err = scanApp(stmt.QueryRowContext(ctx, appID), &app); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return app, storage.ErrAppNotFound
 		}
+
+		return app, fmt.Errorf("%s: %s", op, err.Error())
 	}
 
 	return app, nil
@@ -123,15 +145,15 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	return res, nil
 }
 
-func (s *Storage) SaveApp(ctx context.Context, name string, secret string) (int64, error) {
+func (s *Storage) SaveApp(ctx context.Context, name string, secret string, scopes []string) (int64, error) {
 	const op = "storage.sqlite.CreateApp"
 
-	stmt, err := s.db.Prepare(fmt.Sprintf("INSERT INTO %s (name, secret) values ($1, $2)", appsTable))
+	stmt, err := s.db.Prepare(fmt.Sprintf("INSERT INTO %s (name, secret, scopes) values ($1, $2, $3)", appsTable))
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	res, err := stmt.ExecContext(ctx, name, secret)
+	res, err := stmt.ExecContext(ctx, name, secret, strings.Join(scopes, ","))
 	if err != nil {
 		var sqlliteErr sqlite3.Error
 
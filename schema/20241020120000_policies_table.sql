@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS policies (
+    id SERIAL PRIMARY KEY,
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    effect VARCHAR(16) NOT NULL,
+    actions TEXT NOT NULL DEFAULT '',
+    expression TEXT NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (app_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_policies_app ON policies (app_id, priority);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS policies;
+-- +goose StatementEnd
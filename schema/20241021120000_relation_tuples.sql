@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS relation_namespaces (
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    config TEXT NOT NULL,
+    PRIMARY KEY (app_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS relation_tuples (
+    id SERIAL PRIMARY KEY,
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    object_type VARCHAR(255) NOT NULL,
+    object_id VARCHAR(255) NOT NULL,
+    relation VARCHAR(255) NOT NULL,
+    subject_type VARCHAR(255) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    subject_relation VARCHAR(255) NOT NULL DEFAULT '',
+    UNIQUE (app_id, object_type, object_id, relation, subject_type, subject_id, subject_relation)
+);
+
+CREATE INDEX IF NOT EXISTS idx_relation_tuples_subject
+    ON relation_tuples (app_id, subject_type, subject_id, subject_relation);
+
+CREATE TABLE IF NOT EXISTS relation_revisions (
+    app_id INTEGER PRIMARY KEY REFERENCES apps (id) ON DELETE CASCADE,
+    revision BIGINT NOT NULL DEFAULT 0
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS relation_revisions;
+DROP TABLE IF EXISTS relation_tuples;
+DROP TABLE IF EXISTS relation_namespaces;
+-- +goose StatementEnd
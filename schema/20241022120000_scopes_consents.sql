@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS consents (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    scopes TEXT NOT NULL,
+    granted_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, app_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS consents;
+ALTER TABLE apps DROP COLUMN IF EXISTS scopes;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS throttle_counters (
+    key VARCHAR(320) NOT NULL,
+    bucket TIMESTAMP NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (key, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS throttle_lockouts (
+    key VARCHAR(320) PRIMARY KEY,
+    until TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS throttle_lockouts;
+DROP TABLE IF EXISTS throttle_counters;
+-- +goose StatementEnd
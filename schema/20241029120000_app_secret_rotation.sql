@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS previous_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS previous_secret_expires_at TIMESTAMP NULL;
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS secret_rotated_at TIMESTAMP NULL;
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE apps DROP COLUMN IF EXISTS created_at;
+ALTER TABLE apps DROP COLUMN IF EXISTS secret_rotated_at;
+ALTER TABLE apps DROP COLUMN IF EXISTS previous_secret_expires_at;
+ALTER TABLE apps DROP COLUMN IF EXISTS previous_secret;
+-- +goose StatementEnd
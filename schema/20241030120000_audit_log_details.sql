@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS app_id BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS ip VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS outcome VARCHAR(16) NOT NULL DEFAULT 'success';
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS prev_hash CHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS hash CHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_type ON audit_log (event_type, created_at);
+
+-- the log is append-only, only the retention may delete old events
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP INDEX IF EXISTS idx_audit_log_type;
+DROP INDEX IF EXISTS idx_audit_log_actor;
+DROP INDEX IF EXISTS idx_audit_log_created;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS hash;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS prev_hash;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS outcome;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS ip;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS app_id;
+-- +goose StatementEnd
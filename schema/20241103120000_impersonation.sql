@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS admin_permissions (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    permission VARCHAR(64) NOT NULL,
+    granted_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, permission)
+);
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS actor_id BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN IF EXISTS actor_id;
+DROP TABLE IF EXISTS admin_permissions;
+-- +goose StatementEnd
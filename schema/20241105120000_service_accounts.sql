@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(128) NOT NULL,
+    app_id INTEGER NULL REFERENCES apps (id) ON DELETE CASCADE,
+    org_id BIGINT NOT NULL DEFAULT 0,
+    roles TEXT NOT NULL DEFAULT '',
+    secret_hash VARCHAR(64) NOT NULL DEFAULT '',
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS service_account_keys (
+    id VARCHAR(64) PRIMARY KEY,
+    service_account_id INTEGER NOT NULL REFERENCES service_accounts (id) ON DELETE CASCADE,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- the ids of used assertions until they expire, so an assertion can't be
+-- replayed
+CREATE TABLE IF NOT EXISTS service_account_assertions (
+    service_account_id INTEGER NOT NULL REFERENCES service_accounts (id) ON DELETE CASCADE,
+    jti VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (service_account_id, jti)
+);
+
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS actor_type VARCHAR(32) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN IF EXISTS actor_type;
+DROP TABLE IF EXISTS service_account_assertions;
+DROP TABLE IF EXISTS service_account_keys;
+DROP TABLE IF EXISTS service_accounts;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- links the accounts of upstream identity providers to the users
+CREATE TABLE IF NOT EXISTS identities (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_login_at TIMESTAMP NOT NULL,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_identities_user ON identities (user_id);
+
+-- the pending federated logins, from the redirect to the provider until the
+-- code comes back
+CREATE TABLE IF NOT EXISTS federation_states (
+    state_hash VARCHAR(64) PRIMARY KEY,
+    provider VARCHAR(64) NOT NULL,
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    nonce VARCHAR(128) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS federation_states;
+DROP TABLE IF EXISTS identities;
+-- +goose StatementEnd
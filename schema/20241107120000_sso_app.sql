@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the SSO itself, app id 0. Its tokens are signed with the server token key,
+-- the row has no secret and only anchors their sessions.
+INSERT INTO apps (id, name, secret)
+VALUES (0, 'sso', '')
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM apps WHERE id = 0;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the org of the user, 0 is no org
+ALTER TABLE users ADD COLUMN IF NOT EXISTS org_id BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_users_org ON users (org_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_org;
+ALTER TABLE users DROP COLUMN IF EXISTS org_id;
+-- +goose StatementEnd
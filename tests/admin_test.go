@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"context"
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestListUsers_RequiresAdmin(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AdminClient.ListUsers(ctx, &ssov1.ListUsersRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = st.AdminClient.ListUsers(withToken(ctx, "not-a-token"), &ssov1.ListUsersRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err = st.AdminClient.ListUsers(withToken(ctx, token), &ssov1.ListUsersRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestSetAdmin_RequiresAdmin(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err := st.AdminClient.SetAdmin(withToken(ctx, token), &ssov1.SetAdminRequest{
+		UserId:  1,
+		IsAdmin: true,
+		Reason:  "test",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AdminClient.ListAdmins(withToken(ctx, token), &ssov1.ListAdminsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestListUsers_OrgFilter(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	admin := withToken(ctx, loginAdmin(t, ctx, st))
+	orgID := gofakeit.Int64()&0xffffff + 1
+
+	respIntro, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: registerAndLogin(t, ctx, st)})
+	require.NoError(t, err)
+	registerAndLogin(t, ctx, st)
+
+	_, err = st.AdminClient.SetUserOrg(admin, &ssov1.SetUserOrgRequest{
+		UserId: respIntro.GetUserId(),
+		OrgId:  orgID,
+		Reason: "test",
+	})
+	require.NoError(t, err)
+
+	respList, err := st.AdminClient.ListUsers(admin, &ssov1.ListUsersRequest{OrgId: orgID})
+	require.NoError(t, err)
+	require.Len(t, respList.GetUsers(), 1)
+	assert.Equal(t, respIntro.GetUserId(), respList.GetUsers()[0].GetId())
+	assert.Equal(t, orgID, respList.GetUsers()[0].GetOrgId())
+}
+
+func registerAndLogin(t *testing.T, ctx context.Context, st *suite.Suite) string {
+	t.Helper()
+
+	return registerAndLoginTo(t, ctx, st, ssoAppId)
+}
+
+// registerAndLoginTo registers a user and logs in to the app, registerAndLogin
+// logs in to the SSO itself.
+func registerAndLoginTo(t *testing.T, ctx context.Context, st *suite.Suite, appID int64) string {
+	t.Helper()
+
+	email := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: appID})
+	require.NoError(t, err)
+
+	return respLogin.GetToken()
+}
+
+// loginAdmin logs in as the admin the server bootstraps from the test config.
+func loginAdmin(t *testing.T, ctx context.Context, st *suite.Suite) string {
+	t.Helper()
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    st.Cfg.Bootstrap.AdminEmail,
+		Password: st.Cfg.Bootstrap.AdminPassword,
+		AppId:    ssoAppId,
+	})
+	require.NoError(t, err)
+
+	return respLogin.GetToken()
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
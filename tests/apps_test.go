@@ -0,0 +1,34 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestManageApps_RequiresAdmin(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthClient.GetApp(ctx, &ssov1.GetAppRequest{AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err = st.AuthClient.RotateAppSecret(withToken(ctx, token), &ssov1.RotateAppSecretRequest{AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.ListApps(withToken(ctx, token), &ssov1.ListAppsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.DeleteApp(withToken(ctx, token), &ssov1.DeleteAppRequest{AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
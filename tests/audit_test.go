@@ -0,0 +1,30 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestQueryAuditLog_RequiresAdmin(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuditClient.QueryAuditLog(ctx, &ssov1.QueryAuditLogRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err = st.AuditClient.QueryAuditLog(withToken(ctx, token), &ssov1.QueryAuditLogRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuditClient.VerifyAuditLog(withToken(ctx, token), &ssov1.VerifyAuditLogRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
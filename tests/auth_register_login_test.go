@@ -2,21 +2,24 @@ package tests
 
 import (
 	"fmt"
+	ssov1 "sso/gen/go/sso"
 	suite "sso/tests/suit"
 	"testing"
 	"time"
 
 	"github.com/brianvoe/gofakeit"
 	"github.com/golang-jwt/jwt/v5"
-	ssov1 "github.com/maximka200/buffpr/gen/go/sso"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	emptyAppId = 0
-	appId      = 1
-	appSecret  = "test-secret"
+	ssoAppId  = 0
+	appId     = 1
+	appSecret = "test-secret"
 
 	passDefLen = 10
 )
@@ -104,26 +107,59 @@ func TestLogin_InvalidCredentials(t *testing.T) {
 func TestCreateApp_NewApp_HappyPath(t *testing.T) {
 	ctx, st := suite.NewSuite(t)
 
+	admin := withToken(ctx, loginAdmin(t, ctx, st))
 	name := gofakeit.BeerName()
-	secret := gofakeit.BeerName()
 
-	respReg, err := st.AuthClient.CreateApp(ctx, &ssov1.CreateAppRequest{Name: name, Secret: secret})
+	respReg, err := st.AuthClient.CreateApp(admin, &ssov1.CreateAppRequest{Name: name})
 	require.NoError(t, err)
 	assert.NotEmpty(t, respReg.GetAppId())
+	assert.NotEmpty(t, respReg.GetSecret())
+}
+
+func TestCreateApp_RequiresAdmin(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthClient.CreateApp(ctx, &ssov1.CreateAppRequest{Name: gofakeit.BeerName()})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	user := withToken(ctx, registerAndLogin(t, ctx, st))
+	_, err = st.AuthClient.CreateApp(user, &ssov1.CreateAppRequest{Name: gofakeit.BeerName()})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
 }
 
 func TestCreateApp_AlreadyExist(t *testing.T) {
 	ctx, st := suite.NewSuite(t)
 
+	admin := withToken(ctx, loginAdmin(t, ctx, st))
 	name := gofakeit.BeerName()
-	secret := gofakeit.BeerName()
 
-	respReg, err := st.AuthClient.CreateApp(ctx, &ssov1.CreateAppRequest{Name: name, Secret: secret})
+	respReg, err := st.AuthClient.CreateApp(admin, &ssov1.CreateAppRequest{Name: name})
 	require.NoError(t, err)
 	assert.NotEmpty(t, respReg.GetAppId())
 
-	respReg, err = st.AuthClient.CreateApp(ctx, &ssov1.CreateAppRequest{Name: name, Secret: secret})
+	respReg, err = st.AuthClient.CreateApp(admin, &ssov1.CreateAppRequest{Name: name})
 	require.Error(t, err)
 	assert.Empty(t, respReg.GetAppId())
 	assert.ErrorContains(t, err, fmt.Sprintf("App already exist with email: %s", name))
 }
+
+func TestRegister_WeakPassword(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: gofakeit.Email(), Password: "password"})
+	require.Error(t, err)
+
+	st2, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.InvalidArgument, st2.Code())
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, d := range st2.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			violations = append(violations, br.GetFieldViolations()...)
+		}
+	}
+	assert.NotEmpty(t, violations)
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestAuthorize_DepartmentPolicy(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	admin := withToken(ctx, loginAdmin(t, ctx, st))
+
+	respApp, err := st.AuthClient.CreateApp(admin, &ssov1.CreateAppRequest{Name: gofakeit.BeerName()})
+	require.NoError(t, err)
+
+	respPolicy, err := st.AuthzClient.CreatePolicy(admin, &ssov1.CreatePolicyRequest{Policy: &ssov1.Policy{
+		AppId:      respApp.GetAppId(),
+		Name:       "editors-own-department",
+		Effect:     ssov1.Effect_EFFECT_ALLOW,
+		Actions:    []string{"edit"},
+		Expression: `"editor" in user.roles && user.department == resource.department`,
+	}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respPolicy.GetPolicyId())
+
+	user, err := structpb.NewStruct(map[string]any{"roles": []any{"editor"}, "department": "sales"})
+	require.NoError(t, err)
+	own, err := structpb.NewStruct(map[string]any{"department": "sales"})
+	require.NoError(t, err)
+	other, err := structpb.NewStruct(map[string]any{"department": "finance"})
+	require.NoError(t, err)
+
+	backend := withToken(ctx, serviceAccountToken(t, ctx, st, admin, respApp.GetAppId()))
+
+	respAuth, err := st.AuthzClient.Authorize(backend, &ssov1.AuthorizeRequest{
+		AppId: respApp.GetAppId(), Action: "edit", User: user, Resource: own,
+	})
+	require.NoError(t, err)
+	assert.True(t, respAuth.GetAllowed())
+	assert.Equal(t, respPolicy.GetPolicyId(), respAuth.GetPolicyId())
+
+	respAuth, err = st.AuthzClient.Authorize(backend, &ssov1.AuthorizeRequest{
+		AppId: respApp.GetAppId(), Action: "edit", User: user, Resource: other,
+	})
+	require.NoError(t, err)
+	assert.False(t, respAuth.GetAllowed())
+	assert.Empty(t, respAuth.GetPolicyId())
+
+	// a user can't make up its own attributes
+	userToken := withToken(ctx, registerAndLoginTo(t, ctx, st, respApp.GetAppId()))
+
+	respAuth, err = st.AuthzClient.Authorize(userToken, &ssov1.AuthorizeRequest{
+		AppId: respApp.GetAppId(), Action: "edit", User: user, Resource: own,
+	})
+	require.NoError(t, err)
+	assert.False(t, respAuth.GetAllowed())
+}
+
+func TestAuthorize_RequiresAppToken(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthzClient.Authorize(ctx, &ssov1.AuthorizeRequest{AppId: appId, Action: "read"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the SSO token isn't a token of the app
+	token := withToken(ctx, registerAndLogin(t, ctx, st))
+
+	_, err = st.AuthzClient.Authorize(token, &ssov1.AuthorizeRequest{AppId: appId, Action: "read"})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	token = withToken(ctx, registerAndLoginTo(t, ctx, st, appId))
+
+	_, err = st.AuthzClient.Authorize(token, &ssov1.AuthorizeRequest{AppId: appId, UserId: 1, Action: "read"})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// serviceAccountToken creates a service account of the app and returns a
+// token of it.
+func serviceAccountToken(t *testing.T, ctx context.Context, st *suite.Suite, admin context.Context,
+	appID int64) string {
+	t.Helper()
+
+	respCreate, err := st.AuthClient.CreateServiceAccount(admin, &ssov1.CreateServiceAccountRequest{
+		Name:  gofakeit.BeerName(),
+		AppId: appID,
+	})
+	require.NoError(t, err)
+
+	respToken, err := st.AuthClient.ServiceAccountToken(ctx, &ssov1.ServiceAccountTokenRequest{
+		ServiceAccountId: respCreate.GetServiceAccount().GetId(),
+		ClientSecret:     respCreate.GetClientSecret(),
+		AppId:            appID,
+	})
+	require.NoError(t, err)
+
+	return respToken.GetAccessToken()
+}
+
+func TestCreatePolicy_InvalidExpression(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	admin := withToken(ctx, loginAdmin(t, ctx, st))
+
+	_, err := st.AuthzClient.CreatePolicy(admin, &ssov1.CreatePolicyRequest{Policy: &ssov1.Policy{
+		AppId:      appId,
+		Name:       gofakeit.BeerName(),
+		Effect:     ssov1.Effect_EFFECT_DENY,
+		Expression: "user.department ==",
+	}})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "invalid policy")
+}
+
+func TestPolicies_RequireAdmin(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	policy := &ssov1.Policy{
+		AppId:      appId,
+		Name:       gofakeit.BeerName(),
+		Effect:     ssov1.Effect_EFFECT_ALLOW,
+		Expression: "true",
+	}
+
+	_, err := st.AuthzClient.CreatePolicy(ctx, &ssov1.CreatePolicyRequest{Policy: policy})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	user := withToken(ctx, registerAndLogin(t, ctx, st))
+
+	_, err = st.AuthzClient.CreatePolicy(user, &ssov1.CreatePolicyRequest{Policy: policy})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthzClient.ListPolicies(user, &ssov1.ListPoliciesRequest{AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthzClient.DeletePolicy(user, &ssov1.DeletePolicyRequest{AppId: appId, PolicyId: 1})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogin_ScopesRequireConsent(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	respApp, err := st.AuthClient.CreateApp(withToken(ctx, loginAdmin(t, ctx, st)), &ssov1.CreateAppRequest{
+		Name:   gofakeit.BeerName(),
+		Scopes: []string{"profile", "email"},
+	})
+	require.NoError(t, err)
+	secret := respApp.GetSecret()
+
+	email := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	login := &ssov1.LoginRequest{Email: email, Password: password, AppId: respApp.GetAppId(), Scopes: []string{"profile"}}
+
+	_, err = st.AuthClient.Login(ctx, login)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "Consent required")
+
+	login.Consent = true
+	respLogin, err := st.AuthClient.Login(ctx, login)
+	require.NoError(t, err)
+
+	tokenParsed, err := jwt.Parse(respLogin.GetToken(), func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "profile", tokenParsed.Claims.(jwt.MapClaims)["scope"])
+
+	// the consents are only the user's to see and revoke
+	other := withToken(ctx, registerAndLogin(t, ctx, st))
+	_, err = st.AuthClient.ListConsents(other, &ssov1.ListConsentsRequest{UserId: respReg.GetUserId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = st.AuthClient.RevokeConsent(other, &ssov1.RevokeConsentRequest{
+		UserId: respReg.GetUserId(),
+		AppId:  respApp.GetAppId(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	respSSO, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: ssoAppId})
+	require.NoError(t, err)
+	user := withToken(ctx, respSSO.GetToken())
+
+	respConsents, err := st.AuthClient.ListConsents(user, &ssov1.ListConsentsRequest{})
+	require.NoError(t, err)
+	require.Len(t, respConsents.GetConsents(), 1)
+	assert.Equal(t, []string{"profile"}, respConsents.GetConsents()[0].GetScopes())
+
+	_, err = st.AuthClient.RevokeConsent(user, &ssov1.RevokeConsentRequest{AppId: respApp.GetAppId()})
+	require.NoError(t, err)
+
+	login.Consent = false
+	_, err = st.AuthClient.Login(ctx, login)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "Consent required")
+
+	login.Scopes = []string{"admin"}
+	_, err = st.AuthClient.Login(ctx, login)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "Invalid scope")
+}
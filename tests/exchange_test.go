@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"context"
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// exchangeScope is declared by the test app for the exchanges.
+const exchangeScope = "orders.read"
+
+func TestTokenExchange_HappyPath(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	caller := exchangeCaller(t, ctx, st)
+
+	subjectToken := registerAndLoginWithScopes(t, ctx, st, appId, exchangeScope)
+	actorToken := registerAndLoginTo(t, ctx, st, appId)
+
+	respSubject, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: subjectToken})
+	require.NoError(t, err)
+	respActor, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: actorToken})
+	require.NoError(t, err)
+
+	respExchange, err := st.AuthClient.TokenExchange(caller, &ssov1.TokenExchangeRequest{
+		SubjectToken: subjectToken,
+		ActorToken:   actorToken,
+		AppId:        appId,
+		Scopes:       []string{exchangeScope},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, respExchange.GetAccessToken())
+	assert.Equal(t, "Bearer", respExchange.GetTokenType())
+	assert.Equal(t, "urn:ietf:params:oauth:token-type:access_token", respExchange.GetIssuedTokenType())
+	assert.Equal(t, []string{exchangeScope}, respExchange.GetScopes())
+
+	respIntro, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respExchange.GetAccessToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntro.GetActive())
+	assert.Equal(t, respSubject.GetUserId(), respIntro.GetUserId())
+	assert.Equal(t, int64(appId), respIntro.GetAppId())
+	require.NotNil(t, respIntro.GetAct())
+	assert.Equal(t, respActor.GetUserId(), respIntro.GetAct().GetUserId())
+	assert.Nil(t, respIntro.GetAct().GetAct())
+	assert.False(t, respIntro.GetExpiresAt().AsTime().After(respSubject.GetExpiresAt().AsTime()))
+
+	// exchanging again nests the first actor
+	respExchange, err = st.AuthClient.TokenExchange(caller, &ssov1.TokenExchangeRequest{
+		SubjectToken: respExchange.GetAccessToken(),
+		ActorToken:   subjectToken,
+		AppId:        appId,
+		Scopes:       []string{exchangeScope},
+	})
+	require.NoError(t, err)
+
+	respIntro, err = st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respExchange.GetAccessToken()})
+	require.NoError(t, err)
+	require.NotNil(t, respIntro.GetAct())
+	assert.Equal(t, respSubject.GetUserId(), respIntro.GetAct().GetUserId())
+	require.NotNil(t, respIntro.GetAct().GetAct())
+	assert.Equal(t, respActor.GetUserId(), respIntro.GetAct().GetAct().GetUserId())
+}
+
+func TestTokenExchange_InvalidRequest(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	caller := exchangeCaller(t, ctx, st)
+	token := registerAndLoginTo(t, ctx, st, appId)
+
+	_, err := st.AuthClient.TokenExchange(caller, &ssov1.TokenExchangeRequest{
+		SubjectToken: "not-a-token",
+		AppId:        appId,
+		Scopes:       []string{exchangeScope},
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "Invalid subject token")
+
+	_, err = st.AuthClient.TokenExchange(caller, &ssov1.TokenExchangeRequest{
+		SubjectToken: token,
+		ActorToken:   "not-a-token",
+		AppId:        appId,
+		Scopes:       []string{exchangeScope},
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "Invalid actor token")
+
+	_, err = st.AuthClient.TokenExchange(caller, &ssov1.TokenExchangeRequest{
+		SubjectToken:     token,
+		SubjectTokenType: "urn:ietf:params:oauth:token-type:saml2",
+		AppId:            appId,
+		Scopes:           []string{exchangeScope},
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "Unsupported token type")
+
+	_, err = st.AuthClient.TokenExchange(caller, &ssov1.TokenExchangeRequest{SubjectToken: token, AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the login token has no scopes to pass on
+	_, err = st.AuthClient.TokenExchange(caller, &ssov1.TokenExchangeRequest{
+		SubjectToken: token,
+		AppId:        appId,
+		Scopes:       []string{exchangeScope},
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "Invalid scope")
+}
+
+func TestTokenExchange_RequiresClientOfSourceApp(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	exchangeCaller(t, ctx, st)
+	token := registerAndLoginWithScopes(t, ctx, st, appId, exchangeScope)
+	req := &ssov1.TokenExchangeRequest{SubjectToken: token, AppId: appId, Scopes: []string{exchangeScope}}
+
+	_, err := st.AuthClient.TokenExchange(ctx, req)
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the subject token proves nothing about the caller
+	_, err = st.AuthClient.TokenExchange(withToken(ctx, token), req)
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	admin := withToken(ctx, loginAdmin(t, ctx, st))
+	respApp, err := st.AuthClient.CreateApp(admin, &ssov1.CreateAppRequest{Name: gofakeit.BeerName()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.TokenExchange(withToken(ctx, serviceAccountToken(t, ctx, st, admin, respApp.GetAppId())), req)
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestTokenExchange_NoTrustRule(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	caller := exchangeCaller(t, ctx, st)
+	token := registerAndLoginWithScopes(t, ctx, st, appId, exchangeScope)
+
+	_, err := st.AuthClient.TokenExchange(caller, &ssov1.TokenExchangeRequest{
+		SubjectToken: token,
+		AppId:        appId + 1000000,
+		Scopes:       []string{exchangeScope},
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// exchangeCaller declares exchangeScope for the test app and returns a
+// context with a token of a service account of the app.
+func exchangeCaller(t *testing.T, ctx context.Context, st *suite.Suite) context.Context {
+	t.Helper()
+
+	admin := withToken(ctx, loginAdmin(t, ctx, st))
+
+	_, err := st.AuthClient.UpdateApp(admin, &ssov1.UpdateAppRequest{
+		AppId:  appId,
+		Scopes: &ssov1.AppScopes{Scopes: []string{exchangeScope}},
+	})
+	require.NoError(t, err)
+
+	return withToken(ctx, serviceAccountToken(t, ctx, st, admin, appId))
+}
+
+// registerAndLoginWithScopes registers a user and logs in to the app with
+// the scopes granted.
+func registerAndLoginWithScopes(t *testing.T, ctx context.Context, st *suite.Suite, appID int64,
+	scopes ...string) string {
+	t.Helper()
+
+	email := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    email,
+		Password: password,
+		AppId:    appID,
+		Scopes:   scopes,
+		Consent:  true,
+	})
+	require.NoError(t, err)
+
+	return respLogin.GetToken()
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const mockProvider = "mock"
+
+func TestListIdentityProviders(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	resp, err := st.AuthClient.ListIdentityProviders(ctx, &ssov1.ListIdentityProvidersRequest{OrgId: 1})
+	require.NoError(t, err)
+	require.Len(t, resp.GetProviders(), 1)
+	assert.Equal(t, mockProvider, resp.GetProviders()[0].GetId())
+
+	resp, err = st.AuthClient.ListIdentityProviders(ctx, &ssov1.ListIdentityProvidersRequest{OrgId: 2})
+	require.NoError(t, err)
+	assert.Empty(t, resp.GetProviders())
+}
+
+func TestFederatedLogin_ProvisionsAndLinks(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	idp := st.OIDC()
+
+	subject := gofakeit.UUID()
+	email := gofakeit.Username() + "@mock.test"
+
+	start, err := st.AuthClient.StartFederatedLogin(ctx, &ssov1.StartFederatedLoginRequest{
+		ProviderId: mockProvider,
+		AppId:      appId,
+	})
+	require.NoError(t, err)
+
+	state, code := idp.Authorize(t, start.GetAuthorizationUrl(), subject, email)
+
+	resp, err := st.AuthClient.CompleteFederatedLogin(ctx, &ssov1.CompleteFederatedLoginRequest{State: state, Code: code})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.GetToken())
+
+	introspect, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: resp.GetToken()})
+	require.NoError(t, err)
+	require.True(t, introspect.GetActive())
+	assert.Equal(t, email, introspect.GetEmail())
+	assert.Equal(t, []string{"fed"}, introspect.GetAmr())
+	userID := introspect.GetUserId()
+
+	// the state is single use
+	_, err = st.AuthClient.CompleteFederatedLogin(ctx, &ssov1.CompleteFederatedLoginRequest{State: state, Code: code})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the second login finds the linked user, even with a changed email
+	start, err = st.AuthClient.StartFederatedLogin(ctx, &ssov1.StartFederatedLoginRequest{
+		ProviderId: mockProvider,
+		AppId:      ssoAppId,
+	})
+	require.NoError(t, err)
+
+	state, code = idp.Authorize(t, start.GetAuthorizationUrl(), subject, "renamed."+email)
+
+	resp, err = st.AuthClient.CompleteFederatedLogin(ctx, &ssov1.CompleteFederatedLoginRequest{State: state, Code: code})
+	require.NoError(t, err)
+
+	identities, err := st.AuthClient.ListIdentities(withToken(ctx, resp.GetToken()), &ssov1.ListIdentitiesRequest{})
+	require.NoError(t, err)
+	require.Len(t, identities.GetIdentities(), 1)
+	assert.Equal(t, mockProvider, identities.GetIdentities()[0].GetProvider())
+	assert.Equal(t, subject, identities.GetIdentities()[0].GetSubject())
+	assert.Equal(t, userID, identities.GetIdentities()[0].GetUserId())
+
+	// the provisioned user has no password to log in with
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: "!", AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestFederatedLogin_EmailDomainNotAllowed(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	idp := st.OIDC()
+
+	start, err := st.AuthClient.StartFederatedLogin(ctx, &ssov1.StartFederatedLoginRequest{
+		ProviderId: mockProvider,
+		AppId:      appId,
+	})
+	require.NoError(t, err)
+
+	state, code := idp.Authorize(t, start.GetAuthorizationUrl(), gofakeit.UUID(), gofakeit.Username()+"@other.test")
+
+	_, err = st.AuthClient.CompleteFederatedLogin(ctx, &ssov1.CompleteFederatedLoginRequest{State: state, Code: code})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestFederatedLogin_InvalidRequests(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+	st.OIDC()
+
+	_, err := st.AuthClient.StartFederatedLogin(ctx, &ssov1.StartFederatedLoginRequest{
+		ProviderId: "unknown",
+		AppId:      appId,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = st.AuthClient.CompleteFederatedLogin(ctx, &ssov1.CompleteFederatedLoginRequest{
+		State: "not-a-state",
+		Code:  "not-a-code",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// a code the provider never issued
+	start, err := st.AuthClient.StartFederatedLogin(ctx, &ssov1.StartFederatedLoginRequest{
+		ProviderId: mockProvider,
+		AppId:      appId,
+	})
+	require.NoError(t, err)
+
+	state, _ := st.OIDC().Authorize(t, start.GetAuthorizationUrl(), gofakeit.UUID(), gofakeit.Email())
+
+	_, err = st.AuthClient.CompleteFederatedLogin(ctx, &ssov1.CompleteFederatedLoginRequest{State: state, Code: "forged"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
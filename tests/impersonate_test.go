@@ -0,0 +1,102 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestImpersonate_RequiresToken(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthClient.Impersonate(ctx, &ssov1.ImpersonateRequest{UserId: 1, AppId: appId, Reason: "support"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestImpersonate_RequiresReason(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err := st.AuthClient.Impersonate(withToken(ctx, token), &ssov1.ImpersonateRequest{UserId: 1, AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestImpersonate_NonAdminDenied(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err := st.AuthClient.Impersonate(withToken(ctx, token), &ssov1.ImpersonateRequest{
+		UserId: 1,
+		AppId:  appId,
+		Reason: "support ticket",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestEndImpersonation_NotImpersonating(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err := st.AuthClient.EndImpersonation(withToken(ctx, token), &ssov1.EndImpersonationRequest{Reason: "done"})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestSetPermission_NonAdminDenied(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err := st.AdminClient.SetPermission(withToken(ctx, token), &ssov1.SetPermissionRequest{
+		UserId:     1,
+		Permission: "impersonate",
+		Granted:    true,
+		Reason:     "support team",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestImpersonate_NonAdminCantLiftDenyPolicy(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	admin := withToken(ctx, loginAdmin(t, ctx, st))
+
+	respApp, err := st.AuthClient.CreateApp(admin, &ssov1.CreateAppRequest{Name: gofakeit.BeerName()})
+	require.NoError(t, err)
+
+	respPolicy, err := st.AuthzClient.CreatePolicy(admin, &ssov1.CreatePolicyRequest{Policy: &ssov1.Policy{
+		AppId:      respApp.GetAppId(),
+		Name:       "no-impersonation",
+		Effect:     ssov1.Effect_EFFECT_DENY,
+		Actions:    []string{"sso:impersonate"},
+		Expression: "true",
+	}})
+	require.NoError(t, err)
+
+	user := withToken(ctx, registerAndLogin(t, ctx, st))
+
+	_, err = st.AuthzClient.DeletePolicy(user, &ssov1.DeletePolicyRequest{
+		AppId:    respApp.GetAppId(),
+		PolicyId: respPolicy.GetPolicyId(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	respList, err := st.AuthzClient.ListPolicies(admin, &ssov1.ListPoliciesRequest{AppId: respApp.GetAppId()})
+	require.NoError(t, err)
+	require.Len(t, respList.GetPolicies(), 1)
+	assert.Equal(t, respPolicy.GetPolicyId(), respList.GetPolicies()[0].GetId())
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLoginTo(t, ctx, st, appId)
+
+	resp, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: token})
+	require.NoError(t, err)
+	assert.True(t, resp.GetActive())
+	assert.NotEmpty(t, resp.GetUserId())
+	assert.Equal(t, int64(appId), resp.GetAppId())
+
+	resp, err = st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: "not-a-token"})
+	require.NoError(t, err)
+	assert.False(t, resp.GetActive())
+}
+
+func TestAppToken_NotForSSO(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	// any app can sign its own tokens, the SSO only trusts its own
+	appToken := registerAndLoginTo(t, ctx, st, appId)
+
+	_, err := st.AuthClient.ListSessions(withToken(ctx, appToken), &ssov1.ListSessionsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ssoToken := registerAndLogin(t, ctx, st)
+
+	_, err = st.AuthClient.ListSessions(withToken(ctx, ssoToken), &ssov1.ListSessionsRequest{})
+	require.NoError(t, err)
+
+	resp, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: ssoToken})
+	require.NoError(t, err)
+	assert.False(t, resp.GetActive())
+}
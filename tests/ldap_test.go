@@ -0,0 +1,107 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/lib/totp"
+	suite "sso/tests/suit"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const devsGroup = "cn=devs,ou=groups,dc=mock,dc=test"
+
+func TestLDAPLogin_ShadowsUser(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	email := gofakeit.Username() + "@mock.test"
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+	st.LDAP().AddUser(email, password, devsGroup, "cn=unmapped,ou=groups,dc=mock,dc=test")
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: appId})
+	require.NoError(t, err)
+	require.NotEmpty(t, respLogin.GetToken())
+
+	respIntro, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	require.True(t, respIntro.GetActive())
+	assert.Equal(t, email, respIntro.GetEmail())
+	assert.Equal(t, []string{"developer"}, respIntro.GetRoles())
+	userID := respIntro.GetUserId()
+
+	respSSO, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: ssoAppId})
+	require.NoError(t, err)
+
+	identities, err := st.AuthClient.ListIdentities(withToken(ctx, respSSO.GetToken()), &ssov1.ListIdentitiesRequest{})
+	require.NoError(t, err)
+	require.Len(t, identities.GetIdentities(), 1)
+	assert.Equal(t, "ldap", identities.GetIdentities()[0].GetProvider())
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password + "x", AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// the shadow user keeps its id when the directory renames the user
+	renamed := "renamed." + email
+	st.LDAP().RenameUser(email, renamed)
+
+	respLogin, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: renamed, Password: password, AppId: appId})
+	require.NoError(t, err)
+
+	respIntro, err = st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, userID, respIntro.GetUserId())
+
+	// the step-up checks the password in the directory too
+	secret := enrollTOTP(t, ctx, st, respSSO.GetToken())
+	respStepUp, err := st.AuthClient.StepUp(withToken(ctx, respLogin.GetToken()), &ssov1.StepUpRequest{
+		Password: password, TotpCode: totp.Code(secret, totp.Step(time.Now())),
+	})
+	require.NoError(t, err)
+
+	respIntro, err = st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respStepUp.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, "2", respIntro.GetAcr())
+	assert.Equal(t, []string{"developer"}, respIntro.GetRoles())
+}
+
+func TestLDAPLogin_LocalUserComesFirst(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	email := gofakeit.Username() + "@mock.test"
+	localPassword := gofakeit.Password(true, true, true, true, false, passDefLen)
+	ldapPassword := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: localPassword})
+	require.NoError(t, err)
+	st.LDAP().AddUser(email, ldapPassword)
+
+	// the local backend knows the user, so it decides
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: ldapPassword, AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: localPassword, AppId: appId})
+	require.NoError(t, err)
+
+	respIntro, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Empty(t, respIntro.GetRoles())
+}
+
+func TestLDAPLogin_UnknownUser(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    gofakeit.Username() + "@mock.test",
+		Password: gofakeit.Password(true, true, true, true, false, passDefLen),
+		AppId:    appId,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
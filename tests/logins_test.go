@@ -0,0 +1,46 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGetLoginHistory(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	email := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password + "x", AppId: appId})
+	require.Error(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: appId})
+	require.NoError(t, err)
+	deviceID := respLogin.GetDeviceId()
+	require.NotEmpty(t, deviceID)
+
+	// a known device keeps its id
+	deviceCtx := metadata.AppendToOutgoingContext(ctx, "x-device-id", deviceID)
+	respLogin, err = st.AuthClient.Login(deviceCtx, &ssov1.LoginRequest{Email: email, Password: password, AppId: ssoAppId})
+	require.NoError(t, err)
+	assert.Equal(t, deviceID, respLogin.GetDeviceId())
+
+	respHistory, err := st.AuthClient.GetLoginHistory(withToken(ctx, respLogin.GetToken()), &ssov1.GetLoginHistoryRequest{})
+	require.NoError(t, err)
+
+	attempts := respHistory.GetAttempts()
+	require.Len(t, attempts, 3)
+	assert.True(t, attempts[0].GetSuccess())
+	assert.Equal(t, deviceID, attempts[0].GetDeviceId())
+	assert.False(t, attempts[2].GetSuccess())
+	assert.Equal(t, "invalid_password", attempts[2].GetReason())
+}
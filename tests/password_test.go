@@ -0,0 +1,84 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestChangePassword_HappyPath(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	email := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: appId})
+	require.NoError(t, err)
+	respOther, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: appId})
+	require.NoError(t, err)
+
+	newPassword := gofakeit.Password(true, true, true, true, false, passDefLen)
+	_, err = st.AuthClient.ChangePassword(withToken(ctx, respLogin.GetToken()), &ssov1.ChangePasswordRequest{
+		OldPassword: password,
+		NewPassword: newPassword,
+	})
+	require.NoError(t, err)
+
+	// the session of the change is kept, the other one is ended
+	respIntro, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntro.GetActive())
+	respIntro, err = st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respOther.GetToken()})
+	require.NoError(t, err)
+	assert.False(t, respIntro.GetActive())
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: appId})
+	require.Error(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: newPassword, AppId: appId})
+	require.NoError(t, err)
+}
+
+func TestResetPassword_InvalidToken(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: gofakeit.Email()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ResetPassword(ctx, &ssov1.ResetPasswordRequest{
+		Token:       "not-a-token",
+		NewPassword: gofakeit.Password(true, true, true, true, false, passDefLen),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestChangePassword_Reused(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	email := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: appId})
+	require.NoError(t, err)
+	assert.False(t, respLogin.GetPasswordChangeRequired())
+
+	_, err = st.AuthClient.ChangePassword(withToken(ctx, respLogin.GetToken()), &ssov1.ChangePasswordRequest{
+		OldPassword: password,
+		NewPassword: password,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
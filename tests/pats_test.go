@@ -0,0 +1,99 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPAT_HappyPath(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLogin(t, ctx, st)
+
+	respCreate, err := st.AuthClient.CreatePAT(withToken(ctx, token), &ssov1.CreatePATRequest{
+		Name:      "ci",
+		AppId:     appId,
+		ExpiresAt: timestamppb.New(time.Now().Add(24 * time.Hour)),
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(respCreate.GetToken(), "ssopat_"))
+	assert.True(t, strings.HasSuffix(respCreate.GetToken(), respCreate.GetPat().GetHint()))
+	assert.Equal(t, "ci", respCreate.GetPat().GetName())
+
+	pat := respCreate.GetToken()
+
+	// the token is a token of its app, not of the SSO
+	_, err = st.AuthClient.ListPATs(withToken(ctx, pat), &ssov1.ListPATsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	respList, err := st.AuthClient.ListPATs(withToken(ctx, token), &ssov1.ListPATsRequest{})
+	require.NoError(t, err)
+	require.Len(t, respList.GetPats(), 1)
+	assert.Equal(t, respCreate.GetPat().GetId(), respList.GetPats()[0].GetId())
+	assert.NotNil(t, respList.GetPats()[0].GetLastUsedAt())
+
+	respIntro, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: pat})
+	require.NoError(t, err)
+	assert.True(t, respIntro.GetActive())
+	assert.Equal(t, respCreate.GetPat().GetId(), respIntro.GetPatId())
+
+	// a token can't mint more tokens or reach the admin methods
+	_, err = st.AuthClient.CreatePAT(withToken(ctx, pat), &ssov1.CreatePATRequest{Name: "more", AppId: appId})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = st.AdminClient.ListUsers(withToken(ctx, pat), &ssov1.ListUsersRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = st.AuthClient.RevokePAT(withToken(ctx, token), &ssov1.RevokePATRequest{PatId: respCreate.GetPat().GetId()})
+	require.NoError(t, err)
+
+	respIntro, err = st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: pat})
+	require.NoError(t, err)
+	assert.False(t, respIntro.GetActive())
+
+	_, err = st.AuthzClient.Authorize(withToken(ctx, pat), &ssov1.AuthorizeRequest{AppId: appId, Action: "read"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestCreatePAT_InvalidExpiry(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err := st.AuthClient.CreatePAT(withToken(ctx, token), &ssov1.CreatePATRequest{
+		Name:      "ci",
+		AppId:     appId,
+		ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour)),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRevokePAT_OtherUser(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	owner := registerAndLogin(t, ctx, st)
+	other := registerAndLogin(t, ctx, st)
+
+	respCreate, err := st.AuthClient.CreatePAT(withToken(ctx, owner), &ssov1.CreatePATRequest{Name: "ci", AppId: appId})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RevokePAT(withToken(ctx, other), &ssov1.RevokePATRequest{
+		UserId: respCreate.GetPat().GetUserId(),
+		PatId:  respCreate.GetPat().GetId(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck_ViewerThroughGroupAndFolder(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	respApp, err := st.AuthClient.CreateApp(withToken(ctx, loginAdmin(t, ctx, st)), &ssov1.CreateAppRequest{Name: gofakeit.BeerName()})
+	require.NoError(t, err)
+	appID := respApp.GetAppId()
+
+	namespaces := []*ssov1.Namespace{
+		{Name: "group", Relations: []*ssov1.RelationConfig{{Name: "member"}}},
+		{Name: "folder", Relations: []*ssov1.RelationConfig{
+			{Name: "editor"},
+			{Name: "viewer", Union: []string{"editor"}},
+		}},
+		{Name: "doc", Relations: []*ssov1.RelationConfig{
+			{Name: "parent"},
+			{Name: "viewer", TupleToUserset: []*ssov1.TupleToUserset{{Tupleset: "parent", ComputedRelation: "viewer"}}},
+		}},
+	}
+	for _, ns := range namespaces {
+		_, err := st.RelClient.WriteNamespace(ctx, &ssov1.WriteNamespaceRequest{AppId: appID, Namespace: ns})
+		require.NoError(t, err)
+	}
+
+	respWrite, err := st.RelClient.WriteTuples(ctx, &ssov1.WriteTuplesRequest{AppId: appID, Tuples: []string{
+		"group:z#member@user:x",
+		"folder:w#editor@group:z#member",
+		"doc:y#parent@folder:w",
+	}})
+	require.NoError(t, err)
+	require.NotEmpty(t, respWrite.GetConsistencyToken())
+
+	respCheck, err := st.RelClient.Check(ctx, &ssov1.CheckRequest{
+		AppId: appID, Object: "doc:y", Relation: "viewer", Subject: "user:x",
+		ConsistencyToken: respWrite.GetConsistencyToken(),
+	})
+	require.NoError(t, err)
+	assert.True(t, respCheck.GetAllowed())
+
+	respCheck, err = st.RelClient.Check(ctx, &ssov1.CheckRequest{
+		AppId: appID, Object: "doc:y", Relation: "viewer", Subject: "user:other",
+	})
+	require.NoError(t, err)
+	assert.False(t, respCheck.GetAllowed())
+
+	respList, err := st.RelClient.ListObjects(ctx, &ssov1.ListObjectsRequest{
+		AppId: appID, ObjectType: "doc", Relation: "viewer", Subject: "user:x",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"doc:y"}, respList.GetObjects())
+}
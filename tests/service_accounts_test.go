@@ -0,0 +1,68 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestManageServiceAccounts_RequiresAdmin(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthClient.ListServiceAccounts(ctx, &ssov1.ListServiceAccountsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err = st.AuthClient.CreateServiceAccount(withToken(ctx, token), &ssov1.CreateServiceAccountRequest{
+		Name:  "ci",
+		AppId: appId,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.ListServiceAccounts(withToken(ctx, token), &ssov1.ListServiceAccountsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.AddServiceAccountKey(withToken(ctx, token), &ssov1.AddServiceAccountKeyRequest{
+		ServiceAccountId: 1,
+		PublicKey:        "not-a-key",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServiceAccountToken_InvalidCredentials(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	_, err := st.AuthClient.ServiceAccountToken(ctx, &ssov1.ServiceAccountTokenRequest{
+		ServiceAccountId: 1000000,
+		ClientSecret:     "ssosa_wrong",
+		AppId:            appId,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = st.AuthClient.ServiceAccountToken(ctx, &ssov1.ServiceAccountTokenRequest{
+		ClientAssertion:     "not-a-jwt",
+		ClientAssertionType: "urn:ietf:params:oauth:client-assertion-type:jwt-bearer",
+		AppId:               appId,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = st.AuthClient.ServiceAccountToken(ctx, &ssov1.ServiceAccountTokenRequest{
+		ClientAssertion:     "not-a-jwt",
+		ClientAssertionType: "urn:ietf:params:oauth:client-assertion-type:saml2-bearer",
+		AppId:               appId,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	ssov1 "sso/gen/go/sso"
+	suite "sso/tests/suit"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRevokeAllSessions_KeepCurrent(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	email := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	first, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: ssoAppId})
+	require.NoError(t, err)
+	second, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: ssoAppId})
+	require.NoError(t, err)
+
+	respList, err := st.AuthClient.ListSessions(withToken(ctx, second.GetToken()), &ssov1.ListSessionsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, respList.GetSessions(), 2)
+
+	respRevoke, err := st.AuthClient.RevokeAllSessions(withToken(ctx, second.GetToken()),
+		&ssov1.RevokeAllSessionsRequest{KeepCurrent: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), respRevoke.GetRevoked())
+
+	_, err = st.AuthClient.ListSessions(withToken(ctx, first.GetToken()), &ssov1.ListSessionsRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	respList, err = st.AuthClient.ListSessions(withToken(ctx, second.GetToken()), &ssov1.ListSessionsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, respList.GetSessions(), 1)
+}
+
+func TestRevokeSession_OtherUser(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+		Email:    gofakeit.Email(),
+		Password: gofakeit.Password(true, true, true, true, false, passDefLen),
+	})
+	require.NoError(t, err)
+
+	token := registerAndLogin(t, ctx, st)
+
+	_, err = st.AuthClient.RevokeSession(withToken(ctx, token), &ssov1.RevokeSessionRequest{
+		UserId:    respReg.GetUserId(),
+		SessionId: "unknown",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"context"
+	ssov1 "sso/gen/go/sso"
+	"sso/internal/lib/totp"
+	suite "sso/tests/suit"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStepUp_HappyPath(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	email := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, false, passDefLen)
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	require.NoError(t, err)
+
+	respSSO, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: ssoAppId})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: password, AppId: appId})
+	require.NoError(t, err)
+	assert.False(t, respLogin.GetStepUpRequired())
+
+	respIntro, err := st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, "1", respIntro.GetAcr())
+	assert.Equal(t, []string{"pwd"}, respIntro.GetAmr())
+	require.NotNil(t, respIntro.GetAuthTime())
+
+	// the password alone doesn't raise the acr
+	_, err = st.AuthClient.StepUp(withToken(ctx, respLogin.GetToken()), &ssov1.StepUpRequest{
+		Password: password, TotpCode: "000000",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	secret := enrollTOTP(t, ctx, st, respSSO.GetToken())
+	code := totp.Code(secret, totp.Step(time.Now()))
+
+	_, err = st.AuthClient.StepUp(withToken(ctx, respLogin.GetToken()), &ssov1.StepUpRequest{
+		Password: password + "x", TotpCode: code,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	respStepUp, err := st.AuthClient.StepUp(withToken(ctx, respLogin.GetToken()), &ssov1.StepUpRequest{
+		Password: password, TotpCode: code,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, respStepUp.GetToken())
+
+	respIntro, err = st.AuthClient.IntrospectToken(ctx, &ssov1.IntrospectTokenRequest{Token: respStepUp.GetToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntro.GetActive())
+	assert.Equal(t, "2", respIntro.GetAcr())
+	assert.Equal(t, []string{"pwd", "otp"}, respIntro.GetAmr())
+	assert.True(t, respIntro.GetExpiresAt().AsTime().Before(respStepUp.GetExpiresAt().AsTime().Add(time.Second)))
+
+	// a code is accepted once
+	_, err = st.AuthClient.StepUp(withToken(ctx, respLogin.GetToken()), &ssov1.StepUpRequest{
+		Password: password, TotpCode: code,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestEnrollTOTP_ConfirmedOnce(t *testing.T) {
+	ctx, st := suite.NewSuite(t)
+
+	token := registerAndLogin(t, ctx, st)
+
+	respEnroll, err := st.AuthClient.EnrollTOTP(withToken(ctx, token), &ssov1.EnrollTOTPRequest{})
+	require.NoError(t, err)
+	assert.Contains(t, respEnroll.GetUrl(), "otpauth://totp/")
+
+	_, err = st.AuthClient.ConfirmTOTP(withToken(ctx, token), &ssov1.ConfirmTOTPRequest{Code: "000000x"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	enrollTOTP(t, ctx, st, token)
+
+	_, err = st.AuthClient.EnrollTOTP(withToken(ctx, token), &ssov1.EnrollTOTPRequest{})
+	require.Error(t, err)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+// enrollTOTP enrolls an authenticator for the user of the SSO token and
+// returns its secret. The enrollment is confirmed with the code of the
+// previous step, the current one is left for the step-up.
+func enrollTOTP(t *testing.T, ctx context.Context, st *suite.Suite, token string) []byte {
+	t.Helper()
+
+	respEnroll, err := st.AuthClient.EnrollTOTP(withToken(ctx, token), &ssov1.EnrollTOTPRequest{})
+	require.NoError(t, err)
+
+	secret, err := totp.Decode(respEnroll.GetSecret())
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ConfirmTOTP(withToken(ctx, token), &ssov1.ConfirmTOTPRequest{
+		Code: totp.Code(secret, totp.Step(time.Now())-1),
+	})
+	require.NoError(t, err)
+
+	return secret
+}
@@ -0,0 +1,315 @@
+package suite
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"sso/internal/config"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP protocol operations and result codes the stub speaks (RFC 4511).
+const (
+	ldapBindRequest       = 0
+	ldapBindResponse      = 1
+	ldapUnbindRequest     = 2
+	ldapSearchRequest     = 3
+	ldapSearchEntry       = 4
+	ldapSearchDone        = 5
+	ldapExtendedRequest   = 23
+	ldapExtendedResponse  = 24
+	ldapFilterEquality    = 3
+	ldapStartTLSOID       = "1.3.6.1.4.1.1466.20037"
+	ldapSuccess           = 0
+	ldapProtocolError     = 2
+	ldapConfidentiality   = 13
+	ldapInsufficientRight = 50
+	ldapInvalidCredential = 49
+)
+
+// LDAPDirectory is an in-process LDAP server standing in for the directory
+// of the config. It knows the bind account of the config and the users the
+// tests add, binds are only accepted after StartTLS.
+type LDAPDirectory struct {
+	cfg  config.LDAPConfig
+	cert tls.Certificate
+
+	mu    sync.Mutex
+	users map[string]*ldapUser
+}
+
+type ldapUser struct {
+	dn       string
+	uid      string
+	email    string
+	password string
+	groups   []string
+}
+
+var (
+	ldapOnce      sync.Once
+	ldapDirectory *LDAPDirectory
+	ldapErr       error
+)
+
+// LDAP returns the stub directory. It is started by NewSuite, as the server
+// asks the directory about every email it doesn't know.
+func (s *Suite) LDAP() *LDAPDirectory {
+	return ldapDirectory
+}
+
+func startLDAPDirectory(cfg *config.Config) (*LDAPDirectory, error) {
+	addr, err := url.Parse(cfg.Auth.LDAP.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := selfSignedCert(addr.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	lis, err := net.Listen("tcp", addr.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &LDAPDirectory{cfg: cfg.Auth.LDAP, cert: cert, users: make(map[string]*ldapUser)}
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+
+	return d, nil
+}
+
+// AddUser adds a user to the directory and returns its entryUUID.
+func (d *LDAPDirectory) AddUser(email string, password string, groups ...string) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	uid := hex.EncodeToString(b)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.users[strings.ToLower(email)] = &ldapUser{
+		dn:       fmt.Sprintf("uid=%s,ou=people,%s", uid, d.cfg.BaseDN),
+		uid:      uid,
+		email:    email,
+		password: password,
+		groups:   groups,
+	}
+
+	return uid
+}
+
+// RenameUser changes the email of a user, its entryUUID stays.
+func (d *LDAPDirectory) RenameUser(email string, newEmail string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user := d.users[strings.ToLower(email)]
+	delete(d.users, strings.ToLower(email))
+	user.email = newEmail
+	d.users[strings.ToLower(newEmail)] = user
+}
+
+// serve answers the requests of a connection until it's closed.
+func (d *LDAPDirectory) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	var (
+		secure bool
+		bound  string
+	)
+
+	for {
+		_ = conn.SetDeadline(time.Now().Add(time.Minute))
+
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldapBindRequest:
+			if !secure {
+				d.respond(conn, id, ldapBindResponse, ldapConfidentiality, "StartTLS is required")
+				continue
+			}
+			name, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+
+			bound = ""
+			if d.checkPassword(name, password) {
+				bound = name
+				d.respond(conn, id, ldapBindResponse, ldapSuccess, "")
+			} else {
+				d.respond(conn, id, ldapBindResponse, ldapInvalidCredential, "invalid credentials")
+			}
+		case ldapSearchRequest:
+			if bound != d.cfg.BindDN {
+				d.respond(conn, id, ldapSearchDone, ldapInsufficientRight, "bind as the service account")
+				continue
+			}
+			if user, ok := d.search(op.Children[6]); ok {
+				d.writeEntry(conn, id, user)
+			}
+			d.respond(conn, id, ldapSearchDone, ldapSuccess, "")
+		case ldapExtendedRequest:
+			if secure || len(op.Children) == 0 || op.Children[0].Data.String() != ldapStartTLSOID {
+				d.respond(conn, id, ldapExtendedResponse, ldapProtocolError, "unsupported operation")
+				continue
+			}
+			d.respond(conn, id, ldapExtendedResponse, ldapSuccess, "")
+
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{d.cert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+		case ldapUnbindRequest:
+			return
+		default:
+			d.respond(conn, id, ldapExtendedResponse, ldapProtocolError, "unsupported operation")
+		}
+	}
+}
+
+func (d *LDAPDirectory) checkPassword(dn string, password string) bool {
+	if password == "" {
+		return false
+	}
+	if dn == d.cfg.BindDN {
+		return password == d.cfg.BindPassword
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, user := range d.users {
+		if user.dn == dn {
+			return user.password == password
+		}
+	}
+
+	return false
+}
+
+// search finds the user of the mail equality in the filter, the other parts
+// of the filter are ignored.
+func (d *LDAPDirectory) search(filter *ber.Packet) (ldapUser, bool) {
+	if filter.ClassType == ber.ClassContext && filter.Tag == ldapFilterEquality && len(filter.Children) == 2 {
+		attribute, _ := filter.Children[0].Value.(string)
+		if !strings.EqualFold(attribute, d.cfg.EmailAttribute) {
+			return ldapUser{}, false
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		user, ok := d.users[strings.ToLower(filter.Children[1].Data.String())]
+		if !ok {
+			return ldapUser{}, false
+		}
+
+		return *user, true
+	}
+
+	for _, child := range filter.Children {
+		if user, ok := d.search(child); ok {
+			return user, true
+		}
+	}
+
+	return ldapUser{}, false
+}
+
+func (d *LDAPDirectory) writeEntry(conn net.Conn, id any, user ldapUser) {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, user.dn, "Object Name"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range map[string][]string{
+		d.cfg.UIDAttribute:   {user.uid},
+		d.cfg.EmailAttribute: {user.email},
+		d.cfg.GroupAttribute: user.groups,
+	} {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	entry.AppendChild(attributes)
+
+	d.write(conn, id, entry)
+}
+
+func (d *LDAPDirectory) respond(conn net.Conn, id any, op ber.Tag, code int64, message string) {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "Response")
+	res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+
+	d.write(conn, id, res)
+}
+
+func (d *LDAPDirectory) write(conn net.Conn, id any, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	packet.AppendChild(op)
+
+	_, _ = conn.Write(packet.Bytes())
+}
+
+func selfSignedCert(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
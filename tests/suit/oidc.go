@@ -0,0 +1,203 @@
+package suite
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"sso/internal/config"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mockProviderID = "mock"
+
+// OIDCProvider is an in-process OpenID Connect provider standing in for the
+// "mock" provider of the config. It issues a code for any user the test
+// names, the SSO server redeems it like at a real provider.
+type OIDCProvider struct {
+	cfg config.FederatedProviderConfig
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant is what the provider remembers of an authorization.
+type mockGrant struct {
+	subject       string
+	email         string
+	nonce         string
+	codeChallenge string
+}
+
+var (
+	oidcOnce     sync.Once
+	oidcProvider *OIDCProvider
+	oidcErr      error
+)
+
+// OIDC returns the mock provider, started on the first call at the issuer
+// address of the config. The tests of a run share it.
+func (s *Suite) OIDC() *OIDCProvider {
+	s.Helper()
+
+	oidcOnce.Do(func() {
+		oidcProvider, oidcErr = startOIDCProvider(s.Cfg)
+	})
+	if oidcErr != nil {
+		s.Fatalf("mock oidc provider: %s", oidcErr)
+	}
+
+	return oidcProvider
+}
+
+func startOIDCProvider(cfg *config.Config) (*OIDCProvider, error) {
+	var provider config.FederatedProviderConfig
+	for _, p := range cfg.Auth.Federation.Providers {
+		if p.ID == mockProviderID {
+			provider = p
+		}
+	}
+
+	issuer, err := url.Parse(provider.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &OIDCProvider{cfg: provider, key: key, codes: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/token", p.token)
+
+	lis, err := net.Listen("tcp", issuer.Host)
+	if err != nil {
+		return nil, err
+	}
+	go func() { _ = http.Serve(lis, mux) }()
+
+	return p, nil
+}
+
+// Authorize plays the user logging in at the provider with the subject and
+// email: it reads the authorization URL and returns the state and the code
+// the provider would redirect back with.
+func (p *OIDCProvider) Authorize(t *testing.T, authorizationURL string, subject string, email string) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatalf("authorization url: %s", err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != p.cfg.ClientID || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request: %s", authorizationURL)
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("code: %s", err)
+	}
+	code := hex.EncodeToString(b)
+
+	p.mu.Lock()
+	p.codes[code] = mockGrant{
+		subject:       subject,
+		email:         email,
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+
+	return q.Get("state"), code
+}
+
+func (p *OIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 p.cfg.Issuer,
+		"authorization_endpoint": p.cfg.Issuer + "/authorize",
+		"token_endpoint":         p.cfg.Issuer + "/token",
+		"jwks_uri":               p.cfg.Issuer + "/keys",
+	})
+}
+
+func (p *OIDCProvider) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *OIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != p.cfg.ClientID || r.PostForm.Get("client_secret") != p.cfg.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.cfg.Issuer,
+		"aud":            p.cfg.ClientID,
+		"sub":            grant.subject,
+		"email":          grant.email,
+		"email_verified": true,
+		"nonce":          grant.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = "mock"
+
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock",
+		"token_type":   "Bearer",
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -3,11 +3,11 @@ package suite
 import (
 	"context"
 	"net"
+	ssov1 "sso/gen/go/sso"
 	"sso/internal/config"
 	"strconv"
 	"testing"
 
-	ssov1 "github.com/maximka200/buffpr/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -17,18 +17,31 @@ const (
 )
 
 type Suite struct {
-	*testing.T // обьект для взаимодействия с тестами
-	Cfg        *config.Config
-	AuthClient ssov1.AuthClient
+	*testing.T  // обьект для взаимодействия с тестами
+	Cfg         *config.Config
+	AuthClient  ssov1.AuthClient
+	AuthzClient ssov1.AuthzClient
+	RelClient   ssov1.RelationsClient
+	AdminClient ssov1.AdminClient
+	AuditClient ssov1.AuditClient
 }
 
 func NewSuite(t *testing.T) (context.Context, *Suite) {
 	t.Helper()   // для пометки функции как вспомогательной
 	t.Parallel() // параллельные тесты
 
-	key := "../config/local.yaml"
+	key := "../config/test.yaml"
 	cfg := config.MustByLoad(key)
 
+	if cfg.Auth.LDAP.URL != "" {
+		ldapOnce.Do(func() {
+			ldapDirectory, ldapErr = startLDAPDirectory(cfg)
+		})
+		if ldapErr != nil {
+			t.Fatalf("ldap directory: %s", ldapErr)
+		}
+	}
+
 	// создаем контекст
 	ctx, cancelCtx := context.WithTimeout(context.Background(), cfg.GRPC.Timeout)
 
@@ -45,7 +58,15 @@ func NewSuite(t *testing.T) (context.Context, *Suite) {
 		t.Fatalf("grpc server connection error: %s", err)
 	}
 
-	return ctx, &Suite{T: t, Cfg: cfg, AuthClient: ssov1.NewAuthClient(cc)}
+	return ctx, &Suite{
+		T:           t,
+		Cfg:         cfg,
+		AuthClient:  ssov1.NewAuthClient(cc),
+		AuthzClient: ssov1.NewAuthzClient(cc),
+		RelClient:   ssov1.NewRelationsClient(cc),
+		AdminClient: ssov1.NewAdminClient(cc),
+		AuditClient: ssov1.NewAuditClient(cc),
+	}
 }
 
 func grpcAddress(cfg *config.Config) string {